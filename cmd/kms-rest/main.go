@@ -37,6 +37,9 @@ func main() {
 	logger := log.New("kms-rest")
 	server := startcmd.NewHTTPServer(logger)
 	rootCmd.AddCommand(startcmd.GetStartCmd(server))
+	rootCmd.AddCommand(startcmd.GetRotatePrimaryKeyCmd())
+	rootCmd.AddCommand(startcmd.GetMigrateCmd())
+	rootCmd.AddCommand(startcmd.GetMasterKeyCmd())
 
 	if err := rootCmd.Execute(); err != nil {
 		logger.Fatalf("Failed to run kms-rest: %s", err.Error())
@@ -0,0 +1,156 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package startcmd
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/aries-framework-go/pkg/storage"
+	"github.com/spf13/cobra"
+	cmdutils "github.com/trustbloc/edge-core/pkg/utils/cmd"
+
+	"github.com/trustbloc/hub-kms/pkg/storage/cache"
+	"github.com/trustbloc/hub-kms/pkg/storage/cache/encryptedcache"
+	"github.com/trustbloc/hub-kms/pkg/storage/cache/rediscache"
+)
+
+const (
+	cacheTypeMemOption   = "mem"
+	cacheTypeRedisOption = "redis"
+)
+
+type cacheParameters struct {
+	cacheType         string
+	url               string
+	prefix            string
+	encryptionKeyPath string
+	maxSize           int
+	evictionPolicy    string
+	negativeExp       time.Duration
+}
+
+func getCacheParameters(cmd *cobra.Command) (*cacheParameters, error) {
+	maxSize, err := getNonNegativeInt(cmd, cacheMaxSizeFlagName, cacheMaxSizeEnvKey)
+	if err != nil {
+		return nil, err
+	}
+
+	evictionPolicy := cmdutils.GetUserSetOptionalVarFromString(cmd, cacheEvictionPolicyFlagName,
+		cacheEvictionPolicyEnvKey)
+
+	switch {
+	case evictionPolicy == "":
+	case strings.EqualFold(evictionPolicy, cache.EvictionLRU),
+		strings.EqualFold(evictionPolicy, cache.EvictionLFU),
+		strings.EqualFold(evictionPolicy, cache.EvictionARC):
+		evictionPolicy = strings.ToLower(evictionPolicy)
+	default:
+		return nil, fmt.Errorf("invalid %s: %s", cacheEvictionPolicyFlagName, evictionPolicy)
+	}
+
+	negativeExp, err := getDuration(cmd, cacheNegativeExpirationFlagName, cacheNegativeExpirationEnvKey, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return &cacheParameters{
+		cacheType: cmdutils.GetUserSetOptionalVarFromString(cmd, cacheTypeFlagName, cacheTypeEnvKey),
+		url:       cmdutils.GetUserSetOptionalVarFromString(cmd, cacheURLFlagName, cacheURLEnvKey),
+		prefix:    cmdutils.GetUserSetOptionalVarFromString(cmd, cachePrefixFlagName, cachePrefixEnvKey),
+		encryptionKeyPath: cmdutils.GetUserSetOptionalVarFromString(cmd, cacheEncryptionKeyPathFlagName,
+			cacheEncryptionKeyPathEnvKey),
+		maxSize:        maxSize,
+		evictionPolicy: evictionPolicy,
+		negativeExp:    negativeExp,
+	}, nil
+}
+
+// prepareCacheProvider returns the cache provider of the given type. Cached values are sealed under an ephemeral
+// per-process key, unless the Redis cache is encrypted with the key shared by instances.
+func prepareCacheProvider(params *cacheParameters, exp time.Duration) (storage.Provider, error) {
+	switch {
+	case params.cacheType == "", strings.EqualFold(params.cacheType, cacheTypeMemOption):
+		return encryptedcache.NewProvider(prepareMemCacheProvider(params, exp))
+	case strings.EqualFold(params.cacheType, cacheTypeRedisOption):
+		p, err := prepareRedisCacheProvider(params, exp)
+		if err != nil {
+			return nil, err
+		}
+
+		if params.encryptionKeyPath != "" {
+			return p, nil
+		}
+
+		return encryptedcache.NewProvider(p)
+	default:
+		return nil, errors.New("cache not set to a valid type")
+	}
+}
+
+func prepareRedisCacheProvider(params *cacheParameters, exp time.Duration) (*rediscache.Provider, error) {
+	if params.url == "" {
+		return nil, fmt.Errorf("%s is required for redis cache", cacheURLFlagName)
+	}
+
+	opts := []rediscache.Option{
+		rediscache.WithExpiration(exp),
+		rediscache.WithPrefix(params.prefix),
+	}
+
+	if params.encryptionKeyPath != "" {
+		key, err := readCacheEncryptionKey(params.encryptionKeyPath)
+		if err != nil {
+			return nil, err
+		}
+
+		defer zeroize(key)
+
+		opts = append(opts, rediscache.WithEncryptionKey(key))
+	}
+
+	return rediscache.NewProvider(params.url, opts...)
+}
+
+func prepareMemCacheProvider(params *cacheParameters, exp time.Duration) *cache.Provider {
+	opts := []cache.Option{
+		cache.WithExpiration(exp),
+		cache.WithMaxSize(params.maxSize),
+		cache.WithNegativeExpiration(params.negativeExp),
+	}
+
+	if params.evictionPolicy != "" {
+		opts = append(opts, cache.WithEvictionPolicy(params.evictionPolicy))
+	}
+
+	return cache.NewProvider(opts...)
+}
+
+func readCacheEncryptionKey(path string) ([]byte, error) {
+	b, err := ioutil.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, fmt.Errorf("read cache encryption key: %w", err)
+	}
+
+	key, err := base64.URLEncoding.DecodeString(strings.TrimSpace(string(b)))
+	if err != nil {
+		return nil, fmt.Errorf("decode cache encryption key: %w", err)
+	}
+
+	return key, nil
+}
+
+func zeroize(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
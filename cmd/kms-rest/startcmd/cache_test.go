@@ -0,0 +1,201 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package startcmd
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/hub-kms/pkg/storage/cache"
+	"github.com/trustbloc/hub-kms/pkg/storage/cache/encryptedcache"
+	"github.com/trustbloc/hub-kms/pkg/storage/cache/rediscache"
+)
+
+func TestStartCmdWithCacheParams(t *testing.T) {
+	startCmd := GetStartCmd(&mockServer{})
+
+	args := requiredArgs()
+	args = append(args,
+		"--"+cacheExpirationFlagName, "10m",
+		"--"+cacheTypeFlagName, cacheTypeRedisOption,
+		"--"+cacheURLFlagName, "redis://localhost:6379",
+		"--"+cachePrefixFlagName, "kms",
+		"--"+cacheEncryptionKeyPathFlagName, "/etc/kms/cache.key",
+		"--"+cacheMaxSizeFlagName, "1000",
+		"--"+cacheEvictionPolicyFlagName, "LFU",
+		"--"+cacheNegativeExpirationFlagName, "30s")
+
+	require.NoError(t, startCmd.ParseFlags(args))
+
+	params, err := getKmsRestParameters(startCmd)
+	require.NoError(t, err)
+	require.Equal(t, &cacheParameters{
+		cacheType:         cacheTypeRedisOption,
+		url:               "redis://localhost:6379",
+		prefix:            "kms",
+		encryptionKeyPath: "/etc/kms/cache.key",
+		maxSize:           1000,
+		evictionPolicy:    cache.EvictionLFU,
+		negativeExp:       30 * time.Second,
+	}, params.cacheParams)
+}
+
+func TestStartCmdWithInvalidCacheParams(t *testing.T) {
+	tests := []struct {
+		flag  string
+		value string
+	}{
+		{flag: cacheMaxSizeFlagName, value: "-1"},
+		{flag: cacheEvictionPolicyFlagName, value: "fifo"},
+		{flag: cacheNegativeExpirationFlagName, value: "never"},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run("Fail with invalid "+tc.flag+" "+tc.value, func(t *testing.T) {
+			startCmd := GetStartCmd(&mockServer{})
+
+			args := requiredArgs()
+			args = append(args, "--"+tc.flag, tc.value)
+
+			startCmd.SetArgs(args)
+
+			err := startCmd.Execute()
+			require.EqualError(t, err, fmt.Sprintf("invalid %s: %s", tc.flag, tc.value))
+		})
+	}
+}
+
+func TestPrepareCacheProvider(t *testing.T) {
+	t.Run("Encrypted in-memory cache by default", func(t *testing.T) {
+		p, err := prepareCacheProvider(&cacheParameters{}, time.Minute)
+		require.NoError(t, err)
+		require.IsType(t, &encryptedcache.Provider{}, p)
+	})
+
+	t.Run("Bounded in-memory cache with negative caching", func(t *testing.T) {
+		p, err := prepareCacheProvider(&cacheParameters{
+			cacheType:      cacheTypeMemOption,
+			maxSize:        1,
+			evictionPolicy: cache.EvictionARC,
+			negativeExp:    time.Minute,
+		}, time.Minute)
+		require.NoError(t, err)
+
+		s, err := p.OpenStore("store")
+		require.NoError(t, err)
+		require.NoError(t, s.Put("key1", []byte("value")))
+		require.NoError(t, s.Put("key2", []byte("value")))
+		require.NoError(t, s.(cache.NegativeCache).PutNotFound("key3"))
+
+		_, err = s.Get("key3")
+		require.True(t, errors.Is(err, cache.ErrCachedNotFound))
+		require.Equal(t, uint64(2), p.(*encryptedcache.Provider).Stats()["store"].Evictions)
+	})
+
+	t.Run("Redis cache with encryption", func(t *testing.T) {
+		srv := miniredis.RunT(t)
+
+		keyPath := filepath.Join(t.TempDir(), "cache.key")
+		key := base64.URLEncoding.EncodeToString(make([]byte, 32))
+		require.NoError(t, ioutil.WriteFile(keyPath, []byte(key+"\n"), 0600))
+
+		p, err := prepareCacheProvider(&cacheParameters{
+			cacheType:         cacheTypeRedisOption,
+			url:               "redis://" + srv.Addr(),
+			prefix:            "kms",
+			encryptionKeyPath: keyPath,
+		}, time.Minute)
+		require.NoError(t, err)
+		require.IsType(t, &rediscache.Provider{}, p)
+
+		s, err := p.OpenStore("store")
+		require.NoError(t, err)
+		require.NoError(t, s.Put("key", []byte("value")))
+		require.Equal(t, time.Minute, srv.TTL("kms:store:key"))
+
+		raw, err := srv.Get("kms:store:key")
+		require.NoError(t, err)
+		require.NotEqual(t, "value", raw)
+	})
+
+	t.Run("Cache is enabled with expiration", func(t *testing.T) {
+		srv := miniredis.RunT(t)
+
+		params := kmsRestParams(t)
+		params.cacheExpiration = "10m"
+		params.cacheParams = &cacheParameters{cacheType: cacheTypeRedisOption, url: "redis://" + srv.Addr()}
+
+		_, kmsConfig, err := prepareOperationConfig(params)
+		require.NoError(t, err)
+		require.IsType(t, &encryptedcache.Provider{}, kmsConfig.CacheProvider)
+
+		s, err := kmsConfig.CacheProvider.OpenStore("store")
+		require.NoError(t, err)
+		require.NoError(t, s.Put("key", []byte("value")))
+
+		raw, err := srv.Get("hub-kms:store:key")
+		require.NoError(t, err)
+		require.NotContains(t, raw, "value", "sealed under ephemeral key")
+	})
+
+	tests := []struct {
+		name   string
+		params *cacheParameters
+		errMsg string
+	}{
+		{
+			name:   "invalid type",
+			params: &cacheParameters{cacheType: "memcached"},
+			errMsg: "cache not set to a valid type",
+		},
+		{
+			name:   "missing URL",
+			params: &cacheParameters{cacheType: cacheTypeRedisOption},
+			errMsg: "cache-url is required for redis cache",
+		},
+		{
+			name: "missing key file",
+			params: &cacheParameters{
+				cacheType:         cacheTypeRedisOption,
+				url:               "redis://localhost:6379",
+				encryptionKeyPath: "/not/exists",
+			},
+			errMsg: "read cache encryption key",
+		},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run("Fail with "+tc.name, func(t *testing.T) {
+			_, err := prepareCacheProvider(tc.params, time.Minute)
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tc.errMsg)
+		})
+	}
+
+	t.Run("Fail with invalid key file", func(t *testing.T) {
+		keyPath := filepath.Join(t.TempDir(), "cache.key")
+		require.NoError(t, ioutil.WriteFile(keyPath, []byte("not base64!"), 0600))
+
+		_, err := prepareCacheProvider(&cacheParameters{
+			cacheType:         cacheTypeRedisOption,
+			url:               "redis://localhost:6379",
+			encryptionKeyPath: keyPath,
+		}, time.Minute)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "decode cache encryption key")
+	})
+}
@@ -0,0 +1,109 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package startcmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	cmdutils "github.com/trustbloc/edge-core/pkg/utils/cmd"
+)
+
+type keystoreTypeParameters struct {
+	edvURL                string
+	keyManagerStorageType string
+	storageTypes          []string
+	secretLockTypes       []string
+	// targetStorageParams are parameters of the storage keysets are migrated to, nil if not set.
+	targetStorageParams *storageParameters
+}
+
+// getKeystoreTypeParameters returns storage and secret lock types keystores can be created with. Keystores are stored
+// in the key manager storage by default, or in EDV if it is the key manager storage.
+func getKeystoreTypeParameters(cmd *cobra.Command, keyManagerStorageParams *storageParameters) (
+	*keystoreTypeParameters, error) {
+	edvURL, err := cmdutils.GetUserSetVarFromString(cmd, keyManagerEDVURLFlagName, keyManagerEDVURLEnvKey, true)
+	if err != nil {
+		return nil, err
+	}
+
+	params := &keystoreTypeParameters{
+		edvURL: edvURL,
+		storageTypes: cmdutils.GetUserSetOptionalVarFromArrayString(cmd, keystoreStorageTypesFlagName,
+			keystoreStorageTypesEnvKey),
+		secretLockTypes: cmdutils.GetUserSetOptionalVarFromArrayString(cmd, keystoreSecretLockTypesFlagName,
+			keystoreSecretLockTypesEnvKey),
+	}
+
+	if keyManagerStorageParams.storageType != storageTypeEDVOption {
+		params.keyManagerStorageType = keyManagerStorageParams.storageType
+
+		if len(params.storageTypes) == 0 {
+			params.storageTypes = []string{params.keyManagerStorageType}
+		}
+	}
+
+	params.targetStorageParams, err = getKeyManagerTargetStorageParameters(cmd, params.keyManagerStorageType, edvURL)
+	if err != nil {
+		return nil, err
+	}
+
+	return params, nil
+}
+
+// getKeyManagerTargetStorageParameters returns parameters of the storage keysets are migrated to from the key manager
+// storage. Keysets are migrated to EDV vaults of keystores on the EDV server for keystores created with the edv storage
+// type.
+func getKeyManagerTargetStorageParameters(cmd *cobra.Command, keyManagerStorageType, edvURL string) (
+	*storageParameters, error) {
+	storageType, err := cmdutils.GetUserSetVarFromString(cmd, keyManagerTargetStorageTypeFlagName,
+		keyManagerTargetStorageTypeEnvKey, true)
+	if err != nil || storageType == "" {
+		return nil, err
+	}
+
+	switch {
+	case keyManagerStorageType == "":
+		return nil, fmt.Errorf("%s requires key manager storage other than %s", keyManagerTargetStorageTypeFlagName,
+			storageTypeEDVOption)
+	case strings.EqualFold(storageType, storageTypeEDVOption):
+		if edvURL == "" {
+			return nil, fmt.Errorf("%s %s requires %s", keyManagerTargetStorageTypeFlagName, storageTypeEDVOption,
+				keyManagerEDVURLFlagName)
+		}
+
+		return &storageParameters{storageType: storageTypeEDVOption}, nil
+	case strings.EqualFold(storageType, keyManagerStorageType):
+		return nil, fmt.Errorf("%s must differ from the key manager storage type",
+			keyManagerTargetStorageTypeFlagName)
+	}
+
+	storageURL, err := cmdutils.GetUserSetVarFromString(cmd, keyManagerTargetStorageURLFlagName,
+		keyManagerTargetStorageURLEnvKey, true)
+	if err != nil {
+		return nil, err
+	}
+
+	storagePrefix, err := cmdutils.GetUserSetVarFromString(cmd, keyManagerTargetStoragePrefixFlagName,
+		keyManagerTargetStoragePrefixEnvKey, true)
+	if err != nil {
+		return nil, err
+	}
+
+	sqlPool, err := getSQLPoolParameters(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	return &storageParameters{
+		storageType:   storageType,
+		storageURL:    storageURL,
+		storagePrefix: storagePrefix,
+		sqlPool:       sqlPool,
+	}, nil
+}
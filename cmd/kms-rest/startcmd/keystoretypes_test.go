@@ -0,0 +1,193 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package startcmd
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+	"github.com/trustbloc/edge-core/pkg/log/mocklogger"
+
+	"github.com/trustbloc/hub-kms/pkg/kms"
+)
+
+func TestStartCmdWithKeystoreTypeParams(t *testing.T) {
+	t.Run("Defaults to the key manager storage", func(t *testing.T) {
+		params := kmsRestParams(t)
+
+		require.Equal(t, &keystoreTypeParameters{
+			keyManagerStorageType: storageTypeMemOption,
+			storageTypes:          []string{storageTypeMemOption},
+			secretLockTypes:       []string{},
+		}, params.keystoreTypeParams)
+	})
+
+	t.Run("Defaults to EDV key manager storage", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := requiredArgs()
+		args = append(args,
+			"--"+keyManagerStorageTypeFlagName, storageTypeEDVOption,
+			"--"+keyManagerStorageURLFlagName, "https://edv.example.com")
+
+		require.NoError(t, startCmd.ParseFlags(args))
+
+		params, err := getKmsRestParameters(startCmd)
+		require.NoError(t, err)
+		require.Equal(t, &keystoreTypeParameters{
+			storageTypes:    []string{},
+			secretLockTypes: []string{},
+		}, params.keystoreTypeParams)
+	})
+
+	t.Run("Mixed storage and secret lock types", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := requiredArgs()
+		args = append(args,
+			"--"+keyManagerEDVURLFlagName, "https://edv.example.com",
+			"--"+keystoreStorageTypesFlagName, storageTypeMemOption,
+			"--"+keystoreStorageTypesFlagName, kms.StorageTypeEDV,
+			"--"+keystoreSecretLockTypesFlagName, kms.SecretLockTypePrimary,
+			"--"+hubAuthURLFlagName, "https://hub-auth.example.com")
+
+		require.NoError(t, startCmd.ParseFlags(args))
+
+		params, err := getKmsRestParameters(startCmd)
+		require.NoError(t, err)
+		require.Equal(t, &keystoreTypeParameters{
+			edvURL:                "https://edv.example.com",
+			keyManagerStorageType: storageTypeMemOption,
+			storageTypes:          []string{storageTypeMemOption, kms.StorageTypeEDV},
+			secretLockTypes:       []string{kms.SecretLockTypePrimary},
+		}, params.keystoreTypeParams)
+
+		_, kmsConfig, err := prepareOperationConfig(params)
+		require.NoError(t, err)
+		require.Equal(t, "https://edv.example.com", kmsConfig.EDVServerURL)
+		require.NotNil(t, kmsConfig.DIDKeyCreator)
+		require.NotNil(t, kmsConfig.KeyManagerStorageProvider)
+		require.Equal(t, storageTypeMemOption, kmsConfig.KeyManagerStorageType)
+		require.Equal(t, []string{storageTypeMemOption, kms.StorageTypeEDV}, kmsConfig.StorageTypes)
+		require.Equal(t, []string{kms.SecretLockTypePrimary}, kmsConfig.SecretLockTypes)
+
+		_, err = kms.NewService(kmsConfig)
+		require.NoError(t, err)
+	})
+}
+
+func TestStartCmdWithKeyManagerTargetStorage(t *testing.T) {
+	t.Run("Enables keyset migration API", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := requiredArgs()
+		args = append(args,
+			"--"+keyManagerTargetStorageTypeFlagName, storageTypeBoltOption,
+			"--"+keyManagerTargetStorageURLFlagName, t.TempDir(),
+			"--"+keyManagerTargetStoragePrefixFlagName, "target",
+			"--"+keystoreStorageTypesFlagName, storageTypeBoltOption,
+			"--"+keystoreStorageTypesFlagName, storageTypeMemOption)
+
+		require.NoError(t, startCmd.ParseFlags(args))
+
+		params, err := getKmsRestParameters(startCmd)
+		require.NoError(t, err)
+		require.NotNil(t, params.keystoreTypeParams.targetStorageParams)
+		require.Equal(t, storageTypeBoltOption, params.keystoreTypeParams.targetStorageParams.storageType)
+		require.Equal(t, "target", params.keystoreTypeParams.targetStorageParams.storagePrefix)
+
+		_, kmsConfig, err := prepareOperationConfig(params)
+		require.NoError(t, err)
+		require.Contains(t, kmsConfig.KeyManagerStorageProviders, storageTypeBoltOption)
+
+		_, err = kms.NewService(kmsConfig)
+		require.NoError(t, err)
+
+		router := mux.NewRouter()
+
+		err = addAdminHandlers(router, kmsConfig, "token", true, &mocklogger.MockLogger{})
+		require.NoError(t, err)
+
+		var paths []string
+
+		err = router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+			path, e := route.GetPathTemplate()
+			paths = append(paths, path)
+
+			return e
+		})
+		require.NoError(t, err)
+		require.Equal(t, []string{"/admin/keymanager/migrate"}, paths)
+	})
+
+	t.Run("Migrates keysets to EDV", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := requiredArgs()
+		args = append(args,
+			"--"+keyManagerEDVURLFlagName, "https://edv.example.com",
+			"--"+keyManagerTargetStorageTypeFlagName, storageTypeEDVOption)
+
+		require.NoError(t, startCmd.ParseFlags(args))
+
+		params, err := getKmsRestParameters(startCmd)
+		require.NoError(t, err)
+		require.Equal(t, storageTypeEDVOption, params.keystoreTypeParams.targetStorageParams.storageType)
+
+		_, kmsConfig, err := prepareOperationConfig(params)
+		require.NoError(t, err)
+		require.Empty(t, kmsConfig.KeyManagerStorageProviders)
+		require.Equal(t, "https://edv.example.com", kmsConfig.EDVServerURL)
+
+		migrator, err := kms.NewStorageMigrator(kmsConfig)
+		require.NoError(t, err)
+
+		result, err := migrator.Migrate(context.Background(), kms.StorageTypeEDV)
+		require.NoError(t, err)
+		require.Zero(t, result.Switched)
+	})
+
+	tests := []struct {
+		name string
+		args []string
+		err  string
+	}{
+		{
+			name: "EDV target storage without EDV URL",
+			args: []string{"--" + keyManagerTargetStorageTypeFlagName, storageTypeEDVOption},
+			err:  "key-manager-target-storage-type edv requires key-manager-edv-url",
+		},
+		{
+			name: "Target storage of the key manager storage type",
+			args: []string{"--" + keyManagerTargetStorageTypeFlagName, storageTypeMemOption},
+			err:  "key-manager-target-storage-type must differ from the key manager storage type",
+		},
+		{
+			name: "EDV key manager storage",
+			args: []string{
+				"--" + keyManagerStorageTypeFlagName, storageTypeEDVOption,
+				"--" + keyManagerTargetStorageTypeFlagName, storageTypeMySQLOption,
+			},
+			err: "key-manager-target-storage-type requires key manager storage other than edv",
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run("Fail with "+tc.name, func(t *testing.T) {
+			startCmd := GetStartCmd(&mockServer{})
+
+			require.NoError(t, startCmd.ParseFlags(append(requiredArgs(), tc.args...)))
+
+			_, err := getKmsRestParameters(startCmd)
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tc.err)
+		})
+	}
+}
@@ -0,0 +1,235 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package startcmd
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	cmdutils "github.com/trustbloc/edge-core/pkg/utils/cmd"
+
+	"github.com/trustbloc/hub-kms/pkg/secretlock/keyfile"
+)
+
+const (
+	masterKeyKDFFlagName  = "kdf"
+	masterKeyKDFEnvKey    = "KMS_MASTER_KEY_KDF"
+	masterKeyKDFFlagUsage = "The key derivation function that derives the key encrypting the master key from " +
+		"the passphrase. Supported options: argon2id, scrypt. Defaults to argon2id. " +
+		commonEnvVarUsageText + masterKeyKDFEnvKey
+
+	newPassphraseFDFlagName  = "new-passphrase-fd"
+	newPassphraseFDEnvKey    = "KMS_SECRET_LOCK_KEY_NEW_PASSPHRASE_FD"
+	newPassphraseFDFlagUsage = "The file descriptor to read the new passphrase of the key file from. The " +
+		"passphrase is taken from " + newPassphraseEnvKey + " environment variable if set, otherwise it is " +
+		"prompted for. " + commonEnvVarUsageText + newPassphraseFDEnvKey
+
+	newPassphraseEnvKey = "KMS_SECRET_LOCK_KEY_NEW_PASSPHRASE" //nolint:gosec // not hard-coded credentials
+
+	keyFileMode = 0600
+)
+
+// GetMasterKeyCmd returns the Cobra command that manages passphrase-protected master key files of the local
+// secret lock.
+func GetMasterKeyCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "masterkey",
+		Short: "Manage the master key file",
+		Long:  "Generate and re-encrypt passphrase-protected master key files used by the local secret lock.",
+	}
+
+	cmd.AddCommand(getGenerateMasterKeyCmd(), getRekeyMasterKeyCmd())
+
+	return cmd
+}
+
+func getGenerateMasterKeyCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "generate",
+		Short: "Generate a master key file",
+		Long:  "Generate a new master key and write it encrypted under the passphrase. An existing file is not overwritten.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path, err := cmdutils.GetUserSetVarFromString(cmd, secretLockKeyPathFlagName, secretLockKeyPathEnvKey, false)
+			if err != nil {
+				return err
+			}
+
+			kdf, err := getMasterKeyKDF(cmd)
+			if err != nil {
+				return err
+			}
+
+			passphrase, err := getKeyPassphraseSource(cmd)
+			if err != nil {
+				return err
+			}
+
+			passphrase.confirm = true
+
+			return generateMasterKeyFile(path, kdf, passphrase)
+		},
+	}
+
+	cmd.Flags().StringP(secretLockKeyPathFlagName, "", "", secretLockKeyPathFlagUsage)
+	cmd.Flags().StringP(secretLockKeyPassphraseFDFlagName, "", "", secretLockKeyPassphraseFDFlagUsage)
+	cmd.Flags().StringP(masterKeyKDFFlagName, "", "", masterKeyKDFFlagUsage)
+
+	return cmd
+}
+
+func getRekeyMasterKeyCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "rekey",
+		Short: "Re-encrypt a master key file",
+		Long: "Re-encrypt the master key under a new passphrase. A raw base64 key file is converted to " +
+			"a passphrase-protected one. The master key itself is not changed.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path, err := cmdutils.GetUserSetVarFromString(cmd, secretLockKeyPathFlagName, secretLockKeyPathEnvKey, false)
+			if err != nil {
+				return err
+			}
+
+			kdf, err := getMasterKeyKDF(cmd)
+			if err != nil {
+				return err
+			}
+
+			passphrase, err := getKeyPassphraseSource(cmd)
+			if err != nil {
+				return err
+			}
+
+			newPassphrase, err := getPassphraseSource(cmd, newPassphraseFDFlagName, newPassphraseFDEnvKey,
+				newPassphraseEnvKey, "new master key passphrase")
+			if err != nil {
+				return err
+			}
+
+			newPassphrase.confirm = true
+
+			return rekeyMasterKeyFile(path, kdf, passphrase, newPassphrase)
+		},
+	}
+
+	cmd.Flags().StringP(secretLockKeyPathFlagName, "", "", secretLockKeyPathFlagUsage)
+	cmd.Flags().StringP(secretLockKeyPassphraseFDFlagName, "", "", secretLockKeyPassphraseFDFlagUsage)
+	cmd.Flags().StringP(newPassphraseFDFlagName, "", "", newPassphraseFDFlagUsage)
+	cmd.Flags().StringP(masterKeyKDFFlagName, "", "", masterKeyKDFFlagUsage)
+
+	return cmd
+}
+
+func getMasterKeyKDF(cmd *cobra.Command) (string, error) {
+	kdf := cmdutils.GetUserSetOptionalVarFromString(cmd, masterKeyKDFFlagName, masterKeyKDFEnvKey)
+
+	switch strings.ToLower(kdf) {
+	case "", keyfile.KDFArgon2id:
+		return keyfile.KDFArgon2id, nil
+	case keyfile.KDFScrypt:
+		return keyfile.KDFScrypt, nil
+	default:
+		return "", fmt.Errorf("unsupported %s: %s", masterKeyKDFFlagName, kdf)
+	}
+}
+
+func generateMasterKeyFile(path, kdf string, passphrase *passphraseSource) error {
+	key, err := keyfile.GenerateKey()
+	if err != nil {
+		return err
+	}
+
+	defer keyfile.Zeroize(key)
+
+	p, err := passphrase.read()
+	if err != nil {
+		return err
+	}
+
+	defer keyfile.Zeroize(p)
+
+	data, err := keyfile.Encrypt(key, p, keyfile.WithKDF(kdf))
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(filepath.Clean(path), os.O_WRONLY|os.O_CREATE|os.O_EXCL, keyFileMode)
+	if err != nil {
+		return fmt.Errorf("create master key file: %w", err)
+	}
+
+	if _, err = f.Write(data); err != nil {
+		_ = f.Close() //nolint:errcheck // write error is returned
+
+		return fmt.Errorf("write master key file: %w", err)
+	}
+
+	return f.Close()
+}
+
+func rekeyMasterKeyFile(path, kdf string, passphrase, newPassphrase *passphraseSource) error {
+	data, err := ioutil.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return fmt.Errorf("read master key file: %w", err)
+	}
+
+	key, err := decryptMasterKeyFile(data, passphrase)
+	if err != nil {
+		return err
+	}
+
+	defer keyfile.Zeroize(key)
+
+	p, err := newPassphrase.read()
+	if err != nil {
+		return err
+	}
+
+	defer keyfile.Zeroize(p)
+
+	data, err = keyfile.Encrypt(key, p, keyfile.WithKDF(kdf))
+	if err != nil {
+		return err
+	}
+
+	// write the new file next to the old one and replace it, so an interrupted rekey keeps the old file intact
+	tmp := path + ".tmp"
+
+	if err = ioutil.WriteFile(tmp, data, keyFileMode); err != nil {
+		return fmt.Errorf("write master key file: %w", err)
+	}
+
+	if err = os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("replace master key file: %w", err)
+	}
+
+	return nil
+}
+
+func decryptMasterKeyFile(data []byte, passphrase *passphraseSource) ([]byte, error) {
+	if !keyfile.IsEncrypted(data) {
+		key, err := base64.URLEncoding.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil {
+			return nil, fmt.Errorf("decode raw master key: %w", err)
+		}
+
+		return key, nil
+	}
+
+	p, err := passphrase.read()
+	if err != nil {
+		return nil, err
+	}
+
+	defer keyfile.Zeroize(p)
+
+	return keyfile.Decrypt(data, p)
+}
@@ -0,0 +1,202 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package startcmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh/terminal"
+
+	"github.com/trustbloc/hub-kms/pkg/secretlock/keyfile"
+)
+
+func TestGetMasterKeyCmd(t *testing.T) {
+	dir, err := ioutil.TempDir("", "masterkey")
+	require.NoError(t, err)
+
+	defer func() { require.NoError(t, os.RemoveAll(dir)) }()
+
+	path := filepath.Join(dir, "master.key")
+
+	setEnv(t, secretLockKeyPassphraseEnvKey, "passphrase")
+
+	t.Run("Generate key file", func(t *testing.T) {
+		cmd := GetMasterKeyCmd()
+		cmd.SetArgs([]string{"generate", "--" + secretLockKeyPathFlagName, path})
+
+		require.NoError(t, cmd.Execute())
+
+		data, err := ioutil.ReadFile(path) //nolint:gosec // test file
+		require.NoError(t, err)
+		require.True(t, keyfile.IsEncrypted(data))
+
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		require.Equal(t, os.FileMode(keyFileMode), info.Mode().Perm())
+	})
+
+	t.Run("Fail to overwrite existing key file", func(t *testing.T) {
+		cmd := GetMasterKeyCmd()
+		cmd.SetArgs([]string{"generate", "--" + secretLockKeyPathFlagName, path})
+
+		err := cmd.Execute()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "create master key file")
+	})
+
+	t.Run("Start with protected key file", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+		startCmd.SetArgs(append(requiredArgs(), "--"+secretLockKeyPathFlagName, path))
+
+		require.NoError(t, startCmd.Execute())
+	})
+
+	t.Run("Rekey with passphrase from file descriptor", func(t *testing.T) {
+		before, err := ioutil.ReadFile(path) //nolint:gosec // test file
+		require.NoError(t, err)
+
+		setEnv(t, secretLockKeyPassphraseEnvKey, "")
+		setEnv(t, newPassphraseEnvKey, "new passphrase")
+
+		cmd := GetMasterKeyCmd()
+		cmd.SetArgs([]string{"rekey", "--" + secretLockKeyPathFlagName, path,
+			"--" + secretLockKeyPassphraseFDFlagName, passphraseFD(t, "passphrase\n"),
+			"--" + masterKeyKDFFlagName, keyfile.KDFScrypt})
+
+		require.NoError(t, cmd.Execute())
+
+		after, err := ioutil.ReadFile(path) //nolint:gosec // test file
+		require.NoError(t, err)
+
+		oldKey, err := keyfile.Decrypt(before, []byte("passphrase"))
+		require.NoError(t, err)
+
+		newKey, err := keyfile.Decrypt(after, []byte("new passphrase"))
+		require.NoError(t, err)
+		require.Equal(t, oldKey, newKey)
+	})
+
+	t.Run("Fail to start with wrong passphrase", func(t *testing.T) {
+		setEnv(t, secretLockKeyPassphraseEnvKey, "passphrase")
+
+		startCmd := GetStartCmd(&mockServer{})
+		startCmd.SetArgs(append(requiredArgs(), "--"+secretLockKeyPathFlagName, path))
+
+		err := startCmd.Execute()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), keyfile.ErrInvalidPassphrase.Error())
+	})
+
+	t.Run("Fail to start without passphrase", func(t *testing.T) {
+		if terminal.IsTerminal(int(os.Stdin.Fd())) {
+			t.Skip("the passphrase is prompted for in a terminal")
+		}
+
+		setEnv(t, secretLockKeyPassphraseEnvKey, "")
+
+		startCmd := GetStartCmd(&mockServer{})
+		startCmd.SetArgs(append(requiredArgs(), "--"+secretLockKeyPathFlagName, path))
+
+		err := startCmd.Execute()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "passphrase is required")
+	})
+
+	t.Run("Fail with invalid passphrase file descriptor", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+		startCmd.SetArgs(append(requiredArgs(), "--"+secretLockKeyPathFlagName, path,
+			"--"+secretLockKeyPassphraseFDFlagName, "stdin"))
+
+		err := startCmd.Execute()
+		require.EqualError(t, err, "invalid secret-lock-key-passphrase-fd: stdin")
+	})
+}
+
+func TestRekeyRawMasterKey(t *testing.T) {
+	file, closeFunc := createKeyFile(t, false)
+	defer closeFunc()
+
+	setEnv(t, newPassphraseEnvKey, "passphrase")
+
+	cmd := GetMasterKeyCmd()
+	cmd.SetArgs([]string{"rekey", "--" + secretLockKeyPathFlagName, file})
+
+	require.NoError(t, cmd.Execute())
+
+	data, err := ioutil.ReadFile(file) //nolint:gosec // test file
+	require.NoError(t, err)
+	require.True(t, keyfile.IsEncrypted(data))
+
+	setEnv(t, secretLockKeyPassphraseEnvKey, "passphrase")
+
+	startCmd := GetStartCmd(&mockServer{})
+	startCmd.SetArgs(append(requiredArgs(), "--"+secretLockKeyPathFlagName, file))
+
+	require.NoError(t, startCmd.Execute())
+}
+
+func TestGenerateMasterKeyWithInvalidArgs(t *testing.T) {
+	t.Run("Fail without key path", func(t *testing.T) {
+		cmd := GetMasterKeyCmd()
+		cmd.SetArgs([]string{"generate"})
+
+		err := cmd.Execute()
+		require.EqualError(t, err, "Neither secret-lock-key-path (command line flag) nor KMS_SECRET_LOCK_KEY_PATH "+
+			"(environment variable) have been set.")
+	})
+
+	t.Run("Fail with unsupported KDF", func(t *testing.T) {
+		cmd := GetMasterKeyCmd()
+		cmd.SetArgs([]string{"generate", "--" + secretLockKeyPathFlagName, "master.key",
+			"--" + masterKeyKDFFlagName, "pbkdf2"})
+
+		err := cmd.Execute()
+		require.EqualError(t, err, "unsupported kdf: pbkdf2")
+	})
+}
+
+// setEnv sets the environment variable and restores the previous value when the test completes.
+func setEnv(t *testing.T, key, value string) {
+	t.Helper()
+
+	prev, ok := os.LookupEnv(key)
+
+	require.NoError(t, os.Setenv(key, value))
+
+	t.Cleanup(func() {
+		if ok {
+			require.NoError(t, os.Setenv(key, prev))
+		} else {
+			require.NoError(t, os.Unsetenv(key))
+		}
+	})
+}
+
+// passphraseFD returns the file descriptor to read the passphrase from, it is closed by the reader.
+func passphraseFD(t *testing.T, passphrase string) string {
+	t.Helper()
+
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+
+	defer func() { require.NoError(t, r.Close()) }()
+
+	_, err = w.WriteString(passphrase)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	fd, err := syscall.Dup(int(r.Fd()))
+	require.NoError(t, err)
+
+	return strconv.Itoa(fd)
+}
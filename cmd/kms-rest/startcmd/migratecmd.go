@@ -0,0 +1,311 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package startcmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/aries-framework-go/pkg/kms/localkms"
+	"github.com/hyperledger/aries-framework-go/pkg/storage"
+	"github.com/spf13/cobra"
+	cmdutils "github.com/trustbloc/edge-core/pkg/utils/cmd"
+
+	"github.com/trustbloc/hub-kms/pkg/kms"
+	"github.com/trustbloc/hub-kms/pkg/storage/migration"
+)
+
+// Names of stores copied by default: keystore metadata, zcaps, the primary key and key manager keysets.
+const (
+	keystoreStoreName   = "keystoredb"
+	zcapsStoreName      = "zcaps"
+	primaryKeyStoreName = "primarykey"
+)
+
+const (
+	sourceStorageTypeFlagName  = "source-storage-type"
+	sourceStorageTypeEnvKey    = "KMS_MIGRATE_SOURCE_STORAGE_TYPE"
+	sourceStorageTypeFlagUsage = "The type of storage to copy stores from. Supported options: mem, couchdb, bolt, " +
+		"postgres, mysql. " + commonEnvVarUsageText + sourceStorageTypeEnvKey
+
+	sourceStorageURLFlagName  = "source-storage-url"
+	sourceStorageURLEnvKey    = "KMS_MIGRATE_SOURCE_STORAGE_URL"
+	sourceStorageURLFlagUsage = "The URL of storage to copy stores from. " +
+		commonEnvVarUsageText + sourceStorageURLEnvKey
+
+	sourceStoragePrefixFlagName  = "source-storage-prefix"
+	sourceStoragePrefixEnvKey    = "KMS_MIGRATE_SOURCE_STORAGE_PREFIX"
+	sourceStoragePrefixFlagUsage = "An optional prefix of databases of storage to copy stores from. " +
+		commonEnvVarUsageText + sourceStoragePrefixEnvKey
+
+	targetStorageTypeFlagName  = "target-storage-type"
+	targetStorageTypeEnvKey    = "KMS_MIGRATE_TARGET_STORAGE_TYPE"
+	targetStorageTypeFlagUsage = "The type of storage to copy stores to. Supported options: mem, couchdb, bolt, " +
+		"postgres, mysql. " + commonEnvVarUsageText + targetStorageTypeEnvKey
+
+	targetStorageURLFlagName  = "target-storage-url"
+	targetStorageURLEnvKey    = "KMS_MIGRATE_TARGET_STORAGE_URL"
+	targetStorageURLFlagUsage = "The URL of storage to copy stores to. " +
+		commonEnvVarUsageText + targetStorageURLEnvKey
+
+	targetStoragePrefixFlagName  = "target-storage-prefix"
+	targetStoragePrefixEnvKey    = "KMS_MIGRATE_TARGET_STORAGE_PREFIX"
+	targetStoragePrefixFlagUsage = "An optional prefix of databases of storage to copy stores to. " +
+		commonEnvVarUsageText + targetStoragePrefixEnvKey
+
+	migrateStoresFlagName  = "stores"
+	migrateStoresEnvKey    = "KMS_MIGRATE_STORES"
+	migrateStoresFlagUsage = "Comma-separated list of stores to copy. Defaults to keystoredb (keystore metadata), " +
+		"zcaps, primarykey and kmsdb (key manager keysets). " + commonEnvVarUsageText + migrateStoresEnvKey
+
+	switchKeystoresFlagName  = "switch-keystores"
+	switchKeystoresEnvKey    = "KMS_MIGRATE_SWITCH_KEYSTORES"
+	switchKeystoresFlagUsage = "Switches keystores with keysets in the source storage to the target storage " +
+		"after keysets are copied. The source storage is the key manager storage and keystore metadata is read " +
+		"from the database set with " + databaseTypeFlagName + ", which keystoredb is then copied from. Switched " +
+		"keystores read missing keysets from the source storage until the command is run again after all " +
+		"keystores are switched. Default is false. " +
+		commonEnvVarUsageText + switchKeystoresEnvKey
+)
+
+type migrateParameters struct {
+	sourceStorageParams *storageParameters
+	targetStorageParams *storageParameters
+	stores              []string
+	switchKeystores     bool
+	storageParams       *storageParameters // keystore metadata, used to switch keystores
+}
+
+// GetMigrateCmd returns the Cobra command that copies stores between storages, e.g. from CouchDB to MySQL, and
+// optionally switches keystores to keysets in the target storage. It can run while servers use the source storage.
+func GetMigrateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Migrate stores to another storage",
+		Long: "Copy stores from the source to the target storage and verify checksums of copied entries. " +
+			"Run again to resume an interrupted migration or to copy entries changed in the meantime.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			params, err := getMigrateParameters(cmd)
+			if err != nil {
+				return err
+			}
+
+			return migrate(cmd.OutOrStdout(), params)
+		},
+	}
+
+	cmd.Flags().StringP(sourceStorageTypeFlagName, "", "", sourceStorageTypeFlagUsage)
+	cmd.Flags().StringP(sourceStorageURLFlagName, "", "", sourceStorageURLFlagUsage)
+	cmd.Flags().StringP(sourceStoragePrefixFlagName, "", "", sourceStoragePrefixFlagUsage)
+	cmd.Flags().StringP(targetStorageTypeFlagName, "", "", targetStorageTypeFlagUsage)
+	cmd.Flags().StringP(targetStorageURLFlagName, "", "", targetStorageURLFlagUsage)
+	cmd.Flags().StringP(targetStoragePrefixFlagName, "", "", targetStoragePrefixFlagUsage)
+	cmd.Flags().StringArrayP(migrateStoresFlagName, "", []string{}, migrateStoresFlagUsage)
+	cmd.Flags().StringP(switchKeystoresFlagName, "", "", switchKeystoresFlagUsage)
+	cmd.Flags().StringP(databaseTypeFlagName, "", "", databaseTypeFlagUsage)
+	cmd.Flags().StringP(databaseURLFlagName, "", "", databaseURLFlagUsage)
+	cmd.Flags().StringP(databasePrefixFlagName, "", "", databasePrefixFlagUsage)
+
+	addSQLPoolFlags(cmd)
+
+	return cmd
+}
+
+func getMigrateParameters(cmd *cobra.Command) (*migrateParameters, error) {
+	sourceStorageParams, err := getMigrationStorageParameters(cmd, sourceStorageTypeFlagName, sourceStorageTypeEnvKey,
+		sourceStorageURLFlagName, sourceStorageURLEnvKey, sourceStoragePrefixFlagName, sourceStoragePrefixEnvKey)
+	if err != nil {
+		return nil, err
+	}
+
+	targetStorageParams, err := getMigrationStorageParameters(cmd, targetStorageTypeFlagName, targetStorageTypeEnvKey,
+		targetStorageURLFlagName, targetStorageURLEnvKey, targetStoragePrefixFlagName, targetStoragePrefixEnvKey)
+	if err != nil {
+		return nil, err
+	}
+
+	stores := cmdutils.GetUserSetOptionalVarFromArrayString(cmd, migrateStoresFlagName, migrateStoresEnvKey)
+	if len(stores) == 0 {
+		stores = []string{keystoreStoreName, zcapsStoreName, primaryKeyStoreName, localkms.Namespace}
+	}
+
+	switchKeystoresString, err := cmdutils.GetUserSetVarFromString(cmd, switchKeystoresFlagName,
+		switchKeystoresEnvKey, true)
+	if err != nil {
+		return nil, err
+	}
+
+	params := &migrateParameters{
+		sourceStorageParams: sourceStorageParams,
+		targetStorageParams: targetStorageParams,
+		stores:              stores,
+	}
+
+	if switchKeystoresString != "" {
+		params.switchKeystores, err = strconv.ParseBool(switchKeystoresString)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", switchKeystoresFlagName, err)
+		}
+	}
+
+	if params.switchKeystores {
+		if strings.EqualFold(sourceStorageParams.storageType, targetStorageParams.storageType) {
+			return nil, fmt.Errorf("%s requires source and target storages of different types",
+				switchKeystoresFlagName)
+		}
+
+		params.storageParams, err = getStorageParameters(cmd)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return params, nil
+}
+
+func getMigrationStorageParameters(cmd *cobra.Command, typeFlagName, typeEnvKey, urlFlagName, urlEnvKey,
+	prefixFlagName, prefixEnvKey string) (*storageParameters, error) {
+	storageType, err := cmdutils.GetUserSetVarFromString(cmd, typeFlagName, typeEnvKey, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.EqualFold(storageType, storageTypeEDVOption) {
+		return nil, fmt.Errorf("%s can't be %s: keysets are migrated to EDV vaults of keystores with the admin API",
+			typeFlagName, storageTypeEDVOption)
+	}
+
+	storageURL, err := cmdutils.GetUserSetVarFromString(cmd, urlFlagName, urlEnvKey, true)
+	if err != nil {
+		return nil, err
+	}
+
+	storagePrefix, err := cmdutils.GetUserSetVarFromString(cmd, prefixFlagName, prefixEnvKey, true)
+	if err != nil {
+		return nil, err
+	}
+
+	sqlPool, err := getSQLPoolParameters(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	return &storageParameters{
+		storageType:   storageType,
+		storageURL:    storageURL,
+		storagePrefix: storagePrefix,
+		sqlPool:       sqlPool,
+	}, nil
+}
+
+func migrate(w io.Writer, params *migrateParameters) error {
+	source, err := prepareKMSStorageProvider(params.sourceStorageParams)
+	if err != nil {
+		return fmt.Errorf("source storage: %w", err)
+	}
+
+	target, err := prepareKMSStorageProvider(params.targetStorageParams)
+	if err != nil {
+		return fmt.Errorf("target storage: %w", err)
+	}
+
+	copier, err := migration.NewCopier(source, target)
+	if err != nil {
+		return err
+	}
+
+	// keystore metadata is copied from the source storage unless keystores are switched
+	metadataCopier := copier
+
+	// keystores are switched first, so switched keystore metadata is copied with other stores
+	if params.switchKeystores {
+		metadata, e := prepareStorageProvider(params.storageParams)
+		if e != nil {
+			return e
+		}
+
+		if err = switchKeystores(w, metadata, source, target, params); err != nil {
+			return err
+		}
+
+		// keystores are switched in the database with keystore metadata, which may differ from the source storage
+		metadataCopier, err = migration.NewCopier(metadata, target)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, name := range params.stores {
+		// keysets are copied by the switch without overwriting keysets already used from the target storage
+		if params.switchKeystores && name == localkms.Namespace {
+			continue
+		}
+
+		c := copier
+		if name == keystoreStoreName {
+			c = metadataCopier
+		}
+
+		result, err := c.Copy(name)
+		if err != nil {
+			return err
+		}
+
+		if err = printCopyResult(w, result); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// switchKeystores copies keysets and switches keystores with keysets in the source storage to the target storage.
+// Keystore metadata is switched in the metadata storage. Keystores created before storage types were recorded have
+// keysets in the key manager storage, which is the source storage.
+func switchKeystores(w io.Writer, metadata, source, target storage.Provider, params *migrateParameters) error {
+	targetStorageType := params.targetStorageParams.storageType
+
+	migrator, err := kms.NewStorageMigrator(&kms.Config{
+		StorageProvider:            metadata,
+		KeyManagerStorageProvider:  source,
+		KeyManagerStorageType:      params.sourceStorageParams.storageType,
+		KeyManagerStorageProviders: map[string]storage.Provider{targetStorageType: target},
+	})
+	if err != nil {
+		return err
+	}
+
+	result, err := migrator.Migrate(context.Background(), targetStorageType)
+	if err != nil {
+		return err
+	}
+
+	if err = printCopyResult(w, result.Copied); err != nil {
+		return err
+	}
+
+	if result.Synced != nil {
+		if err = printCopyResult(w, result.Synced); err != nil {
+			return err
+		}
+	}
+
+	_, err = fmt.Fprintf(w, "Keystores switched to %s: %d switched, %d completed, %d pending\n",
+		targetStorageType, result.Switched, result.Completed, result.Pending)
+
+	return err
+}
+
+func printCopyResult(w io.Writer, result *migration.Result) error {
+	_, err := fmt.Fprintf(w, "Store %s copied: %d entries copied, %d skipped, checksum %s\n",
+		result.Store, result.Copied, result.Skipped, result.Checksum)
+
+	return err
+}
@@ -0,0 +1,232 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package startcmd
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hyperledger/aries-framework-go/pkg/kms/localkms"
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/hub-kms/pkg/kms"
+	"github.com/trustbloc/hub-kms/pkg/storage/bolt"
+)
+
+func TestGetMigrateCmd(t *testing.T) {
+	t.Run("Copy stores", func(t *testing.T) {
+		sourceDir, targetDir := t.TempDir(), t.TempDir()
+
+		putEntries(t, sourceDir, map[string]map[string]string{
+			keystoreStoreName:  {"keystore1": "data1", "keystore2": "data2"},
+			localkms.Namespace: {"keyset1": "keyset"},
+		})
+
+		var out bytes.Buffer
+
+		cmd := GetMigrateCmd()
+		cmd.SetOut(&out)
+		cmd.SetArgs(migrateArgs(sourceDir, targetDir))
+
+		require.NoError(t, cmd.Execute())
+		require.Contains(t, out.String(), "Store keystoredb copied: 2 entries copied, 0 skipped")
+		require.Contains(t, out.String(), "Store zcaps copied: 0 entries copied, 0 skipped")
+		require.Contains(t, out.String(), "Store kmsdb copied: 1 entries copied, 0 skipped")
+
+		requireEntry(t, targetDir, keystoreStoreName, "keystore2", "data2")
+		requireEntry(t, targetDir, localkms.Namespace, "keyset1", "keyset")
+
+		out.Reset()
+
+		cmd = GetMigrateCmd()
+		cmd.SetOut(&out)
+		cmd.SetArgs(append(migrateArgs(sourceDir, targetDir), "--"+migrateStoresFlagName, keystoreStoreName))
+
+		require.NoError(t, cmd.Execute())
+		require.Equal(t, 1, bytes.Count(out.Bytes(), []byte("\n")))
+		require.Contains(t, out.String(), "Store keystoredb copied: 0 entries copied, 2 skipped")
+	})
+
+	t.Run("Switch keystores", func(t *testing.T) {
+		sourceDir, metadataDir := t.TempDir(), t.TempDir()
+
+		putEntries(t, sourceDir, map[string]map[string]string{
+			localkms.Namespace: {"keyset1": "keyset"},
+		})
+
+		metadata, err := bolt.NewProvider(metadataDir)
+		require.NoError(t, err)
+
+		svc, err := kms.NewService(&kms.Config{
+			StorageProvider:       metadata,
+			KeyManagerStorageType: storageTypeBoltOption,
+		})
+		require.NoError(t, err)
+
+		data, _, err := svc.CreateKeystore(httptest.NewRequest(http.MethodPost, "/kms/keystores", nil), "controller", "")
+		require.NoError(t, err)
+		require.NoError(t, metadata.Close())
+
+		var out bytes.Buffer
+
+		cmd := GetMigrateCmd()
+		cmd.SetOut(&out)
+		cmd.SetArgs([]string{
+			"--" + sourceStorageTypeFlagName, storageTypeBoltOption,
+			"--" + sourceStorageURLFlagName, sourceDir,
+			"--" + targetStorageTypeFlagName, storageTypeMemOption,
+			"--" + switchKeystoresFlagName, "true",
+			"--" + databaseTypeFlagName, storageTypeBoltOption,
+			"--" + databaseURLFlagName, metadataDir,
+		})
+
+		require.NoError(t, cmd.Execute())
+		require.Contains(t, out.String(), "Store kmsdb copied: 1 entries copied, 0 skipped")
+		require.Contains(t, out.String(), "Keystores switched to mem: 1 switched, 0 completed, 1 pending")
+		require.Equal(t, 1, bytes.Count(out.Bytes(), []byte("Store kmsdb copied")))
+		require.Contains(t, out.String(), "Store keystoredb copied: ", "switched keystore metadata is copied")
+		require.NotContains(t, out.String(), "Store keystoredb copied: 0 entries")
+
+		metadata, err = bolt.NewProvider(metadataDir)
+		require.NoError(t, err)
+
+		defer func() { require.NoError(t, metadata.Close()) }()
+
+		svc, err = kms.NewService(&kms.Config{StorageProvider: metadata})
+		require.NoError(t, err)
+
+		switched, err := svc.GetKeystoreData(data.ID)
+		require.NoError(t, err)
+		require.Equal(t, storageTypeMemOption, switched.StorageType)
+		require.Equal(t, storageTypeBoltOption, switched.Migration.SourceStorageType)
+	})
+
+	tests := []struct {
+		name string
+		args []string
+		err  string
+	}{
+		{
+			name: "Missing source storage type",
+			args: []string{"--" + targetStorageTypeFlagName, storageTypeMemOption},
+			err:  sourceStorageTypeFlagName,
+		},
+		{
+			name: "Missing target storage type",
+			args: []string{"--" + sourceStorageTypeFlagName, storageTypeMemOption},
+			err:  targetStorageTypeFlagName,
+		},
+		{
+			name: "EDV target storage",
+			args: []string{
+				"--" + sourceStorageTypeFlagName, storageTypeMemOption,
+				"--" + targetStorageTypeFlagName, storageTypeEDVOption,
+			},
+			err: "target-storage-type can't be edv: keysets are migrated to EDV vaults of keystores with the admin API",
+		},
+		{
+			name: "Invalid switch-keystores",
+			args: []string{
+				"--" + sourceStorageTypeFlagName, storageTypeMemOption,
+				"--" + targetStorageTypeFlagName, storageTypeMySQLOption,
+				"--" + switchKeystoresFlagName, "invalid",
+			},
+			err: "invalid switch-keystores",
+		},
+		{
+			name: "Switch keystores to storage of the same type",
+			args: []string{
+				"--" + sourceStorageTypeFlagName, storageTypeMemOption,
+				"--" + targetStorageTypeFlagName, storageTypeMemOption,
+				"--" + switchKeystoresFlagName, "true",
+			},
+			err: "switch-keystores requires source and target storages of different types",
+		},
+		{
+			name: "Switch keystores without database type",
+			args: []string{
+				"--" + sourceStorageTypeFlagName, storageTypeMemOption,
+				"--" + targetStorageTypeFlagName, storageTypeBoltOption,
+				"--" + switchKeystoresFlagName, "true",
+			},
+			err: databaseTypeFlagName,
+		},
+		{
+			name: "Invalid source storage",
+			args: []string{
+				"--" + sourceStorageTypeFlagName, "invalid",
+				"--" + targetStorageTypeFlagName, storageTypeMemOption,
+			},
+			err: "source storage: KMS storage not set to a valid type",
+		},
+		{
+			name: "Invalid target storage",
+			args: []string{
+				"--" + sourceStorageTypeFlagName, storageTypeMemOption,
+				"--" + targetStorageTypeFlagName, "invalid",
+			},
+			err: "target storage: KMS storage not set to a valid type",
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run("Fail with "+tc.name, func(t *testing.T) {
+			cmd := GetMigrateCmd()
+			cmd.SetArgs(tc.args)
+
+			err := cmd.Execute()
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tc.err)
+		})
+	}
+}
+
+func migrateArgs(sourceDir, targetDir string) []string {
+	return []string{
+		"--" + sourceStorageTypeFlagName, storageTypeBoltOption,
+		"--" + sourceStorageURLFlagName, sourceDir,
+		"--" + targetStorageTypeFlagName, storageTypeBoltOption,
+		"--" + targetStorageURLFlagName, targetDir,
+	}
+}
+
+func putEntries(t *testing.T, dir string, stores map[string]map[string]string) {
+	t.Helper()
+
+	p, err := bolt.NewProvider(dir)
+	require.NoError(t, err)
+
+	defer func() { require.NoError(t, p.Close()) }()
+
+	for name, entries := range stores {
+		store, err := p.OpenStore(name)
+		require.NoError(t, err)
+
+		for k, v := range entries {
+			require.NoError(t, store.Put(k, []byte(v)))
+		}
+	}
+}
+
+func requireEntry(t *testing.T, dir, name, k, v string) {
+	t.Helper()
+
+	p, err := bolt.NewProvider(dir)
+	require.NoError(t, err)
+
+	defer func() { require.NoError(t, p.Close()) }()
+
+	store, err := p.OpenStore(name)
+	require.NoError(t, err)
+
+	b, err := store.Get(k)
+	require.NoError(t, err)
+	require.Equal(t, v, string(b))
+}
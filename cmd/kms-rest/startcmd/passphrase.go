@@ -0,0 +1,134 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package startcmd
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/spf13/cobra"
+	cmdutils "github.com/trustbloc/edge-core/pkg/utils/cmd"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// passphraseSource reads the passphrase of the master key file. The environment variable takes precedence over
+// the file descriptor, the passphrase is prompted for if neither is set and stdin is a terminal.
+type passphraseSource struct {
+	envKey  string
+	fdFlag  string
+	fd      int // -1 if not set
+	prompt  string
+	confirm bool
+}
+
+func getPassphraseSource(cmd *cobra.Command, fdFlagName, fdEnvKey, envKey, prompt string) (*passphraseSource, error) {
+	s := &passphraseSource{envKey: envKey, fdFlag: fdFlagName, fd: -1, prompt: prompt}
+
+	fdStr := cmdutils.GetUserSetOptionalVarFromString(cmd, fdFlagName, fdEnvKey)
+	if fdStr == "" {
+		return s, nil
+	}
+
+	fd, err := strconv.Atoi(fdStr)
+	if err != nil || fd < 0 {
+		return nil, fmt.Errorf("invalid %s: %s", fdFlagName, fdStr)
+	}
+
+	s.fd = fd
+
+	return s, nil
+}
+
+func (s *passphraseSource) read() ([]byte, error) {
+	var (
+		passphrase []byte
+		err        error
+	)
+
+	switch {
+	case os.Getenv(s.envKey) != "":
+		passphrase = []byte(os.Getenv(s.envKey))
+	case s.fd >= 0:
+		passphrase, err = readPassphraseFromFD(s.fd)
+	default:
+		passphrase, err = s.readFromTerminal()
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(passphrase) == 0 {
+		return nil, errors.New("passphrase is empty")
+	}
+
+	return passphrase, nil
+}
+
+// readPassphraseFromFD reads the first line from the file descriptor and closes it.
+func readPassphraseFromFD(fd int) ([]byte, error) {
+	f := os.NewFile(uintptr(fd), "passphrase")
+	if f == nil {
+		return nil, fmt.Errorf("invalid passphrase file descriptor: %d", fd)
+	}
+
+	defer f.Close() //nolint:errcheck // read-only descriptor
+
+	line, err := bufio.NewReader(f).ReadBytes('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("read passphrase from file descriptor %d: %w", fd, err)
+	}
+
+	return bytes.TrimRight(line, "\r\n"), nil
+}
+
+func (s *passphraseSource) readFromTerminal() ([]byte, error) {
+	stdin := int(os.Stdin.Fd())
+
+	if !terminal.IsTerminal(stdin) {
+		return nil, fmt.Errorf("passphrase is required: set %s environment variable or --%s", s.envKey, s.fdFlag)
+	}
+
+	passphrase, err := promptPassphrase(stdin, "Enter "+s.prompt)
+	if err != nil {
+		return nil, err
+	}
+
+	if !s.confirm {
+		return passphrase, nil
+	}
+
+	confirmation, err := promptPassphrase(stdin, "Confirm "+s.prompt)
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.Equal(passphrase, confirmation) {
+		return nil, errors.New("passphrases do not match")
+	}
+
+	return passphrase, nil
+}
+
+func promptPassphrase(fd int, prompt string) ([]byte, error) {
+	fmt.Fprintf(os.Stderr, "%s: ", prompt)
+
+	passphrase, err := terminal.ReadPassword(fd)
+
+	fmt.Fprintln(os.Stderr)
+
+	if err != nil {
+		return nil, fmt.Errorf("read passphrase: %w", err)
+	}
+
+	return passphrase, nil
+}
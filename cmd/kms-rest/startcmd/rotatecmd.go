@@ -0,0 +1,110 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package startcmd
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/trustbloc/hub-kms/pkg/kms"
+	lock "github.com/trustbloc/hub-kms/pkg/secretlock"
+)
+
+// GetRotatePrimaryKeyCmd returns the Cobra command that rotates the primary key protecting keysets of keystores.
+// It is an offline alternative to the admin API of the running server.
+func GetRotatePrimaryKeyCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "rotate-primary-key",
+		Short: "Rotate the primary key",
+		Long: "Generate a new primary key and re-encrypt keysets of all keystores under it. " +
+			"Run again to resume an interrupted rotation.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			config, err := getRotatePrimaryKeyConfig(cmd)
+			if err != nil {
+				return err
+			}
+
+			rotator, err := kms.NewPrimaryKeyRotator(config)
+			if err != nil {
+				return err
+			}
+
+			result, err := rotator.Rotate()
+			if err != nil {
+				return err
+			}
+
+			return printRotationResult(cmd.OutOrStdout(), result)
+		},
+	}
+
+	addSecretLockFlags(cmd)
+
+	cmd.Flags().StringP(primaryKeyDatabaseTypeFlagName, "", "", primaryKeyDatabaseTypeFlagUsage)
+	cmd.Flags().StringP(primaryKeyDatabaseURLFlagName, "", "", primaryKeyDatabaseURLFlagUsage)
+	cmd.Flags().StringP(primaryKeyDatabasePrefixFlagName, "", "", primaryKeyDatabasePrefixFlagUsage)
+
+	cmd.Flags().StringP(keyManagerStorageTypeFlagName, "", "", keyManagerStorageTypeFlagUsage)
+	cmd.Flags().StringP(keyManagerStorageURLFlagName, "", "", keyManagerStorageURLFlagUsage)
+	cmd.Flags().StringP(keyManagerStoragePrefixFlagName, "", "", keyManagerStoragePrefixFlagUsage)
+
+	addSQLPoolFlags(cmd)
+
+	return cmd
+}
+
+func getRotatePrimaryKeyConfig(cmd *cobra.Command) (*kms.Config, error) {
+	secretLockParams, err := getSecretLockParameters(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	primaryKeyStorageParams, err := getPrimaryKeyStorageParameters(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	keyManagerStorageParams, err := getKeyManagerStorageParameters(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.EqualFold(keyManagerStorageParams.storageType, storageTypeEDVOption) {
+		return nil, kms.ErrRotationNotSupported
+	}
+
+	primaryKeyStorageProvider, err := prepareKMSStorageProvider(primaryKeyStorageParams)
+	if err != nil {
+		return nil, err
+	}
+
+	primaryKeyLock, err := preparePrimaryKeyLock(primaryKeyStorageProvider, secretLockParams, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	keyManagerStorageProvider, err := prepareKMSStorageProvider(keyManagerStorageParams)
+	if err != nil {
+		return nil, err
+	}
+
+	return &kms.Config{
+		KeyManagerStorageProvider: keyManagerStorageProvider,
+		PrimaryKeyStorageProvider: primaryKeyStorageProvider,
+		PrimaryKeyLock:            primaryKeyLock,
+	}, nil
+}
+
+func printRotationResult(w io.Writer, result *lock.RotationResult) error {
+	_, err := fmt.Fprintf(w, "Primary key rotated: %d keysets re-encrypted, %d skipped, %d foreign\n",
+		result.Reencrypted, result.Skipped, result.Foreign)
+
+	return err
+}
@@ -0,0 +1,103 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package startcmd
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/hub-kms/pkg/kms"
+	lock "github.com/trustbloc/hub-kms/pkg/secretlock"
+)
+
+func TestGetRotatePrimaryKeyCmd(t *testing.T) {
+	t.Run("Fail if there is no primary key to rotate", func(t *testing.T) {
+		cmd := GetRotatePrimaryKeyCmd()
+		cmd.SetArgs(rotateArgs(storageTypeMemOption))
+
+		err := cmd.Execute()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "rotate primary key")
+	})
+
+	t.Run("Fail with key manager storage in EDV", func(t *testing.T) {
+		cmd := GetRotatePrimaryKeyCmd()
+		cmd.SetArgs(rotateArgs(storageTypeEDVOption))
+
+		err := cmd.Execute()
+		require.True(t, errors.Is(err, kms.ErrRotationNotSupported))
+	})
+
+	t.Run("Fail with invalid key manager storage option", func(t *testing.T) {
+		cmd := GetRotatePrimaryKeyCmd()
+		cmd.SetArgs(rotateArgs("invalid"))
+
+		err := cmd.Execute()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "KMS storage not set to a valid type")
+	})
+
+	t.Run("Fail with missing primary key storage type", func(t *testing.T) {
+		cmd := GetRotatePrimaryKeyCmd()
+		cmd.SetArgs([]string{"--" + keyManagerStorageTypeFlagName, storageTypeMemOption})
+
+		err := cmd.Execute()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), primaryKeyDatabaseTypeFlagName)
+	})
+
+	t.Run("Fail with invalid secret-lock-key-path arg", func(t *testing.T) {
+		cmd := GetRotatePrimaryKeyCmd()
+		cmd.SetArgs(append(rotateArgs(storageTypeMemOption), "--"+secretLockKeyPathFlagName, "invalid"))
+
+		err := cmd.Execute()
+		require.Error(t, err)
+	})
+}
+
+func TestRotatePrimaryKey(t *testing.T) {
+	params := kmsRestParams(t)
+
+	_, kmsConfig, err := prepareOperationConfig(params)
+	require.NoError(t, err)
+
+	// primary key is created when the first keystore is resolved
+	_, err = lock.New("local-lock://keystoredb", &secretLockProvider{
+		storageProvider: kmsConfig.PrimaryKeyStorageProvider,
+		secretLock:      kmsConfig.PrimaryKeyLock,
+	})
+	require.NoError(t, err)
+
+	rotator, err := kms.NewPrimaryKeyRotator(kmsConfig)
+	require.NoError(t, err)
+
+	result, err := rotator.Rotate()
+	require.NoError(t, err)
+	require.NotNil(t, result)
+
+	var out bytes.Buffer
+
+	require.NoError(t, printRotationResult(&out, result))
+	require.Equal(t, "Primary key rotated: 0 keysets re-encrypted, 0 skipped, 0 foreign\n", out.String())
+}
+
+func TestPrintRotationResult(t *testing.T) {
+	var out bytes.Buffer
+
+	require.NoError(t, printRotationResult(&out, &lock.RotationResult{Reencrypted: 3, Skipped: 2, Foreign: 1}))
+	require.Equal(t, "Primary key rotated: 3 keysets re-encrypted, 2 skipped, 1 foreign\n", out.String())
+}
+
+func rotateArgs(keyManagerStorageType string) []string {
+	return []string{
+		"--" + primaryKeyDatabaseTypeFlagName, storageTypeMemOption,
+		"--" + keyManagerStorageTypeFlagName, keyManagerStorageType,
+	}
+}
@@ -0,0 +1,283 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package startcmd
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strconv"
+
+	"github.com/hyperledger/aries-framework-go/pkg/secretlock"
+	"github.com/hyperledger/aries-framework-go/pkg/secretlock/local"
+	"github.com/spf13/cobra"
+	cmdutils "github.com/trustbloc/edge-core/pkg/utils/cmd"
+
+	"github.com/trustbloc/hub-kms/pkg/secretlock/keyfile"
+	"github.com/trustbloc/hub-kms/pkg/secretlock/pkcs11lock"
+	"github.com/trustbloc/hub-kms/pkg/secretlock/vaultlock"
+)
+
+// Secret lock that protects primary keys.
+const (
+	secretLockTypeFlagName  = "secret-lock-type"
+	secretLockTypeEnvKey    = "KMS_SECRET_LOCK_TYPE"
+	secretLockTypeFlagUsage = "The type of secret lock that protects primary keys. Supported options: local, " +
+		"vault, pkcs11. Defaults to local. " + commonEnvVarUsageText + secretLockTypeEnvKey
+
+	secretLockKeyPathFlagName  = "secret-lock-key-path"
+	secretLockKeyPathEnvKey    = "KMS_SECRET_LOCK_KEY_PATH" //nolint:gosec // not hard-coded credentials
+	secretLockKeyPathFlagUsage = "The path to the file with key to be used by local secret lock. If missing noop " +
+		"service lock is used. The file is either a raw base64 key or a passphrase-protected key file created by " +
+		"the masterkey command. " + commonEnvVarUsageText + secretLockKeyPathEnvKey
+
+	secretLockKeyPassphraseFDFlagName  = "secret-lock-key-passphrase-fd"
+	secretLockKeyPassphraseFDEnvKey    = "KMS_SECRET_LOCK_KEY_PASSPHRASE_FD"
+	secretLockKeyPassphraseFDFlagUsage = "The file descriptor to read the passphrase of the protected key file " +
+		"from. The passphrase is taken from " + secretLockKeyPassphraseEnvKey + " environment variable if set, " +
+		"otherwise it is prompted for. " + commonEnvVarUsageText + secretLockKeyPassphraseFDEnvKey
+
+	// secretLockKeyPassphraseEnvKey has no flag, so the passphrase is not exposed in the process arguments
+	secretLockKeyPassphraseEnvKey = "KMS_SECRET_LOCK_KEY_PASSPHRASE" //nolint:gosec // not hard-coded credentials
+
+	vaultURLFlagName  = "vault-url"
+	vaultURLEnvKey    = "KMS_VAULT_URL"
+	vaultURLFlagUsage = "The URL of the Vault server used by the vault secret lock. " +
+		commonEnvVarUsageText + vaultURLEnvKey
+
+	vaultTransitKeyFlagName  = "vault-transit-key"
+	vaultTransitKeyEnvKey    = "KMS_VAULT_TRANSIT_KEY"
+	vaultTransitKeyFlagUsage = "The name of the key in the Vault Transit engine that encrypts primary keys. " +
+		commonEnvVarUsageText + vaultTransitKeyEnvKey
+
+	vaultTransitMountFlagName  = "vault-transit-mount-path"
+	vaultTransitMountEnvKey    = "KMS_VAULT_TRANSIT_MOUNT_PATH"
+	vaultTransitMountFlagUsage = "The path the Vault Transit engine is mounted at. Defaults to transit. " +
+		commonEnvVarUsageText + vaultTransitMountEnvKey
+
+	vaultTokenFlagName  = "vault-token"     //nolint:gosec // not hard-coded credentials
+	vaultTokenEnvKey    = "KMS_VAULT_TOKEN" //nolint:gosec // not hard-coded credentials
+	vaultTokenFlagUsage = "The token used to authenticate to Vault. Either the token or AppRole credentials " +
+		"must be set. " + commonEnvVarUsageText + vaultTokenEnvKey
+
+	vaultRoleIDFlagName  = "vault-approle-role-id"
+	vaultRoleIDEnvKey    = "KMS_VAULT_APPROLE_ROLE_ID"
+	vaultRoleIDFlagUsage = "The role ID used to authenticate to Vault with AppRole. " +
+		commonEnvVarUsageText + vaultRoleIDEnvKey
+
+	vaultSecretIDFlagName  = "vault-approle-secret-id"     //nolint:gosec // not hard-coded credentials
+	vaultSecretIDEnvKey    = "KMS_VAULT_APPROLE_SECRET_ID" //nolint:gosec // not hard-coded credentials
+	vaultSecretIDFlagUsage = "The secret ID used to authenticate to Vault with AppRole. " +
+		commonEnvVarUsageText + vaultSecretIDEnvKey
+
+	pkcs11ModulePathFlagName  = "pkcs11-module-path"
+	pkcs11ModulePathEnvKey    = "KMS_PKCS11_MODULE_PATH"
+	pkcs11ModulePathFlagUsage = "The path to the PKCS#11 library of the HSM used by the pkcs11 secret lock. " +
+		commonEnvVarUsageText + pkcs11ModulePathEnvKey
+
+	pkcs11SlotFlagName  = "pkcs11-slot"
+	pkcs11SlotEnvKey    = "KMS_PKCS11_SLOT"
+	pkcs11SlotFlagUsage = "The ID of the HSM slot with the token. " + commonEnvVarUsageText + pkcs11SlotEnvKey
+
+	pkcs11PINFlagName  = "pkcs11-pin"
+	pkcs11PINEnvKey    = "KMS_PKCS11_PIN"
+	pkcs11PINFlagUsage = "The user PIN of the HSM token. " + commonEnvVarUsageText + pkcs11PINEnvKey
+
+	pkcs11KeyLabelFlagName  = "pkcs11-key-label"
+	pkcs11KeyLabelEnvKey    = "KMS_PKCS11_KEY_LABEL"
+	pkcs11KeyLabelFlagUsage = "The label of the AES key in the HSM token that encrypts primary keys. " +
+		commonEnvVarUsageText + pkcs11KeyLabelEnvKey
+)
+
+const (
+	secretLockTypeLocalOption  = "local"
+	secretLockTypeVaultOption  = "vault"
+	secretLockTypePKCS11Option = "pkcs11"
+)
+
+type secretLockParameters struct {
+	lockType   string
+	keyPath    string
+	passphrase *passphraseSource
+	vault      *vaultlock.Config
+	pkcs11     *pkcs11lock.Config
+}
+
+func addSecretLockFlags(cmd *cobra.Command) {
+	cmd.Flags().StringP(secretLockTypeFlagName, "", "", secretLockTypeFlagUsage)
+	cmd.Flags().StringP(secretLockKeyPathFlagName, "", "", secretLockKeyPathFlagUsage)
+	cmd.Flags().StringP(secretLockKeyPassphraseFDFlagName, "", "", secretLockKeyPassphraseFDFlagUsage)
+	cmd.Flags().StringP(vaultURLFlagName, "", "", vaultURLFlagUsage)
+	cmd.Flags().StringP(vaultTransitKeyFlagName, "", "", vaultTransitKeyFlagUsage)
+	cmd.Flags().StringP(vaultTransitMountFlagName, "", "", vaultTransitMountFlagUsage)
+	cmd.Flags().StringP(vaultTokenFlagName, "", "", vaultTokenFlagUsage)
+	cmd.Flags().StringP(vaultRoleIDFlagName, "", "", vaultRoleIDFlagUsage)
+	cmd.Flags().StringP(vaultSecretIDFlagName, "", "", vaultSecretIDFlagUsage)
+	cmd.Flags().StringP(pkcs11ModulePathFlagName, "", "", pkcs11ModulePathFlagUsage)
+	cmd.Flags().StringP(pkcs11SlotFlagName, "", "", pkcs11SlotFlagUsage)
+	cmd.Flags().StringP(pkcs11PINFlagName, "", "", pkcs11PINFlagUsage)
+	cmd.Flags().StringP(pkcs11KeyLabelFlagName, "", "", pkcs11KeyLabelFlagUsage)
+}
+
+func getSecretLockParameters(cmd *cobra.Command) (*secretLockParameters, error) {
+	lockType := cmdutils.GetUserSetOptionalVarFromString(cmd, secretLockTypeFlagName, secretLockTypeEnvKey)
+
+	switch lockType {
+	case "", secretLockTypeLocalOption:
+		keyPath, err := cmdutils.GetUserSetVarFromString(cmd, secretLockKeyPathFlagName, secretLockKeyPathEnvKey, true)
+		if err != nil {
+			return nil, err
+		}
+
+		passphrase, err := getKeyPassphraseSource(cmd)
+		if err != nil {
+			return nil, err
+		}
+
+		return &secretLockParameters{
+			lockType:   secretLockTypeLocalOption,
+			keyPath:    keyPath,
+			passphrase: passphrase,
+		}, nil
+	case secretLockTypeVaultOption:
+		return getVaultParameters(cmd)
+	case secretLockTypePKCS11Option:
+		return getPKCS11Parameters(cmd)
+	default:
+		return nil, fmt.Errorf("unsupported %s: %s", secretLockTypeFlagName, lockType)
+	}
+}
+
+func getVaultParameters(cmd *cobra.Command) (*secretLockParameters, error) {
+	vaultURL, err := cmdutils.GetUserSetVarFromString(cmd, vaultURLFlagName, vaultURLEnvKey, false)
+	if err != nil {
+		return nil, err
+	}
+
+	transitKey, err := cmdutils.GetUserSetVarFromString(cmd, vaultTransitKeyFlagName, vaultTransitKeyEnvKey, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return &secretLockParameters{
+		lockType: secretLockTypeVaultOption,
+		vault: &vaultlock.Config{
+			URL:       vaultURL,
+			KeyName:   transitKey,
+			MountPath: cmdutils.GetUserSetOptionalVarFromString(cmd, vaultTransitMountFlagName, vaultTransitMountEnvKey),
+			Token:     cmdutils.GetUserSetOptionalVarFromString(cmd, vaultTokenFlagName, vaultTokenEnvKey),
+			RoleID:    cmdutils.GetUserSetOptionalVarFromString(cmd, vaultRoleIDFlagName, vaultRoleIDEnvKey),
+			SecretID:  cmdutils.GetUserSetOptionalVarFromString(cmd, vaultSecretIDFlagName, vaultSecretIDEnvKey),
+		},
+	}, nil
+}
+
+func getPKCS11Parameters(cmd *cobra.Command) (*secretLockParameters, error) {
+	modulePath, err := cmdutils.GetUserSetVarFromString(cmd, pkcs11ModulePathFlagName, pkcs11ModulePathEnvKey, false)
+	if err != nil {
+		return nil, err
+	}
+
+	slotStr, err := cmdutils.GetUserSetVarFromString(cmd, pkcs11SlotFlagName, pkcs11SlotEnvKey, false)
+	if err != nil {
+		return nil, err
+	}
+
+	slot, err := strconv.ParseUint(slotStr, 10, 0)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %s", pkcs11SlotFlagName, slotStr)
+	}
+
+	pin, err := cmdutils.GetUserSetVarFromString(cmd, pkcs11PINFlagName, pkcs11PINEnvKey, false)
+	if err != nil {
+		return nil, err
+	}
+
+	keyLabel, err := cmdutils.GetUserSetVarFromString(cmd, pkcs11KeyLabelFlagName, pkcs11KeyLabelEnvKey, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return &secretLockParameters{
+		lockType: secretLockTypePKCS11Option,
+		pkcs11: &pkcs11lock.Config{
+			ModulePath: modulePath,
+			Slot:       uint(slot),
+			PIN:        pin,
+			KeyLabel:   keyLabel,
+		},
+	}, nil
+}
+
+// prepareMasterLock returns the secret lock that encrypts primary keys.
+func prepareMasterLock(params *secretLockParameters, tlsConfig *tls.Config) (secretlock.Service, error) {
+	switch params.lockType {
+	case secretLockTypeVaultOption:
+		vaultLock, err := vaultlock.New(params.vault, vaultlock.WithHTTPClient(&http.Client{
+			Transport: &http.Transport{TLSClientConfig: tlsConfig},
+		}))
+		if err != nil {
+			return nil, err
+		}
+
+		return vaultLock, nil
+	case secretLockTypePKCS11Option:
+		// the lock stays open for the lifetime of the process
+		pkcs11Lock, err := pkcs11lock.New(params.pkcs11)
+		if err != nil {
+			return nil, err
+		}
+
+		return pkcs11Lock, nil
+	}
+
+	primaryKeyReader, err := readMasterKey(params.keyPath, params.passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	return local.NewService(primaryKeyReader, nil)
+}
+
+func getKeyPassphraseSource(cmd *cobra.Command) (*passphraseSource, error) {
+	return getPassphraseSource(cmd, secretLockKeyPassphraseFDFlagName, secretLockKeyPassphraseFDEnvKey,
+		secretLockKeyPassphraseEnvKey, "master key passphrase")
+}
+
+// readMasterKey returns the reader of the master key for the local secret lock. Raw keys are read as is,
+// protected key files are decrypted with the passphrase.
+func readMasterKey(path string, passphrase *passphraseSource) (io.Reader, error) {
+	data, err := ioutil.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, err
+	}
+
+	if !keyfile.IsEncrypted(data) {
+		return local.MasterKeyFromPath(path)
+	}
+
+	p, err := passphrase.read()
+	if err != nil {
+		return nil, err
+	}
+
+	defer keyfile.Zeroize(p)
+
+	key, err := keyfile.Decrypt(data, p)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt master key file %s: %w", path, err)
+	}
+
+	defer keyfile.Zeroize(key)
+
+	return bytes.NewReader([]byte(base64.URLEncoding.EncodeToString(key))), nil
+}
@@ -0,0 +1,167 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package startcmd
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStartCmdWithVaultSecretLock(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(fakeTransit))
+	defer srv.Close()
+
+	t.Run("Success with vault token", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := requiredArgs()
+		args = append(args, "--"+secretLockTypeFlagName, secretLockTypeVaultOption,
+			"--"+vaultURLFlagName, srv.URL,
+			"--"+vaultTransitKeyFlagName, "hub-kms",
+			"--"+vaultTokenFlagName, "token")
+
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.NoError(t, err)
+	})
+
+	t.Run("Fail without vault URL", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := requiredArgs()
+		args = append(args, "--"+secretLockTypeFlagName, secretLockTypeVaultOption,
+			"--"+vaultTransitKeyFlagName, "hub-kms",
+			"--"+vaultTokenFlagName, "token")
+
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.EqualError(t, err, "Neither vault-url (command line flag) nor KMS_VAULT_URL (environment variable) "+
+			"have been set.")
+	})
+
+	t.Run("Fail without vault credentials", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := requiredArgs()
+		args = append(args, "--"+secretLockTypeFlagName, secretLockTypeVaultOption,
+			"--"+vaultURLFlagName, srv.URL,
+			"--"+vaultTransitKeyFlagName, "hub-kms")
+
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.EqualError(t, err, "either vault token or AppRole role ID and secret ID are required")
+	})
+
+	t.Run("Fail if vault rejects token", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := requiredArgs()
+		args = append(args, "--"+secretLockTypeFlagName, secretLockTypeVaultOption,
+			"--"+vaultURLFlagName, srv.URL,
+			"--"+vaultTransitKeyFlagName, "hub-kms",
+			"--"+vaultTokenFlagName, "invalid")
+
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "vault encrypt: vault returned status 403")
+	})
+
+	t.Run("Fail with unsupported secret lock type", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := requiredArgs()
+		args = append(args, "--"+secretLockTypeFlagName, "hsm")
+
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.EqualError(t, err, "unsupported secret-lock-type: hsm")
+	})
+}
+
+// fakeTransit imitates the Vault Transit engine, it encrypts by adding a prefix to the plaintext.
+func fakeTransit(rw http.ResponseWriter, req *http.Request) {
+	if req.Header.Get("X-Vault-Token") != "token" {
+		rw.WriteHeader(http.StatusForbidden)
+
+		return
+	}
+
+	var body map[string]string
+
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		rw.WriteHeader(http.StatusBadRequest)
+
+		return
+	}
+
+	var data map[string]string
+
+	switch req.URL.Path {
+	case "/v1/transit/encrypt/hub-kms":
+		data = map[string]string{"ciphertext": "vault:v1:" + body["plaintext"]}
+	case "/v1/transit/decrypt/hub-kms":
+		data = map[string]string{"plaintext": strings.TrimPrefix(body["ciphertext"], "vault:v1:")}
+	default:
+		rw.WriteHeader(http.StatusNotFound)
+
+		return
+	}
+
+	_ = json.NewEncoder(rw).Encode(map[string]interface{}{"data": data})
+}
+
+func TestStartCmdWithPKCS11SecretLock(t *testing.T) {
+	pkcs11Args := func(slot string) []string {
+		return append(requiredArgs(), "--"+secretLockTypeFlagName, secretLockTypePKCS11Option,
+			"--"+pkcs11ModulePathFlagName, "/invalid/libpkcs11.so",
+			"--"+pkcs11SlotFlagName, slot,
+			"--"+pkcs11PINFlagName, "1234",
+			"--"+pkcs11KeyLabelFlagName, "hub-kms")
+	}
+
+	t.Run("Fail to load PKCS#11 module", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+		startCmd.SetArgs(pkcs11Args("0"))
+
+		err := startCmd.Execute()
+		require.EqualError(t, err, "load PKCS#11 module /invalid/libpkcs11.so")
+	})
+
+	t.Run("Fail with invalid slot", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+		startCmd.SetArgs(pkcs11Args("first"))
+
+		err := startCmd.Execute()
+		require.EqualError(t, err, "invalid pkcs11-slot: first")
+	})
+
+	t.Run("Fail without PIN", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := requiredArgs()
+		args = append(args, "--"+secretLockTypeFlagName, secretLockTypePKCS11Option,
+			"--"+pkcs11ModulePathFlagName, "/invalid/libpkcs11.so",
+			"--"+pkcs11SlotFlagName, "0")
+
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.EqualError(t, err, "Neither pkcs11-pin (command line flag) nor KMS_PKCS11_PIN (environment variable) "+
+			"have been set.")
+	})
+}
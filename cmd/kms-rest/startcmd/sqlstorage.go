@@ -0,0 +1,100 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package startcmd
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+	cmdutils "github.com/trustbloc/edge-core/pkg/utils/cmd"
+
+	"github.com/trustbloc/hub-kms/pkg/storage/sqlstore"
+)
+
+// Connection pool of SQL databases (postgres and mysql storage types).
+const (
+	sqlMaxOpenConnsFlagName  = "sql-max-open-conns"
+	sqlMaxOpenConnsEnvKey    = "KMS_SQL_MAX_OPEN_CONNS"
+	sqlMaxOpenConnsFlagUsage = "The maximum number of open connections to each SQL database. Defaults to unlimited. " +
+		commonEnvVarUsageText + sqlMaxOpenConnsEnvKey
+
+	sqlMaxIdleConnsFlagName  = "sql-max-idle-conns"
+	sqlMaxIdleConnsEnvKey    = "KMS_SQL_MAX_IDLE_CONNS"
+	sqlMaxIdleConnsFlagUsage = "The maximum number of idle connections kept in the pool of each SQL database. " +
+		"Defaults to 2. " + commonEnvVarUsageText + sqlMaxIdleConnsEnvKey
+
+	sqlConnMaxLifetimeFlagName  = "sql-conn-max-lifetime"
+	sqlConnMaxLifetimeEnvKey    = "KMS_SQL_CONN_MAX_LIFETIME"
+	sqlConnMaxLifetimeFlagUsage = "The maximum amount of time a SQL database connection may be reused, e.g. 30m. " +
+		"Defaults to unlimited. " + commonEnvVarUsageText + sqlConnMaxLifetimeEnvKey
+)
+
+type sqlPoolParameters struct {
+	maxOpenConns    int
+	maxIdleConns    int
+	connMaxLifetime time.Duration
+}
+
+func addSQLPoolFlags(cmd *cobra.Command) {
+	cmd.Flags().StringP(sqlMaxOpenConnsFlagName, "", "", sqlMaxOpenConnsFlagUsage)
+	cmd.Flags().StringP(sqlMaxIdleConnsFlagName, "", "", sqlMaxIdleConnsFlagUsage)
+	cmd.Flags().StringP(sqlConnMaxLifetimeFlagName, "", "", sqlConnMaxLifetimeFlagUsage)
+}
+
+func getSQLPoolParameters(cmd *cobra.Command) (*sqlPoolParameters, error) {
+	maxOpenConns, err := getNonNegativeInt(cmd, sqlMaxOpenConnsFlagName, sqlMaxOpenConnsEnvKey)
+	if err != nil {
+		return nil, err
+	}
+
+	maxIdleConns, err := getNonNegativeInt(cmd, sqlMaxIdleConnsFlagName, sqlMaxIdleConnsEnvKey)
+	if err != nil {
+		return nil, err
+	}
+
+	connMaxLifetime, err := getDuration(cmd, sqlConnMaxLifetimeFlagName, sqlConnMaxLifetimeEnvKey, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sqlPoolParameters{
+		maxOpenConns:    maxOpenConns,
+		maxIdleConns:    maxIdleConns,
+		connMaxLifetime: connMaxLifetime,
+	}, nil
+}
+
+// getNonNegativeInt returns the non-negative integer set with the flag or environment variable, or zero.
+func getNonNegativeInt(cmd *cobra.Command, flagName, envKey string) (int, error) {
+	v := cmdutils.GetUserSetOptionalVarFromString(cmd, flagName, envKey)
+	if v == "" {
+		return 0, nil
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid %s: %s", flagName, v)
+	}
+
+	return n, nil
+}
+
+func prepareSQLStorageProvider(params *storageParameters) (*sqlstore.Provider, error) {
+	opts := []sqlstore.Option{sqlstore.WithDBPrefix(params.storagePrefix)}
+
+	if pool := params.sqlPool; pool != nil {
+		opts = append(opts,
+			sqlstore.WithMaxOpenConns(pool.maxOpenConns),
+			sqlstore.WithMaxIdleConns(pool.maxIdleConns),
+			sqlstore.WithConnMaxLifetime(pool.connMaxLifetime),
+		)
+	}
+
+	return sqlstore.NewProvider(params.storageType, params.storageURL, opts...)
+}
@@ -9,17 +9,22 @@ package startcmd
 import (
 	"crypto/rand"
 	"crypto/sha256"
+	"crypto/tls"
 	"encoding/base64"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"os"
 	"testing"
+	"time"
 
+	"github.com/gorilla/mux"
 	"github.com/spf13/cobra"
 	"github.com/stretchr/testify/require"
 	"github.com/trustbloc/edge-core/pkg/log"
 	"github.com/trustbloc/edge-core/pkg/log/mocklogger"
+
+	"github.com/trustbloc/hub-kms/pkg/kms"
 )
 
 const (
@@ -32,7 +37,7 @@ const (
 
 type mockServer struct{}
 
-func (s *mockServer) ListenAndServe(host, certFile, keyFile string, router http.Handler) error {
+func (s *mockServer) ListenAndServe(host, certFile, keyFile string, tlsConfig *tls.Config, router http.Handler) error {
 	return nil
 }
 
@@ -43,14 +48,14 @@ func (s *mockServer) Logger() log.Logger {
 func TestListenAndServe(t *testing.T) {
 	t.Run("test wrong host", func(t *testing.T) {
 		var w httpServer
-		err := w.ListenAndServe("wronghost", "", "", nil)
+		err := w.ListenAndServe("wronghost", "", "", nil, nil)
 		require.Error(t, err)
 		require.Contains(t, err.Error(), "address wronghost: missing port in address")
 	})
 
 	t.Run("test invalid key file", func(t *testing.T) {
 		var w httpServer
-		err := w.ListenAndServe("localhost:8080", "test.key", "test.cert", nil)
+		err := w.ListenAndServe("localhost:8080", "test.key", "test.cert", nil, nil)
 		require.Error(t, err)
 		require.Contains(t, err.Error(), "open test.key: no such file or directory")
 	})
@@ -359,6 +364,454 @@ func TestStartCmdWithEnableCORSParam(t *testing.T) {
 	})
 }
 
+func TestStartCmdWithZCAPParams(t *testing.T) {
+	t.Run("Success with P-256 key type and multiple signature suites", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := requiredArgs()
+		args = append(args, "--"+zcapKeyTypeFlagName, "ECDSAP256IEEEP1363",
+			"--"+zcapSignatureSuitesFlagName, "JsonWebSignature2020",
+			"--"+zcapSignatureSuitesFlagName, "EcdsaSecp256k1Signature2019")
+
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.NoError(t, err)
+	})
+
+	t.Run("Success with secp256k1 key type", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := requiredArgs()
+		args = append(args, "--"+zcapKeyTypeFlagName, "ECDSASecp256k1IEEEP1363")
+
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.NoError(t, err)
+	})
+
+	t.Run("Fail with unsupported key type", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := requiredArgs()
+		args = append(args, "--"+zcapKeyTypeFlagName, "RSARS256")
+
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "unsupported key type for signing zcaps")
+	})
+
+	t.Run("Fail with unsupported signature suite", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := requiredArgs()
+		args = append(args, "--"+zcapSignatureSuitesFlagName, "invalid")
+
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "unsupported signature suite")
+	})
+
+	t.Run("Success with did-cache-ttl set", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := requiredArgs()
+		args = append(args, "--"+didCacheTTLFlagName, "1m")
+
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.NoError(t, err)
+	})
+
+	t.Run("Fail with invalid did-cache-ttl duration string", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := requiredArgs()
+		args = append(args, "--"+didCacheTTLFlagName, "invalid")
+
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "invalid did-cache-ttl")
+	})
+
+	t.Run("Fail when signature suites do not include signing suite", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := requiredArgs()
+		args = append(args, "--"+zcapSignatureSuitesFlagName, "JsonWebSignature2020")
+
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "must include Ed25519Signature2018")
+	})
+
+	t.Run("Success with HTTP signature clock skew and database replay cache", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := requiredArgs()
+		args = append(args, "--"+httpSigClockSkewFlagName, "1m",
+			"--"+httpSigReplayCacheFlagName, replayCacheDatabaseOption)
+
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.NoError(t, err)
+	})
+
+	t.Run("Fail with invalid HTTP signature clock skew", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := requiredArgs()
+		args = append(args, "--"+httpSigClockSkewFlagName, "-1m")
+
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "invalid http-sig-clock-skew")
+	})
+
+	t.Run("Fail with unsupported replay cache", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := requiredArgs()
+		args = append(args, "--"+httpSigReplayCacheFlagName, "redis")
+
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "unsupported http-sig-replay-cache: redis")
+	})
+}
+
+func TestStartCmdWithOAuth2Params(t *testing.T) {
+	t.Run("Success with JWKS URL", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := requiredArgs()
+		args = append(args, "--"+oauth2JWKSFlagName, "https://issuer.example.com/jwks",
+			"--"+oauth2IssuerFlagName, "https://issuer.example.com",
+			"--"+oauth2AudienceFlagName, "hub-kms",
+			"--"+oauth2RequiredScopesFlagName, "keystore:create")
+
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.NoError(t, err)
+	})
+
+	t.Run("Fail with invalid JWKS file", func(t *testing.T) {
+		file, closeFunc := createKeyFile(t, true)
+		defer closeFunc()
+
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := requiredArgs()
+		args = append(args, "--"+oauth2JWKSFlagName, file)
+
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to parse JWKS")
+	})
+}
+
+func TestStartCmdWithUserAssertionParams(t *testing.T) {
+	t.Run("Success with JWKS URL", func(t *testing.T) {
+		params := kmsRestParams(t)
+		params.userAssertionParams.jwks = "https://issuer.example.com/jwks"
+		params.userAssertionParams.issuer = "https://issuer.example.com"
+
+		_, kmsConfig, err := prepareOperationConfig(params)
+		require.NoError(t, err)
+		require.NotNil(t, kmsConfig.UserAssertionValidator)
+	})
+
+	t.Run("Fail without issuer", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := requiredArgs()
+		args = append(args, "--"+userAssertionJWKSFlagName, "https://issuer.example.com/jwks")
+
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.EqualError(t, err, "user-assertion-issuer is required with user-assertion-jwks")
+	})
+
+	t.Run("Fail with invalid JWKS file", func(t *testing.T) {
+		file, closeFunc := createKeyFile(t, true)
+		defer closeFunc()
+
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := requiredArgs()
+		args = append(args, "--"+userAssertionJWKSFlagName, file,
+			"--"+userAssertionIssuerFlagName, "https://issuer.example.com")
+
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "user assertion validator: failed to parse JWKS")
+	})
+}
+
+func TestStartCmdWithMTLSParams(t *testing.T) {
+	t.Run("Success with mTLS client auth", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := requiredArgs()
+		args = append(args, "--"+tlsServeCertPathFlagName, "cert.pem",
+			"--"+tlsServeKeyPathFlagName, "key.pem",
+			"--"+mtlsClientAuthFlagName, "true",
+			"--"+mtlsIdentityFlagName, "subject")
+
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.NoError(t, err)
+	})
+
+	t.Run("Fail without TLS serve cert and key", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := requiredArgs()
+		args = append(args, "--"+mtlsClientAuthFlagName, "true")
+
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "mtls-client-auth requires tls-serve-cert and tls-serve-key")
+	})
+
+	t.Run("Fail with unsupported mTLS identity", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := requiredArgs()
+		args = append(args, "--"+tlsServeCertPathFlagName, "cert.pem",
+			"--"+tlsServeKeyPathFlagName, "key.pem",
+			"--"+mtlsClientAuthFlagName, "true",
+			"--"+mtlsIdentityFlagName, "email")
+
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "unsupported mtls-identity: email")
+	})
+}
+
+func TestStartCmdWithAdminAPITokenParam(t *testing.T) {
+	startCmd := GetStartCmd(&mockServer{})
+
+	args := requiredArgs()
+	args = append(args, "--"+adminAPITokenFlagName, "token")
+
+	startCmd.SetArgs(args)
+
+	err := startCmd.Execute()
+	require.NoError(t, err)
+}
+
+func TestStartCmdWithSecretShareParams(t *testing.T) {
+	t.Run("Success with all share providers", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := requiredArgs()
+		args = append(args, "--"+secretShareProviderFlagName, shareProviderHTTPS,
+			"--"+secretSharePathFlagName, "shares",
+			"--"+secretShareEnvFlagName, "KMS_SECRET_SHARE",
+			"--"+secretShareURLFlagName, "https://shares.example.com",
+			"--"+secretShareOAuth2TokenURLFlagName, "https://oauth2.example.com/token",
+			"--"+secretShareOAuth2ClientIDFlagName, "client",
+			"--"+secretShareOAuth2ClientSecretFlagName, "secret",
+			"--"+secretShareOAuth2ScopesFlagName, "shares",
+			"--"+peerKMSURLFlagName, "https://kms.example.com",
+			"--"+peerKMSAPITokenFlagName, "token",
+			"--"+adminAPITokenFlagName, "token")
+
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.NoError(t, err)
+	})
+
+	t.Run("Success with hub-auth share provider", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := requiredArgs()
+		args = append(args, "--"+secretShareProviderFlagName, "hub-auth",
+			"--"+hubAuthURLFlagName, "https://hub-auth.example.com")
+
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.NoError(t, err)
+	})
+
+	t.Run("Fail with not configured share provider", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := requiredArgs()
+		args = append(args, "--"+secretShareProviderFlagName, shareProviderEnv)
+
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "secret share provider env is not supported or not configured")
+	})
+
+	t.Run("Fail with unsupported share provider", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := requiredArgs()
+		args = append(args, "--"+secretShareProviderFlagName, "invalid")
+
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "secret share provider invalid is not supported or not configured")
+	})
+}
+
+func TestStartCmdWithHubAuthRetryParams(t *testing.T) {
+	t.Run("Success with retry params set", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := requiredArgs()
+		args = append(args, "--"+hubAuthURLFlagName, "https://hub-auth.example.com",
+			"--"+hubAuthMaxRetriesFlagName, "3",
+			"--"+hubAuthRetryBackoffFlagName, "50ms",
+			"--"+hubAuthCircuitBreakerFlagName, "0")
+
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.NoError(t, err)
+	})
+
+	t.Run("Defaults", func(t *testing.T) {
+		params := kmsRestParams(t)
+
+		require.Equal(t, defaultHubAuthMaxRetries, params.hubAuthRetryParams.maxRetries)
+		require.Equal(t, defaultHubAuthRetryBackoff, params.hubAuthRetryParams.backoff)
+		require.Equal(t, defaultHubAuthCircuitBreakerOpen, params.hubAuthRetryParams.openInterval)
+	})
+
+	tests := []struct {
+		flag  string
+		value string
+	}{
+		{flag: hubAuthMaxRetriesFlagName, value: "-1"},
+		{flag: hubAuthMaxRetriesFlagName, value: "many"},
+		{flag: hubAuthRetryBackoffFlagName, value: "soon"},
+		{flag: hubAuthCircuitBreakerFlagName, value: "-1s"},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run("Fail with invalid "+tc.flag+" "+tc.value, func(t *testing.T) {
+			startCmd := GetStartCmd(&mockServer{})
+
+			args := requiredArgs()
+			args = append(args, "--"+tc.flag, tc.value)
+
+			startCmd.SetArgs(args)
+
+			err := startCmd.Execute()
+			require.EqualError(t, err, fmt.Sprintf("invalid %s: %s", tc.flag, tc.value))
+		})
+	}
+}
+
+func TestStartCmdWithKeystoreSessionTTL(t *testing.T) {
+	t.Run("Defaults to 5m", func(t *testing.T) {
+		params := kmsRestParams(t)
+
+		require.Equal(t, kms.DefaultSessionTTL, params.sessionTTL)
+	})
+
+	t.Run("Success", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := requiredArgs()
+		args = append(args, "--"+keystoreSessionTTLFlagName, "30s")
+
+		require.NoError(t, startCmd.ParseFlags(args))
+
+		params, err := getKmsRestParameters(startCmd)
+		require.NoError(t, err)
+		require.Equal(t, 30*time.Second, params.sessionTTL)
+	})
+
+	t.Run("Fail with invalid value", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := requiredArgs()
+		args = append(args, "--"+keystoreSessionTTLFlagName, "later")
+
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.EqualError(t, err, "invalid keystore-session-ttl: later")
+	})
+}
+
+func TestPrepareKMSConfigWithSecretShareProvider(t *testing.T) {
+	params := kmsRestParams(t)
+	params.shareParams.provider = shareProviderEnv
+	params.shareParams.envKey = "KMS_SECRET_SHARE"
+
+	_, kmsConfig, err := prepareOperationConfig(params)
+	require.NoError(t, err)
+	require.NotNil(t, kmsConfig.SecretShareProvider)
+	require.Equal(t, kmsConfig.ShareProviders[shareProviderEnv], kmsConfig.SecretShareProvider)
+}
+
+func TestAddAdminHandlers(t *testing.T) {
+	params := kmsRestParams(t)
+	params.shareParams.path = "shares"
+	params.shareParams.peerKMSURL = "https://kms.example.com"
+
+	_, kmsConfig, err := prepareOperationConfig(params)
+	require.NoError(t, err)
+	require.Len(t, kmsConfig.ShareProviders, 2)
+
+	router := mux.NewRouter()
+
+	err = addAdminHandlers(router, kmsConfig, "token", false, &mocklogger.MockLogger{})
+	require.NoError(t, err)
+
+	var paths []string
+
+	err = router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		path, e := route.GetPathTemplate()
+		paths = append(paths, path)
+
+		return e
+	})
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{
+		"/admin/primarykey/rotate", "/admin/shares/{keystoreID}", "/admin/shares/{keystoreID}",
+	}, paths, "shares are served and stored")
+}
+
 func TestStartCmdWithCacheExpirationParam(t *testing.T) {
 	t.Run("Success with cache-expiration set", func(t *testing.T) {
 		startCmd := GetStartCmd(&mockServer{})
@@ -407,6 +860,35 @@ func TestStartKMSService(t *testing.T) {
 		require.NoError(t, err)
 	})
 
+	t.Run("Success with bolt storage", func(t *testing.T) {
+		dir := t.TempDir()
+
+		params := kmsRestParams(t)
+
+		for _, p := range []*storageParameters{
+			params.storageParams,
+			params.primaryKeyStorageParams,
+			params.localKMSStorageParams,
+			params.keyManagerStorageParams,
+		} {
+			p.storageType = storageTypeBoltOption
+			p.storageURL = dir
+		}
+
+		params.keyManagerStorageParams.storagePrefix = "km"
+
+		err := startKmsService(params, &mockServer{})
+		require.NoError(t, err)
+	})
+
+	t.Run("Fail with bolt storage without data directory", func(t *testing.T) {
+		params := kmsRestParams(t)
+		params.storageParams.storageType = storageTypeBoltOption
+
+		err := startKmsService(params, &mockServer{})
+		require.EqualError(t, err, "data directory is required")
+	})
+
 	t.Run("Fail with invalid storage option", func(t *testing.T) {
 		params := kmsRestParams(t)
 		params.storageParams.storageType = invalidStorageOption
@@ -430,6 +912,15 @@ func TestStartKMSService(t *testing.T) {
 		err := startKmsService(params, &mockServer{})
 		require.Error(t, err)
 	})
+
+	t.Run("Rotation API is disabled if primary key rotation is not supported", func(t *testing.T) {
+		params := kmsRestParams(t)
+		params.adminAPIToken = "token"
+		params.hubAuthURL = "https://hub-auth.example.com"
+
+		err := startKmsService(params, &mockServer{})
+		require.NoError(t, err)
+	})
 }
 
 func requiredArgs() []string {
@@ -7,17 +7,28 @@ module github.com/trustbloc/hub-kms
 go 1.15
 
 require (
+	github.com/DATA-DOG/go-sqlmock v1.5.0
+	github.com/alicebob/miniredis/v2 v2.30.0
 	github.com/bluele/gcache v0.0.0-20190518031135-bc40bd653833
+	github.com/btcsuite/btcd v0.20.1-beta
+	github.com/btcsuite/btcutil v1.0.1
 	github.com/cenkalti/backoff/v4 v4.1.0 // indirect
+	github.com/go-sql-driver/mysql v1.5.0
+	github.com/gomodule/redigo v1.8.2
 	github.com/google/tink/go v1.5.0
 	github.com/google/uuid v1.1.2
 	github.com/gorilla/mux v1.8.0
 	github.com/hyperledger/aries-framework-go v0.1.6-0.20201223142031-ac4ce368a9c8
 	github.com/igor-pavlenko/httpsignatures-go v0.0.21
+	github.com/lib/pq v1.9.0
+	github.com/miekg/pkcs11 v1.1.1
 	github.com/piprate/json-gold v0.3.1-0.20201222165305-f4ce31c02ca3
 	github.com/rs/xid v1.2.1
+	github.com/square/go-jose/v3 v3.0.0-20200630053402-0a67ce9b0693
 	github.com/stretchr/testify v1.6.1
 	github.com/trustbloc/edge-core v0.1.5
+	go.etcd.io/bbolt v1.3.5
 	go.opentelemetry.io/otel v0.15.0
+	golang.org/x/crypto v0.0.0-20201002170205-7f63de1d35b0
 	golang.org/x/net v0.0.0-20201202161906-c7110b5ffcbb
 )
@@ -0,0 +1,337 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package oauth2
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/square/go-jose/v3"
+	"github.com/square/go-jose/v3/jwt"
+)
+
+const (
+	defaultLeeway             = time.Minute
+	defaultJWKSRefreshBackoff = time.Minute
+)
+
+// Claims are the claims of a validated access token.
+type Claims struct {
+	Subject string
+	Scopes  []string
+}
+
+// Validator validates OAuth2/OIDC access tokens in the JWT format.
+type Validator struct {
+	jwksURL        string
+	httpClient     *http.Client
+	issuer         string
+	audience       []string
+	requiredScopes []string
+	leeway         time.Duration
+	now            func() time.Time
+
+	mu          sync.RWMutex
+	jwks        *jose.JSONWebKeySet
+	lastFetched time.Time
+}
+
+// Options configures Validator.
+type Options struct {
+	jwksFile       string
+	jwksURL        string
+	httpClient     *http.Client
+	issuer         string
+	audience       []string
+	requiredScopes []string
+	leeway         time.Duration
+	now            func() time.Time
+}
+
+// Option configures Validator.
+type Option func(options *Options)
+
+// WithJWKSFile sets the path to the file with a JSON Web Key Set used to verify token signatures.
+func WithJWKSFile(path string) Option {
+	return func(o *Options) {
+		o.jwksFile = path
+	}
+}
+
+// WithJWKSURL sets the URL of the JSON Web Key Set used to verify token signatures. The key set is fetched on
+// first use and refreshed when a token references an unknown key.
+func WithJWKSURL(url string) Option {
+	return func(o *Options) {
+		o.jwksURL = url
+	}
+}
+
+// WithHTTPClient sets the HTTP client used for fetching the JSON Web Key Set.
+func WithHTTPClient(c *http.Client) Option {
+	return func(o *Options) {
+		o.httpClient = c
+	}
+}
+
+// WithIssuer sets the expected value of the "iss" claim.
+func WithIssuer(issuer string) Option {
+	return func(o *Options) {
+		o.issuer = issuer
+	}
+}
+
+// WithAudience sets accepted values of the "aud" claim. A token must be issued for at least one of them.
+func WithAudience(audience ...string) Option {
+	return func(o *Options) {
+		o.audience = audience
+	}
+}
+
+// WithRequiredScopes sets scopes a token must be granted.
+func WithRequiredScopes(scopes ...string) Option {
+	return func(o *Options) {
+		o.requiredScopes = scopes
+	}
+}
+
+// WithLeeway sets the allowed clock skew for the time-based claims.
+func WithLeeway(leeway time.Duration) Option {
+	return func(o *Options) {
+		o.leeway = leeway
+	}
+}
+
+// WithClock sets the function used to get the current time.
+func WithClock(now func() time.Time) Option {
+	return func(o *Options) {
+		o.now = now
+	}
+}
+
+// New returns a new Validator instance.
+func New(opts ...Option) (*Validator, error) {
+	o := &Options{
+		httpClient: &http.Client{},
+		leeway:     defaultLeeway,
+		now:        time.Now,
+	}
+
+	for i := range opts {
+		opts[i](o)
+	}
+
+	if (o.jwksFile == "") == (o.jwksURL == "") {
+		return nil, errors.New("either JWKS file or JWKS URL must be set")
+	}
+
+	v := &Validator{
+		jwksURL:        o.jwksURL,
+		httpClient:     o.httpClient,
+		issuer:         o.issuer,
+		audience:       o.audience,
+		requiredScopes: o.requiredScopes,
+		leeway:         o.leeway,
+		now:            o.now,
+	}
+
+	if o.jwksFile != "" {
+		b, err := ioutil.ReadFile(o.jwksFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read JWKS file: %w", err)
+		}
+
+		v.jwks, err = parseJWKS(b)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return v, nil
+}
+
+type scopeClaims struct {
+	Scope string   `json:"scope,omitempty"`
+	Scp   []string `json:"scp,omitempty"`
+}
+
+// Validate verifies the token signature and validates its claims. The context bounds fetching of the JSON Web
+// Key Set.
+func (v *Validator) Validate(ctx context.Context, token string) (*Claims, error) {
+	tok, err := jwt.ParseSigned(token)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse token: %w", err)
+	}
+
+	if len(tok.Headers) != 1 {
+		return nil, errors.New("token must have exactly one signature")
+	}
+
+	keys, err := v.verificationKeys(ctx, tok.Headers[0].KeyID)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		claims jwt.Claims
+		scopes scopeClaims
+	)
+
+	for i := range keys {
+		if err = tok.Claims(keys[i].Key, &claims, &scopes); err == nil {
+			break
+		}
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify token signature: %w", err)
+	}
+
+	err = v.validateClaims(&claims)
+	if err != nil {
+		return nil, err
+	}
+
+	granted := scopes.Scp
+	if scopes.Scope != "" {
+		granted = strings.Fields(scopes.Scope)
+	}
+
+	for _, s := range v.requiredScopes {
+		if !contains(granted, s) {
+			return nil, fmt.Errorf("token is missing required scope %q", s)
+		}
+	}
+
+	return &Claims{Subject: claims.Subject, Scopes: granted}, nil
+}
+
+func (v *Validator) validateClaims(claims *jwt.Claims) error {
+	if claims.Expiry == nil {
+		return errors.New("token has no expiration time")
+	}
+
+	err := claims.ValidateWithLeeway(jwt.Expected{Issuer: v.issuer, Time: v.now()}, v.leeway)
+	if err != nil {
+		return fmt.Errorf("invalid token claims: %w", err)
+	}
+
+	if len(v.audience) == 0 {
+		return nil
+	}
+
+	for _, aud := range v.audience {
+		if claims.Audience.Contains(aud) {
+			return nil
+		}
+	}
+
+	return jwt.ErrInvalidAudience
+}
+
+// verificationKeys returns keys with the given ID, or all keys if the token does not reference any.
+func (v *Validator) verificationKeys(ctx context.Context, kid string) ([]jose.JSONWebKey, error) {
+	v.mu.RLock()
+	jwks := v.jwks
+	v.mu.RUnlock()
+
+	if jwks != nil {
+		if keys := lookup(jwks, kid); len(keys) > 0 || v.jwksURL == "" {
+			return checkKeys(keys, kid)
+		}
+	}
+
+	jwks, err := v.refreshJWKS(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return checkKeys(lookup(jwks, kid), kid)
+}
+
+func (v *Validator) refreshJWKS(ctx context.Context) (*jose.JSONWebKeySet, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	// a token that references an unknown key must not make us hammer the JWKS endpoint
+	if v.jwks != nil && v.now().Sub(v.lastFetched) < defaultJWKSRefreshBackoff {
+		return v.jwks, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.jwksURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create JWKS request: %w", err)
+	}
+
+	resp, err := v.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+
+	defer resp.Body.Close() //nolint:errcheck // ignore
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch JWKS: unexpected status %d", resp.StatusCode)
+	}
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWKS response: %w", err)
+	}
+
+	jwks, err := parseJWKS(b)
+	if err != nil {
+		return nil, err
+	}
+
+	v.jwks = jwks
+	v.lastFetched = v.now()
+
+	return jwks, nil
+}
+
+func parseJWKS(b []byte) (*jose.JSONWebKeySet, error) {
+	var jwks jose.JSONWebKeySet
+
+	if err := json.Unmarshal(b, &jwks); err != nil {
+		return nil, fmt.Errorf("failed to parse JWKS: %w", err)
+	}
+
+	return &jwks, nil
+}
+
+func lookup(jwks *jose.JSONWebKeySet, kid string) []jose.JSONWebKey {
+	if kid == "" {
+		return jwks.Keys
+	}
+
+	return jwks.Key(kid)
+}
+
+func checkKeys(keys []jose.JSONWebKey, kid string) ([]jose.JSONWebKey, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no verification key found for kid %q", kid)
+	}
+
+	return keys, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,289 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package oauth2_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/square/go-jose/v3"
+	"github.com/square/go-jose/v3/jwt"
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/hub-kms/pkg/auth/oauth2"
+)
+
+const (
+	testIssuer   = "https://issuer.example.com"
+	testAudience = "hub-kms"
+	testSubject  = "did:example:123456789"
+	testKeyID    = "key-1"
+)
+
+type extraClaims struct {
+	Scope string `json:"scope,omitempty"`
+}
+
+func TestNew(t *testing.T) {
+	t.Run("error if JWKS source is not set", func(t *testing.T) {
+		_, err := oauth2.New()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "either JWKS file or JWKS URL must be set")
+	})
+
+	t.Run("error if both JWKS sources are set", func(t *testing.T) {
+		_, err := oauth2.New(oauth2.WithJWKSFile("jwks.json"), oauth2.WithJWKSURL("https://example.com/jwks"))
+		require.Error(t, err)
+	})
+
+	t.Run("error if JWKS file does not exist", func(t *testing.T) {
+		_, err := oauth2.New(oauth2.WithJWKSFile("does-not-exist.json"))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to read JWKS file")
+	})
+
+	t.Run("error if JWKS file is invalid", func(t *testing.T) {
+		path := writeFile(t, []byte("invalid"))
+
+		_, err := oauth2.New(oauth2.WithJWKSFile(path))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to parse JWKS")
+	})
+}
+
+func TestValidator_Validate(t *testing.T) {
+	key := newKey(t)
+	path := writeFile(t, jwksBytes(t, key))
+
+	newValidator := func(t *testing.T, opts ...oauth2.Option) *oauth2.Validator {
+		t.Helper()
+
+		v, err := oauth2.New(append([]oauth2.Option{
+			oauth2.WithJWKSFile(path),
+			oauth2.WithIssuer(testIssuer),
+			oauth2.WithAudience("other", testAudience),
+			oauth2.WithRequiredScopes("keystore:create"),
+		}, opts...)...)
+		require.NoError(t, err)
+
+		return v
+	}
+
+	t.Run("success", func(t *testing.T) {
+		claims, err := newValidator(t).Validate(context.Background(), newToken(t, key, validClaims(), "openid keystore:create"))
+		require.NoError(t, err)
+		require.Equal(t, testSubject, claims.Subject)
+		require.Equal(t, []string{"openid", "keystore:create"}, claims.Scopes)
+	})
+
+	t.Run("error: malformed token", func(t *testing.T) {
+		_, err := newValidator(t).Validate(context.Background(), "invalid")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to parse token")
+	})
+
+	t.Run("error: token signed with unknown key", func(t *testing.T) {
+		_, err := newValidator(t).Validate(context.Background(), newToken(t, newKey(t), validClaims(), "keystore:create"))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to verify token signature")
+	})
+
+	t.Run("error: wrong issuer", func(t *testing.T) {
+		c := validClaims()
+		c.Issuer = "https://other.example.com"
+
+		_, err := newValidator(t).Validate(context.Background(), newToken(t, key, c, "keystore:create"))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "invalid token claims")
+	})
+
+	t.Run("error: wrong audience", func(t *testing.T) {
+		c := validClaims()
+		c.Audience = jwt.Audience{"unknown"}
+
+		_, err := newValidator(t).Validate(context.Background(), newToken(t, key, c, "keystore:create"))
+		require.Error(t, err)
+		require.Equal(t, jwt.ErrInvalidAudience, err)
+	})
+
+	t.Run("error: expired token", func(t *testing.T) {
+		c := validClaims()
+		c.Expiry = jwt.NewNumericDate(time.Now().Add(-time.Hour))
+
+		_, err := newValidator(t).Validate(context.Background(), newToken(t, key, c, "keystore:create"))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "token is expired")
+	})
+
+	t.Run("error: token without expiration time", func(t *testing.T) {
+		c := validClaims()
+		c.Expiry = nil
+
+		_, err := newValidator(t).Validate(context.Background(), newToken(t, key, c, "keystore:create"))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "token has no expiration time")
+	})
+
+	t.Run("error: missing required scope", func(t *testing.T) {
+		_, err := newValidator(t).Validate(context.Background(), newToken(t, key, validClaims(), "openid"))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), `token is missing required scope "keystore:create"`)
+	})
+}
+
+func TestValidator_JWKSURL(t *testing.T) {
+	key := newKey(t)
+
+	var (
+		hits int32
+		jwks = jwksBytes(t, key)
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+
+		_, err := w.Write(jwks)
+		require.NoError(t, err)
+	}))
+	defer server.Close()
+
+	v, err := oauth2.New(oauth2.WithJWKSURL(server.URL), oauth2.WithHTTPClient(server.Client()))
+	require.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		_, err = v.Validate(context.Background(), newToken(t, key, validClaims(), ""))
+		require.NoError(t, err)
+	}
+
+	require.EqualValues(t, 1, atomic.LoadInt32(&hits), "JWKS must be fetched once")
+
+	// unknown key IDs do not trigger refetching within the backoff period
+	_, err = v.Validate(context.Background(), newTokenWithKeyID(t, newKey(t), "unknown", validClaims()))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `no verification key found for kid "unknown"`)
+	require.EqualValues(t, 1, atomic.LoadInt32(&hits))
+}
+
+func TestValidator_JWKSURLError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	v, err := oauth2.New(oauth2.WithJWKSURL(server.URL))
+	require.NoError(t, err)
+
+	_, err = v.Validate(context.Background(), newToken(t, newKey(t), validClaims(), ""))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "failed to fetch JWKS: unexpected status 500")
+}
+
+func TestValidator_JWKSURLCanceled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	v, err := oauth2.New(oauth2.WithJWKSURL(server.URL))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err = v.Validate(ctx, newToken(t, newKey(t), validClaims(), ""))
+	require.Error(t, err)
+	require.True(t, errors.Is(err, context.DeadlineExceeded))
+}
+
+func validClaims() jwt.Claims {
+	return jwt.Claims{
+		Issuer:   testIssuer,
+		Subject:  testSubject,
+		Audience: jwt.Audience{testAudience},
+		Expiry:   jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		IssuedAt: jwt.NewNumericDate(time.Now()),
+	}
+}
+
+func newKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	return key
+}
+
+func newToken(t *testing.T, key *ecdsa.PrivateKey, claims jwt.Claims, scope string) string {
+	t.Helper()
+
+	return newTokenWithKeyIDAndScope(t, key, testKeyID, claims, scope)
+}
+
+func newTokenWithKeyID(t *testing.T, key *ecdsa.PrivateKey, kid string, claims jwt.Claims) string {
+	t.Helper()
+
+	return newTokenWithKeyIDAndScope(t, key, kid, claims, "")
+}
+
+func newTokenWithKeyIDAndScope(t *testing.T, key *ecdsa.PrivateKey, kid string, claims jwt.Claims,
+	scope string) string {
+	t.Helper()
+
+	signer, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: jose.ES256, Key: jose.JSONWebKey{Key: key, KeyID: kid}},
+		(&jose.SignerOptions{}).WithType("JWT"),
+	)
+	require.NoError(t, err)
+
+	token, err := jwt.Signed(signer).Claims(claims).Claims(extraClaims{Scope: scope}).CompactSerialize()
+	require.NoError(t, err)
+
+	return token
+}
+
+func jwksBytes(t *testing.T, key *ecdsa.PrivateKey) []byte {
+	t.Helper()
+
+	b, err := json.Marshal(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{
+		Key:       key.Public(),
+		KeyID:     testKeyID,
+		Algorithm: string(jose.ES256),
+		Use:       "sig",
+	}}})
+	require.NoError(t, err)
+
+	return b
+}
+
+func writeFile(t *testing.T, content []byte) string {
+	t.Helper()
+
+	file, err := ioutil.TempFile("", "jwks*.json")
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		require.NoError(t, os.Remove(file.Name()))
+	})
+
+	_, err = file.Write(content)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	return file.Name()
+}
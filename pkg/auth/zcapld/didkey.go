@@ -0,0 +1,189 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package zcapld
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcutil/base58"
+	"github.com/hyperledger/aries-framework-go/pkg/doc/jose"
+	"github.com/hyperledger/aries-framework-go/pkg/doc/signature/verifier"
+	"github.com/hyperledger/aries-framework-go/pkg/kms"
+	"github.com/hyperledger/aries-framework-go/pkg/vdr/fingerprint"
+)
+
+// Multicodec codes of the public keys supported in did:key URLs.
+// Source: https://github.com/multiformats/multicodec/blob/master/table.csv.
+const (
+	ed25519PubKeyCode   = 0xed
+	secp256k1PubKeyCode = 0xe7
+	p256PubKeyCode      = 0x1200
+	p384PubKeyCode      = 0x1201
+)
+
+// Verification method types of the keys resolved from did:key URLs.
+const (
+	ed25519VerificationKey2018        = "Ed25519VerificationKey2018"
+	jwsVerificationKey2020            = "JwsVerificationKey2020"
+	ecdsaSecp256k1VerificationKey2019 = "EcdsaSecp256k1VerificationKey2019"
+	jsonWebKey2020                    = "JsonWebKey2020" // found in DID documents resolved from VDRs
+)
+
+const didKeyPrefix = "did:key:"
+
+// DIDKeyURL returns a did:key URL for the public key of the given key type.
+// Supported key types: ED25519, ECDSAP256IEEEP1363, ECDSAP384IEEEP1363 and ECDSASecp256k1IEEEP1363.
+func DIDKeyURL(pubKeyBytes []byte, kt kms.KeyType) (string, error) {
+	var (
+		code  uint64
+		value []byte
+	)
+
+	switch kt {
+	case kms.ED25519Type:
+		code, value = ed25519PubKeyCode, pubKeyBytes
+	case kms.ECDSAP256TypeIEEEP1363, kms.ECDSAP384TypeIEEEP1363:
+		curve := elliptic.P256()
+		code = p256PubKeyCode
+
+		if kt == kms.ECDSAP384TypeIEEEP1363 {
+			curve = elliptic.P384()
+			code = p384PubKeyCode
+		}
+
+		x, y := elliptic.Unmarshal(curve, pubKeyBytes)
+		if x == nil {
+			return "", errors.New("invalid ecdsa public key")
+		}
+
+		value = elliptic.MarshalCompressed(curve, x, y)
+	case kms.ECDSASecp256k1TypeIEEEP1363:
+		pubKey, err := btcec.ParsePubKey(pubKeyBytes, btcec.S256())
+		if err != nil {
+			return "", fmt.Errorf("invalid secp256k1 public key: %w", err)
+		}
+
+		code, value = secp256k1PubKeyCode, pubKey.SerializeCompressed()
+	default:
+		return "", fmt.Errorf("unsupported key type for did:key: %s", kt)
+	}
+
+	methodID := fingerprint.KeyFingerprint(code, value)
+
+	return fmt.Sprintf("%s%s#%s", didKeyPrefix, methodID, methodID), nil
+}
+
+// DIDKeyResolver resolves verification keys from did:key URLs: https://w3c-ccg.github.io/did-method-key/.
+// Unlike the resolver in edge-core, it supports Ed25519, P-256, P-384 and secp256k1 keys.
+type DIDKeyResolver struct{}
+
+// Resolve expects 'didKeyURL' to be a did:key URL.
+func (r *DIDKeyResolver) Resolve(didKeyURL string) (*verifier.PublicKey, error) {
+	const numParts = 2
+
+	parts := strings.Split(didKeyURL, "#")
+	if len(parts) != numParts || !strings.HasPrefix(parts[0], didKeyPrefix) {
+		return nil, fmt.Errorf("not a did:key URL: %s", didKeyURL)
+	}
+
+	methodID := strings.TrimPrefix(parts[0], didKeyPrefix)
+
+	if parts[1] != methodID {
+		return nil, fmt.Errorf("did:key URL does not reference a key contained in itself: %s", didKeyURL)
+	}
+
+	return publicKeyFromFingerprint(methodID)
+}
+
+func publicKeyFromFingerprint(fp string) (*verifier.PublicKey, error) {
+	if len(fp) < 2 || fp[0] != 'z' {
+		return nil, fmt.Errorf("unsupported multibase encoding of did:key fingerprint: %s", fp)
+	}
+
+	mc := base58.Decode(fp[1:])
+
+	code, n := binary.Uvarint(mc)
+	if n <= 0 {
+		return nil, fmt.Errorf("invalid multicodec prefix in did:key fingerprint: %s", fp)
+	}
+
+	value := mc[n:]
+
+	switch code {
+	case ed25519PubKeyCode:
+		return &verifier.PublicKey{
+			Type:  ed25519VerificationKey2018,
+			Value: value,
+		}, nil
+	case p256PubKeyCode, p384PubKeyCode:
+		return ecdsaPublicKey(code, value)
+	case secp256k1PubKeyCode:
+		pubKey, err := btcec.ParsePubKey(value, btcec.S256())
+		if err != nil {
+			return nil, fmt.Errorf("invalid secp256k1 public key: %w", err)
+		}
+
+		return &verifier.PublicKey{
+			Type:  ecdsaSecp256k1VerificationKey2019,
+			Value: pubKey.SerializeUncompressed(),
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported did:key public key (multicodec code: %#x)", code)
+	}
+}
+
+func ecdsaPublicKey(code uint64, value []byte) (*verifier.PublicKey, error) {
+	curve := elliptic.P256()
+	if code == p384PubKeyCode {
+		curve = elliptic.P384()
+	}
+
+	x, y := elliptic.UnmarshalCompressed(curve, value)
+	if x == nil {
+		return nil, errors.New("invalid compressed ecdsa public key")
+	}
+
+	jwk, err := jose.JWKFromPublicKey(&ecdsa.PublicKey{Curve: curve, X: x, Y: y})
+	if err != nil {
+		return nil, fmt.Errorf("create jwk: %w", err)
+	}
+
+	return &verifier.PublicKey{
+		Type:  jwsVerificationKey2020,
+		Value: elliptic.Marshal(curve, x, y),
+		JWK:   jwk,
+	}, nil
+}
+
+// keyTypeOf returns the KMS key type of the resolved public key.
+func keyTypeOf(pubKey *verifier.PublicKey) (kms.KeyType, error) {
+	switch pubKey.Type {
+	case ed25519VerificationKey2018:
+		return kms.ED25519Type, nil
+	case ecdsaSecp256k1VerificationKey2019:
+		return kms.ECDSASecp256k1TypeIEEEP1363, nil
+	case jwsVerificationKey2020, jsonWebKey2020:
+		if pubKey.JWK != nil {
+			switch pubKey.JWK.Crv {
+			case "Ed25519":
+				return kms.ED25519Type, nil
+			case elliptic.P256().Params().Name:
+				return kms.ECDSAP256TypeIEEEP1363, nil
+			case elliptic.P384().Params().Name:
+				return kms.ECDSAP384TypeIEEEP1363, nil
+			}
+		}
+	}
+
+	return "", fmt.Errorf("unsupported public key type: %s", pubKey.Type)
+}
@@ -0,0 +1,148 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package zcapld_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/hyperledger/aries-framework-go/pkg/kms"
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/hub-kms/pkg/auth/zcapld"
+)
+
+func TestDIDKeyURL(t *testing.T) {
+	tests := []struct {
+		name        string
+		keyType     kms.KeyType
+		pubKey      []byte
+		keyIDPrefix string
+		pubKeyType  string
+	}{
+		{
+			name:        "ED25519",
+			keyType:     kms.ED25519Type,
+			pubKey:      ed25519PubKey(t),
+			keyIDPrefix: "did:key:z6Mk",
+			pubKeyType:  "Ed25519VerificationKey2018",
+		},
+		{
+			name:        "ECDSAP256IEEEP1363",
+			keyType:     kms.ECDSAP256TypeIEEEP1363,
+			pubKey:      ecdsaPubKey(t, elliptic.P256()),
+			keyIDPrefix: "did:key:zDn",
+			pubKeyType:  "JwsVerificationKey2020",
+		},
+		{
+			name:        "ECDSAP384IEEEP1363",
+			keyType:     kms.ECDSAP384TypeIEEEP1363,
+			pubKey:      ecdsaPubKey(t, elliptic.P384()),
+			keyIDPrefix: "did:key:z82",
+			pubKeyType:  "JwsVerificationKey2020",
+		},
+		{
+			name:        "ECDSASecp256k1IEEEP1363",
+			keyType:     kms.ECDSASecp256k1TypeIEEEP1363,
+			pubKey:      secp256k1PubKey(t),
+			keyIDPrefix: "did:key:zQ3s",
+			pubKeyType:  "EcdsaSecp256k1VerificationKey2019",
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			keyURL, err := zcapld.DIDKeyURL(tc.pubKey, tc.keyType)
+			require.NoError(t, err)
+			require.True(t, strings.HasPrefix(keyURL, tc.keyIDPrefix), keyURL)
+
+			pubKey, err := (&zcapld.DIDKeyResolver{}).Resolve(keyURL)
+			require.NoError(t, err)
+			require.Equal(t, tc.pubKeyType, pubKey.Type)
+			require.Equal(t, tc.pubKey, pubKey.Value)
+		})
+	}
+
+	t.Run("error: unsupported key type", func(t *testing.T) {
+		_, err := zcapld.DIDKeyURL([]byte("key"), kms.RSARS256Type)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "unsupported key type for did:key")
+	})
+
+	t.Run("error: invalid ecdsa public key", func(t *testing.T) {
+		_, err := zcapld.DIDKeyURL([]byte("invalid"), kms.ECDSAP256TypeIEEEP1363)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "invalid ecdsa public key")
+	})
+
+	t.Run("error: invalid secp256k1 public key", func(t *testing.T) {
+		_, err := zcapld.DIDKeyURL([]byte("invalid"), kms.ECDSASecp256k1TypeIEEEP1363)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "invalid secp256k1 public key")
+	})
+}
+
+func TestDIDKeyResolver_Resolve(t *testing.T) {
+	t.Run("error: not a did:key URL", func(t *testing.T) {
+		_, err := (&zcapld.DIDKeyResolver{}).Resolve("did:example:123#key1")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "not a did:key URL")
+	})
+
+	t.Run("error: key is not contained in did:key", func(t *testing.T) {
+		_, err := (&zcapld.DIDKeyResolver{}).Resolve("did:key:z6Mkabc#z6Mkdef")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "does not reference a key contained in itself")
+	})
+
+	t.Run("error: unsupported multibase encoding", func(t *testing.T) {
+		_, err := (&zcapld.DIDKeyResolver{}).Resolve("did:key:abc#abc")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "unsupported multibase encoding")
+	})
+
+	t.Run("error: unsupported multicodec code", func(t *testing.T) {
+		// z + base58(0x01 0x02)
+		_, err := (&zcapld.DIDKeyResolver{}).Resolve("did:key:z5R#z5R")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "unsupported did:key public key")
+	})
+}
+
+func ed25519PubKey(t *testing.T) []byte {
+	t.Helper()
+
+	pubKey, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	return pubKey
+}
+
+func ecdsaPubKey(t *testing.T, curve elliptic.Curve) []byte {
+	t.Helper()
+
+	privKey, err := ecdsa.GenerateKey(curve, rand.Reader)
+	require.NoError(t, err)
+
+	return elliptic.Marshal(curve, privKey.X, privKey.Y)
+}
+
+func secp256k1PubKey(t *testing.T) []byte {
+	t.Helper()
+
+	privKey, err := btcec.NewPrivateKey(btcec.S256())
+	require.NoError(t, err)
+
+	return privKey.PubKey().SerializeUncompressed()
+}
@@ -0,0 +1,435 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package zcapld
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	cryptoapi "github.com/hyperledger/aries-framework-go/pkg/crypto"
+	"github.com/hyperledger/aries-framework-go/pkg/doc/signature/suite/ecdsasecp256k1signature2019"
+	"github.com/hyperledger/aries-framework-go/pkg/doc/signature/suite/ed25519signature2018"
+	"github.com/hyperledger/aries-framework-go/pkg/doc/signature/suite/jsonwebsignature2020"
+	"github.com/hyperledger/aries-framework-go/pkg/doc/signature/verifier"
+	"github.com/hyperledger/aries-framework-go/pkg/kms"
+	"github.com/hyperledger/aries-framework-go/pkg/kms/localkms"
+	"github.com/igor-pavlenko/httpsignatures-go"
+	"github.com/trustbloc/edge-core/pkg/zcapld"
+)
+
+const (
+	// ariesHTTPSigAlgorithm must match the custom algorithm name used by edge-core (zcapld.AriesDIDKeySecrets).
+	ariesHTTPSigAlgorithm = "https://github.com/hyperledger/aries-framework-go/zcaps"
+
+	signatureHeader = "signature"
+	capabilityParam = "capability"
+	actionParam     = "action"
+	keyIDParam      = "keyId"
+	headersParam    = "headers"
+	createdParam    = "created"
+	signatureParam  = "signature"
+	createdHeader   = "(created)"
+	dateHeader      = "date"
+
+	// DefaultMaxClockSkew is the default allowed difference between the HTTP signature's creation time
+	// and the server time.
+	DefaultMaxClockSkew = 5 * time.Minute
+)
+
+// SignatureHashAlgorithm is a custom httpsignatures.SignatureHashAlgorithm composed of the aries framework's
+// KMS and Crypto APIs. Unlike its edge-core counterpart, it resolves keys with the configured KeyResolver and
+// supports Ed25519, P-256, P-384 and secp256k1 keys. Signing with secp256k1 keys is available in Service.SignHeader
+// only, as these keys are kept by the Service.
+type SignatureHashAlgorithm struct {
+	Crypto      cryptoapi.Crypto
+	KMS         kms.KeyManager
+	KeyResolver zcapld.KeyResolver
+	secp256k1   *secp256k1Keys
+}
+
+// Algorithm returns this algorithm's name.
+func (a *SignatureHashAlgorithm) Algorithm() string {
+	return ariesHTTPSigAlgorithm
+}
+
+// Create signs data with the secret.
+func (a *SignatureHashAlgorithm) Create(secret httpsignatures.Secret, data []byte) ([]byte, error) {
+	pubKey, err := a.KeyResolver.Resolve(secret.KeyID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve key %s: %w", secret.KeyID, err)
+	}
+
+	kt, err := keyTypeOf(pubKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if kt == kms.ECDSASecp256k1TypeIEEEP1363 {
+		return a.signSecp256k1(pubKey.Value, data)
+	}
+
+	kid, err := localkms.CreateKID(pubKey.Value, kt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create KID from public key: %w", err)
+	}
+
+	kh, err := a.KMS.Get(kid)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get key handle for kid %s: %w", kid, err)
+	}
+
+	sig, err := a.Crypto.Sign(data, kh)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign data: %w", err)
+	}
+
+	return sig, nil
+}
+
+func (a *SignatureHashAlgorithm) signSecp256k1(pubKey, data []byte) ([]byte, error) {
+	if a.secp256k1 == nil {
+		return nil, errors.New("signing with secp256k1 keys is not supported")
+	}
+
+	signer, err := a.secp256k1.get(pubKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return signer.Sign(data)
+}
+
+// Verify verifies the signature over data with the secret.
+func (a *SignatureHashAlgorithm) Verify(secret httpsignatures.Secret, data, signature []byte) error {
+	pubKey, err := a.KeyResolver.Resolve(secret.KeyID)
+	if err != nil {
+		return fmt.Errorf("failed to resolve key %s: %w", secret.KeyID, err)
+	}
+
+	v, err := publicKeyVerifier(pubKey)
+	if err != nil {
+		return err
+	}
+
+	err = v.Verify(pubKey, data, signature)
+	if err != nil {
+		return fmt.Errorf("failed to verify signature: %w", err)
+	}
+
+	return nil
+}
+
+func publicKeyVerifier(pubKey *verifier.PublicKey) (*verifier.PublicKeyVerifier, error) {
+	switch pubKey.Type {
+	case ed25519VerificationKey2018:
+		return ed25519signature2018.NewPublicKeyVerifier(), nil
+	case jwsVerificationKey2020, jsonWebKey2020:
+		return jsonwebsignature2020.NewPublicKeyVerifier(), nil
+	case ecdsaSecp256k1VerificationKey2019:
+		return ecdsasecp256k1signature2019.NewPublicKeyVerifier(), nil
+	default:
+		return nil, fmt.Errorf("unsupported public key type: %s", pubKey.Type)
+	}
+}
+
+// HTTPSigAuthConfig configures the HTTP auth handler.
+type HTTPSigAuthConfig struct {
+	CapabilityResolver zcapld.CapabilityResolver
+	KeyResolver        zcapld.KeyResolver
+	VerifierOptions    []zcapld.VerificationOption
+	Secrets            httpsignatures.Secrets
+	ErrConsumer        func(error)
+	KMS                kms.KeyManager
+	Crypto             cryptoapi.Crypto
+	MaxClockSkew       time.Duration // DefaultMaxClockSkew if not set
+	ReplayCache        *ReplayCache  // rejects replayed signatures (optional)
+}
+
+// NewHTTPSigAuthHandler authenticates and authorizes a request before forwarding to 'next'.
+// It follows zcapld.NewHTTPSigAuthHandler from edge-core, but verifies HTTP signatures with
+// SignatureHashAlgorithm, so that invokers are not limited to Ed25519 did:key. Signatures must cover their
+// creation time ("(created)" or "date") within MaxClockSkew and, if ReplayCache is set, can be used only once.
+func NewHTTPSigAuthHandler(config *HTTPSigAuthConfig, expect *zcapld.InvocationExpectations,
+	next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		authZHandleFunc(w, r, config, expect, next)
+	}
+}
+
+func authZHandleFunc(w http.ResponseWriter, r *http.Request, config *HTTPSigAuthConfig,
+	expect *zcapld.InvocationExpectations, next http.HandlerFunc) {
+	err := newHTTPSignatures(config).Verify(r)
+	if err != nil {
+		consumeError(config.ErrConsumer, fmt.Errorf("failed to verify http signature: %w", err))
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+
+		return
+	}
+
+	err = checkReplay(r, config)
+	if err != nil {
+		consumeError(config.ErrConsumer, err)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+
+		return
+	}
+
+	zcap, action, err := parseInvocationHeader(r)
+	if err != nil {
+		consumeError(config.ErrConsumer, fmt.Errorf("failed to parse capability-invocation header: %w", err))
+		http.Error(w, "bad request", http.StatusBadRequest)
+
+		return
+	}
+
+	keyID, err := parseKeyID(r)
+	if err != nil {
+		consumeError(config.ErrConsumer, fmt.Errorf("failed to parse keyID: %w", err))
+		http.Error(w, "bad request", http.StatusBadRequest)
+
+		return
+	}
+
+	v, err := zcapld.NewVerifier(config.CapabilityResolver, config.KeyResolver, config.VerifierOptions...)
+	if err != nil {
+		consumeError(config.ErrConsumer, fmt.Errorf("middleware failed to init verifier: %w", err))
+		http.Error(w, fmt.Sprintf("failed to init zcap verifier: %s", err.Error()), http.StatusInternalServerError)
+
+		return
+	}
+
+	err = v.Verify(
+		&zcapld.Proof{
+			Capability:         zcap,
+			CapabilityAction:   action,
+			VerificationMethod: keyID,
+		},
+		&zcapld.CapabilityInvocation{
+			ExpectedTarget:         expect.Target,
+			ExpectedAction:         expect.Action,
+			ExpectedRootCapability: expect.RootCapability,
+			VerificationMethod: &zcapld.VerificationMethod{
+				ID:         keyID,
+				Controller: controllerOf(keyID),
+			},
+		},
+	)
+	if err != nil {
+		consumeError(config.ErrConsumer, fmt.Errorf("failed to verify zcap: %w", err))
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+
+		return
+	}
+
+	next(w, r)
+}
+
+func newHTTPSignatures(config *HTTPSigAuthConfig) *httpsignatures.HTTPSignatures {
+	hs := httpsignatures.NewHTTPSignatures(config.Secrets)
+
+	// tolerance for (created) in the future and (expires) in the past
+	hs.SetDefaultTimeGap(int64(maxClockSkew(config)))
+
+	// same default headers as in edge-core (see zcapld.NewHTTPSigAuthHandler)
+	hs.SetDefaultSignatureHeaders([]string{
+		"(key-id)", "(created)", "(expires)", "(request-target)", "host", zcapld.CapabilityInvocationHTTPHeader,
+	})
+
+	hs.SetSignatureHashAlgorithm(&SignatureHashAlgorithm{
+		Crypto:      config.Crypto,
+		KMS:         config.KMS,
+		KeyResolver: config.KeyResolver,
+	})
+
+	return hs
+}
+
+// checkReplay verifies that the signature was created within the allowed clock skew and has not been seen before.
+func checkReplay(r *http.Request, config *HTTPSigAuthConfig) error {
+	params := signatureParams(r)
+	skew := maxClockSkew(config)
+
+	created, err := signatureCreated(r, params)
+	if err != nil {
+		return err
+	}
+
+	if d := time.Since(created); d > skew || d < -skew {
+		return fmt.Errorf("http signature created at %s is outside of the allowed clock skew of %s",
+			created.UTC().Format(time.RFC3339), skew)
+	}
+
+	if config.ReplayCache == nil {
+		return nil
+	}
+
+	err = config.ReplayCache.CheckAndStore(params[signatureParam], created.Add(skew))
+	if err != nil {
+		return fmt.Errorf("failed to check http signature for replay: %w", err)
+	}
+
+	return nil
+}
+
+// signatureCreated returns the signature's creation time from either the signed (created) param or date header.
+func signatureCreated(r *http.Request, params map[string]string) (time.Time, error) {
+	signed := strings.Fields(strings.ToLower(params[headersParam]))
+	if len(signed) == 0 {
+		signed = []string{createdHeader} // default per the HTTP signatures spec
+	}
+
+	switch {
+	case containsString(signed, createdHeader):
+		sec, err := strconv.ParseInt(params[createdParam], 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid %q signature param: %w", createdParam, err)
+		}
+
+		return time.Unix(sec, 0), nil
+	case containsString(signed, dateHeader):
+		t, err := http.ParseTime(r.Header.Get(dateHeader))
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid %q header: %w", dateHeader, err)
+		}
+
+		return t, nil
+	default:
+		return time.Time{}, fmt.Errorf("http signature must cover %q or %q", createdHeader, dateHeader)
+	}
+}
+
+func maxClockSkew(config *HTTPSigAuthConfig) time.Duration {
+	if config.MaxClockSkew > 0 {
+		return config.MaxClockSkew
+	}
+
+	return DefaultMaxClockSkew
+}
+
+func containsString(values []string, v string) bool {
+	for _, s := range values {
+		if s == v {
+			return true
+		}
+	}
+
+	return false
+}
+
+// controllerOf returns the DID part of the verification method ID.
+func controllerOf(keyID string) string {
+	return strings.Split(keyID, "#")[0]
+}
+
+func consumeError(consumer func(error), err error) {
+	if consumer != nil {
+		consumer(err)
+	}
+}
+
+// parseInvocationHeader expects the same format as the Bearer authentication scheme:
+// https://tools.ietf.org/html/rfc6750#section-2.1
+func parseInvocationHeader(r *http.Request) (*zcapld.Capability, string, error) {
+	const (
+		scheme     = "zcap "
+		numParts   = 2
+		equalityOp = "="
+		delim      = ","
+	)
+
+	value := strings.TrimSpace(strings.Join(r.Header.Values(zcapld.CapabilityInvocationHTTPHeader), delim))
+
+	if !strings.HasPrefix(strings.ToLower(value), scheme) {
+		return nil, "", fmt.Errorf(`"%s" header is missing or has invalid scheme`, zcapld.CapabilityInvocationHTTPHeader)
+	}
+
+	var (
+		zcap   *zcapld.Capability
+		action string
+		err    error
+	)
+
+	for _, param := range strings.Split(value[len(scheme):], delim) {
+		kv := strings.SplitN(strings.TrimSpace(param), equalityOp, numParts)
+		if len(kv) != numParts {
+			return nil, "", fmt.Errorf("invalid key=value format: %s", param)
+		}
+
+		v := strings.Trim(kv[1], `"`)
+
+		switch kv[0] {
+		case capabilityParam:
+			zcap, err = DecompressZCAP(v)
+			if err != nil {
+				return nil, "", fmt.Errorf("failed to parse capability: %w", err)
+			}
+		case actionParam:
+			action = v
+		default:
+			return nil, "", fmt.Errorf("unrecognized invocation header param: %s", kv[0])
+		}
+	}
+
+	if zcap == nil || action == "" {
+		return nil, "", fmt.Errorf("%q and %q params are required", capabilityParam, actionParam)
+	}
+
+	return zcap, action, nil
+}
+
+func parseKeyID(r *http.Request) (string, error) {
+	keyID, ok := signatureParams(r)[keyIDParam]
+	if !ok {
+		return "", fmt.Errorf("no %s parameter found for %s header", keyIDParam, signatureHeader)
+	}
+
+	return keyID, nil
+}
+
+// signatureParams returns the params of the signature header.
+func signatureParams(r *http.Request) map[string]string {
+	const numParts = 2
+
+	params := make(map[string]string)
+
+	for _, param := range strings.Split(strings.Join(r.Header.Values(signatureHeader), ","), ",") {
+		kv := strings.SplitN(strings.TrimSpace(param), "=", numParts)
+		if len(kv) == numParts {
+			params[kv[0]] = strings.Trim(kv[1], `"`)
+		}
+	}
+
+	return params
+}
+
+// DecompressZCAP base64URL-decodes and gunzips the zcap.
+func DecompressZCAP(compressed string) (*zcapld.Capability, error) {
+	decoded, err := base64.URLEncoding.DecodeString(compressed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to base64URL-decode zcap: %w", err)
+	}
+
+	r, err := gzip.NewReader(bytes.NewReader(decoded))
+	if err != nil {
+		return nil, fmt.Errorf("failed to init gzip reader: %w", err)
+	}
+
+	raw, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read gunzipped zcap: %w", err)
+	}
+
+	return zcapld.ParseCapability(raw)
+}
@@ -0,0 +1,231 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package zcapld_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/aries-framework-go/pkg/crypto/tinkcrypto"
+	"github.com/hyperledger/aries-framework-go/pkg/kms"
+	"github.com/hyperledger/aries-framework-go/pkg/kms/localkms"
+	"github.com/hyperledger/aries-framework-go/pkg/secretlock"
+	"github.com/hyperledger/aries-framework-go/pkg/secretlock/noop"
+	"github.com/hyperledger/aries-framework-go/pkg/storage"
+	"github.com/hyperledger/aries-framework-go/pkg/storage/mem"
+	"github.com/igor-pavlenko/httpsignatures-go"
+	"github.com/stretchr/testify/require"
+	edgezcapld "github.com/trustbloc/edge-core/pkg/zcapld"
+
+	"github.com/trustbloc/hub-kms/pkg/auth/zcapld"
+)
+
+func TestSignatureHashAlgorithm(t *testing.T) {
+	for _, kt := range []kms.KeyType{kms.ED25519Type, kms.ECDSAP256TypeIEEEP1363, kms.ECDSAP384TypeIEEEP1363} {
+		kt := kt
+
+		t.Run(string(kt), func(t *testing.T) {
+			alg, keyURL := newSignatureHashAlgorithm(t, kt)
+
+			secret := httpsignatures.Secret{KeyID: keyURL}
+
+			sig, err := alg.Create(secret, []byte("data"))
+			require.NoError(t, err)
+
+			require.NoError(t, alg.Verify(secret, []byte("data"), sig))
+			require.Error(t, alg.Verify(secret, []byte("other data"), sig))
+		})
+	}
+
+	t.Run("error: secp256k1 signing key", func(t *testing.T) {
+		alg, _ := newSignatureHashAlgorithm(t, kms.ED25519Type)
+
+		keyURL, err := zcapld.DIDKeyURL(secp256k1PubKey(t), kms.ECDSASecp256k1TypeIEEEP1363)
+		require.NoError(t, err)
+
+		_, err = alg.Create(httpsignatures.Secret{KeyID: keyURL}, []byte("data"))
+		require.EqualError(t, err, "signing with secp256k1 keys is not supported")
+	})
+
+	t.Run("error: invalid key ID", func(t *testing.T) {
+		alg, _ := newSignatureHashAlgorithm(t, kms.ED25519Type)
+
+		_, err := alg.Create(httpsignatures.Secret{KeyID: "invalid"}, []byte("data"))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to resolve key")
+
+		err = alg.Verify(httpsignatures.Secret{KeyID: "invalid"}, []byte("data"), []byte("sig"))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to resolve key")
+	})
+}
+
+func TestNewHTTPSigAuthHandler(t *testing.T) {
+	t.Run("unauthorized if request is not signed", func(t *testing.T) {
+		alg, _ := newSignatureHashAlgorithm(t, kms.ED25519Type)
+
+		executed := false
+		handler := zcapld.NewHTTPSigAuthHandler(newHTTPSigAuthConfig(alg), &edgezcapld.InvocationExpectations{},
+			func(w http.ResponseWriter, r *http.Request) { executed = true })
+
+		result := httptest.NewRecorder()
+		handler(result, httptest.NewRequest(http.MethodPost, "/test", nil))
+
+		require.Equal(t, http.StatusUnauthorized, result.Code)
+		require.False(t, executed)
+	})
+
+	t.Run("bad request if P-256 signed request has invalid invocation header", func(t *testing.T) {
+		alg, keyURL := newSignatureHashAlgorithm(t, kms.ECDSAP256TypeIEEEP1363)
+
+		request := httptest.NewRequest(http.MethodPost, "/test", nil)
+		request.Header.Set(edgezcapld.CapabilityInvocationHTTPHeader, `zcap action="sign"`)
+
+		hs := httpsignatures.NewHTTPSignatures(&edgezcapld.AriesDIDKeySecrets{})
+		hs.SetSignatureHashAlgorithm(alg)
+
+		require.NoError(t, hs.Sign(keyURL, request))
+
+		executed := false
+		handler := zcapld.NewHTTPSigAuthHandler(newHTTPSigAuthConfig(alg), &edgezcapld.InvocationExpectations{},
+			func(w http.ResponseWriter, r *http.Request) { executed = true })
+
+		result := httptest.NewRecorder()
+		handler(result, request)
+
+		require.Equal(t, http.StatusBadRequest, result.Code)
+		require.False(t, executed)
+	})
+
+	t.Run("unauthorized if signature is replayed", func(t *testing.T) {
+		alg, keyURL := newSignatureHashAlgorithm(t, kms.ED25519Type)
+
+		replayCache, err := zcapld.NewReplayCache(mem.NewProvider())
+		require.NoError(t, err)
+
+		config := newHTTPSigAuthConfig(alg)
+		config.ReplayCache = replayCache
+
+		handler := zcapld.NewHTTPSigAuthHandler(config, &edgezcapld.InvocationExpectations{},
+			func(w http.ResponseWriter, r *http.Request) {})
+
+		request := newSignedRequest(t, alg, keyURL, nil, time.Now())
+
+		result := httptest.NewRecorder()
+		handler(result, request)
+		require.Equal(t, http.StatusBadRequest, result.Code) // passed signature checks
+
+		result = httptest.NewRecorder()
+		handler(result, request)
+		require.Equal(t, http.StatusUnauthorized, result.Code)
+	})
+
+	t.Run("unauthorized if signature is outside of the clock skew", func(t *testing.T) {
+		alg, keyURL := newSignatureHashAlgorithm(t, kms.ED25519Type)
+
+		config := newHTTPSigAuthConfig(alg)
+		config.MaxClockSkew = time.Minute
+
+		handler := zcapld.NewHTTPSigAuthHandler(config, &edgezcapld.InvocationExpectations{},
+			func(w http.ResponseWriter, r *http.Request) {})
+
+		headers := []string{"(request-target)", "date"}
+
+		result := httptest.NewRecorder()
+		handler(result, newSignedRequest(t, alg, keyURL, headers, time.Now().Add(-time.Hour)))
+		require.Equal(t, http.StatusUnauthorized, result.Code)
+
+		result = httptest.NewRecorder()
+		handler(result, newSignedRequest(t, alg, keyURL, headers, time.Now()))
+		require.Equal(t, http.StatusBadRequest, result.Code) // passed signature checks
+	})
+
+	t.Run("unauthorized if signature does not cover its creation time", func(t *testing.T) {
+		alg, keyURL := newSignatureHashAlgorithm(t, kms.ED25519Type)
+
+		handler := zcapld.NewHTTPSigAuthHandler(newHTTPSigAuthConfig(alg), &edgezcapld.InvocationExpectations{},
+			func(w http.ResponseWriter, r *http.Request) {})
+
+		result := httptest.NewRecorder()
+		handler(result, newSignedRequest(t, alg, keyURL,
+			[]string{"(request-target)", edgezcapld.CapabilityInvocationHTTPHeader}, time.Now()))
+		require.Equal(t, http.StatusUnauthorized, result.Code)
+	})
+}
+
+// newSignedRequest returns a request signed with the given headers (default headers if nil). The request has an
+// invalid invocation header, so it fails with 400 Bad Request once the signature checks pass.
+func newSignedRequest(t *testing.T, alg *zcapld.SignatureHashAlgorithm, keyURL string, headers []string,
+	date time.Time) *http.Request {
+	t.Helper()
+
+	request := httptest.NewRequest(http.MethodPost, "/test", nil)
+	request.Header.Set(edgezcapld.CapabilityInvocationHTTPHeader, `zcap action="sign"`)
+	request.Header.Set("Date", date.UTC().Format(http.TimeFormat))
+
+	hs := httpsignatures.NewHTTPSignatures(&edgezcapld.AriesDIDKeySecrets{})
+	hs.SetSignatureHashAlgorithm(alg)
+
+	if headers != nil {
+		hs.SetDefaultSignatureHeaders(headers)
+	}
+
+	require.NoError(t, hs.Sign(keyURL, request))
+
+	return request
+}
+
+func TestDecompressZCAP(t *testing.T) {
+	_, err := zcapld.DecompressZCAP("invalid!")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "failed to base64URL-decode zcap")
+}
+
+func newSignatureHashAlgorithm(t *testing.T, kt kms.KeyType) (*zcapld.SignatureHashAlgorithm, string) {
+	t.Helper()
+
+	keyManager, err := localkms.New("local-lock://test", &kmsProvider{sp: mem.NewProvider()})
+	require.NoError(t, err)
+
+	cryptoService, err := tinkcrypto.New()
+	require.NoError(t, err)
+
+	_, pubKey, err := keyManager.CreateAndExportPubKeyBytes(kt)
+	require.NoError(t, err)
+
+	keyURL, err := zcapld.DIDKeyURL(pubKey, kt)
+	require.NoError(t, err)
+
+	return &zcapld.SignatureHashAlgorithm{
+		Crypto:      cryptoService,
+		KMS:         keyManager,
+		KeyResolver: &zcapld.DIDKeyResolver{},
+	}, keyURL
+}
+
+func newHTTPSigAuthConfig(alg *zcapld.SignatureHashAlgorithm) *zcapld.HTTPSigAuthConfig {
+	return &zcapld.HTTPSigAuthConfig{
+		KeyResolver: alg.KeyResolver,
+		Secrets:     &edgezcapld.AriesDIDKeySecrets{},
+		KMS:         alg.KMS,
+		Crypto:      alg.Crypto,
+	}
+}
+
+type kmsProvider struct {
+	sp storage.Provider
+}
+
+func (p *kmsProvider) StorageProvider() storage.Provider {
+	return p.sp
+}
+
+func (p *kmsProvider) SecretLock() secretlock.Service {
+	return &noop.NoLock{}
+}
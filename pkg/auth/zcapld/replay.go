@@ -0,0 +1,157 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package zcapld
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/aries-framework-go/pkg/storage"
+)
+
+const replayCacheStoreName = "httpsigreplaycache"
+
+// DefaultReplayCachePurgeInterval is the default interval of purging expired signatures from the replay cache.
+const DefaultReplayCachePurgeInterval = DefaultMaxClockSkew
+
+// ErrReplayedSignature is returned when an HTTP signature has already been seen.
+var ErrReplayedSignature = errors.New("replayed http signature")
+
+// ReplayCache records digests of HTTP signatures until they expire, to detect replayed requests. Expired signatures
+// are ignored and purged from the store periodically.
+//
+// The check and the write are serialized within an instance only, as storage providers have no conditional writes.
+// With a shared storage provider (e.g. CouchDB), replays are detected across multiple kms-rest instances unless
+// the same signature is sent to two instances at the same time, so the replay cache is strictly reliable for
+// a single instance only.
+type ReplayCache struct {
+	store         storage.Store
+	now           func() time.Time
+	purgeInterval time.Duration
+	lastPurge     time.Time
+	mu            sync.Mutex
+}
+
+// ReplayCacheOptions configures ReplayCache.
+type ReplayCacheOptions struct {
+	purgeInterval time.Duration
+	now           func() time.Time
+}
+
+// ReplayCacheOption configures ReplayCacheOptions.
+type ReplayCacheOption func(options *ReplayCacheOptions)
+
+// WithPurgeInterval sets how often expired signatures are deleted from the store (DefaultReplayCachePurgeInterval
+// by default).
+func WithPurgeInterval(d time.Duration) ReplayCacheOption {
+	return func(o *ReplayCacheOptions) {
+		o.purgeInterval = d
+	}
+}
+
+// WithReplayCacheClock sets the function used to get the current time.
+func WithReplayCacheClock(now func() time.Time) ReplayCacheOption {
+	return func(o *ReplayCacheOptions) {
+		o.now = now
+	}
+}
+
+// NewReplayCache returns a new ReplayCache backed by the given storage provider.
+func NewReplayCache(p storage.Provider, opts ...ReplayCacheOption) (*ReplayCache, error) {
+	o := &ReplayCacheOptions{
+		purgeInterval: DefaultReplayCachePurgeInterval,
+		now:           time.Now,
+	}
+
+	for i := range opts {
+		opts[i](o)
+	}
+
+	store, err := p.OpenStore(replayCacheStoreName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open replay cache store: %w", err)
+	}
+
+	return &ReplayCache{
+		store:         store,
+		now:           o.now,
+		purgeInterval: o.purgeInterval,
+		lastPurge:     o.now(),
+	}, nil
+}
+
+// CheckAndStore returns ErrReplayedSignature if the signature was stored before and has not expired yet.
+// Otherwise, it stores the signature's digest until expiry.
+func (c *ReplayCache) CheckAndStore(signature string, expiry time.Time) error {
+	digest := sha256.Sum256([]byte(signature))
+	key := base64.RawURLEncoding.EncodeToString(digest[:])
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	b, err := c.store.Get(key)
+
+	switch {
+	case err == nil:
+		if !c.expired(b) {
+			return ErrReplayedSignature
+		}
+	case !errors.Is(err, storage.ErrDataNotFound):
+		return fmt.Errorf("failed to get signature from replay cache: %w", err)
+	}
+
+	err = c.store.Put(key, []byte(strconv.FormatInt(expiry.Unix(), 10)))
+	if err != nil {
+		return fmt.Errorf("failed to store signature in replay cache: %w", err)
+	}
+
+	if c.now().Sub(c.lastPurge) >= c.purgeInterval {
+		// a failed purge is retried with the next signature, the signature itself has been checked
+		if c.purge() == nil {
+			c.lastPurge = c.now()
+		}
+	}
+
+	return nil
+}
+
+func (c *ReplayCache) expired(value []byte) bool {
+	exp, err := strconv.ParseInt(string(value), 10, 64)
+
+	return err != nil || c.now().Unix() > exp
+}
+
+// purge deletes expired signatures from the store.
+func (c *ReplayCache) purge() error {
+	it := c.store.Iterator("", storage.EndKeySuffix)
+	defer it.Release()
+
+	var keys []string
+
+	for it.Next() {
+		if c.expired(it.Value()) {
+			keys = append(keys, string(it.Key()))
+		}
+	}
+
+	if err := it.Error(); err != nil {
+		return fmt.Errorf("failed to iterate replay cache: %w", err)
+	}
+
+	for _, k := range keys {
+		if err := c.store.Delete(k); err != nil {
+			return fmt.Errorf("failed to delete signature from replay cache: %w", err)
+		}
+	}
+
+	return nil
+}
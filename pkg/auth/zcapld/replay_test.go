@@ -0,0 +1,123 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package zcapld_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	mockstorage "github.com/hyperledger/aries-framework-go/pkg/mock/storage"
+	"github.com/hyperledger/aries-framework-go/pkg/storage"
+	"github.com/hyperledger/aries-framework-go/pkg/storage/mem"
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/hub-kms/pkg/auth/zcapld"
+)
+
+func TestNewReplayCache(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		c, err := zcapld.NewReplayCache(mem.NewProvider())
+		require.NoError(t, err)
+		require.NotNil(t, c)
+	})
+
+	t.Run("error: open store", func(t *testing.T) {
+		p := mockstorage.NewMockStoreProvider()
+		p.ErrOpenStoreHandle = errors.New("open error")
+
+		_, err := zcapld.NewReplayCache(p)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to open replay cache store")
+	})
+}
+
+func TestReplayCache_CheckAndStore(t *testing.T) {
+	t.Run("detects replayed signature", func(t *testing.T) {
+		c, err := zcapld.NewReplayCache(mem.NewProvider())
+		require.NoError(t, err)
+
+		expiry := time.Now().Add(time.Minute)
+
+		require.NoError(t, c.CheckAndStore("signature", expiry))
+		require.NoError(t, c.CheckAndStore("other signature", expiry))
+		require.True(t, errors.Is(c.CheckAndStore("signature", expiry), zcapld.ErrReplayedSignature))
+	})
+
+	t.Run("ignores expired signature", func(t *testing.T) {
+		c, err := zcapld.NewReplayCache(mem.NewProvider())
+		require.NoError(t, err)
+
+		expiry := time.Now().Add(-time.Minute)
+
+		require.NoError(t, c.CheckAndStore("signature", expiry))
+		require.NoError(t, c.CheckAndStore("signature", expiry))
+	})
+
+	t.Run("purges expired signatures", func(t *testing.T) {
+		p := mem.NewProvider()
+		now := time.Now()
+
+		c, err := zcapld.NewReplayCache(p, zcapld.WithPurgeInterval(time.Minute),
+			zcapld.WithReplayCacheClock(func() time.Time { return now }))
+		require.NoError(t, err)
+
+		require.NoError(t, c.CheckAndStore("expiring signature", now.Add(time.Second)))
+		require.NoError(t, c.CheckAndStore("signature", now.Add(time.Hour)))
+		require.Equal(t, 2, countEntries(t, p))
+
+		now = now.Add(2 * time.Minute)
+
+		require.NoError(t, c.CheckAndStore("other signature", now.Add(time.Hour)))
+		require.Equal(t, 2, countEntries(t, p), "expired signature must be purged")
+		require.True(t, errors.Is(c.CheckAndStore("signature", now), zcapld.ErrReplayedSignature))
+	})
+
+	t.Run("error: get from store", func(t *testing.T) {
+		p := mockstorage.NewMockStoreProvider()
+		p.Store.ErrGet = errors.New("get error")
+
+		c, err := zcapld.NewReplayCache(p)
+		require.NoError(t, err)
+
+		err = c.CheckAndStore("signature", time.Now())
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to get signature from replay cache")
+	})
+
+	t.Run("error: put to store", func(t *testing.T) {
+		p := mockstorage.NewMockStoreProvider()
+		p.Store.ErrPut = errors.New("put error")
+
+		c, err := zcapld.NewReplayCache(p)
+		require.NoError(t, err)
+
+		err = c.CheckAndStore("signature", time.Now())
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to store signature in replay cache")
+	})
+}
+
+func countEntries(t *testing.T, p storage.Provider) int {
+	t.Helper()
+
+	store, err := p.OpenStore("httpsigreplaycache")
+	require.NoError(t, err)
+
+	it := store.Iterator("", storage.EndKeySuffix)
+	defer it.Release()
+
+	n := 0
+
+	for it.Next() {
+		n++
+	}
+
+	require.NoError(t, it.Error())
+
+	return n
+}
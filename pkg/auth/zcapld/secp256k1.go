@@ -0,0 +1,139 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package zcapld
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcec"
+	cryptoapi "github.com/hyperledger/aries-framework-go/pkg/crypto"
+	"github.com/hyperledger/aries-framework-go/pkg/kms"
+	"github.com/hyperledger/aries-framework-go/pkg/storage"
+)
+
+const (
+	// secp256k1KeyPrefix prefixes IDs of wrapped secp256k1 keys in the zcaps store.
+	secp256k1KeyPrefix = "secp256k1key_"
+	secp256k1KeySize   = 32
+)
+
+// secp256k1Keys keeps secp256k1 signing keys, which the aries KMS can't create, in the zcaps store. Private keys
+// are encrypted with AES-256-GCM keys of the key manager, so they are protected by its secret lock.
+type secp256k1Keys struct {
+	keyManager kms.KeyManager
+	crypto     cryptoapi.Crypto
+	store      storage.Store
+}
+
+type wrappedSecp256k1Key struct {
+	KEKID      string `json:"kekID"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// create generates a new secp256k1 key and stores it wrapped with a new key encryption key.
+func (k *secp256k1Keys) create() (*secp256k1Signer, error) {
+	privKey, err := btcec.NewPrivateKey(btcec.S256())
+	if err != nil {
+		return nil, fmt.Errorf("generate secp256k1 key: %w", err)
+	}
+
+	signer := &secp256k1Signer{privKey: privKey}
+	pubKey := signer.PublicKeyBytes()
+
+	kekID, kek, err := k.keyManager.Create(kms.AES256GCMType)
+	if err != nil {
+		return nil, fmt.Errorf("create key encryption key: %w", err)
+	}
+
+	ciphertext, nonce, err := k.crypto.Encrypt(privKey.Serialize(), pubKey, kek)
+	if err != nil {
+		return nil, fmt.Errorf("wrap secp256k1 key: %w", err)
+	}
+
+	raw, err := json.Marshal(&wrappedSecp256k1Key{KEKID: kekID, Nonce: nonce, Ciphertext: ciphertext})
+	if err != nil {
+		return nil, fmt.Errorf("marshal secp256k1 key: %w", err)
+	}
+
+	if err = k.store.Put(secp256k1KeyID(pubKey), raw); err != nil {
+		return nil, fmt.Errorf("store secp256k1 key: %w", err)
+	}
+
+	return signer, nil
+}
+
+// get returns the signer of the secp256k1 key with the given uncompressed public key.
+func (k *secp256k1Keys) get(pubKey []byte) (*secp256k1Signer, error) {
+	raw, err := k.store.Get(secp256k1KeyID(pubKey))
+	if err != nil {
+		return nil, fmt.Errorf("get secp256k1 key: %w", err)
+	}
+
+	var wrapped wrappedSecp256k1Key
+
+	if err = json.Unmarshal(raw, &wrapped); err != nil {
+		return nil, fmt.Errorf("unmarshal secp256k1 key: %w", err)
+	}
+
+	kek, err := k.keyManager.Get(wrapped.KEKID)
+	if err != nil {
+		return nil, fmt.Errorf("get key encryption key %s: %w", wrapped.KEKID, err)
+	}
+
+	d, err := k.crypto.Decrypt(wrapped.Ciphertext, pubKey, wrapped.Nonce, kek)
+	if err != nil {
+		return nil, fmt.Errorf("unwrap secp256k1 key: %w", err)
+	}
+
+	privKey, _ := btcec.PrivKeyFromBytes(btcec.S256(), d)
+
+	return &secp256k1Signer{privKey: privKey}, nil
+}
+
+func secp256k1KeyID(pubKey []byte) string {
+	h := sha256.Sum256(pubKey)
+
+	return secp256k1KeyPrefix + base64.RawURLEncoding.EncodeToString(h[:])
+}
+
+// secp256k1Signer signs SHA-256 digests with a secp256k1 key and returns IEEE P1363 signatures, as expected by
+// EcdsaSecp256k1Signature2019 (ES256K) verifiers.
+type secp256k1Signer struct {
+	privKey *btcec.PrivateKey
+}
+
+// Sign signs the message.
+func (s *secp256k1Signer) Sign(msg []byte) ([]byte, error) {
+	digest := sha256.Sum256(msg)
+
+	r, sigS, err := ecdsa.Sign(rand.Reader, s.privKey.ToECDSA(), digest[:])
+	if err != nil {
+		return nil, fmt.Errorf("sign with secp256k1 key: %w", err)
+	}
+
+	sig := make([]byte, 2*secp256k1KeySize)
+	r.FillBytes(sig[:secp256k1KeySize])
+	sigS.FillBytes(sig[secp256k1KeySize:])
+
+	return sig, nil
+}
+
+// PublicKey returns the *ecdsa.PublicKey.
+func (s *secp256k1Signer) PublicKey() interface{} {
+	return s.privKey.PubKey().ToECDSA()
+}
+
+// PublicKeyBytes returns the uncompressed public key.
+func (s *secp256k1Signer) PublicKeyBytes() []byte {
+	return s.privKey.PubKey().SerializeUncompressed()
+}
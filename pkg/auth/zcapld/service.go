@@ -16,12 +16,9 @@ import (
 	"time"
 
 	cryptoapi "github.com/hyperledger/aries-framework-go/pkg/crypto"
-	"github.com/hyperledger/aries-framework-go/pkg/doc/signature/suite"
-	"github.com/hyperledger/aries-framework-go/pkg/doc/signature/suite/ed25519signature2018"
 	"github.com/hyperledger/aries-framework-go/pkg/doc/util/signature"
 	"github.com/hyperledger/aries-framework-go/pkg/kms"
 	"github.com/hyperledger/aries-framework-go/pkg/storage"
-	"github.com/hyperledger/aries-framework-go/pkg/vdr/fingerprint"
 	"github.com/igor-pavlenko/httpsignatures-go"
 	"github.com/trustbloc/edge-core/pkg/zcapld"
 	"go.opentelemetry.io/otel"
@@ -38,12 +35,40 @@ type Service struct {
 	keyManager kms.KeyManager
 	crypto     cryptoapi.Crypto
 	store      storage.Store
+	keyType    kms.KeyType
+	secp256k1  *secp256k1Keys
 }
 
 var tracer = otel.Tracer("hub-kms/zcapld") //nolint:gochecknoglobals // ignore
 
+// Options configures the zcap service.
+type Options struct {
+	keyType kms.KeyType
+}
+
+// Option configures Options.
+type Option func(options *Options)
+
+// WithKeyType sets the type of keys used to sign capabilities and HTTP requests (ED25519 by default).
+// Supported key types: ED25519, ECDSAP256IEEEP1363, ECDSAP384IEEEP1363 and ECDSASecp256k1IEEEP1363.
+func WithKeyType(kt kms.KeyType) Option {
+	return func(o *Options) {
+		o.keyType = kt
+	}
+}
+
 // New return zcap service.
-func New(keyManager kms.KeyManager, crypto cryptoapi.Crypto, sp storage.Provider) (*Service, error) {
+func New(keyManager kms.KeyManager, crypto cryptoapi.Crypto, sp storage.Provider, opts ...Option) (*Service, error) {
+	o := &Options{keyType: kms.ED25519Type}
+
+	for i := range opts {
+		opts[i](o)
+	}
+
+	if _, err := SignatureTypeForKeyType(o.keyType); err != nil {
+		return nil, err
+	}
+
 	store, err := sp.OpenStore(zcapsStoreName)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open store: %w", err)
@@ -53,6 +78,8 @@ func New(keyManager kms.KeyManager, crypto cryptoapi.Crypto, sp storage.Provider
 		keyManager: keyManager,
 		crypto:     crypto,
 		store:      store,
+		keyType:    o.keyType,
+		secp256k1:  &secp256k1Keys{keyManager: keyManager, crypto: crypto, store: store},
 	}, nil
 }
 
@@ -63,15 +90,15 @@ func (s *Service) CreateDIDKey(ctx context.Context) (string, error) {
 
 	start := time.Now()
 
-	signer, err := signature.NewCryptoSigner(s.crypto, s.keyManager, kms.ED25519)
+	signer, err := s.newSigner()
 	if err != nil {
 		return "", fmt.Errorf("failed to create crypto signer: %w", err)
 	}
 
-	span.AddEvent("signature.NewCryptoSigner completed",
+	span.AddEvent("newSigner completed",
 		trace.WithAttributes(label.String("duration", time.Since(start).String())))
 
-	return didKeyURL(signer.PublicKeyBytes()), nil
+	return DIDKeyURL(signer.PublicKeyBytes(), s.keyType)
 }
 
 // SignHeader sign header.
@@ -95,9 +122,11 @@ func (s *Service) SignHeader(req *http.Request, capabilityBytes []byte) (*http.H
 		fmt.Sprintf(`zcap capability="%s",action="%s"`, compressedZcap, action))
 
 	hs := httpsignatures.NewHTTPSignatures(&zcapld.AriesDIDKeySecrets{})
-	hs.SetSignatureHashAlgorithm(&zcapld.AriesDIDKeySignatureHashAlgorithm{
-		Crypto: s.crypto,
-		KMS:    s.keyManager,
+	hs.SetSignatureHashAlgorithm(&SignatureHashAlgorithm{
+		Crypto:      s.crypto,
+		KMS:         s.keyManager,
+		KeyResolver: &DIDKeyResolver{},
+		secp256k1:   s.secp256k1,
 	})
 
 	err = hs.Sign(capability.Invoker, req)
@@ -115,24 +144,22 @@ func (s *Service) NewCapability(ctx context.Context, options ...zcapld.Capabilit
 
 	start := time.Now()
 
-	signer, err := signature.NewCryptoSigner(s.crypto, s.keyManager, kms.ED25519)
+	signer, err := s.newSigner()
 	if err != nil {
 		return nil, fmt.Errorf("failed to create a new signer: %w", err)
 	}
 
-	span.AddEvent("signature.NewCryptoSigner completed",
+	span.AddEvent("newSigner completed",
 		trace.WithAttributes(label.String("duration", time.Since(start).String())))
 
+	zcapSigner, err := newZCAPSigner(signer, s.keyType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create zcap signer: %w", err)
+	}
+
 	startNewCapability := time.Now()
 
-	zcap, err := zcapld.NewCapability(
-		&zcapld.Signer{
-			SignatureSuite:     ed25519signature2018.New(suite.WithSigner(signer)),
-			SuiteType:          ed25519signature2018.SignatureType,
-			VerificationMethod: didKeyURL(signer.PublicKeyBytes()),
-		},
-		options...,
-	)
+	zcap, err := zcapld.NewCapability(zcapSigner, options...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create zcap: %w", err)
 	}
@@ -158,6 +185,16 @@ func (s *Service) NewCapability(ctx context.Context, options ...zcapld.Capabilit
 	return zcap, nil
 }
 
+// newSigner creates a new key of the configured type. Secp256k1 keys are created outside the aries KMS, which
+// doesn't support them.
+func (s *Service) newSigner() (signature.Signer, error) {
+	if s.keyType == kms.ECDSASecp256k1TypeIEEEP1363 {
+		return s.secp256k1.create()
+	}
+
+	return signature.NewCryptoSigner(s.crypto, s.keyManager, s.keyType)
+}
+
 // Resolve the capability.
 func (s *Service) Resolve(uri string) (*zcapld.Capability, error) {
 	raw, err := s.store.Get(uri)
@@ -201,9 +238,3 @@ func CompressZCAP(zcap *zcapld.Capability) (string, error) {
 
 	return base64.URLEncoding.EncodeToString(compressed.Bytes()), nil
 }
-
-func didKeyURL(pubKeyBytes []byte) string {
-	_, didKeyURL := fingerprint.CreateDIDKey(pubKeyBytes)
-
-	return didKeyURL
-}
@@ -11,12 +11,18 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/google/uuid"
+	"github.com/hyperledger/aries-framework-go/pkg/crypto/tinkcrypto"
+	"github.com/hyperledger/aries-framework-go/pkg/kms"
+	"github.com/hyperledger/aries-framework-go/pkg/kms/localkms"
 	mockcrypto "github.com/hyperledger/aries-framework-go/pkg/mock/crypto"
 	mockkms "github.com/hyperledger/aries-framework-go/pkg/mock/kms"
 	mockstorage "github.com/hyperledger/aries-framework-go/pkg/mock/storage"
+	"github.com/hyperledger/aries-framework-go/pkg/storage/mem"
+	"github.com/igor-pavlenko/httpsignatures-go"
 	"github.com/stretchr/testify/require"
 	zcapld2 "github.com/trustbloc/edge-core/pkg/zcapld"
 	"golang.org/x/net/context"
@@ -34,6 +40,17 @@ func TestNew(t *testing.T) {
 		require.Error(t, err)
 		require.Contains(t, err.Error(), "failed to open store")
 	})
+
+	t.Run("error if key type is not supported for signing zcaps", func(t *testing.T) {
+		_, err := zcapld.New(
+			&mockkms.KeyManager{},
+			&mockcrypto.Crypto{},
+			&mockstorage.MockStoreProvider{},
+			zcapld.WithKeyType(kms.RSARS256Type),
+		)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "unsupported key type for signing zcaps")
+	})
 }
 
 func TestService_CreateDIDKey(t *testing.T) {
@@ -61,6 +78,51 @@ func TestService_CreateDIDKey(t *testing.T) {
 	})
 }
 
+func TestService_Secp256k1(t *testing.T) {
+	t.Run("signs requests with a secp256k1 key", func(t *testing.T) {
+		keyManager, err := localkms.New("local-lock://test", &kmsProvider{sp: mem.NewProvider()})
+		require.NoError(t, err)
+
+		cryptoService, err := tinkcrypto.New()
+		require.NoError(t, err)
+
+		svc, err := zcapld.New(keyManager, cryptoService, mem.NewProvider(),
+			zcapld.WithKeyType(kms.ECDSASecp256k1TypeIEEEP1363))
+		require.NoError(t, err)
+
+		didKey, err := svc.CreateDIDKey(context.Background())
+		require.NoError(t, err)
+
+		pubKey, err := (&zcapld.DIDKeyResolver{}).Resolve(didKey)
+		require.NoError(t, err)
+		require.Equal(t, "EcdsaSecp256k1VerificationKey2019", pubKey.Type)
+
+		req := httptest.NewRequest(http.MethodPost, "/test", nil)
+
+		_, err = svc.SignHeader(req, []byte(fmt.Sprintf(`{"id":"urn:zcap:test","invoker":%q}`, didKey)))
+		require.NoError(t, err)
+
+		hs := httpsignatures.NewHTTPSignatures(&zcapld2.AriesDIDKeySecrets{})
+		hs.SetSignatureHashAlgorithm(&zcapld.SignatureHashAlgorithm{KeyResolver: &zcapld.DIDKeyResolver{}})
+
+		require.NoError(t, hs.Verify(req))
+	})
+
+	t.Run("error if cannot wrap secp256k1 key", func(t *testing.T) {
+		svc, err := zcapld.New(
+			&mockkms.KeyManager{},
+			&mockcrypto.Crypto{EncryptErr: errors.New("test")},
+			&mockstorage.MockStoreProvider{},
+			zcapld.WithKeyType(kms.ECDSASecp256k1TypeIEEEP1363),
+		)
+		require.NoError(t, err)
+
+		_, err = svc.CreateDIDKey(context.Background())
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "wrap secp256k1 key")
+	})
+}
+
 func TestService_SignHeader(t *testing.T) {
 	t.Run("test error from parse capability", func(t *testing.T) {
 		svc, err := zcapld.New(&mockkms.KeyManager{}, &mockcrypto.Crypto{}, &mockstorage.MockStoreProvider{})
@@ -0,0 +1,94 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package zcapld
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/aries-framework-go/pkg/doc/signature/suite"
+	"github.com/hyperledger/aries-framework-go/pkg/doc/signature/suite/ecdsasecp256k1signature2019"
+	"github.com/hyperledger/aries-framework-go/pkg/doc/signature/suite/ed25519signature2018"
+	"github.com/hyperledger/aries-framework-go/pkg/doc/signature/suite/jsonwebsignature2020"
+	"github.com/hyperledger/aries-framework-go/pkg/doc/signature/verifier"
+	"github.com/hyperledger/aries-framework-go/pkg/doc/util/signature"
+	"github.com/hyperledger/aries-framework-go/pkg/kms"
+	"github.com/trustbloc/edge-core/pkg/zcapld"
+)
+
+// Signature suites supported for zcaps.
+const (
+	Ed25519Signature2018        = ed25519signature2018.SignatureType
+	JSONWebSignature2020        = "JsonWebSignature2020"
+	EcdsaSecp256k1Signature2019 = "EcdsaSecp256k1Signature2019"
+)
+
+// SignatureSuites returns verifier signature suites for the given signature types.
+func SignatureSuites(types ...string) ([]verifier.SignatureSuite, error) {
+	suites := make([]verifier.SignatureSuite, 0, len(types))
+
+	for _, t := range types {
+		switch t {
+		case Ed25519Signature2018:
+			suites = append(suites,
+				ed25519signature2018.New(suite.WithVerifier(ed25519signature2018.NewPublicKeyVerifier())))
+		case JSONWebSignature2020:
+			suites = append(suites,
+				jsonwebsignature2020.New(suite.WithVerifier(jsonwebsignature2020.NewPublicKeyVerifier())))
+		case EcdsaSecp256k1Signature2019:
+			suites = append(suites, ecdsasecp256k1signature2019.New(
+				suite.WithVerifier(ecdsasecp256k1signature2019.NewPublicKeyVerifier())))
+		default:
+			return nil, fmt.Errorf("unsupported signature suite: %s", t)
+		}
+	}
+
+	return suites, nil
+}
+
+// SignatureTypeForKeyType returns the signature suite used to sign zcaps with keys of the given type.
+func SignatureTypeForKeyType(kt kms.KeyType) (string, error) {
+	switch kt {
+	case kms.ED25519Type:
+		return Ed25519Signature2018, nil
+	case kms.ECDSAP256TypeIEEEP1363, kms.ECDSAP384TypeIEEEP1363:
+		return JSONWebSignature2020, nil
+	case kms.ECDSASecp256k1TypeIEEEP1363:
+		return EcdsaSecp256k1Signature2019, nil
+	default:
+		return "", fmt.Errorf("unsupported key type for signing zcaps: %s", kt)
+	}
+}
+
+func newZCAPSigner(signer signature.Signer, kt kms.KeyType) (*zcapld.Signer, error) {
+	suiteType, err := SignatureTypeForKeyType(kt)
+	if err != nil {
+		return nil, err
+	}
+
+	verificationMethod, err := DIDKeyURL(signer.PublicKeyBytes(), kt)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &zcapld.Signer{
+		SuiteType:          suiteType,
+		VerificationMethod: verificationMethod,
+	}
+
+	switch suiteType {
+	case Ed25519Signature2018:
+		s.SignatureSuite = ed25519signature2018.New(suite.WithSigner(signer))
+	case JSONWebSignature2020:
+		s.SignatureSuite = jsonwebsignature2020.New(suite.WithSigner(signer))
+	case EcdsaSecp256k1Signature2019:
+		s.SignatureSuite = ecdsasecp256k1signature2019.New(suite.WithSigner(signer))
+	default:
+		return nil, fmt.Errorf("unsupported signature suite for signing zcaps: %s", suiteType)
+	}
+
+	return s, nil
+}
@@ -0,0 +1,52 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package zcapld_test
+
+import (
+	"testing"
+
+	"github.com/hyperledger/aries-framework-go/pkg/kms"
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/hub-kms/pkg/auth/zcapld"
+)
+
+func TestSignatureSuites(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		suites, err := zcapld.SignatureSuites(zcapld.Ed25519Signature2018, zcapld.JSONWebSignature2020,
+			zcapld.EcdsaSecp256k1Signature2019)
+		require.NoError(t, err)
+		require.Len(t, suites, 3)
+
+		require.True(t, suites[0].Accept(zcapld.Ed25519Signature2018))
+		require.True(t, suites[1].Accept(zcapld.JSONWebSignature2020))
+		require.True(t, suites[2].Accept(zcapld.EcdsaSecp256k1Signature2019))
+	})
+
+	t.Run("error: unsupported signature suite", func(t *testing.T) {
+		_, err := zcapld.SignatureSuites("invalid")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "unsupported signature suite")
+	})
+}
+
+func TestSignatureTypeForKeyType(t *testing.T) {
+	suite, err := zcapld.SignatureTypeForKeyType(kms.ED25519Type)
+	require.NoError(t, err)
+	require.Equal(t, zcapld.Ed25519Signature2018, suite)
+
+	suite, err = zcapld.SignatureTypeForKeyType(kms.ECDSAP256TypeIEEEP1363)
+	require.NoError(t, err)
+	require.Equal(t, zcapld.JSONWebSignature2020, suite)
+
+	suite, err = zcapld.SignatureTypeForKeyType(kms.ECDSASecp256k1TypeIEEEP1363)
+	require.NoError(t, err)
+	require.Equal(t, zcapld.EcdsaSecp256k1Signature2019, suite)
+
+	_, err = zcapld.SignatureTypeForKeyType(kms.RSARS256Type)
+	require.Error(t, err)
+}
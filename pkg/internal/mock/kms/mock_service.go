@@ -20,22 +20,39 @@ var _ kms.Service = (*MockService)(nil)
 // MockService is a mock KMS service.
 type MockService struct {
 	CreateKeystoreValue  *kms.KeystoreData
+	CreateKeystoreShare  []byte
 	ResolveKeystoreValue keystore.Keystore
 	GetKeystoreDataValue *kms.KeystoreData
+	UnlockKeystoreValue  *kms.Session
+	RotateSharesValue    []byte
+	QueryKeystoresValue  *kms.KeystorePage
 	CreateKeystoreErr    error
 	ResolveKeystoreErr   error
 	GetKeystoreDataErr   error
 	SaveKeystoreDataErr  error
+	UnlockKeystoreErr    error
+	LockKeystoreErr      error
+	RotateSharesErr      error
+	QueryKeystoresErr    error
+	// CreateKeystoreOptions are options of the last CreateKeystore call.
+	CreateKeystoreOptions *kms.CreateKeystoreOptions
 	mockcrypto.Crypto
 }
 
 // CreateKeystore creates a new Keystore.
-func (s *MockService) CreateKeystore(controller, vaultID string) (*kms.KeystoreData, error) {
+func (s *MockService) CreateKeystore(_ *http.Request, controller, vaultID string,
+	options ...kms.CreateKeystoreOption) (*kms.KeystoreData, []byte, error) {
+	s.CreateKeystoreOptions = &kms.CreateKeystoreOptions{}
+
+	for i := range options {
+		options[i](s.CreateKeystoreOptions)
+	}
+
 	if s.CreateKeystoreErr != nil {
-		return nil, s.CreateKeystoreErr
+		return nil, nil, s.CreateKeystoreErr
 	}
 
-	return s.CreateKeystoreValue, nil
+	return s.CreateKeystoreValue, s.CreateKeystoreShare, nil
 }
 
 // ResolveKeystore resolves Keystore for the given request.
@@ -47,6 +64,29 @@ func (s *MockService) ResolveKeystore(req *http.Request) (keystore.Keystore, err
 	return s.ResolveKeystoreValue, nil
 }
 
+// UnlockKeystore opens the unlock session of the keystore.
+func (s *MockService) UnlockKeystore(req *http.Request) (*kms.Session, error) {
+	if s.UnlockKeystoreErr != nil {
+		return nil, s.UnlockKeystoreErr
+	}
+
+	return s.UnlockKeystoreValue, nil
+}
+
+// LockKeystore closes the unlock session of the keystore.
+func (s *MockService) LockKeystore(req *http.Request) error {
+	return s.LockKeystoreErr
+}
+
+// RotateSecretShares replaces secret shares of the keystore.
+func (s *MockService) RotateSecretShares(req *http.Request) ([]byte, error) {
+	if s.RotateSharesErr != nil {
+		return nil, s.RotateSharesErr
+	}
+
+	return s.RotateSharesValue, nil
+}
+
 // GetKeystoreData retrieves Keystore metadata.
 func (s *MockService) GetKeystoreData(keystoreID string) (*kms.KeystoreData, error) {
 	if s.GetKeystoreDataErr != nil {
@@ -56,11 +96,22 @@ func (s *MockService) GetKeystoreData(keystoreID string) (*kms.KeystoreData, err
 	return s.GetKeystoreDataValue, nil
 }
 
-// SaveKeystoreData saves Keystore metadata.
+// SaveKeystoreData saves Keystore metadata and increments its revision.
 func (s *MockService) SaveKeystoreData(keystoreData *kms.KeystoreData) error {
 	if s.SaveKeystoreDataErr != nil {
 		return s.SaveKeystoreDataErr
 	}
 
+	keystoreData.Revision++
+
 	return nil
 }
+
+// QueryKeystores returns a page of keystores selected with the query.
+func (s *MockService) QueryKeystores(query *kms.KeystoreQuery) (*kms.KeystorePage, error) {
+	if s.QueryKeystoresErr != nil {
+		return nil, s.QueryKeystoresErr
+	}
+
+	return s.QueryKeystoresValue, nil
+}
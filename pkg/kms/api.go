@@ -18,10 +18,15 @@ import (
 
 // Service manages key stores data and provides support for crypto operations.
 type Service interface {
-	CreateKeystore(controller, vaultID string) (*KeystoreData, error)
+	CreateKeystore(req *http.Request, controller, vaultID string, options ...CreateKeystoreOption) (*KeystoreData,
+		[]byte, error)
 	ResolveKeystore(req *http.Request) (keystore.Keystore, error)
+	UnlockKeystore(req *http.Request) (*Session, error)
+	LockKeystore(req *http.Request) error
+	RotateSecretShares(req *http.Request) ([]byte, error)
 	GetKeystoreData(keystoreID string) (*KeystoreData, error)
 	SaveKeystoreData(data *KeystoreData) error
+	QueryKeystores(query *KeystoreQuery) (*KeystorePage, error)
 	crypto.Crypto
 }
 
@@ -33,5 +38,73 @@ type KeystoreData struct {
 	MACKeyID       string          `json:"macKeyID,omitempty"`
 	VaultID        string          `json:"vaultID,omitempty"`
 	EDVCapability  json.RawMessage `json:"edvCapability,omitempty"`
-	CreatedAt      *time.Time      `json:"createdAt"`
+	SecretShares   *SecretShares   `json:"secretShares,omitempty"`
+	// StorageType and SecretLockType are chosen when the keystore is created. Keystores created before they were
+	// recorded use the default types of the server.
+	StorageType    string     `json:"storageType,omitempty"`
+	SecretLockType string     `json:"secretLockType,omitempty"`
+	CreatedAt      *time.Time `json:"createdAt"`
+	// Revision is incremented each time the data is saved. SaveKeystoreData rejects data with an outdated revision.
+	Revision int `json:"revision,omitempty"`
+	// Migration is set while keysets of the keystore are migrated to its storage type by StorageMigrator.
+	Migration *KeystoreMigration `json:"migration,omitempty"`
+}
+
+// KeystoreMigration is the migration of keysets of the keystore to its storage type. Keysets not found in the
+// storage of the keystore are read from the source storage and copied to it.
+type KeystoreMigration struct {
+	SourceStorageType string     `json:"sourceStorageType"`
+	SwitchedAt        *time.Time `json:"switchedAt"`
+}
+
+// SecretShares defines the k-of-n secret split lock of the keystore. The keystore secret is split into shares held
+// by the providers, the keystore is unlocked with any Threshold of them. Providers other than the header one must
+// store a share per keystore.
+type SecretShares struct {
+	Threshold int      `json:"threshold"`
+	Providers []string `json:"providers"`
+}
+
+// CreateKeystoreOptions holds options for creating the keystore.
+type CreateKeystoreOptions struct {
+	SecretShares   *SecretShares
+	StorageType    string
+	SecretLockType string
+	ProvisionVault bool
+}
+
+// CreateKeystoreOption configures CreateKeystoreOptions.
+type CreateKeystoreOption func(options *CreateKeystoreOptions)
+
+// WithSecretShares protects the keystore with the k-of-n secret split lock.
+func WithSecretShares(threshold int, providers ...string) CreateKeystoreOption {
+	return func(o *CreateKeystoreOptions) {
+		o.SecretShares = &SecretShares{
+			Threshold: threshold,
+			Providers: providers,
+		}
+	}
+}
+
+// WithStorageType sets the storage of keysets of the keystore, one of the storage types allowed by the server.
+func WithStorageType(storageType string) CreateKeystoreOption {
+	return func(o *CreateKeystoreOptions) {
+		o.StorageType = storageType
+	}
+}
+
+// WithSecretLockType sets the secret lock that protects keysets of the keystore, one of the secret lock types allowed
+// by the server.
+func WithSecretLockType(secretLockType string) CreateKeystoreOption {
+	return func(o *CreateKeystoreOptions) {
+		o.SecretLockType = secretLockType
+	}
+}
+
+// WithVaultProvisioning creates the EDV vault of the keystore, so the vault ID is not passed to CreateKeystore.
+// The keystore must have the edv storage type.
+func WithVaultProvisioning() CreateKeystoreOption {
+	return func(o *CreateKeystoreOptions) {
+		o.ProvisionVault = true
+	}
 }
@@ -0,0 +1,473 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package kms
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/aries-framework-go/pkg/storage"
+)
+
+// Index entries are kept in the keystore metadata store next to the records. Keys of the entries end with the creation
+// time and the keystore ID, so the entries of each index value are ordered by creation time:
+//
+//	index|controller|<base64url(controller)>|<createdAt>|<keystoreID>
+//	index|vault|<base64url(vaultID)>|<createdAt>|<keystoreID>
+//	index|created|<createdAt>|<keystoreID>
+const (
+	indexPrefix           = "index|"
+	controllerIndexPrefix = indexPrefix + "controller|"
+	vaultIndexPrefix      = indexPrefix + "vault|"
+	createdIndexPrefix    = indexPrefix + "created|"
+	indexVersionKey       = indexPrefix + "version"
+	indexVersion          = "2" // 2: types of keystores are backfilled
+	indexSeparator        = "|"
+	indexTimeFormat       = "20060102150405.000000000"
+)
+
+const (
+	// DefaultQueryLimit is the number of keystores returned by QueryKeystores if the limit is not set.
+	DefaultQueryLimit = 100
+	// MaxQueryLimit is the maximum number of keystores returned by QueryKeystores.
+	MaxQueryLimit = 1000
+)
+
+// ErrInvalidQuery is returned by QueryKeystores for the invalid cursor or limit.
+var ErrInvalidQuery = errors.New("invalid keystore query")
+
+// KeystoreQuery selects keystores by the controller, the EDV vault ID and the creation time. All set criteria must
+// match. Keystores are returned in order of creation.
+type KeystoreQuery struct {
+	Controller    string
+	VaultID       string
+	CreatedAfter  *time.Time // exclusive
+	CreatedBefore *time.Time // exclusive
+	// Cursor is NextCursor of the previous page, empty for the first page.
+	Cursor string
+	// Limit is the maximum number of keystores on the page. Defaults to DefaultQueryLimit.
+	Limit int
+}
+
+// KeystorePage is a page of keystores returned by QueryKeystores.
+type KeystorePage struct {
+	Keystores []*KeystoreData `json:"keystores"`
+	// NextCursor is the cursor of the next page, empty if this page is the last one.
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+// QueryKeystores returns a page of keystores selected with the query. Keystores indexed before the record was
+// changed or removed by another instance are skipped, so each returned keystore matches the query.
+func (s *service) QueryKeystores(query *KeystoreQuery) (*KeystorePage, error) {
+	limit := query.Limit
+	if limit == 0 {
+		limit = DefaultQueryLimit
+	}
+
+	if limit < 0 || limit > MaxQueryLimit {
+		return nil, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidQuery, MaxQueryLimit)
+	}
+
+	after, err := decodeCursor(query.Cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.ensureIndexes(); err != nil {
+		return nil, fmt.Errorf("query keystores: %w", err)
+	}
+
+	page := &KeystorePage{Keystores: []*KeystoreData{}}
+
+	err = s.scanIndex(queryIndexPrefix(query), seekPosition(after, query), func(e *indexEntry) (bool, error) {
+		if query.CreatedBefore != nil && e.createdAt >= indexTime(query.CreatedBefore) {
+			return false, nil
+		}
+
+		if e.position() <= after || !e.createdIn(query) {
+			return true, nil
+		}
+
+		if len(page.Keystores) == limit {
+			page.NextCursor = encodeCursor(page.Keystores[limit-1])
+
+			return false, nil
+		}
+
+		kd, err := s.GetKeystoreData(e.id)
+		if errors.Is(err, storage.ErrDataNotFound) {
+			return true, nil
+		}
+
+		if err != nil {
+			return false, err
+		}
+
+		if matches(kd, query) && indexTime(kd.CreatedAt) == e.createdAt {
+			page.Keystores = append(page.Keystores, kd)
+		}
+
+		return true, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("query keystores: %w", err)
+	}
+
+	return page, nil
+}
+
+// seekPosition returns the position from which the index is scanned: the cursor or the start of the creation time
+// range, whichever is later.
+func seekPosition(after string, query *KeystoreQuery) string {
+	if query.CreatedAfter != nil && indexTime(query.CreatedAfter) > after {
+		return indexTime(query.CreatedAfter)
+	}
+
+	return after
+}
+
+// queryIndexPrefix selects the most specific index for the query.
+func queryIndexPrefix(query *KeystoreQuery) string {
+	switch {
+	case query.Controller != "":
+		return controllerIndexPrefix + encodeIndexValue(query.Controller) + indexSeparator
+	case query.VaultID != "":
+		return vaultIndexPrefix + encodeIndexValue(query.VaultID) + indexSeparator
+	default:
+		return createdIndexPrefix
+	}
+}
+
+func matches(kd *KeystoreData, query *KeystoreQuery) bool {
+	return (query.Controller == "" || kd.Controller == query.Controller) &&
+		(query.VaultID == "" || kd.VaultID == query.VaultID)
+}
+
+type indexEntry struct {
+	createdAt string
+	id        string
+}
+
+// position orders entries across indexes and is the cursor of the entry.
+func (e *indexEntry) position() string {
+	return e.createdAt + indexSeparator + e.id
+}
+
+func (e *indexEntry) createdIn(query *KeystoreQuery) bool {
+	return (query.CreatedAfter == nil || e.createdAt > indexTime(query.CreatedAfter)) &&
+		(query.CreatedBefore == nil || e.createdAt < indexTime(query.CreatedBefore))
+}
+
+// scanIndex calls visit for entries of the index with the given prefix in order of creation until visit returns
+// false. If the store iterates over key ranges, the scan starts at the seek position, so a page costs as many reads
+// as it has entries. Otherwise all entries of the index are read and sorted.
+func (s *service) scanIndex(prefix, seek string, visit func(e *indexEntry) (bool, error)) error {
+	if !s.rangeIterator {
+		seek = ""
+	}
+
+	it := s.store.Iterator(prefix+seek, prefix+storage.EndKeySuffix)
+	defer it.Release()
+
+	var entries []*indexEntry
+
+	for it.Next() {
+		e, ok := parseIndexKey(prefix, string(it.Key()))
+		if !ok {
+			continue
+		}
+
+		if !s.rangeIterator {
+			entries = append(entries, e)
+
+			continue
+		}
+
+		next, err := visit(e)
+		if err != nil || !next {
+			return err
+		}
+	}
+
+	if err := it.Error(); err != nil {
+		return fmt.Errorf("iterate index: %w", err)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].position() < entries[j].position()
+	})
+
+	for _, e := range entries {
+		next, err := visit(e)
+		if err != nil || !next {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func parseIndexKey(prefix, key string) (*indexEntry, bool) {
+	if !strings.HasPrefix(key, prefix) {
+		return nil, false
+	}
+
+	parts := strings.Split(strings.TrimPrefix(key, prefix), indexSeparator)
+	if len(parts) != 2 { //nolint:gomnd // <createdAt>|<keystoreID>
+		return nil, false
+	}
+
+	return &indexEntry{createdAt: parts[0], id: parts[1]}, true
+}
+
+// supportsRangeIteration checks whether the store iterator starts at the first key not less than the start key.
+// Some stores, e.g. the aries mem store, iterate only over keys that begin with the start key, so the index cannot
+// be scanned from a position. No key begins with the probe, but the index version key follows it.
+func (s *service) supportsRangeIteration() (bool, error) {
+	it := s.store.Iterator(indexPrefix+"u", indexPrefix+"w")
+	defer it.Release()
+
+	found := false
+
+	for it.Next() {
+		if string(it.Key()) == indexVersionKey {
+			found = true
+		}
+	}
+
+	if err := it.Error(); err != nil {
+		return false, fmt.Errorf("iterate index: %w", err)
+	}
+
+	return found, nil
+}
+
+// indexKeys returns keys of index entries of the keystore.
+func indexKeys(kd *KeystoreData) []string {
+	suffix := indexSeparator + indexTime(kd.CreatedAt) + indexSeparator + kd.ID
+
+	keys := []string{createdIndexPrefix + indexTime(kd.CreatedAt) + indexSeparator + kd.ID}
+
+	if kd.Controller != "" {
+		keys = append(keys, controllerIndexPrefix+encodeIndexValue(kd.Controller)+suffix)
+	}
+
+	if kd.VaultID != "" {
+		keys = append(keys, vaultIndexPrefix+encodeIndexValue(kd.VaultID)+suffix)
+	}
+
+	return keys
+}
+
+// saveWithIndexes saves the keystore record with its index entries, old is the previous version of the record or nil
+// and oldRecord is its stored value. New entries are added before the record, so the record is never saved without
+// them, and are removed if the record is not saved. Entries are kept on a revision conflict, since the version saved
+// by another instance may have the same ones. Stale entries of the previous version are removed after it. The caller
+// holds indexMu.
+func (s *service) saveWithIndexes(kd, old *KeystoreData, oldRecord, record []byte) error {
+	var oldKeys []string
+
+	if old != nil {
+		oldKeys = indexKeys(old)
+	}
+
+	added := difference(indexKeys(kd), oldKeys)
+
+	for i, key := range added {
+		if err := s.store.Put(key, []byte(kd.ID)); err != nil {
+			s.deleteKeys(added[:i])
+
+			return err
+		}
+	}
+
+	if err := s.putRecord(kd.ID, oldRecord, record); err != nil {
+		if !errors.Is(err, ErrRevisionConflict) {
+			s.deleteKeys(added)
+		}
+
+		return err
+	}
+
+	// stale entries that are not removed are skipped by queries
+	s.deleteKeys(difference(oldKeys, indexKeys(kd)))
+
+	return nil
+}
+
+// ensureIndexes indexes keystores saved before indexes were introduced and checks how the store iterates over keys.
+// It runs once for the service.
+func (s *service) ensureIndexes() error {
+	s.indexMu.Lock()
+	defer s.indexMu.Unlock()
+
+	if s.indexed {
+		return nil
+	}
+
+	v, err := s.store.Get(indexVersionKey)
+	if err != nil && !errors.Is(err, storage.ErrDataNotFound) {
+		return fmt.Errorf("get index version: %w", err)
+	}
+
+	if err != nil || string(v) != indexVersion {
+		if err = s.reindex(); err != nil {
+			return err
+		}
+
+		if err = s.store.Put(indexVersionKey, []byte(indexVersion)); err != nil {
+			return fmt.Errorf("save index version: %w", err)
+		}
+	}
+
+	s.rangeIterator, err = s.supportsRangeIteration()
+	if err != nil {
+		return err
+	}
+
+	s.indexed = true
+
+	return nil
+}
+
+func (s *service) reindex() error {
+	it := s.store.Iterator("", storage.EndKeySuffix)
+	defer it.Release()
+
+	for it.Next() {
+		if strings.HasPrefix(string(it.Key()), indexPrefix) {
+			continue
+		}
+
+		var kd KeystoreData
+
+		if err := json.Unmarshal(it.Value(), &kd); err != nil || kd.ID == "" {
+			continue
+		}
+
+		for _, key := range indexKeys(&kd) {
+			if err := s.store.Put(key, []byte(kd.ID)); err != nil {
+				return fmt.Errorf("index keystore %s: %w", kd.ID, err)
+			}
+		}
+
+		if err := s.backfillRecord(it.Value(), &kd); err != nil {
+			return fmt.Errorf("backfill keystore %s: %w", kd.ID, err)
+		}
+	}
+
+	if err := it.Error(); err != nil {
+		return fmt.Errorf("iterate keystores: %w", err)
+	}
+
+	return nil
+}
+
+// backfillRecord saves the keystore record with its types recorded. The record changed by another instance in the
+// meantime is skipped, since it is saved with the types.
+func (s *service) backfillRecord(oldRecord []byte, kd *KeystoreData) error {
+	if !s.backfillTypes(kd) {
+		return nil
+	}
+
+	record, err := json.Marshal(kd)
+	if err != nil {
+		return err
+	}
+
+	if err = s.putRecord(kd.ID, oldRecord, record); err != nil && !errors.Is(err, ErrRevisionConflict) {
+		return err
+	}
+
+	return nil
+}
+
+// conditionalStore is implemented by stores that replace a value only if it was not changed after it was read,
+// e.g. the SQL and bolt stores.
+type conditionalStore interface {
+	PutIf(k string, old, v []byte) (bool, error)
+}
+
+// putRecord saves the keystore record. If the store supports conditional writes, the record is saved only if its
+// stored value is still oldRecord (or it does not exist if oldRecord is nil), otherwise ErrRevisionConflict is
+// returned.
+func (s *service) putRecord(id string, oldRecord, record []byte) error {
+	cs, ok := s.store.(conditionalStore)
+	if !ok {
+		return s.store.Put(id, record)
+	}
+
+	stored, err := cs.PutIf(id, oldRecord, record)
+	if err != nil {
+		return err
+	}
+
+	if !stored {
+		return fmt.Errorf("%w: keystore %s was changed by another instance", ErrRevisionConflict, id)
+	}
+
+	return nil
+}
+
+func (s *service) deleteKeys(keys []string) {
+	for _, key := range keys {
+		_ = s.store.Delete(key) //nolint:errcheck // best effort, stale index entries are skipped by queries
+	}
+}
+
+// difference returns keys of a not in b.
+func difference(a, b []string) []string {
+	var d []string
+
+	for _, x := range a {
+		found := false
+
+		for _, y := range b {
+			if x == y {
+				found = true
+
+				break
+			}
+		}
+
+		if !found {
+			d = append(d, x)
+		}
+	}
+
+	return d
+}
+
+func indexTime(t *time.Time) string {
+	if t == nil {
+		return time.Time{}.Format(indexTimeFormat)
+	}
+
+	return t.UTC().Format(indexTimeFormat)
+}
+
+func encodeIndexValue(v string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(v))
+}
+
+func encodeCursor(kd *KeystoreData) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(indexTime(kd.CreatedAt) + indexSeparator + kd.ID))
+}
+
+func decodeCursor(cursor string) (string, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || (cursor != "" && !strings.Contains(string(b), indexSeparator)) {
+		return "", fmt.Errorf("%w: malformed cursor", ErrInvalidQuery)
+	}
+
+	return string(b), nil
+}
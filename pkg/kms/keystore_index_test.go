@@ -0,0 +1,445 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package kms_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	mockkms "github.com/hyperledger/aries-framework-go/pkg/mock/kms"
+	mockstorage "github.com/hyperledger/aries-framework-go/pkg/mock/storage"
+	"github.com/hyperledger/aries-framework-go/pkg/storage"
+	"github.com/hyperledger/aries-framework-go/pkg/storage/mem"
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/hub-kms/pkg/kms"
+	"github.com/trustbloc/hub-kms/pkg/storage/bolt"
+)
+
+func TestQueryKeystores(t *testing.T) {
+	t.Run("Store matches start key as prefix", func(t *testing.T) {
+		testQueryKeystores(t, mem.NewProvider())
+	})
+
+	t.Run("Store iterates over key ranges", func(t *testing.T) {
+		testQueryKeystores(t, newBoltProvider(t))
+	})
+}
+
+func testQueryKeystores(t *testing.T, p storage.Provider) {
+	t.Helper()
+
+	svc := newIndexedService(t, p)
+
+	base := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 5; i++ {
+		createdAt := base.Add(time.Duration(i) * time.Hour)
+		controller := "did:example:alice"
+
+		if i%2 == 1 {
+			controller = "did:example:bob"
+		}
+
+		require.NoError(t, svc.SaveKeystoreData(&kms.KeystoreData{
+			ID:         fmt.Sprintf("keystore%d", 4-i), // IDs are not ordered by creation time
+			Controller: controller,
+			VaultID:    fmt.Sprintf("vault%d", i%3),
+			CreatedAt:  &createdAt,
+		}))
+	}
+
+	t.Run("By controller in order of creation", func(t *testing.T) {
+		page, err := svc.QueryKeystores(&kms.KeystoreQuery{Controller: "did:example:alice"})
+		require.NoError(t, err)
+		require.Equal(t, []string{"keystore4", "keystore2", "keystore0"}, ids(page))
+		require.Empty(t, page.NextCursor)
+	})
+
+	t.Run("By vault ID", func(t *testing.T) {
+		page, err := svc.QueryKeystores(&kms.KeystoreQuery{VaultID: "vault0"})
+		require.NoError(t, err)
+		require.Equal(t, []string{"keystore4", "keystore1"}, ids(page))
+	})
+
+	t.Run("By controller and vault ID", func(t *testing.T) {
+		page, err := svc.QueryKeystores(&kms.KeystoreQuery{Controller: "did:example:bob", VaultID: "vault1"})
+		require.NoError(t, err)
+		require.Equal(t, []string{"keystore3"}, ids(page))
+	})
+
+	t.Run("By creation time", func(t *testing.T) {
+		after := base
+		before := base.Add(3 * time.Hour)
+
+		page, err := svc.QueryKeystores(&kms.KeystoreQuery{CreatedAfter: &after, CreatedBefore: &before})
+		require.NoError(t, err)
+		require.Equal(t, []string{"keystore3", "keystore2"}, ids(page))
+	})
+
+	t.Run("Paginate all keystores", func(t *testing.T) {
+		var (
+			all    []string
+			cursor string
+			pages  int
+		)
+
+		for {
+			page, err := svc.QueryKeystores(&kms.KeystoreQuery{Cursor: cursor, Limit: 2})
+			require.NoError(t, err)
+
+			all = append(all, ids(page)...)
+			pages++
+
+			if page.NextCursor == "" {
+				break
+			}
+
+			cursor = page.NextCursor
+		}
+
+		require.Equal(t, 3, pages)
+		require.Equal(t, []string{"keystore4", "keystore3", "keystore2", "keystore1", "keystore0"}, all)
+	})
+
+	t.Run("No keystores for unknown controller", func(t *testing.T) {
+		page, err := svc.QueryKeystores(&kms.KeystoreQuery{Controller: "did:example:carol"})
+		require.NoError(t, err)
+		require.Empty(t, page.Keystores)
+	})
+
+	t.Run("Fail with invalid query", func(t *testing.T) {
+		for _, q := range []*kms.KeystoreQuery{
+			{Limit: -1},
+			{Limit: kms.MaxQueryLimit + 1},
+			{Cursor: "not a cursor!"},
+			{Cursor: "YWJj"},
+		} {
+			_, err := svc.QueryKeystores(q)
+			require.True(t, errors.Is(err, kms.ErrInvalidQuery))
+		}
+	})
+}
+
+func TestQueryKeystoresReadsOnlyPage(t *testing.T) {
+	provider := &countingProvider{Provider: newBoltProvider(t)}
+	svc := newIndexedService(t, provider)
+
+	const count = 50
+
+	base := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for i := 0; i < count; i++ {
+		createdAt := base.Add(time.Duration(i) * time.Minute)
+
+		require.NoError(t, svc.SaveKeystoreData(&kms.KeystoreData{
+			ID:         fmt.Sprintf("keystore%02d", i),
+			Controller: "did:example:alice",
+			CreatedAt:  &createdAt,
+		}))
+	}
+
+	page, err := svc.QueryKeystores(&kms.KeystoreQuery{Controller: "did:example:alice", Limit: 5})
+	require.NoError(t, err)
+
+	provider.iterated = 0
+
+	page, err = svc.QueryKeystores(&kms.KeystoreQuery{
+		Controller: "did:example:alice",
+		Cursor:     page.NextCursor,
+		Limit:      5,
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"keystore05", "keystore06", "keystore07", "keystore08", "keystore09"}, ids(page))
+	require.NotEmpty(t, page.NextCursor)
+	require.LessOrEqual(t, provider.iterated, 7, "the index is read from the cursor to the end of the page")
+
+	provider.iterated = 0
+	after := base.Add(44 * time.Minute)
+
+	page, err = svc.QueryKeystores(&kms.KeystoreQuery{CreatedAfter: &after})
+	require.NoError(t, err)
+	require.Equal(t, []string{"keystore45", "keystore46", "keystore47", "keystore48", "keystore49"}, ids(page))
+	require.LessOrEqual(t, provider.iterated, 6, "the index is read from the creation time")
+}
+
+func TestSaveKeystoreDataUpdatesIndexes(t *testing.T) {
+	provider := mockstorage.NewMockStoreProvider()
+	svc := newIndexedService(t, provider)
+
+	kd := testKeystoreData()
+	require.NoError(t, svc.SaveKeystoreData(kd))
+
+	kd.Controller = "did:example:new"
+	require.NoError(t, svc.SaveKeystoreData(kd))
+
+	page, err := svc.QueryKeystores(&kms.KeystoreQuery{Controller: testController})
+	require.NoError(t, err)
+	require.Empty(t, page.Keystores)
+
+	page, err = svc.QueryKeystores(&kms.KeystoreQuery{Controller: "did:example:new"})
+	require.NoError(t, err)
+	require.Equal(t, []string{testKeystoreID}, ids(page))
+
+	require.Equal(t, 3, countIndexEntries(provider.Store), "stale entry is removed")
+
+	t.Run("Stale entries are skipped", func(t *testing.T) {
+		b, err := json.Marshal(&kms.KeystoreData{ID: testKeystoreID, Controller: "did:example:other"})
+		require.NoError(t, err)
+
+		provider.Store.Store[testKeystoreID] = b // changed by another instance
+
+		page, err := svc.QueryKeystores(&kms.KeystoreQuery{Controller: "did:example:new"})
+		require.NoError(t, err)
+		require.Empty(t, page.Keystores)
+
+		delete(provider.Store.Store, testKeystoreID)
+
+		page, err = svc.QueryKeystores(&kms.KeystoreQuery{})
+		require.NoError(t, err)
+		require.Empty(t, page.Keystores)
+	})
+}
+
+func TestSaveKeystoreDataRollsBackIndexes(t *testing.T) {
+	store := &failingStore{MockStore: &mockstorage.MockStore{Store: map[string][]byte{}}, failKey: testKeystoreID}
+
+	svc := newIndexedService(t, mockstorage.NewCustomMockStoreProvider(store))
+
+	err := svc.SaveKeystoreData(testKeystoreData())
+	require.EqualError(t, err, "put error")
+	require.Zero(t, countIndexEntries(store.MockStore), "index entries are removed")
+}
+
+func TestSaveKeystoreDataConflictsAcrossInstances(t *testing.T) {
+	provider := newBoltProvider(t)
+	other := newIndexedService(t, provider)
+
+	racing := &racingProvider{Provider: provider}
+	svc := newIndexedService(t, racing)
+
+	require.NoError(t, svc.SaveKeystoreData(testKeystoreData()))
+
+	kd, err := svc.GetKeystoreData(testKeystoreID)
+	require.NoError(t, err)
+
+	// another instance saves the keystore after it is read by SaveKeystoreData
+	racing.race = func() {
+		concurrent, e := other.GetKeystoreData(testKeystoreID)
+		require.NoError(t, e)
+
+		concurrent.Controller = "did:example:other"
+		require.NoError(t, other.SaveKeystoreData(concurrent))
+	}
+
+	kd.Controller = "did:example:new"
+
+	err = svc.SaveKeystoreData(kd)
+	require.True(t, errors.Is(err, kms.ErrRevisionConflict))
+	require.Equal(t, 1, kd.Revision, "revision is not changed on conflict")
+
+	saved, err := svc.GetKeystoreData(testKeystoreID)
+	require.NoError(t, err)
+	require.Equal(t, "did:example:other", saved.Controller)
+	require.Equal(t, 2, saved.Revision)
+
+	page, err := svc.QueryKeystores(&kms.KeystoreQuery{Controller: "did:example:new"})
+	require.NoError(t, err)
+	require.Empty(t, page.Keystores, "index entries of the rejected save are skipped")
+}
+
+func TestQueryKeystoresIndexesExistingKeystores(t *testing.T) {
+	provider := mockstorage.NewMockStoreProvider()
+
+	for i := 0; i < 3; i++ {
+		kd := testKeystoreData()
+		kd.ID = fmt.Sprintf("keystore%d", i)
+
+		b, err := json.Marshal(kd)
+		require.NoError(t, err)
+
+		provider.Store.Store[kd.ID] = b // saved before indexes were introduced
+	}
+
+	provider.Store.Store["other"] = []byte("not a keystore")
+
+	svc := newIndexedService(t, provider)
+
+	page, err := svc.QueryKeystores(&kms.KeystoreQuery{Controller: testController})
+	require.NoError(t, err)
+	require.Len(t, page.Keystores, 3)
+
+	t.Run("Fail to index", func(t *testing.T) {
+		provider := mockstorage.NewMockStoreProvider()
+		provider.Store.Store["keystore"] = []byte(`{"id":"keystore"}`)
+		provider.Store.ErrPut = errors.New("put error")
+
+		_, err := newIndexedService(t, provider).QueryKeystores(&kms.KeystoreQuery{})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "index keystore keystore: put error")
+	})
+
+	t.Run("Fail to iterate", func(t *testing.T) {
+		provider := mockstorage.NewMockStoreProvider()
+		provider.Store.ErrItr = errors.New("iterator error")
+
+		_, err := newIndexedService(t, provider).QueryKeystores(&kms.KeystoreQuery{})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "iterator error")
+	})
+
+	t.Run("Fail to get index version", func(t *testing.T) {
+		provider := mockstorage.NewMockStoreProvider()
+		provider.Store.ErrGet = errors.New("get error")
+
+		_, err := newIndexedService(t, provider).QueryKeystores(&kms.KeystoreQuery{})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "get index version: get error")
+	})
+}
+
+func newIndexedService(t *testing.T, p storage.Provider) kms.Service {
+	t.Helper()
+
+	svc, err := kms.NewService(&kms.Config{
+		StorageProvider: p,
+		LocalKMS:        &mockkms.KeyManager{},
+	})
+	require.NoError(t, err)
+
+	return svc
+}
+
+func newBoltProvider(t *testing.T) storage.Provider {
+	t.Helper()
+
+	p, err := bolt.NewProvider(t.TempDir())
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		require.NoError(t, p.Close())
+	})
+
+	return p
+}
+
+// countingProvider counts keys read with iterators of its stores.
+type countingProvider struct {
+	storage.Provider
+	iterated int
+}
+
+func (p *countingProvider) OpenStore(name string) (storage.Store, error) {
+	s, err := p.Provider.OpenStore(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &countingStore{Store: s, provider: p}, nil
+}
+
+type countingStore struct {
+	storage.Store
+	provider *countingProvider
+}
+
+func (s *countingStore) Iterator(start, end string) storage.StoreIterator {
+	return &countingIterator{StoreIterator: s.Store.Iterator(start, end), provider: s.provider}
+}
+
+type countingIterator struct {
+	storage.StoreIterator
+	provider *countingProvider
+}
+
+func (it *countingIterator) Next() bool {
+	if !it.StoreIterator.Next() {
+		return false
+	}
+
+	it.provider.iterated++
+
+	return true
+}
+
+func ids(page *kms.KeystorePage) []string {
+	var ids []string
+
+	for _, kd := range page.Keystores {
+		ids = append(ids, kd.ID)
+	}
+
+	return ids
+}
+
+func countIndexEntries(store *mockstorage.MockStore) int {
+	var n int
+
+	for k := range store.Store {
+		if strings.HasPrefix(k, "index|") && k != "index|version" {
+			n++
+		}
+	}
+
+	return n
+}
+
+// failingStore fails to put the value with the given key.
+type racingProvider struct {
+	storage.Provider
+	race func()
+}
+
+func (p *racingProvider) OpenStore(name string) (storage.Store, error) {
+	s, err := p.Provider.OpenStore(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &racingStore{Store: s, provider: p}, nil
+}
+
+// racingStore runs the race of the provider once after the keystore is read.
+type racingStore struct {
+	storage.Store
+	provider *racingProvider
+}
+
+func (s *racingStore) Get(k string) ([]byte, error) {
+	v, err := s.Store.Get(k)
+
+	if race := s.provider.race; race != nil && k == testKeystoreID {
+		s.provider.race = nil
+
+		race()
+	}
+
+	return v, err
+}
+
+func (s *racingStore) PutIf(k string, old, v []byte) (bool, error) {
+	return s.Store.(interface {
+		PutIf(k string, old, v []byte) (bool, error)
+	}).PutIf(k, old, v)
+}
+
+type failingStore struct {
+	*mockstorage.MockStore
+	failKey string
+}
+
+func (s *failingStore) Put(k string, v []byte) error {
+	if k == s.failKey {
+		return errors.New("put error")
+	}
+
+	return s.MockStore.Put(k, v)
+}
@@ -0,0 +1,250 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package kms
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/hyperledger/aries-framework-go/pkg/storage"
+
+	"github.com/trustbloc/hub-kms/pkg/storage/migration"
+)
+
+const (
+	// StorageTypeEDV is the storage type of keystores with keysets in the EDV vault of the keystore.
+	StorageTypeEDV = "edv"
+	// DefaultKeyManagerStorageType is the name of the key manager storage if KeyManagerStorageType is not set.
+	DefaultKeyManagerStorageType = "key-manager"
+)
+
+const (
+	// SecretLockTypePrimary protects keysets with the primary key lock of the server.
+	SecretLockTypePrimary = "primary"
+	// SecretLockTypeSplit protects keysets with the secret combined from the share in the Hub-Kms-Secret header and
+	// the share of SecretShareProvider.
+	SecretLockTypeSplit = "split"
+	// SecretLockTypeThreshold protects keysets with the k-of-n secret split lock. It is the type of keystores created
+	// with secret shares.
+	SecretLockTypeThreshold = "threshold"
+)
+
+// ErrUnsupportedKeystoreType is returned by CreateKeystore when the storage or secret lock type is not allowed or
+// the vault options don't match the storage type.
+var ErrUnsupportedKeystoreType = errors.New("unsupported keystore type")
+
+// keystoreTypes are storage and secret lock types keystores can be created with. The first type of each is
+// the default.
+type keystoreTypes struct {
+	storageTypes    []string
+	secretLockTypes []string
+	// legacyStorageType and legacySecretLockType are types of keystores saved before the types were recorded per
+	// keystore. They follow the global setup of the server, whatever types new keystores are created with.
+	legacyStorageType    string
+	legacySecretLockType string
+}
+
+// newKeystoreTypes returns types allowed by the config. By default, keystores are stored in EDV if EDVServerURL is set
+// and protected with the secret split lock if the secret share provider is configured, as before the types were
+// recorded per keystore.
+func newKeystoreTypes(c *Config, shareProviderConfigured bool) (*keystoreTypes, error) {
+	keyManagerStorageType := keyManagerStorageType(c)
+
+	// EDV is the key manager storage if there is no other one
+	legacyStorageType := keyManagerStorageType
+	if c.EDVServerURL != "" && c.KeyManagerStorageProvider == nil {
+		legacyStorageType = StorageTypeEDV
+	}
+
+	legacySecretLockType := SecretLockTypePrimary
+	if shareProviderConfigured {
+		legacySecretLockType = SecretLockTypeSplit
+	}
+
+	storageTypes := c.StorageTypes
+	if len(storageTypes) == 0 {
+		storageTypes = []string{keyManagerStorageType}
+
+		if c.EDVServerURL != "" {
+			storageTypes = []string{StorageTypeEDV}
+		}
+	}
+
+	for _, t := range storageTypes {
+		switch t {
+		case StorageTypeEDV:
+			if c.EDVServerURL == "" {
+				return nil, fmt.Errorf("storage type %s requires EDV server URL", t)
+			}
+		case keyManagerStorageType:
+		default:
+			if _, ok := c.KeyManagerStorageProviders[t]; !ok {
+				return nil, fmt.Errorf("unknown storage type %s", t)
+			}
+		}
+	}
+
+	secretLockTypes := c.SecretLockTypes
+	if len(secretLockTypes) == 0 {
+		secretLockTypes = []string{legacySecretLockType}
+	}
+
+	for _, t := range secretLockTypes {
+		switch t {
+		case SecretLockTypePrimary:
+		case SecretLockTypeSplit:
+			if !shareProviderConfigured {
+				return nil, fmt.Errorf("secret lock type %s requires secret share provider", t)
+			}
+		default:
+			return nil, fmt.Errorf("unknown secret lock type %s", t)
+		}
+	}
+
+	return &keystoreTypes{
+		storageTypes:         storageTypes,
+		secretLockTypes:      secretLockTypes,
+		legacyStorageType:    legacyStorageType,
+		legacySecretLockType: legacySecretLockType,
+	}, nil
+}
+
+func keyManagerStorageType(c *Config) string {
+	if c.KeyManagerStorageType == "" {
+		return DefaultKeyManagerStorageType
+	}
+
+	return c.KeyManagerStorageType
+}
+
+// selectTypes returns storage and secret lock types of the new keystore. Keystores with secret shares are protected
+// with the threshold lock.
+func (t *keystoreTypes) selectTypes(opts *CreateKeystoreOptions) (string, string, error) {
+	storageType, err := selectType(opts.StorageType, t.storageTypes, "storage type")
+	if err != nil {
+		return "", "", err
+	}
+
+	if opts.SecretShares != nil {
+		if opts.SecretLockType != "" && opts.SecretLockType != SecretLockTypeThreshold {
+			return "", "", fmt.Errorf("%w: secret lock type of keystore with secret shares must be %s",
+				ErrUnsupportedKeystoreType, SecretLockTypeThreshold)
+		}
+
+		return storageType, SecretLockTypeThreshold, nil
+	}
+
+	secretLockType, err := selectType(opts.SecretLockType, t.secretLockTypes, "secret lock type")
+	if err != nil {
+		return "", "", err
+	}
+
+	return storageType, secretLockType, nil
+}
+
+func selectType(requested string, allowed []string, name string) (string, error) {
+	if requested == "" {
+		return allowed[0], nil
+	}
+
+	for _, t := range allowed {
+		if t == requested {
+			return t, nil
+		}
+	}
+
+	return "", fmt.Errorf("%w: %s %s is not allowed", ErrUnsupportedKeystoreType, name, requested)
+}
+
+// validateVault checks that the keystore with EDV storage has the vault and the vault is provisioned only for it.
+func validateVault(storageType, vaultID string, provisionVault bool) error {
+	switch {
+	case provisionVault && storageType != StorageTypeEDV:
+		return fmt.Errorf("%w: vault is provisioned only for storage type %s", ErrUnsupportedKeystoreType,
+			StorageTypeEDV)
+	case provisionVault && vaultID != "":
+		return fmt.Errorf("%w: vault ID is set for provisioned vault", ErrUnsupportedKeystoreType)
+	case storageType == StorageTypeEDV && vaultID == "" && !provisionVault:
+		return fmt.Errorf("%w: storage type %s requires vault ID or vault provisioning", ErrUnsupportedKeystoreType,
+			storageType)
+	default:
+		return nil
+	}
+}
+
+// storageType returns the storage type of the keystore. Keystores without the recorded type are in the storage of
+// the previous global setup.
+func (s *service) storageType(kd *KeystoreData) string {
+	if kd.StorageType == "" {
+		return s.types.legacyStorageType
+	}
+
+	return kd.StorageType
+}
+
+// secretLockType returns the secret lock type of the keystore. Keystores without the recorded type are protected
+// with the secret lock of the previous global setup.
+func (s *service) secretLockType(kd *KeystoreData) string {
+	switch {
+	case kd.SecretLockType != "":
+		return kd.SecretLockType
+	case kd.SecretShares != nil:
+		return SecretLockTypeThreshold
+	default:
+		return s.types.legacySecretLockType
+	}
+}
+
+// backfillTypes records storage and secret lock types of the keystore saved before the types were recorded. It
+// returns false if both types are already recorded.
+func (s *service) backfillTypes(kd *KeystoreData) bool {
+	if kd.StorageType != "" && kd.SecretLockType != "" {
+		return false
+	}
+
+	kd.StorageType = s.storageType(kd)
+	kd.SecretLockType = s.secretLockType(kd)
+
+	return true
+}
+
+// prepareStorageProvider returns the storage provider of keysets of the keystore. While keysets of the keystore are
+// migrated, keysets not found in its storage are read from the source storage.
+func (s *service) prepareStorageProvider(ctx context.Context, kd *KeystoreData) (storage.Provider, error) {
+	p, err := s.storageProviderOf(ctx, kd, s.storageType(kd))
+	if err != nil || kd.Migration == nil {
+		return p, err
+	}
+
+	source, err := s.storageProviderOf(ctx, kd, kd.Migration.SourceStorageType)
+	if err != nil {
+		return nil, fmt.Errorf("migration source: %w", err)
+	}
+
+	return migration.NewFallbackProvider(p, source), nil
+}
+
+// storageProviderOf returns the storage provider of keysets of the keystore in the storage of the given type.
+func (s *service) storageProviderOf(ctx context.Context, kd *KeystoreData, t string) (storage.Provider, error) {
+	switch t {
+	case StorageTypeEDV:
+		if s.config.EDVServerURL == "" {
+			return nil, fmt.Errorf("storage type %s is not configured", t)
+		}
+
+		return s.prepareEDVStorageProvider(ctx, kd)
+	case keyManagerStorageType(s.config):
+		return s.config.KeyManagerStorageProvider, nil
+	default:
+		if p, ok := s.config.KeyManagerStorageProviders[t]; ok {
+			return p, nil
+		}
+
+		return nil, fmt.Errorf("storage type %s is not configured", t)
+	}
+}
@@ -0,0 +1,335 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package kms_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	mockkms "github.com/hyperledger/aries-framework-go/pkg/mock/kms"
+	mockstorage "github.com/hyperledger/aries-framework-go/pkg/mock/storage"
+	"github.com/hyperledger/aries-framework-go/pkg/secretlock"
+	"github.com/hyperledger/aries-framework-go/pkg/storage"
+	"github.com/stretchr/testify/require"
+	"github.com/trustbloc/edge-core/pkg/sss/base"
+
+	"github.com/trustbloc/hub-kms/pkg/kms"
+	lock "github.com/trustbloc/hub-kms/pkg/secretlock"
+	"github.com/trustbloc/hub-kms/pkg/secretlock/secretsplitlock"
+)
+
+const testKeyManagerStorageType = "couchdb"
+
+func TestNewServiceWithKeystoreTypes(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		_, err := kms.NewService(mixedTypesConfig(mockstorage.NewMockStoreProvider(), nil, nil))
+		require.NoError(t, err)
+	})
+
+	tests := []struct {
+		name   string
+		config func(c *kms.Config)
+		err    string
+	}{
+		{
+			name: "EDV without server URL",
+			config: func(c *kms.Config) {
+				c.EDVServerURL = ""
+			},
+			err: "storage type edv requires EDV server URL",
+		},
+		{
+			name: "Unknown storage type",
+			config: func(c *kms.Config) {
+				c.StorageTypes = []string{"mysql"}
+			},
+			err: "unknown storage type mysql",
+		},
+		{
+			name: "Split lock without share provider",
+			config: func(c *kms.Config) {
+				c.SecretShareProvider = nil
+			},
+			err: "secret lock type split requires secret share provider",
+		},
+		{
+			name: "Unknown secret lock type",
+			config: func(c *kms.Config) {
+				c.SecretLockTypes = []string{kms.SecretLockTypeThreshold}
+			},
+			err: "unknown secret lock type threshold",
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run("Fail with "+tc.name, func(t *testing.T) {
+			c := mixedTypesConfig(mockstorage.NewMockStoreProvider(), nil, nil)
+			tc.config(c)
+
+			_, err := kms.NewService(c)
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tc.err)
+		})
+	}
+}
+
+func TestCreateKeystoreWithKeystoreTypes(t *testing.T) {
+	svc, err := kms.NewService(mixedTypesConfig(mockstorage.NewMockStoreProvider(), nil, nil))
+	require.NoError(t, err)
+
+	t.Run("Default types", func(t *testing.T) {
+		k, _, err := svc.CreateKeystore(createRequest(), testController, "")
+		require.NoError(t, err)
+		require.Equal(t, testKeyManagerStorageType, k.StorageType)
+		require.Equal(t, kms.SecretLockTypePrimary, k.SecretLockType)
+	})
+
+	t.Run("Requested types", func(t *testing.T) {
+		k, _, err := svc.CreateKeystore(createRequest(), testController, testVaultID,
+			kms.WithStorageType(kms.StorageTypeEDV), kms.WithSecretLockType(kms.SecretLockTypeSplit))
+		require.NoError(t, err)
+		require.Equal(t, kms.StorageTypeEDV, k.StorageType)
+		require.Equal(t, kms.SecretLockTypeSplit, k.SecretLockType)
+	})
+
+	t.Run("Threshold lock for secret shares", func(t *testing.T) {
+		k, _, err := svc.CreateKeystore(createRequest(), testController, "",
+			kms.WithSecretShares(2, "header", testShareProvider))
+		require.NoError(t, err)
+		require.Equal(t, kms.SecretLockTypeThreshold, k.SecretLockType)
+	})
+
+	tests := []struct {
+		name    string
+		vaultID string
+		opts    []kms.CreateKeystoreOption
+		err     string
+	}{
+		{
+			name: "Storage type is not allowed",
+			opts: []kms.CreateKeystoreOption{kms.WithStorageType("mysql")},
+			err:  "storage type mysql is not allowed",
+		},
+		{
+			name: "Secret lock type is not allowed",
+			opts: []kms.CreateKeystoreOption{kms.WithSecretLockType(kms.SecretLockTypeThreshold)},
+			err:  "secret lock type threshold is not allowed",
+		},
+		{
+			name: "Secret shares with another secret lock type",
+			opts: []kms.CreateKeystoreOption{
+				kms.WithSecretShares(2, "header", testShareProvider),
+				kms.WithSecretLockType(kms.SecretLockTypeSplit),
+			},
+			err: "secret lock type of keystore with secret shares must be threshold",
+		},
+		{
+			name: "EDV storage without vault ID",
+			opts: []kms.CreateKeystoreOption{kms.WithStorageType(kms.StorageTypeEDV)},
+			err:  "storage type edv requires vault ID",
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run("Fail if "+tc.name, func(t *testing.T) {
+			k, _, err := svc.CreateKeystore(createRequest(), testController, tc.vaultID, tc.opts...)
+			require.Nil(t, k)
+			require.True(t, errors.Is(err, kms.ErrUnsupportedKeystoreType))
+			require.Contains(t, err.Error(), tc.err)
+		})
+	}
+}
+
+func TestResolveKeystoreWithKeystoreTypes(t *testing.T) {
+	secrets, err := (&base.Splitter{}).Split([]byte("secret"), 2, 2)
+	require.NoError(t, err)
+
+	sp := mockstorage.NewMockStoreProvider()
+
+	var keyURI string
+
+	svc, err := kms.NewService(mixedTypesConfig(sp, &keyURI, secrets[1]))
+	require.NoError(t, err)
+
+	t.Run("Primary key lock", func(t *testing.T) {
+		saveKeystoreData(t, sp, testKeyManagerStorageType, kms.SecretLockTypePrimary)
+
+		k, err := svc.ResolveKeystore(newKeystoreRequest())
+		require.NoError(t, err)
+		require.NotNil(t, k)
+		require.Equal(t, "local-lock://keystoredb", keyURI)
+	})
+
+	t.Run("Secret split lock", func(t *testing.T) {
+		saveKeystoreData(t, sp, testKeyManagerStorageType, kms.SecretLockTypeSplit)
+
+		req := newKeystoreRequest()
+		req.Header.Set("Hub-Kms-Secret", base64.StdEncoding.EncodeToString(secrets[0]))
+
+		k, err := svc.ResolveKeystore(req)
+		require.NoError(t, err)
+		require.NotNil(t, k)
+		require.Equal(t, "local-lock://"+testKeystoreID, keyURI)
+	})
+
+	t.Run("Fail if storage type is not configured", func(t *testing.T) {
+		saveKeystoreData(t, sp, "mysql", kms.SecretLockTypePrimary)
+
+		_, err := svc.ResolveKeystore(newKeystoreRequest())
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "storage type mysql is not configured")
+	})
+
+	t.Run("Fail if secret lock type is not configured", func(t *testing.T) {
+		saveKeystoreData(t, sp, testKeyManagerStorageType, "unknown")
+
+		_, err := svc.ResolveKeystore(newKeystoreRequest())
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "secret lock type unknown is not configured")
+	})
+
+	t.Run("Fail if threshold lock has no secret shares", func(t *testing.T) {
+		saveKeystoreData(t, sp, testKeyManagerStorageType, kms.SecretLockTypeThreshold)
+
+		_, err := svc.ResolveKeystore(newKeystoreRequest())
+		require.True(t, errors.Is(err, kms.ErrInvalidSecretShares))
+	})
+}
+
+func TestLegacyKeystoreTypes(t *testing.T) {
+	secrets, err := (&base.Splitter{}).Split([]byte("secret"), 2, 2)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name            string
+		storageTypes    []string
+		secretLockTypes []string
+	}{
+		{
+			name:            "Types of previous setup are listed first",
+			storageTypes:    []string{testKeyManagerStorageType, "mysql"},
+			secretLockTypes: []string{kms.SecretLockTypeSplit, kms.SecretLockTypePrimary},
+		},
+		{
+			name:            "Types of previous setup are not listed first",
+			storageTypes:    []string{"mysql", testKeyManagerStorageType},
+			secretLockTypes: []string{kms.SecretLockTypePrimary, kms.SecretLockTypeSplit},
+		},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tc.name, func(t *testing.T) {
+			sp := mockstorage.NewMockStoreProvider()
+
+			var keyURI string
+
+			c := mixedTypesConfig(sp, &keyURI, secrets[1])
+			c.EDVServerURL = ""
+			c.KeyManagerStorageProviders = map[string]storage.Provider{
+				"mysql": &mockstorage.MockStoreProvider{ErrOpenStoreHandle: errors.New("mysql is not used")},
+			}
+			c.StorageTypes = tc.storageTypes
+			c.SecretLockTypes = tc.secretLockTypes
+
+			svc, err := kms.NewService(c)
+			require.NoError(t, err)
+
+			saveKeystoreData(t, sp, "", "")
+
+			req := newKeystoreRequest()
+			req.Header.Set("Hub-Kms-Secret", base64.StdEncoding.EncodeToString(secrets[0]))
+
+			_, err = svc.ResolveKeystore(req)
+			require.NoError(t, err)
+			require.Equal(t, "local-lock://"+testKeystoreID, keyURI, "secret split lock is used")
+
+			_, err = svc.QueryKeystores(&kms.KeystoreQuery{})
+			require.NoError(t, err)
+
+			kd, err := svc.GetKeystoreData(testKeystoreID)
+			require.NoError(t, err)
+			require.Equal(t, testKeyManagerStorageType, kd.StorageType, "storage type is backfilled")
+			require.Equal(t, kms.SecretLockTypeSplit, kd.SecretLockType, "secret lock type is backfilled")
+			require.Zero(t, kd.Revision)
+		})
+	}
+
+	t.Run("EDV storage and primary key lock of previous setup", func(t *testing.T) {
+		sp := mockstorage.NewMockStoreProvider()
+
+		c := mixedTypesConfig(sp, nil, nil)
+		c.KeyManagerStorageProvider = nil
+		c.KeyManagerStorageType = ""
+		c.StorageTypes = []string{kms.StorageTypeEDV}
+		c.SecretShareProvider = nil
+		c.SecretLockTypes = nil
+
+		svc, err := kms.NewService(c)
+		require.NoError(t, err)
+
+		saveKeystoreData(t, sp, "", "")
+
+		_, err = svc.QueryKeystores(&kms.KeystoreQuery{})
+		require.NoError(t, err)
+
+		kd, err := svc.GetKeystoreData(testKeystoreID)
+		require.NoError(t, err)
+		require.Equal(t, kms.StorageTypeEDV, kd.StorageType)
+		require.Equal(t, kms.SecretLockTypePrimary, kd.SecretLockType)
+	})
+}
+
+// mixedTypesConfig returns the config of the service that stores keysets in CouchDB or EDV and protects them with
+// the primary key lock or the secret split lock.
+func mixedTypesConfig(sp *mockstorage.MockStoreProvider, keyURI *string, share []byte) *kms.Config {
+	return &kms.Config{
+		StorageProvider:           sp,
+		KeyManagerStorageProvider: mockstorage.NewMockStoreProvider(),
+		KeyManagerStorageType:     testKeyManagerStorageType,
+		EDVServerURL:              "https://edv.example.com",
+		StorageTypes:              []string{testKeyManagerStorageType, kms.StorageTypeEDV},
+		SecretLockTypes:           []string{kms.SecretLockTypePrimary, kms.SecretLockTypeSplit},
+		LocalKMS:                  &mockkms.KeyManager{},
+		PrimaryKeyStorageProvider: mockstorage.NewMockStoreProvider(),
+		CreateSecretLockFunc: func(uri string, p lock.Provider) (secretlock.Service, error) {
+			if keyURI != nil {
+				*keyURI = uri
+			}
+
+			return p.SecretLock(), nil
+		},
+		SecretShareProvider: &mockShareProvider{share: share},
+		ShareProviders:      map[string]secretsplitlock.ShareProvider{testShareProvider: &updatableShareProvider{}},
+	}
+}
+
+func saveKeystoreData(t *testing.T, sp *mockstorage.MockStoreProvider, storageType, secretLockType string) {
+	t.Helper()
+
+	kd := testKeystoreData()
+	kd.StorageType = storageType
+	kd.SecretLockType = secretLockType
+
+	b, err := json.Marshal(kd)
+	require.NoError(t, err)
+
+	sp.Store.Store[testKeystoreID] = b
+}
+
+func newKeystoreRequest() *http.Request {
+	return mux.SetURLVars(httptest.NewRequest(http.MethodPost, "/", nil), map[string]string{
+		"keystoreID": testKeystoreID,
+	})
+}
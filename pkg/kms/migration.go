@@ -0,0 +1,319 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package kms
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/aries-framework-go/pkg/kms/localkms"
+	"github.com/hyperledger/aries-framework-go/pkg/storage"
+
+	"github.com/trustbloc/hub-kms/pkg/storage/migration"
+)
+
+const (
+	maxUpdateAttempts = 3
+	// DefaultDrainPeriod is the time given to requests that resolved keystores before they were switched to the target
+	// storage to finish if the drain period is not set.
+	DefaultDrainPeriod = time.Minute
+)
+
+// ErrMigrationNotSupported is returned when keysets can't be migrated to the target storage type.
+var ErrMigrationNotSupported = errors.New("keysets can be migrated only from the key manager storage to " +
+	"an additional key manager storage or EDV")
+
+// MigrationResult is the outcome of the keyset migration.
+type MigrationResult struct {
+	// Copied is the result of copying keysets to the target storage, nil for EDV.
+	Copied *migration.Result `json:"copied,omitempty"`
+	// Synced is the result of copying keysets again once all keystores are switched and the drain period passed,
+	// before switched keystores are completed. It includes keysets created by requests that resolved keystores before
+	// they were switched.
+	Synced *migration.Result `json:"synced,omitempty"`
+	// Switched is the number of keystores switched to the target storage.
+	Switched int `json:"switched"`
+	// Completed is the number of switched keystores that no longer read keysets from the key manager storage.
+	Completed int `json:"completed"`
+	// Pending is the number of switched keystores that still read keysets missing in the target storage from the key
+	// manager storage. Their migration is completed by calling Migrate again after the drain period.
+	Pending int `json:"pending"`
+}
+
+// StorageMigrator migrates keysets of keystores from the key manager storage to an additional key manager storage
+// or to EDV vaults of keystores without downtime.
+type StorageMigrator struct {
+	service     *service
+	drainPeriod time.Duration
+	mu          sync.Mutex
+}
+
+// MigratorOption configures StorageMigrator.
+type MigratorOption func(m *StorageMigrator)
+
+// WithDrainPeriod sets the time given to requests that resolved keystores before they were switched to the target
+// storage to finish. Defaults to DefaultDrainPeriod.
+func WithDrainPeriod(d time.Duration) MigratorOption {
+	return func(m *StorageMigrator) {
+		m.drainPeriod = d
+	}
+}
+
+// NewStorageMigrator returns a new StorageMigrator instance.
+func NewStorageMigrator(c *Config, opts ...MigratorOption) (*StorageMigrator, error) {
+	svc, err := NewService(c)
+	if err != nil {
+		return nil, fmt.Errorf("new storage migrator: %w", err)
+	}
+
+	m := &StorageMigrator{
+		service:     svc.(*service),
+		drainPeriod: DefaultDrainPeriod,
+	}
+
+	for i := range opts {
+		opts[i](m)
+	}
+
+	return m, nil
+}
+
+// Migrate migrates keysets from the key manager storage to the storage of the target type. Keysets are copied, then
+// keystores with keysets in the key manager storage are switched to the target storage. A switched keystore reads
+// keysets missing in the target storage from the key manager storage and copies them, so keysets written there by
+// requests that resolved the keystore before the switch are not lost. Once all keystores are switched, a call made
+// after the drain period copies the remaining keysets and completes the migration of switched keystores.
+//
+// Keysets of all keystores share the key manager storage and are not attributed to keystores, so keysets can't be
+// copied to EDV vaults of keystores in advance. Keystores switched to EDV, with vaults provisioned within ctx if they
+// have none, copy each keyset to their vault when it is read and keep reading missing keysets from the key manager
+// storage.
+//
+// Each keystore is switched atomically with SaveKeystoreData, requests resolve it in the target storage since then.
+// An interrupted migration is resumed by calling Migrate again. Concurrent calls are serialized.
+//
+// Only keysets are migrated. Keystore metadata, primary keys and zcaps are kept in databases of the server, which
+// are read by all keystores and can't be switched per keystore, so they are moved offline with the migrate command.
+func (m *StorageMigrator) Migrate(ctx context.Context, targetStorageType string) (*MigrationResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c := m.service.config
+
+	target, ok := c.KeyManagerStorageProviders[targetStorageType]
+	if targetStorageType == StorageTypeEDV {
+		ok = c.EDVServerURL != ""
+	}
+
+	if !ok || targetStorageType == keyManagerStorageType(c) || c.KeyManagerStorageProvider == nil {
+		return nil, fmt.Errorf("%w: storage type %s", ErrMigrationNotSupported, targetStorageType)
+	}
+
+	result := &MigrationResult{}
+
+	var copier *migration.Copier
+
+	if target != nil {
+		var err error
+
+		copier, err = migration.NewCopier(c.KeyManagerStorageProvider, target, migration.WithoutOverwrite())
+		if err != nil {
+			return nil, fmt.Errorf("migrate keysets: %w", err)
+		}
+
+		result.Copied, err = copier.Copy(localkms.Namespace)
+		if err != nil {
+			return nil, fmt.Errorf("migrate keysets: %w", err)
+		}
+	}
+
+	migrating, lastSwitchedAt, err := m.switchKeystores(ctx, targetStorageType, result)
+	if err != nil {
+		return nil, fmt.Errorf("migrate keysets: %w", err)
+	}
+
+	result.Pending = len(migrating)
+
+	if copier == nil || result.Switched > 0 || len(migrating) == 0 || time.Since(lastSwitchedAt) < m.drainPeriod {
+		return result, nil
+	}
+
+	// the previous copy is completed, so this one reads all keysets, including those written to the key manager
+	// storage by requests that resolved keystores before they were switched
+	result.Synced, err = copier.Copy(localkms.Namespace)
+	if err != nil {
+		return nil, fmt.Errorf("migrate keysets: %w", err)
+	}
+
+	for _, id := range migrating {
+		if err = m.completeKeystore(id); err != nil {
+			return nil, fmt.Errorf("migrate keysets: %w", err)
+		}
+
+		result.Completed++
+		result.Pending--
+	}
+
+	return result, nil
+}
+
+// switchKeystores switches keystores with keysets in the key manager storage to the target storage type. It returns
+// IDs of keystores migrated to the target storage and the time the last of them was switched.
+func (m *StorageMigrator) switchKeystores(ctx context.Context, targetStorageType string, result *MigrationResult) (
+	[]string, time.Time, error) {
+	query := &KeystoreQuery{Limit: MaxQueryLimit}
+	sourceStorageType := keyManagerStorageType(m.service.config)
+
+	var (
+		migrating      []string
+		lastSwitchedAt time.Time
+	)
+
+	for {
+		page, err := m.service.QueryKeystores(query)
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+
+		for _, kd := range page.Keystores {
+			kd, switched, err := m.switchKeystore(ctx, kd, targetStorageType)
+			if err != nil {
+				return nil, time.Time{}, err
+			}
+
+			if switched {
+				result.Switched++
+			}
+
+			if kd == nil || kd.Migration == nil || kd.Migration.SourceStorageType != sourceStorageType ||
+				m.service.storageType(kd) != targetStorageType {
+				continue
+			}
+
+			if t := kd.Migration.SwitchedAt; t != nil && t.After(lastSwitchedAt) {
+				lastSwitchedAt = *t
+			}
+
+			migrating = append(migrating, kd.ID)
+		}
+
+		if page.NextCursor == "" {
+			return migrating, lastSwitchedAt, nil
+		}
+
+		query.Cursor = page.NextCursor
+	}
+}
+
+// switchKeystore saves the keystore with the target storage type if its keysets are in the key manager storage. The
+// vault provisioned for the keystore is reused if the keystore is saved again after a conflict.
+func (m *StorageMigrator) switchKeystore(ctx context.Context, kd *KeystoreData, targetStorageType string) (
+	*KeystoreData, bool, error) {
+	sourceStorageType := keyManagerStorageType(m.service.config)
+
+	var vault *KeystoreData
+
+	return m.updateKeystore(kd, func(kd *KeystoreData) (bool, error) {
+		if m.service.storageType(kd) != sourceStorageType {
+			return false, nil
+		}
+
+		if targetStorageType == StorageTypeEDV && kd.VaultID == "" {
+			if vault == nil {
+				if err := m.service.prepareVault(ctx, kd); err != nil {
+					return false, err
+				}
+
+				vault = &KeystoreData{
+					RecipientKeyID: kd.RecipientKeyID,
+					MACKeyID:       kd.MACKeyID,
+					VaultID:        kd.VaultID,
+					EDVCapability:  kd.EDVCapability,
+				}
+			}
+
+			kd.RecipientKeyID = vault.RecipientKeyID
+			kd.MACKeyID = vault.MACKeyID
+			kd.VaultID = vault.VaultID
+			kd.EDVCapability = vault.EDVCapability
+		}
+
+		switchedAt := time.Now().UTC()
+
+		kd.StorageType = targetStorageType
+		kd.Migration = &KeystoreMigration{
+			SourceStorageType: sourceStorageType,
+			SwitchedAt:        &switchedAt,
+		}
+
+		return true, nil
+	})
+}
+
+// completeKeystore stops the keystore from reading keysets from the key manager storage.
+func (m *StorageMigrator) completeKeystore(id string) error {
+	kd, err := m.service.GetKeystoreData(id)
+	if errors.Is(err, storage.ErrDataNotFound) { // removed by another instance
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("complete keystore %s: %w", id, err)
+	}
+
+	_, _, err = m.updateKeystore(kd, func(kd *KeystoreData) (bool, error) {
+		if kd.Migration == nil {
+			return false, nil
+		}
+
+		kd.Migration = nil
+
+		return true, nil
+	})
+
+	return err
+}
+
+// updateKeystore saves the keystore changed by update, unless update leaves it as is. The keystore is read again and
+// updated if it was changed after it was read. It returns the keystore data, nil if the keystore was removed, and
+// whether it was saved.
+func (m *StorageMigrator) updateKeystore(kd *KeystoreData, update func(kd *KeystoreData) (bool, error)) (
+	*KeystoreData, bool, error) {
+	id := kd.ID
+
+	for attempt := 1; ; attempt++ {
+		changed, err := update(kd)
+		if err != nil {
+			return nil, false, fmt.Errorf("update keystore %s: %w", id, err)
+		}
+
+		if !changed {
+			return kd, false, nil
+		}
+
+		err = m.service.SaveKeystoreData(kd)
+		if err == nil {
+			return kd, true, nil
+		}
+
+		if !errors.Is(err, ErrRevisionConflict) || attempt == maxUpdateAttempts {
+			return nil, false, fmt.Errorf("update keystore %s: %w", id, err)
+		}
+
+		kd, err = m.service.GetKeystoreData(id)
+		if errors.Is(err, storage.ErrDataNotFound) { // removed by another instance
+			return nil, false, nil
+		}
+
+		if err != nil {
+			return nil, false, fmt.Errorf("update keystore %s: %w", id, err)
+		}
+	}
+}
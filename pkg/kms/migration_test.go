@@ -0,0 +1,359 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package kms_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	arieskms "github.com/hyperledger/aries-framework-go/pkg/kms"
+	"github.com/hyperledger/aries-framework-go/pkg/kms/localkms"
+	mockkms "github.com/hyperledger/aries-framework-go/pkg/mock/kms"
+	mockstorage "github.com/hyperledger/aries-framework-go/pkg/mock/storage"
+	"github.com/hyperledger/aries-framework-go/pkg/secretlock/noop"
+	"github.com/hyperledger/aries-framework-go/pkg/storage"
+	"github.com/hyperledger/aries-framework-go/pkg/storage/mem"
+	"github.com/hyperledger/aries-framework-go/pkg/storage/wrapper/prefix"
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/hub-kms/pkg/kms"
+	lock "github.com/trustbloc/hub-kms/pkg/secretlock"
+)
+
+const testTargetStorageType = "mysql"
+
+func TestStorageMigrator_Migrate(t *testing.T) {
+	t.Run("Keys are available after migration", func(t *testing.T) {
+		target := mem.NewProvider()
+		config := migrationConfig(target)
+
+		svc, err := kms.NewService(config)
+		require.NoError(t, err)
+
+		data, _, err := svc.CreateKeystore(createRequest(), testController, "")
+		require.NoError(t, err)
+
+		req := keystoreRequest(data.ID)
+
+		ks, err := svc.ResolveKeystore(req)
+		require.NoError(t, err)
+
+		keyID, err := ks.CreateKey(arieskms.ED25519Type)
+		require.NoError(t, err)
+
+		_, _, err = svc.CreateKeystore(createRequest(), testController, "")
+		require.NoError(t, err)
+
+		// a request that resolved the keystore before it is switched
+		staleKeystore, err := svc.ResolveKeystore(req)
+		require.NoError(t, err)
+
+		migrator, err := kms.NewStorageMigrator(config, kms.WithDrainPeriod(time.Hour))
+		require.NoError(t, err)
+
+		result, err := migrator.Migrate(context.Background(), testTargetStorageType)
+		require.NoError(t, err)
+		require.Equal(t, 2, result.Switched)
+		require.Equal(t, 1, result.Copied.Copied)
+		require.Equal(t, 0, result.Completed)
+		require.Equal(t, 2, result.Pending)
+
+		migrated, err := svc.GetKeystoreData(data.ID)
+		require.NoError(t, err)
+		require.Equal(t, testTargetStorageType, migrated.StorageType)
+		require.Equal(t, kms.DefaultKeyManagerStorageType, migrated.Migration.SourceStorageType)
+
+		keysets, err := target.OpenStore(localkms.Namespace)
+		require.NoError(t, err)
+
+		_, err = keysets.Get(prefix.StorageKIDPrefix + keyID)
+		require.NoError(t, err)
+
+		ks, err = svc.ResolveKeystore(req)
+		require.NoError(t, err)
+
+		_, err = ks.GetKeyHandle(keyID)
+		require.NoError(t, err)
+
+		// new keys of the switched keystore are stored in the target storage
+		newKeyID, err := ks.CreateKey(arieskms.ED25519Type)
+		require.NoError(t, err)
+
+		_, err = keysets.Get(prefix.StorageKIDPrefix + newKeyID)
+		require.NoError(t, err)
+
+		// keys created by the request that resolved the keystore before the switch are read from the source storage
+		staleKeyID, err := staleKeystore.CreateKey(arieskms.ED25519Type)
+		require.NoError(t, err)
+
+		_, err = keysets.Get(prefix.StorageKIDPrefix + staleKeyID)
+		require.True(t, errors.Is(err, storage.ErrDataNotFound))
+
+		ks, err = svc.ResolveKeystore(req)
+		require.NoError(t, err)
+
+		_, err = ks.GetKeyHandle(staleKeyID)
+		require.NoError(t, err)
+
+		t.Run("Migration is pending during the drain period", func(t *testing.T) {
+			result, err := migrator.Migrate(context.Background(), testTargetStorageType)
+			require.NoError(t, err)
+			require.Equal(t, 0, result.Switched)
+			require.Equal(t, 0, result.Completed)
+			require.Equal(t, 2, result.Pending)
+			require.Nil(t, result.Synced)
+		})
+
+		t.Run("Migration is completed after the drain period", func(t *testing.T) {
+			source, err := config.KeyManagerStorageProvider.OpenStore(localkms.Namespace)
+			require.NoError(t, err)
+
+			// written by another request that resolved the keystore before the switch
+			staleKeyset, err := source.Get(prefix.StorageKIDPrefix + keyID)
+			require.NoError(t, err)
+			require.NoError(t, source.Put(prefix.StorageKIDPrefix+"stale", staleKeyset))
+
+			migrator, err := kms.NewStorageMigrator(config, kms.WithDrainPeriod(0))
+			require.NoError(t, err)
+
+			result, err := migrator.Migrate(context.Background(), testTargetStorageType)
+			require.NoError(t, err)
+			require.Equal(t, 0, result.Switched)
+			require.Equal(t, 2, result.Completed)
+			require.Equal(t, 0, result.Pending)
+			require.Equal(t, 1, result.Copied.Copied)
+			require.Equal(t, 0, result.Synced.Copied)
+			require.Equal(t, result.Copied.Checksum, result.Synced.Checksum)
+
+			_, err = keysets.Get(prefix.StorageKIDPrefix + "stale")
+			require.NoError(t, err)
+
+			migrated, err := svc.GetKeystoreData(data.ID)
+			require.NoError(t, err)
+			require.Equal(t, testTargetStorageType, migrated.StorageType)
+			require.Nil(t, migrated.Migration)
+
+			ks, err = svc.ResolveKeystore(req)
+			require.NoError(t, err)
+
+			for _, id := range []string{keyID, newKeyID, staleKeyID} {
+				_, err = ks.GetKeyHandle(id)
+				require.NoError(t, err)
+			}
+		})
+	})
+
+	t.Run("Keysets changed in the target storage are not overwritten", func(t *testing.T) {
+		target := mem.NewProvider()
+		config := migrationConfig(target)
+
+		source, err := config.KeyManagerStorageProvider.OpenStore(localkms.Namespace)
+		require.NoError(t, err)
+		require.NoError(t, source.Put(prefix.StorageKIDPrefix+"key", []byte("old")))
+
+		keysets, err := target.OpenStore(localkms.Namespace)
+		require.NoError(t, err)
+		require.NoError(t, keysets.Put(prefix.StorageKIDPrefix+"key", []byte("new")))
+
+		migrator, err := kms.NewStorageMigrator(config)
+		require.NoError(t, err)
+
+		result, err := migrator.Migrate(context.Background(), testTargetStorageType)
+		require.NoError(t, err)
+		require.Equal(t, 1, result.Copied.Skipped)
+
+		v, err := keysets.Get(prefix.StorageKIDPrefix + "key")
+		require.NoError(t, err)
+		require.Equal(t, []byte("new"), v)
+	})
+
+	t.Run("Keystore created before types were recorded is switched if target is listed first", func(t *testing.T) {
+		config := migrationConfig(mem.NewProvider())
+		config.StorageTypes = []string{testTargetStorageType, kms.DefaultKeyManagerStorageType}
+
+		svc, err := kms.NewService(config)
+		require.NoError(t, err)
+
+		legacy := testKeystoreData()
+		require.NoError(t, svc.SaveKeystoreData(legacy))
+
+		migrator, err := kms.NewStorageMigrator(config)
+		require.NoError(t, err)
+
+		result, err := migrator.Migrate(context.Background(), testTargetStorageType)
+		require.NoError(t, err)
+		require.Equal(t, 1, result.Switched)
+
+		migrated, err := svc.GetKeystoreData(legacy.ID)
+		require.NoError(t, err)
+		require.Equal(t, testTargetStorageType, migrated.StorageType)
+		require.Equal(t, kms.DefaultKeyManagerStorageType, migrated.Migration.SourceStorageType)
+	})
+
+	t.Run("Switch keystores to EDV", func(t *testing.T) {
+		edvServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Location", "/encrypted-data-vaults/"+testVaultID)
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"id":"urn:zcap:1"}`)) //nolint:errcheck // ignore
+		}))
+		defer edvServer.Close()
+
+		config := migrationConfig(mem.NewProvider())
+		config.EDVServerURL = edvServer.URL
+		config.StorageTypes = []string{kms.DefaultKeyManagerStorageType}
+		config.LocalKMS = &mockkms.KeyManager{CreateKeyID: "keyID"}
+
+		svc, err := kms.NewService(config)
+		require.NoError(t, err)
+
+		data, _, err := svc.CreateKeystore(createRequest(), testController, "")
+		require.NoError(t, err)
+
+		migrator, err := kms.NewStorageMigrator(config, kms.WithDrainPeriod(0))
+		require.NoError(t, err)
+
+		result, err := migrator.Migrate(context.Background(), kms.StorageTypeEDV)
+		require.NoError(t, err)
+		require.Nil(t, result.Copied)
+		require.Equal(t, 1, result.Switched)
+		require.Equal(t, 1, result.Pending)
+
+		migrated, err := svc.GetKeystoreData(data.ID)
+		require.NoError(t, err)
+		require.Equal(t, kms.StorageTypeEDV, migrated.StorageType)
+		require.Equal(t, testVaultID, migrated.VaultID)
+		require.Equal(t, "keyID", migrated.RecipientKeyID)
+		require.Equal(t, "keyID", migrated.MACKeyID)
+		require.Equal(t, kms.DefaultKeyManagerStorageType, migrated.Migration.SourceStorageType)
+
+		// keysets are not attributed to keystores, so keystores keep reading them from the key manager storage
+		result, err = migrator.Migrate(context.Background(), kms.StorageTypeEDV)
+		require.NoError(t, err)
+		require.Equal(t, 0, result.Switched)
+		require.Equal(t, 0, result.Completed)
+		require.Equal(t, 1, result.Pending)
+	})
+
+	t.Run("Fail to provision vault", func(t *testing.T) {
+		config := migrationConfig(mem.NewProvider())
+		config.EDVServerURL = "https://edv.example.com"
+		config.StorageTypes = []string{kms.DefaultKeyManagerStorageType}
+		config.LocalKMS = &mockkms.KeyManager{CreateKeyErr: errors.New("create error")}
+
+		svc, err := kms.NewService(config)
+		require.NoError(t, err)
+
+		_, _, err = svc.CreateKeystore(createRequest(), testController, "")
+		require.NoError(t, err)
+
+		migrator, err := kms.NewStorageMigrator(config)
+		require.NoError(t, err)
+
+		_, err = migrator.Migrate(context.Background(), kms.StorageTypeEDV)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "create vault keys: create error")
+	})
+
+	t.Run("Fail to provision vault if context is canceled", func(t *testing.T) {
+		edvServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusCreated)
+		}))
+		defer edvServer.Close()
+
+		config := migrationConfig(mem.NewProvider())
+		config.EDVServerURL = edvServer.URL
+		config.StorageTypes = []string{kms.DefaultKeyManagerStorageType}
+		config.LocalKMS = &mockkms.KeyManager{CreateKeyID: "keyID"}
+
+		svc, err := kms.NewService(config)
+		require.NoError(t, err)
+
+		_, _, err = svc.CreateKeystore(createRequest(), testController, "")
+		require.NoError(t, err)
+
+		migrator, err := kms.NewStorageMigrator(config)
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err = migrator.Migrate(ctx, kms.StorageTypeEDV)
+		require.True(t, errors.Is(err, context.Canceled))
+	})
+
+	t.Run("Fail with unknown target storage type", func(t *testing.T) {
+		migrator, err := kms.NewStorageMigrator(migrationConfig(mem.NewProvider()))
+		require.NoError(t, err)
+
+		_, err = migrator.Migrate(context.Background(), kms.StorageTypeEDV)
+		require.True(t, errors.Is(err, kms.ErrMigrationNotSupported), "EDV server URL is not set")
+
+		_, err = migrator.Migrate(context.Background(), kms.DefaultKeyManagerStorageType)
+		require.True(t, errors.Is(err, kms.ErrMigrationNotSupported))
+	})
+
+	t.Run("Fail to copy keysets", func(t *testing.T) {
+		config := migrationConfig(mem.NewProvider())
+		source := mockstorage.NewMockStoreProvider()
+		source.FailNamespace = localkms.Namespace
+		config.KeyManagerStorageProvider = source
+
+		migrator, err := kms.NewStorageMigrator(config)
+		require.NoError(t, err)
+
+		_, err = migrator.Migrate(context.Background(), testTargetStorageType)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "migrate keysets: open source store kmsdb")
+	})
+
+	t.Run("Fail to query keystores", func(t *testing.T) {
+		config := migrationConfig(mem.NewProvider())
+		config.StorageProvider = &mockstorage.MockStoreProvider{Store: &mockstorage.MockStore{
+			Store:  map[string][]byte{},
+			ErrGet: errors.New("get error"),
+		}}
+
+		migrator, err := kms.NewStorageMigrator(config)
+		require.NoError(t, err)
+
+		_, err = migrator.Migrate(context.Background(), testTargetStorageType)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "migrate keysets: query keystores")
+	})
+
+	t.Run("Fail to create storage migrator", func(t *testing.T) {
+		config := migrationConfig(mem.NewProvider())
+		config.StorageProvider = &mockstorage.MockStoreProvider{ErrOpenStoreHandle: errors.New("open error")}
+
+		_, err := kms.NewStorageMigrator(config)
+		require.EqualError(t, err, "new storage migrator: new service: open error")
+	})
+}
+
+func migrationConfig(target storage.Provider) *kms.Config {
+	return &kms.Config{
+		StorageProvider:           mem.NewProvider(),
+		KeyManagerStorageProvider: mem.NewProvider(),
+		KeyManagerStorageProviders: map[string]storage.Provider{
+			testTargetStorageType: target,
+		},
+		PrimaryKeyStorageProvider: mem.NewProvider(),
+		PrimaryKeyLock:            &noop.NoLock{},
+		CreateSecretLockFunc:      lock.New,
+	}
+}
+
+func keystoreRequest(keystoreID string) *http.Request {
+	return mux.SetURLVars(httptest.NewRequest(http.MethodPost, "/", nil), map[string]string{
+		"keystoreID": keystoreID,
+	})
+}
@@ -0,0 +1,59 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package kms
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	lock "github.com/trustbloc/hub-kms/pkg/secretlock"
+)
+
+// ErrRotationNotSupported is returned when keysets are not protected by the local secret lock.
+var ErrRotationNotSupported = errors.New("primary key rotation is supported only for the local secret lock " +
+	"with keysets in the key manager storage")
+
+// PrimaryKeyRotator rotates the primary key that protects keysets of all keystores.
+type PrimaryKeyRotator struct {
+	rotator *lock.Rotator
+	mu      sync.Mutex
+}
+
+// NewPrimaryKeyRotator returns a new PrimaryKeyRotator instance. Rotation is not supported if keysets are stored
+// in EDV or additional key manager storages or protected with secret shares.
+func NewPrimaryKeyRotator(c *Config) (*PrimaryKeyRotator, error) {
+	if c.EDVServerURL != "" || c.HubAuthURL != "" || c.SecretShareProvider != nil ||
+		len(c.KeyManagerStorageProviders) > 0 {
+		return nil, ErrRotationNotSupported
+	}
+
+	provider := &secretLockProvider{
+		storageProvider: c.PrimaryKeyStorageProvider,
+		secretLock:      c.PrimaryKeyLock,
+	}
+
+	rotator, err := lock.NewRotator(fmt.Sprintf(primaryKeyURI, keystoreDB), provider, c.KeyManagerStorageProvider)
+	if err != nil {
+		return nil, fmt.Errorf("new primary key rotator: %w", err)
+	}
+
+	return &PrimaryKeyRotator{rotator: rotator}, nil
+}
+
+// Rotate rotates the primary key. Concurrent calls are serialized.
+func (r *PrimaryKeyRotator) Rotate() (*lock.RotationResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	result, err := r.rotator.Rotate()
+	if err != nil {
+		return nil, fmt.Errorf("rotate primary key: %w", err)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,110 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package kms_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	arieskms "github.com/hyperledger/aries-framework-go/pkg/kms"
+	mockstorage "github.com/hyperledger/aries-framework-go/pkg/mock/storage"
+	"github.com/hyperledger/aries-framework-go/pkg/secretlock/noop"
+	"github.com/hyperledger/aries-framework-go/pkg/storage"
+	"github.com/hyperledger/aries-framework-go/pkg/storage/mem"
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/hub-kms/pkg/kms"
+	lock "github.com/trustbloc/hub-kms/pkg/secretlock"
+	"github.com/trustbloc/hub-kms/pkg/secretlock/secretsplitlock"
+)
+
+func TestPrimaryKeyRotator(t *testing.T) {
+	t.Run("keys are available after rotation", func(t *testing.T) {
+		config := &kms.Config{
+			StorageProvider:           mem.NewProvider(),
+			KeyManagerStorageProvider: mem.NewProvider(),
+			PrimaryKeyStorageProvider: mem.NewProvider(),
+			PrimaryKeyLock:            &noop.NoLock{},
+			CreateSecretLockFunc:      lock.New,
+		}
+
+		svc, err := kms.NewService(config)
+		require.NoError(t, err)
+
+		data, _, err := svc.CreateKeystore(createRequest(), testController, "")
+		require.NoError(t, err)
+
+		req := mux.SetURLVars(httptest.NewRequest(http.MethodPost, "/", nil), map[string]string{
+			"keystoreID": data.ID,
+		})
+
+		ks, err := svc.ResolveKeystore(req)
+		require.NoError(t, err)
+
+		keyID, err := ks.CreateKey(arieskms.ED25519Type)
+		require.NoError(t, err)
+
+		rotator, err := kms.NewPrimaryKeyRotator(config)
+		require.NoError(t, err)
+
+		result, err := rotator.Rotate()
+		require.NoError(t, err)
+		require.Equal(t, 1, result.Reencrypted)
+
+		ks, err = svc.ResolveKeystore(req)
+		require.NoError(t, err)
+
+		_, err = ks.GetKeyHandle(keyID)
+		require.NoError(t, err)
+	})
+
+	t.Run("error: rotation is not supported with Hub Auth", func(t *testing.T) {
+		_, err := kms.NewPrimaryKeyRotator(&kms.Config{HubAuthURL: "https://hub-auth.example.com"})
+		require.True(t, errors.Is(err, kms.ErrRotationNotSupported))
+	})
+
+	t.Run("error: rotation is not supported with EDV", func(t *testing.T) {
+		_, err := kms.NewPrimaryKeyRotator(&kms.Config{EDVServerURL: "https://edv.example.com"})
+		require.True(t, errors.Is(err, kms.ErrRotationNotSupported))
+	})
+
+	t.Run("error: rotation is not supported with secret share provider", func(t *testing.T) {
+		_, err := kms.NewPrimaryKeyRotator(&kms.Config{SecretShareProvider: secretsplitlock.NewEnvShareProvider("")})
+		require.True(t, errors.Is(err, kms.ErrRotationNotSupported))
+	})
+
+	t.Run("error: rotation is not supported with additional key manager storages", func(t *testing.T) {
+		_, err := kms.NewPrimaryKeyRotator(&kms.Config{KeyManagerStorageProviders: map[string]storage.Provider{
+			"mysql": mem.NewProvider(),
+		}})
+		require.True(t, errors.Is(err, kms.ErrRotationNotSupported))
+	})
+
+	t.Run("error: open store", func(t *testing.T) {
+		_, err := kms.NewPrimaryKeyRotator(&kms.Config{
+			PrimaryKeyStorageProvider: &mockstorage.MockStoreProvider{ErrOpenStoreHandle: errors.New("open error")},
+		})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "new primary key rotator")
+	})
+
+	t.Run("error: no primary key", func(t *testing.T) {
+		rotator, err := kms.NewPrimaryKeyRotator(&kms.Config{
+			KeyManagerStorageProvider: mem.NewProvider(),
+			PrimaryKeyStorageProvider: mem.NewProvider(),
+			PrimaryKeyLock:            &noop.NoLock{},
+		})
+		require.NoError(t, err)
+
+		_, err = rotator.Rotate()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "rotate primary key")
+	})
+}
@@ -9,11 +9,11 @@ package kms
 import (
 	"context"
 	"crypto/tls"
-	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/gorilla/mux"
@@ -36,6 +36,22 @@ const (
 	keystoreIDQueryParam = "keystoreID"
 	secretHeader         = "Hub-Kms-Secret" //nolint:gosec // name of header with secret share
 	userHeader           = "Hub-Kms-User"
+	maxSecretShares      = 255
+)
+
+const (
+	// ShareProviderHeader is the name of the provider of the secret share passed in the Hub-Kms-Secret header.
+	ShareProviderHeader = "header"
+	// ShareProviderHubAuth is the name of the provider of the user's secret share from Hub Auth.
+	// Available if HubAuthURL is set.
+	ShareProviderHubAuth = "hub-auth"
+)
+
+var (
+	// ErrInvalidSecretShares is returned when the secret split lock of the keystore is misconfigured.
+	ErrInvalidSecretShares = errors.New("invalid secret shares")
+	// ErrRevisionConflict is returned by SaveKeystoreData when the keystore data was changed after it was read.
+	ErrRevisionConflict = errors.New("keystore revision conflict")
 )
 
 // Config defines configuration for the KMS service.
@@ -47,24 +63,83 @@ type Config struct {
 	LocalKMS      kms.KeyManager
 	CryptoService crypto.Crypto
 	HeaderSigner  edv.HeaderSigner
+	// DIDKeyCreator creates the DID that controls vaults provisioned for keystores, so requests to the vault are
+	// signed with its key. If not set, the vault is controlled by the controller of the keystore.
+	DIDKeyCreator DIDKeyCreator
 
 	PrimaryKeyStorageProvider storage.Provider
 	PrimaryKeyLock            secretlock.Service
 	CreateSecretLockFunc      func(keyURI string, provider lock.Provider) (secretlock.Service, error)
 
+	// KeyManagerStorageType is the name of the backend of KeyManagerStorageProvider, e.g. couchdb, recorded in data
+	// of keystores with keysets in the key manager storage. Defaults to DefaultKeyManagerStorageType.
+	KeyManagerStorageType string
+	// KeyManagerStorageProviders are additional key manager storages by storage type, e.g. the storage keysets are
+	// migrated to by StorageMigrator. Their types can be listed in StorageTypes.
+	KeyManagerStorageProviders map[string]storage.Provider
+	// StorageTypes are storage types keystores can be created with, KeyManagerStorageType and StorageTypeEDV.
+	// The first one is the default. Defaults to StorageTypeEDV if EDVServerURL is set, KeyManagerStorageType otherwise.
+	StorageTypes []string
+	// SecretLockTypes are secret lock types keystores can be created with, SecretLockTypePrimary and
+	// SecretLockTypeSplit. The first one is the default. Defaults to SecretLockTypeSplit if the secret share provider
+	// is configured, SecretLockTypePrimary otherwise.
+	SecretLockTypes []string
+
 	EDVServerURL    string
 	HubAuthURL      string
 	HubAuthAPIToken string
 
+	// HubAuthMaxRetries is the number of retries of the request for the secret share failed with a transient error.
+	// The delay between retries starts at HubAuthRetryBackoff and doubles with each retry.
+	HubAuthMaxRetries   int
+	HubAuthRetryBackoff time.Duration
+	// HubAuthCircuitBreakerOpenInterval is how long requests to Hub Auth are not sent after consecutive failures.
+	// The circuit breaker is disabled if zero.
+	HubAuthCircuitBreakerOpenInterval time.Duration
+
+	// SecretShareProvider provides the second share of the keystore secret, the first one is passed in the
+	// Hub-Kms-Secret header. Defaults to Hub Auth if HubAuthURL is set.
+	SecretShareProvider secretsplitlock.ShareProvider
+
+	// ShareProviders are additional providers of secret shares for keystores protected by the k-of-n secret split
+	// lock. The header and hub-auth providers are built in.
+	ShareProviders map[string]secretsplitlock.ShareProvider
+
+	// UserAssertionValidator verifies the signed user assertion passed in the Hub-Kms-User-Assertion header before
+	// secret shares are fetched. If set, the user of share providers is the verified subject, which must be
+	// the controller of the keystore, and the plain Hub-Kms-User header is not trusted.
+	UserAssertionValidator UserAssertionValidator
+
+	// SessionTTL is the lifetime of the session opened by UnlockKeystore. Defaults to DefaultSessionTTL.
+	SessionTTL time.Duration
+
 	HTTPClient support.HTTPClient
 	TLSConfig  *tls.Config
 }
 
+// DIDKeyCreator creates DID keys with keys of the local KMS.
+type DIDKeyCreator interface {
+	CreateDIDKey(ctx context.Context) (string, error)
+}
+
 type service struct {
-	store    storage.Store
-	localKMS kms.KeyManager
-	crypto   crypto.Crypto
-	config   *Config
+	store          storage.Store
+	localKMS       kms.KeyManager
+	crypto         crypto.Crypto
+	shareProvider  secretsplitlock.ShareProvider
+	shareProviders map[string]secretsplitlock.ShareProvider
+	sessions       *sessionStore
+	types          *keystoreTypes
+	config         *Config
+
+	shareRotationMu sync.Mutex
+
+	// indexMu serializes index maintenance within the instance only. Replicas sharing the store may leave stale
+	// index entries behind when they update the same keystore concurrently, so queries check each entry against
+	// the record and skip stale ones.
+	indexMu       sync.Mutex
+	indexed       bool
+	rangeIterator bool
 }
 
 // NewService returns a new Service instance.
@@ -74,32 +149,89 @@ func NewService(c *Config) (Service, error) {
 		return nil, fmt.Errorf("new service: %w", err)
 	}
 
+	shareProviders := map[string]secretsplitlock.ShareProvider{
+		ShareProviderHeader: secretsplitlock.NewHeaderShareProvider(secretHeader),
+	}
+
+	if c.HubAuthURL != "" {
+		shareProviders[ShareProviderHubAuth] = newHubAuthShareProvider(c)
+	}
+
+	for name, p := range c.ShareProviders {
+		shareProviders[name] = p
+	}
+
+	shareProvider := c.SecretShareProvider
+	if shareProvider == nil && c.HubAuthURL != "" {
+		shareProvider = shareProviders[ShareProviderHubAuth]
+	}
+
+	types, err := newKeystoreTypes(c, shareProvider != nil)
+	if err != nil {
+		return nil, fmt.Errorf("new service: %w", err)
+	}
+
 	return &service{
-		store:    store,
-		localKMS: c.LocalKMS,
-		crypto:   c.CryptoService,
-		config:   c,
+		store:          store,
+		localKMS:       c.LocalKMS,
+		crypto:         c.CryptoService,
+		shareProvider:  shareProvider,
+		shareProviders: shareProviders,
+		sessions:       newSessionStore(c.SessionTTL),
+		types:          types,
+		config:         c,
 	}, nil
 }
 
-// CreateKeystore creates a new Keystore.
-func (s *service) CreateKeystore(controller, vaultID string) (*KeystoreData, error) {
-	var recipientKeyID, macKeyID string
+func newHubAuthShareProvider(c *Config) secretsplitlock.ShareProvider {
+	opts := []secretsplitlock.Option{
+		secretsplitlock.WithHTTPClient(c.HTTPClient),
+		secretsplitlock.WithCacheProvider(c.CacheProvider),
+		secretsplitlock.WithRetry(c.HubAuthMaxRetries, c.HubAuthRetryBackoff),
+	}
 
-	if vaultID != "" {
-		recKID, _, err := s.localKMS.Create(kms.ECDH256KWAES256GCM)
-		if err != nil {
-			return nil, fmt.Errorf("create keystore: %w", err)
+	if c.HubAuthCircuitBreakerOpenInterval > 0 {
+		opts = append(opts, secretsplitlock.WithCircuitBreaker(
+			secretsplitlock.NewCircuitBreaker(secretsplitlock.DefaultCircuitBreakerFailures,
+				c.HubAuthCircuitBreakerOpenInterval)))
+	}
+
+	return secretsplitlock.NewHubAuthShareProvider(c.HubAuthURL, c.HubAuthAPIToken, userHeader, opts...)
+}
+
+// CreateKeystore creates a new Keystore. The secret of the keystore with secret shares is generated and split into
+// shares, which are pushed to the share providers of the keystore. The share of the header provider is returned, it
+// is passed in the Hub-Kms-Secret header of requests to the keystore. The share is nil for other keystores.
+func (s *service) CreateKeystore(req *http.Request, controller, vaultID string,
+	options ...CreateKeystoreOption) (*KeystoreData, []byte, error) {
+	opts := &CreateKeystoreOptions{}
+
+	for i := range options {
+		options[i](opts)
+	}
+
+	if opts.SecretShares != nil {
+		if err := s.validateSecretShares(opts.SecretShares); err != nil {
+			return nil, nil, fmt.Errorf("create keystore: %w", err)
 		}
+	}
+
+	storageType, secretLockType, err := s.types.selectTypes(opts)
+	if err != nil {
+		return nil, nil, fmt.Errorf("create keystore: %w", err)
+	}
 
-		recipientKeyID = recKID
+	if err = validateVault(storageType, vaultID, opts.ProvisionVault); err != nil {
+		return nil, nil, fmt.Errorf("create keystore: %w", err)
+	}
+
+	var recipientKeyID, macKeyID string
 
-		macKID, _, err := s.localKMS.Create(kms.HMACSHA256Tag256)
+	if vaultID != "" || opts.ProvisionVault {
+		recipientKeyID, macKeyID, err = s.createVaultKeys()
 		if err != nil {
-			return nil, fmt.Errorf("create keystore: %w", err)
+			return nil, nil, fmt.Errorf("create keystore: %w", err)
 		}
-
-		macKeyID = macKID
 	}
 
 	createdAt := time.Now().UTC()
@@ -110,18 +242,37 @@ func (s *service) CreateKeystore(controller, vaultID string) (*KeystoreData, err
 		RecipientKeyID: recipientKeyID,
 		MACKeyID:       macKeyID,
 		VaultID:        vaultID,
+		SecretShares:   opts.SecretShares,
+		StorageType:    storageType,
+		SecretLockType: secretLockType,
 		CreatedAt:      &createdAt,
 	}
 
-	err := s.SaveKeystoreData(keystoreData)
+	var clientShare []byte
+
+	if opts.SecretShares != nil {
+		clientShare, err = s.distributeSecretShares(req, keystoreData)
+		if err != nil {
+			return nil, nil, fmt.Errorf("create keystore: %w", err)
+		}
+	}
+
+	if opts.ProvisionVault {
+		if err = s.provisionVault(req.Context(), keystoreData); err != nil {
+			return nil, nil, fmt.Errorf("create keystore: %w", err)
+		}
+	}
+
+	err = s.SaveKeystoreData(keystoreData)
 	if err != nil {
-		return nil, fmt.Errorf("create keystore: %w", err)
+		return nil, nil, fmt.Errorf("create keystore: %w", err)
 	}
 
-	return keystoreData, nil
+	return keystoreData, clientShare, nil
 }
 
-// ResolveKeystore resolves Keystore for the given request.
+// ResolveKeystore resolves Keystore for the given request. A keystore protected with secret shares is unlocked
+// with the session token from UnlockKeystore if the request has one, otherwise with the shares.
 func (s *service) ResolveKeystore(req *http.Request) (keystore.Keystore, error) {
 	keystoreID := mux.Vars(req)[keystoreIDQueryParam]
 
@@ -130,42 +281,25 @@ func (s *service) ResolveKeystore(req *http.Request) (keystore.Keystore, error)
 		return nil, fmt.Errorf("resolve keystore: %w", err)
 	}
 
-	storageProvider := s.config.KeyManagerStorageProvider
-
-	if s.config.EDVServerURL != "" {
-		p, e := s.prepareEDVStorageProvider(req.Context(), keystoreData)
-		if e != nil {
-			return nil, fmt.Errorf("resolve keystore: %w", e)
-		}
-
-		storageProvider = p
+	storageProvider, err := s.prepareStorageProvider(req.Context(), keystoreData)
+	if err != nil {
+		return nil, fmt.Errorf("resolve keystore: %w", err)
 	}
 
-	primaryKeyLock := s.config.PrimaryKeyLock
-	keyURI := fmt.Sprintf(primaryKeyURI, keystoreDB)
+	var secretLock secretlock.Service
 
-	if s.config.HubAuthURL != "" {
-		l, e := s.prepareSecretSplitLock(req)
-		if e != nil {
-			return nil, fmt.Errorf("resolve keystore: %w", e)
-		}
-
-		primaryKeyLock = l
-		keyURI = fmt.Sprintf(primaryKeyURI, keystoreID)
-	}
-
-	secLockProvider := &secretLockProvider{
-		storageProvider: s.config.PrimaryKeyStorageProvider,
-		secretLock:      primaryKeyLock,
+	if token := req.Header.Get(sessionHeader); token != "" && s.isSecretShared(keystoreData) {
+		secretLock, err = s.sessionSecretLock(keystoreData, token)
+	} else {
+		secretLock, err = s.prepareSecretLock(req, keystoreData)
 	}
 
-	secretLock, err := s.config.CreateSecretLockFunc(keyURI, secLockProvider)
 	if err != nil {
 		return nil, fmt.Errorf("resolve keystore: %w", err)
 	}
 
 	k, err := keystore.New(
-		keystore.WithPrimaryKeyURI(keyURI),
+		keystore.WithPrimaryKeyURI(s.primaryKeyURI(keystoreData)),
 		keystore.WithStorageProvider(storageProvider),
 		keystore.WithSecretLock(secretLock),
 	)
@@ -176,6 +310,137 @@ func (s *service) ResolveKeystore(req *http.Request) (keystore.Keystore, error)
 	return k, nil
 }
 
+// UnlockKeystore validates secret shares of the keystore and opens the session, so the following requests are
+// authorized with the session token instead of the shares.
+func (s *service) UnlockKeystore(req *http.Request) (*Session, error) {
+	keystoreData, err := s.GetKeystoreData(mux.Vars(req)[keystoreIDQueryParam])
+	if err != nil {
+		return nil, fmt.Errorf("unlock keystore: %w", err)
+	}
+
+	if !s.isSecretShared(keystoreData) {
+		return nil, fmt.Errorf("unlock keystore: %w", ErrUnlockNotSupported)
+	}
+
+	secret, err := s.sharedSecret(req, keystoreData)
+	if err != nil {
+		return nil, fmt.Errorf("unlock keystore: %w", err)
+	}
+
+	// the primary key of the keystore is decrypted here, so invalid shares are rejected
+	if _, err = s.sharedSecretLock(keystoreData, secret); err != nil {
+		secretsplitlock.Zeroize(secret)
+
+		return nil, fmt.Errorf("unlock keystore: %w", err)
+	}
+
+	sess, err := s.sessions.open(keystoreData.ID, secret)
+	if err != nil {
+		secretsplitlock.Zeroize(secret)
+
+		return nil, fmt.Errorf("unlock keystore: %w", err)
+	}
+
+	return sess, nil
+}
+
+// sessionSecretLock returns the secret lock of the keystore unlocked with the session token.
+func (s *service) sessionSecretLock(kd *KeystoreData, token string) (secretlock.Service, error) {
+	secret, err := s.sessions.get(kd.ID, token)
+	if err != nil {
+		return nil, err
+	}
+
+	defer secretsplitlock.Zeroize(secret)
+
+	return s.sharedSecretLock(kd, secret)
+}
+
+// LockKeystore closes the session from the request.
+func (s *service) LockKeystore(req *http.Request) error {
+	err := s.sessions.close(mux.Vars(req)[keystoreIDQueryParam], req.Header.Get(sessionHeader))
+	if err != nil {
+		return fmt.Errorf("lock keystore: %w", err)
+	}
+
+	return nil
+}
+
+func (s *service) isSecretShared(kd *KeystoreData) bool {
+	return s.secretLockType(kd) != SecretLockTypePrimary
+}
+
+func (s *service) primaryKeyURI(kd *KeystoreData) string {
+	if s.isSecretShared(kd) {
+		return fmt.Sprintf(primaryKeyURI, kd.ID)
+	}
+
+	return fmt.Sprintf(primaryKeyURI, keystoreDB)
+}
+
+// prepareSecretLock returns the secret lock that protects keysets of the keystore.
+func (s *service) prepareSecretLock(req *http.Request, kd *KeystoreData) (secretlock.Service, error) {
+	if !s.isSecretShared(kd) {
+		return s.primaryKeySecretLock(kd, s.config.PrimaryKeyLock)
+	}
+
+	secret, err := s.sharedSecret(req, kd)
+	if err != nil {
+		return nil, err
+	}
+
+	defer secretsplitlock.Zeroize(secret)
+
+	return s.sharedSecretLock(kd, secret)
+}
+
+// sharedSecret verifies the user and returns the secret combined from secret shares of the keystore.
+func (s *service) sharedSecret(req *http.Request, kd *KeystoreData) ([]byte, error) {
+	r, err := s.verifyUser(req, kd)
+	if err != nil {
+		return nil, err
+	}
+
+	switch t := s.secretLockType(kd); t {
+	case SecretLockTypeThreshold:
+		if kd.SecretShares == nil {
+			return nil, fmt.Errorf("%w: no secret shares", ErrInvalidSecretShares)
+		}
+
+		return s.thresholdSecret(r, kd)
+	case SecretLockTypeSplit:
+		if s.shareProvider == nil {
+			return nil, fmt.Errorf("secret lock type %s is not configured", t)
+		}
+
+		return s.splitSecret(r, kd.ID)
+	default:
+		return nil, fmt.Errorf("secret lock type %s is not configured", t)
+	}
+}
+
+// sharedSecretLock returns the secret lock of the keystore protected by the combined secret.
+func (s *service) sharedSecretLock(kd *KeystoreData, secret []byte) (secretlock.Service, error) {
+	l, err := secretsplitlock.NewSecretLock(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.primaryKeySecretLock(kd, l)
+}
+
+// primaryKeySecretLock returns the secret lock based on the primary key of the keystore decrypted with
+// primaryKeyLock.
+func (s *service) primaryKeySecretLock(kd *KeystoreData, primaryKeyLock secretlock.Service) (secretlock.Service,
+	error) {
+	secLockProvider := &secretLockProvider{
+		storageProvider: s.config.PrimaryKeyStorageProvider,
+		secretLock:      primaryKeyLock,
+	}
+
+	return s.config.CreateSecretLockFunc(s.primaryKeyURI(kd), secLockProvider)
+}
+
 func (s *service) prepareEDVStorageProvider(ctx context.Context, kd *KeystoreData) (storage.Provider, error) {
 	edvConfig := &edv.Config{
 		KeyManager:     s.localKMS,
@@ -193,32 +458,171 @@ func (s *service) prepareEDVStorageProvider(ctx context.Context, kd *KeystoreDat
 	return edv.NewStorageProvider(ctx, edvConfig)
 }
 
-func (s *service) prepareSecretSplitLock(req *http.Request) (secretlock.Service, error) {
-	secret := req.Header.Get(secretHeader)
-	if secret == "" {
-		return nil, errors.New("empty secret share in the header")
+// createVaultKeys creates the recipient and MAC keys the EDV vault of the keystore is encrypted with.
+func (s *service) createVaultKeys() (string, string, error) {
+	recipientKeyID, _, err := s.localKMS.Create(kms.ECDH256KWAES256GCM)
+	if err != nil {
+		return "", "", err
 	}
 
-	secretBytes, err := base64.StdEncoding.DecodeString(secret)
+	macKeyID, _, err := s.localKMS.Create(kms.HMACSHA256Tag256)
 	if err != nil {
-		return nil, errors.New("fail to decode secret share from the header")
+		return "", "", err
 	}
 
-	sub := req.Header.Get(userHeader)
-	if sub == "" {
-		return nil, errors.New("empty user in the header")
+	return recipientKeyID, macKeyID, nil
+}
+
+// prepareVault provisions the EDV vault of the keystore that was created without one.
+func (s *service) prepareVault(ctx context.Context, kd *KeystoreData) error {
+	if kd.VaultID != "" {
+		return nil
 	}
 
-	hubAuthParams := &secretsplitlock.HubAuthParams{
-		URL:      s.config.HubAuthURL,
-		APIToken: s.config.HubAuthAPIToken,
-		Subject:  sub,
+	recipientKeyID, macKeyID, err := s.createVaultKeys()
+	if err != nil {
+		return fmt.Errorf("create vault keys: %w", err)
 	}
 
-	return secretsplitlock.New(secretBytes, hubAuthParams,
-		secretsplitlock.WithHTTPClient(s.config.HTTPClient),
-		secretsplitlock.WithCacheProvider(s.config.CacheProvider),
-	)
+	kd.RecipientKeyID = recipientKeyID
+	kd.MACKeyID = macKeyID
+
+	return s.provisionVault(ctx, kd)
+}
+
+// provisionVault creates the EDV vault of the keystore. The vault is left on the EDV server if the keystore is not
+// saved, the EDV REST API has no means to delete it.
+func (s *service) provisionVault(ctx context.Context, kd *KeystoreData) error {
+	controller := kd.Controller
+
+	if s.config.DIDKeyCreator != nil {
+		didKey, err := s.config.DIDKeyCreator.CreateDIDKey(ctx)
+		if err != nil {
+			return fmt.Errorf("create vault controller: %w", err)
+		}
+
+		controller = didKey
+	}
+
+	vault, err := edv.CreateVault(ctx, &edv.Config{
+		TLSConfig:      s.config.TLSConfig,
+		EDVServerURL:   s.config.EDVServerURL,
+		RecipientKeyID: kd.RecipientKeyID,
+		MACKeyID:       kd.MACKeyID,
+		HTTPClient:     s.config.HTTPClient,
+	}, controller, kd.ID)
+	if err != nil {
+		return fmt.Errorf("provision vault: %w", err)
+	}
+
+	kd.VaultID = vault.ID
+	kd.EDVCapability = vault.Capability
+
+	return nil
+}
+
+// splitSecret returns the secret combined from the share in the header and the share of the configured provider.
+func (s *service) splitSecret(req *http.Request, keystoreID string) ([]byte, error) {
+	providers := []secretsplitlock.ShareProvider{s.shareProviders[ShareProviderHeader], s.shareProvider}
+
+	return secretsplitlock.CombineShares(req, keystoreID, len(providers), providers)
+}
+
+func (s *service) thresholdSecret(req *http.Request, kd *KeystoreData) ([]byte, error) {
+	providers := make([]secretsplitlock.ShareProvider, len(kd.SecretShares.Providers))
+
+	for i, name := range kd.SecretShares.Providers {
+		p, ok := s.shareProviders[name]
+		if !ok {
+			return nil, fmt.Errorf("secret share provider %s is not configured", name)
+		}
+
+		providers[i] = p
+	}
+
+	return secretsplitlock.CombineShares(req, kd.ID, kd.SecretShares.Threshold, providers)
+}
+
+// distributeSecretShares generates the secret of the keystore and splits it into one share per provider of
+// the keystore. The shares are pushed to the providers for the verified user, except the share of the header
+// provider, which is returned. The primary key of the keystore is created under the secret. Shares already pushed are
+// left with the providers if a later step fails, they protect nothing as the keystore is not saved.
+func (s *service) distributeSecretShares(req *http.Request, kd *KeystoreData) ([]byte, error) {
+	r, err := s.verifyUser(req, kd)
+	if err != nil {
+		return nil, err
+	}
+
+	providers := kd.SecretShares.Providers
+
+	shares, secretLock, err := secretsplitlock.NewSecretShares(kd.SecretShares.Threshold, len(providers))
+	if err != nil {
+		return nil, err
+	}
+
+	var clientShare []byte
+
+	for i, name := range providers {
+		if name == ShareProviderHeader {
+			clientShare = shares[i]
+
+			continue
+		}
+
+		updater := s.shareProviders[name].(secretsplitlock.ShareUpdater) //nolint:errcheck // checked on validation
+
+		err = updater.UpdateShare(r, kd.ID, shares[i])
+
+		secretsplitlock.Zeroize(shares[i])
+
+		if err != nil {
+			return nil, fmt.Errorf("push secret share to %s: %w", name, err)
+		}
+	}
+
+	if _, err = s.primaryKeySecretLock(kd, secretLock); err != nil {
+		return nil, fmt.Errorf("create primary key: %w", err)
+	}
+
+	return clientShare, nil
+}
+
+// storesShares checks whether the provider stores a separate share for each keystore. Providers that keep one share
+// per user (e.g. Hub Auth) or for all keystores can't hold shares of the keystore secret.
+func storesShares(p secretsplitlock.ShareProvider) bool {
+	_, ok := p.(secretsplitlock.ShareUpdater)
+
+	return ok && !perUser(p)
+}
+
+func (s *service) validateSecretShares(shares *SecretShares) error {
+	n := len(shares.Providers)
+
+	if shares.Threshold < 2 || shares.Threshold > n || n > maxSecretShares {
+		return fmt.Errorf("%w: threshold must be at least 2 and not greater than the number of providers (%d)",
+			ErrInvalidSecretShares, n)
+	}
+
+	seen := make(map[string]struct{}, n)
+
+	for _, name := range shares.Providers {
+		p, ok := s.shareProviders[name]
+		if !ok {
+			return fmt.Errorf("%w: unknown provider %s", ErrInvalidSecretShares, name)
+		}
+
+		if name != ShareProviderHeader && !storesShares(p) {
+			return fmt.Errorf("%w: provider %s can't store a share per keystore", ErrInvalidSecretShares, name)
+		}
+
+		if _, ok := seen[name]; ok {
+			return fmt.Errorf("%w: duplicate provider %s", ErrInvalidSecretShares, name)
+		}
+
+		seen[name] = struct{}{}
+	}
+
+	return nil
 }
 
 type secretLockProvider struct {
@@ -251,17 +655,55 @@ func (s *service) GetKeystoreData(keystoreID string) (*KeystoreData, error) {
 	return &keystoreData, nil
 }
 
-// SaveKeystoreData saves Keystore metadata.
+// SaveKeystoreData saves Keystore metadata and updates indexes of the keystore. The data is saved only if its
+// revision is the revision of the stored data (zero for a new keystore), otherwise ErrRevisionConflict is returned.
+// The revision of the saved data is incremented.
+//
+// The stored data is replaced with a conditional write if the store supports one (the SQL and bolt stores do), so
+// the revision check holds across instances sharing the store. With other stores, e.g. CouchDB, ErrRevisionConflict
+// is only guaranteed for concurrent saves within one instance.
 func (s *service) SaveKeystoreData(keystoreData *KeystoreData) error {
-	b, err := json.Marshal(keystoreData)
-	if err != nil {
+	s.indexMu.Lock()
+	defer s.indexMu.Unlock()
+
+	oldRecord, err := s.store.Get(keystoreData.ID)
+	if err != nil && !errors.Is(err, storage.ErrDataNotFound) {
 		return err
 	}
 
-	err = s.store.Put(keystoreData.ID, b)
+	var (
+		old      *KeystoreData
+		revision int
+	)
+
+	if oldRecord != nil {
+		old = &KeystoreData{}
+
+		if err = json.Unmarshal(oldRecord, old); err != nil {
+			return err
+		}
+
+		revision = old.Revision
+	}
+
+	if keystoreData.Revision != revision {
+		return fmt.Errorf("%w: keystore %s is at revision %d, not %d", ErrRevisionConflict, keystoreData.ID,
+			revision, keystoreData.Revision)
+	}
+
+	saved := *keystoreData
+	saved.Revision++
+
+	b, err := json.Marshal(&saved)
 	if err != nil {
 		return err
 	}
 
+	if err = s.saveWithIndexes(&saved, old, oldRecord, b); err != nil {
+		return err
+	}
+
+	keystoreData.Revision = saved.Revision
+
 	return nil
 }
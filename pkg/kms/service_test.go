@@ -15,6 +15,7 @@ import (
 	"errors"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
@@ -22,16 +23,19 @@ import (
 	"github.com/google/tink/go/mac"
 	"github.com/gorilla/mux"
 	"github.com/hyperledger/aries-framework-go/pkg/crypto/tinkcrypto/primitive/composite/ecdh"
+	arieskms "github.com/hyperledger/aries-framework-go/pkg/kms"
 	mockcrypto "github.com/hyperledger/aries-framework-go/pkg/mock/crypto"
 	mockkms "github.com/hyperledger/aries-framework-go/pkg/mock/kms"
 	mocksecretlock "github.com/hyperledger/aries-framework-go/pkg/mock/secretlock"
 	mockstorage "github.com/hyperledger/aries-framework-go/pkg/mock/storage"
 	"github.com/hyperledger/aries-framework-go/pkg/secretlock"
+	"github.com/hyperledger/aries-framework-go/pkg/storage/mem"
 	"github.com/stretchr/testify/require"
 	"github.com/trustbloc/edge-core/pkg/sss/base"
 
 	"github.com/trustbloc/hub-kms/pkg/kms"
 	lock "github.com/trustbloc/hub-kms/pkg/secretlock"
+	"github.com/trustbloc/hub-kms/pkg/secretlock/secretsplitlock"
 )
 
 const (
@@ -40,6 +44,7 @@ const (
 	testRecipientKeyID = "recipientKeyID"
 	testMACKeyID       = "macKeyID"
 	testVaultID        = "vaultID"
+	testShareProvider  = "mock"
 )
 
 func TestNewService(t *testing.T) {
@@ -72,7 +77,7 @@ func TestCreateKeystore(t *testing.T) {
 		})
 		require.NoError(t, err)
 
-		k, err := svc.CreateKeystore(testController, testVaultID)
+		k, _, err := svc.CreateKeystore(createRequest(), testController, testVaultID)
 
 		require.NotNil(t, k)
 		require.NoError(t, err)
@@ -87,11 +92,293 @@ func TestCreateKeystore(t *testing.T) {
 		})
 		require.NoError(t, err)
 
-		k, err := svc.CreateKeystore(testController, testVaultID)
+		k, _, err := svc.CreateKeystore(createRequest(), testController, testVaultID)
 
 		require.Nil(t, k)
 		require.Error(t, err)
 	})
+
+	t.Run("Fail with invalid secret shares", func(t *testing.T) {
+		svc, err := kms.NewService(&kms.Config{
+			StorageProvider: mockstorage.NewMockStoreProvider(),
+			LocalKMS:        &mockkms.KeyManager{},
+			HubAuthURL:      "hubAuthURL",
+			ShareProviders: map[string]secretsplitlock.ShareProvider{
+				testShareProvider: &updatableShareProvider{},
+				"readonly":        &mockShareProvider{},
+			},
+		})
+		require.NoError(t, err)
+
+		tests := []struct {
+			name      string
+			threshold int
+			providers []string
+		}{
+			{"threshold is less than 2", 1, []string{kms.ShareProviderHeader, testShareProvider}},
+			{"threshold is greater than number of providers", 3, []string{kms.ShareProviderHeader, testShareProvider}},
+			{"unknown provider", 2, []string{kms.ShareProviderHeader, "unknown"}},
+			{"duplicate provider", 2, []string{testShareProvider, testShareProvider}},
+			{"provider keeps share per user", 2, []string{kms.ShareProviderHeader, kms.ShareProviderHubAuth}},
+			{"provider does not store shares", 2, []string{kms.ShareProviderHeader, "readonly"}},
+		}
+
+		for _, tt := range tests {
+			tc := tt
+			t.Run(tc.name, func(t *testing.T) {
+				k, _, err := svc.CreateKeystore(createRequest(), testController, "",
+					kms.WithSecretShares(tc.threshold, tc.providers...))
+
+				require.Nil(t, k)
+				require.True(t, errors.Is(err, kms.ErrInvalidSecretShares))
+			})
+		}
+	})
+}
+
+func TestCreateKeystoreWithSecretShares(t *testing.T) {
+	const (
+		providerA = "a"
+		providerB = "b"
+	)
+
+	newService := func(t *testing.T, a, b *keystoreShareProvider) kms.Service {
+		t.Helper()
+
+		svc, err := kms.NewService(&kms.Config{
+			StorageProvider:           mem.NewProvider(),
+			KeyManagerStorageProvider: mem.NewProvider(),
+			PrimaryKeyStorageProvider: mem.NewProvider(),
+			CreateSecretLockFunc:      lock.New,
+			ShareProviders:            map[string]secretsplitlock.ShareProvider{providerA: a, providerB: b},
+			SessionTTL:                time.Minute,
+		})
+		require.NoError(t, err)
+
+		return svc
+	}
+
+	newRequest := func(keystoreID string, clientShare []byte) *http.Request {
+		req := mux.SetURLVars(httptest.NewRequest(http.MethodPost, "/", nil), map[string]string{
+			"keystoreID": keystoreID,
+		})
+
+		if clientShare != nil {
+			req.Header.Set("Hub-Kms-Secret", base64.StdEncoding.EncodeToString(clientShare))
+		}
+
+		return req
+	}
+
+	t.Run("Keystore is unlocked with any threshold of shares", func(t *testing.T) {
+		a, b := &keystoreShareProvider{}, &keystoreShareProvider{}
+		svc := newService(t, a, b)
+
+		k, clientShare, err := svc.CreateKeystore(createRequest(), testController, "",
+			kms.WithSecretShares(2, kms.ShareProviderHeader, providerA, providerB))
+		require.NoError(t, err)
+		require.Equal(t, kms.SecretLockTypeThreshold, k.SecretLockType)
+		require.NotEmpty(t, clientShare)
+		require.NotEmpty(t, a.shares[k.ID])
+		require.NotEmpty(t, b.shares[k.ID])
+		require.NotEqual(t, a.shares[k.ID], b.shares[k.ID])
+		require.NotEqual(t, clientShare, a.shares[k.ID])
+
+		ks, err := svc.ResolveKeystore(newRequest(k.ID, clientShare))
+		require.NoError(t, err)
+
+		keyID, err := ks.CreateKey(arieskms.ED25519Type)
+		require.NoError(t, err)
+
+		tests := []struct {
+			name        string
+			clientShare []byte
+			downA       bool
+			downB       bool
+		}{
+			{name: "client share and share of a", clientShare: clientShare, downB: true},
+			{name: "client share and share of b", clientShare: clientShare, downA: true},
+			{name: "shares of a and b"},
+		}
+
+		for _, tt := range tests {
+			tc := tt
+			t.Run(tc.name, func(t *testing.T) {
+				a.down, b.down = tc.downA, tc.downB
+				defer func() { a.down, b.down = false, false }()
+
+				ks, err := svc.ResolveKeystore(newRequest(k.ID, tc.clientShare))
+				require.NoError(t, err)
+
+				_, err = ks.GetKeyHandle(keyID)
+				require.NoError(t, err)
+
+				_, err = svc.UnlockKeystore(newRequest(k.ID, tc.clientShare))
+				require.NoError(t, err)
+			})
+		}
+
+		t.Run("Fail with one share", func(t *testing.T) {
+			a.down, b.down = true, true
+			defer func() { a.down, b.down = false, false }()
+
+			_, err := svc.ResolveKeystore(newRequest(k.ID, clientShare))
+			require.Error(t, err)
+			require.Contains(t, err.Error(), "not enough secret shares: got 1 of 2")
+		})
+	})
+
+	t.Run("No client share without header provider", func(t *testing.T) {
+		a, b := &keystoreShareProvider{}, &keystoreShareProvider{}
+		svc := newService(t, a, b)
+
+		k, clientShare, err := svc.CreateKeystore(createRequest(), testController, "",
+			kms.WithSecretShares(2, providerA, providerB))
+		require.NoError(t, err)
+		require.Nil(t, clientShare)
+
+		_, err = svc.ResolveKeystore(newRequest(k.ID, nil))
+		require.NoError(t, err)
+	})
+
+	t.Run("Fail to push secret share", func(t *testing.T) {
+		a, b := &keystoreShareProvider{}, &keystoreShareProvider{updateErr: errors.New("update error")}
+		svc := newService(t, a, b)
+
+		k, _, err := svc.CreateKeystore(createRequest(), testController, "",
+			kms.WithSecretShares(2, kms.ShareProviderHeader, providerA, providerB))
+		require.Nil(t, k)
+		require.EqualError(t, err, "create keystore: push secret share to b: update error")
+
+		page, err := svc.QueryKeystores(&kms.KeystoreQuery{Controller: testController})
+		require.NoError(t, err)
+		require.Empty(t, page.Keystores, "keystore is not saved")
+	})
+
+	t.Run("Fail with invalid user assertion", func(t *testing.T) {
+		a, b := &keystoreShareProvider{}, &keystoreShareProvider{}
+
+		svc, err := kms.NewService(&kms.Config{
+			StorageProvider:        mem.NewProvider(),
+			ShareProviders:         map[string]secretsplitlock.ShareProvider{providerA: a, providerB: b},
+			UserAssertionValidator: &mockUserAssertionValidator{subject: "other"},
+		})
+		require.NoError(t, err)
+
+		req := createRequest()
+		req.Header.Set("Hub-Kms-User-Assertion", testUserAssertion)
+
+		_, _, err = svc.CreateKeystore(req, testController, "",
+			kms.WithSecretShares(2, kms.ShareProviderHeader, providerA, providerB))
+		require.True(t, errors.Is(err, kms.ErrInvalidUserAssertion))
+		require.Empty(t, a.shares, "shares are not pushed")
+	})
+}
+
+func TestCreateKeystoreWithVaultProvisioning(t *testing.T) {
+	var controller string
+
+	edvServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var config struct {
+			Controller string `json:"controller"`
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+
+			return
+		}
+
+		controller = config.Controller
+
+		w.Header().Set("Location", "/encrypted-data-vaults/"+testVaultID)
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"id":"urn:zcap:1"}`)) //nolint:errcheck // ignore
+	}))
+	defer edvServer.Close()
+
+	newService := func(t *testing.T, didKeyCreator kms.DIDKeyCreator) kms.Service {
+		t.Helper()
+
+		svc, err := kms.NewService(&kms.Config{
+			StorageProvider: mockstorage.NewMockStoreProvider(),
+			LocalKMS:        &mockkms.KeyManager{CreateKeyID: "keyID"},
+			DIDKeyCreator:   didKeyCreator,
+			EDVServerURL:    edvServer.URL,
+		})
+		require.NoError(t, err)
+
+		return svc
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		svc := newService(t, &mockDIDKeyCreator{didKey: "did:key:kms"})
+
+		k, _, err := svc.CreateKeystore(createRequest(), testController, "", kms.WithVaultProvisioning())
+		require.NoError(t, err)
+		require.Equal(t, testVaultID, k.VaultID)
+		require.JSONEq(t, `{"id":"urn:zcap:1"}`, string(k.EDVCapability))
+		require.Equal(t, "keyID", k.RecipientKeyID)
+		require.Equal(t, "keyID", k.MACKeyID)
+		require.Equal(t, "did:key:kms", controller)
+	})
+
+	t.Run("Vault is controlled by keystore controller without DID key creator", func(t *testing.T) {
+		_, _, err := newService(t, nil).CreateKeystore(createRequest(), testController, "", kms.WithVaultProvisioning())
+		require.NoError(t, err)
+		require.Equal(t, testController, controller)
+	})
+
+	t.Run("Fail to create DID key", func(t *testing.T) {
+		svc := newService(t, &mockDIDKeyCreator{err: errors.New("create error")})
+
+		_, _, err := svc.CreateKeystore(createRequest(), testController, "", kms.WithVaultProvisioning())
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "create vault controller: create error")
+	})
+
+	t.Run("Fail to create vault", func(t *testing.T) {
+		svc, err := kms.NewService(&kms.Config{
+			StorageProvider: mockstorage.NewMockStoreProvider(),
+			LocalKMS:        &mockkms.KeyManager{},
+			EDVServerURL:    edvServer.URL,
+			HTTPClient: &mockHTTPClient{DoFunc: func(*http.Request) (*http.Response, error) {
+				return nil, errors.New("connection refused")
+			}},
+		})
+		require.NoError(t, err)
+
+		_, _, err = svc.CreateKeystore(createRequest(), testController, "", kms.WithVaultProvisioning())
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "provision vault: create vault: connection refused")
+	})
+
+	t.Run("Fail if request is canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, _, err := newService(t, nil).CreateKeystore(createRequest().WithContext(ctx), testController, "",
+			kms.WithVaultProvisioning())
+		require.True(t, errors.Is(err, context.Canceled))
+	})
+
+	t.Run("Fail with vault ID", func(t *testing.T) {
+		_, _, err := newService(t, nil).CreateKeystore(createRequest(), testController, testVaultID,
+			kms.WithVaultProvisioning())
+		require.True(t, errors.Is(err, kms.ErrUnsupportedKeystoreType))
+	})
+
+	t.Run("Fail without EDV storage", func(t *testing.T) {
+		svc, err := kms.NewService(&kms.Config{
+			StorageProvider: mockstorage.NewMockStoreProvider(),
+			LocalKMS:        &mockkms.KeyManager{},
+		})
+		require.NoError(t, err)
+
+		_, _, err = svc.CreateKeystore(createRequest(), testController, "", kms.WithVaultProvisioning())
+		require.True(t, errors.Is(err, kms.ErrUnsupportedKeystoreType))
+		require.Contains(t, err.Error(), "vault is provisioned only for storage type edv")
+	})
 }
 
 func TestResolveKeystore(t *testing.T) {
@@ -166,6 +453,177 @@ func TestResolveKeystore(t *testing.T) {
 	})
 }
 
+func TestResolveKeystoreWithHubAuthUnavailable(t *testing.T) {
+	b, err := json.Marshal(testKeystoreData())
+	require.NoError(t, err)
+
+	sp := mockstorage.NewMockStoreProvider()
+	sp.Store.Store[testKeystoreID] = b
+
+	calls := 0
+
+	svc, err := kms.NewService(&kms.Config{
+		StorageProvider:                   sp,
+		KeyManagerStorageProvider:         mockstorage.NewMockStoreProvider(),
+		PrimaryKeyStorageProvider:         mockstorage.NewMockStoreProvider(),
+		HubAuthURL:                        "hubAuthURL",
+		HubAuthCircuitBreakerOpenInterval: time.Minute,
+		HTTPClient: &mockHTTPClient{
+			DoFunc: func(req *http.Request) (*http.Response, error) {
+				calls++
+
+				return nil, errors.New("connection refused")
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	req := mux.SetURLVars(httptest.NewRequest(http.MethodPost, "/", nil), map[string]string{
+		"keystoreID": testKeystoreID,
+	})
+	req.Header.Set("Hub-Kms-Secret", base64.StdEncoding.EncodeToString([]byte("secret")))
+	req.Header.Set("Hub-Kms-User", "user")
+
+	for i := 0; i < secretsplitlock.DefaultCircuitBreakerFailures; i++ {
+		_, err = svc.ResolveKeystore(req)
+		require.True(t, errors.Is(err, secretsplitlock.ErrUnavailable))
+	}
+
+	_, err = svc.ResolveKeystore(req)
+	require.True(t, errors.Is(err, secretsplitlock.ErrUnavailable))
+	require.Contains(t, err.Error(), "circuit breaker is open")
+	require.Equal(t, secretsplitlock.DefaultCircuitBreakerFailures, calls)
+}
+
+func TestResolveKeystoreWithSecretShareProvider(t *testing.T) {
+	secrets, err := (&base.Splitter{}).Split([]byte("secret"), 2, 2)
+	require.NoError(t, err)
+
+	b, err := json.Marshal(testKeystoreData())
+	require.NoError(t, err)
+
+	sp := mockstorage.NewMockStoreProvider()
+	sp.Store.Store[testKeystoreID] = b
+
+	svc, err := kms.NewService(&kms.Config{
+		StorageProvider:           sp,
+		KeyManagerStorageProvider: mockstorage.NewMockStoreProvider(),
+		PrimaryKeyStorageProvider: mockstorage.NewMockStoreProvider(),
+		CreateSecretLockFunc: func(keyURI string, p lock.Provider) (secretlock.Service, error) {
+			require.Equal(t, "local-lock://"+testKeystoreID, keyURI)
+
+			return p.SecretLock(), nil
+		},
+		SecretShareProvider: &mockShareProvider{share: secrets[1]},
+	})
+	require.NoError(t, err)
+
+	t.Run("Success", func(t *testing.T) {
+		req := mux.SetURLVars(httptest.NewRequest(http.MethodPost, "/", nil), map[string]string{
+			"keystoreID": testKeystoreID,
+		})
+		req.Header.Set("Hub-Kms-Secret", base64.StdEncoding.EncodeToString(secrets[0]))
+
+		k, err := svc.ResolveKeystore(req)
+
+		require.NotNil(t, k)
+		require.NoError(t, err)
+	})
+
+	t.Run("Fail without secret share in the header", func(t *testing.T) {
+		req := mux.SetURLVars(httptest.NewRequest(http.MethodPost, "/", nil), map[string]string{
+			"keystoreID": testKeystoreID,
+		})
+
+		k, err := svc.ResolveKeystore(req)
+
+		require.Nil(t, k)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "empty secret share in the Hub-Kms-Secret header")
+	})
+}
+
+func TestResolveKeystoreWithSecretShares(t *testing.T) {
+	secrets, err := (&base.Splitter{}).Split([]byte("secret"), 2, 2)
+	require.NoError(t, err)
+
+	data := testKeystoreData()
+	data.SecretShares = &kms.SecretShares{
+		Threshold: 2,
+		Providers: []string{kms.ShareProviderHeader, testShareProvider},
+	}
+
+	b, err := json.Marshal(data)
+	require.NoError(t, err)
+
+	newService := func(t *testing.T, shareProviders map[string]secretsplitlock.ShareProvider) kms.Service {
+		t.Helper()
+
+		sp := mockstorage.NewMockStoreProvider()
+		sp.Store.Store[testKeystoreID] = b
+
+		svc, err := kms.NewService(&kms.Config{
+			StorageProvider:           sp,
+			KeyManagerStorageProvider: mockstorage.NewMockStoreProvider(),
+			PrimaryKeyStorageProvider: mockstorage.NewMockStoreProvider(),
+			CreateSecretLockFunc: func(keyURI string, p lock.Provider) (secretlock.Service, error) {
+				require.Equal(t, "local-lock://"+testKeystoreID, keyURI)
+
+				return p.SecretLock(), nil
+			},
+			ShareProviders: shareProviders,
+		})
+		require.NoError(t, err)
+
+		return svc
+	}
+
+	newRequest := func(secret []byte) *http.Request {
+		req := mux.SetURLVars(httptest.NewRequest(http.MethodPost, "/", nil), map[string]string{
+			"keystoreID": testKeystoreID,
+		})
+
+		if secret != nil {
+			req.Header.Set("Hub-Kms-Secret", base64.StdEncoding.EncodeToString(secret))
+		}
+
+		return req
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		svc := newService(t, map[string]secretsplitlock.ShareProvider{
+			testShareProvider: &mockShareProvider{share: secrets[1]},
+		})
+
+		k, err := svc.ResolveKeystore(newRequest(secrets[0]))
+
+		require.NotNil(t, k)
+		require.NoError(t, err)
+	})
+
+	t.Run("Fail if not enough secret shares", func(t *testing.T) {
+		svc := newService(t, map[string]secretsplitlock.ShareProvider{
+			testShareProvider: &mockShareProvider{share: secrets[1]},
+		})
+
+		k, err := svc.ResolveKeystore(newRequest(nil))
+
+		require.Nil(t, k)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "not enough secret shares: got 1 of 2")
+	})
+
+	t.Run("Fail if share provider is not configured", func(t *testing.T) {
+		svc := newService(t, nil)
+
+		k, err := svc.ResolveKeystore(newRequest(secrets[0]))
+
+		require.Nil(t, k)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "secret share provider mock is not configured")
+	})
+}
+
 func TestGetKeystoreData(t *testing.T) {
 	t.Run("Success", func(t *testing.T) {
 		b, err := json.Marshal(testKeystoreData())
@@ -215,6 +673,52 @@ func TestSaveKeystoreData(t *testing.T) {
 		require.NoError(t, err)
 	})
 
+	t.Run("Revision is compared and incremented", func(t *testing.T) {
+		svc, err := kms.NewService(&kms.Config{
+			StorageProvider: mockstorage.NewMockStoreProvider(),
+			LocalKMS:        &mockkms.KeyManager{},
+		})
+		require.NoError(t, err)
+
+		kd := testKeystoreData()
+		require.NoError(t, svc.SaveKeystoreData(kd))
+		require.Equal(t, 1, kd.Revision)
+
+		first, err := svc.GetKeystoreData(testKeystoreID)
+		require.NoError(t, err)
+
+		second, err := svc.GetKeystoreData(testKeystoreID)
+		require.NoError(t, err)
+
+		first.EDVCapability = []byte(`{"id":"first"}`)
+		require.NoError(t, svc.SaveKeystoreData(first))
+		require.Equal(t, 2, first.Revision)
+
+		second.EDVCapability = []byte(`{"id":"second"}`)
+		err = svc.SaveKeystoreData(second)
+		require.True(t, errors.Is(err, kms.ErrRevisionConflict))
+		require.Equal(t, 1, second.Revision, "revision is not changed on conflict")
+
+		saved, err := svc.GetKeystoreData(testKeystoreID)
+		require.NoError(t, err)
+		require.JSONEq(t, `{"id":"first"}`, string(saved.EDVCapability))
+		require.Equal(t, 2, saved.Revision)
+	})
+
+	t.Run("Conflict for a new keystore with revision", func(t *testing.T) {
+		svc, err := kms.NewService(&kms.Config{
+			StorageProvider: mockstorage.NewMockStoreProvider(),
+			LocalKMS:        &mockkms.KeyManager{},
+		})
+		require.NoError(t, err)
+
+		kd := testKeystoreData()
+		kd.Revision = 1
+
+		err = svc.SaveKeystoreData(kd)
+		require.True(t, errors.Is(err, kms.ErrRevisionConflict))
+	})
+
 	t.Run("Fail to save keystore data", func(t *testing.T) {
 		svc, err := kms.NewService(&kms.Config{
 			StorageProvider: &mockstorage.MockStoreProvider{
@@ -230,6 +734,10 @@ func TestSaveKeystoreData(t *testing.T) {
 	})
 }
 
+func createRequest() *http.Request {
+	return httptest.NewRequest(http.MethodPost, "/kms/keystores", nil)
+}
+
 func testKeystoreData() *kms.KeystoreData {
 	createdAt := time.Now().UTC()
 
@@ -286,6 +794,57 @@ func (m *mockHTTPClient) Do(req *http.Request) (*http.Response, error) {
 	return m.DoFunc(req)
 }
 
+type mockShareProvider struct {
+	share []byte
+	err   error
+	calls int
+}
+
+func (p *mockShareProvider) Share(*http.Request, string) ([]byte, error) {
+	p.calls++
+
+	return p.share, p.err
+}
+
+// keystoreShareProvider stores one share per keystore.
+type keystoreShareProvider struct {
+	shares    map[string][]byte
+	updateErr error
+	down      bool
+}
+
+func (p *keystoreShareProvider) Share(_ *http.Request, keystoreID string) ([]byte, error) {
+	share, ok := p.shares[keystoreID]
+	if p.down || !ok {
+		return nil, secretsplitlock.ErrShareNotFound
+	}
+
+	return share, nil
+}
+
+func (p *keystoreShareProvider) UpdateShare(_ *http.Request, keystoreID string, share []byte) error {
+	if p.updateErr != nil {
+		return p.updateErr
+	}
+
+	if p.shares == nil {
+		p.shares = make(map[string][]byte)
+	}
+
+	p.shares[keystoreID] = append([]byte(nil), share...)
+
+	return nil
+}
+
+type mockDIDKeyCreator struct {
+	didKey string
+	err    error
+}
+
+func (m *mockDIDKeyCreator) CreateDIDKey(context.Context) (string, error) {
+	return m.didKey, m.err
+}
+
 type mockHeaderSigner struct {
 	signVal *http.Header
 	signErr error
@@ -0,0 +1,150 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package kms
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/trustbloc/hub-kms/pkg/secretlock/secretsplitlock"
+)
+
+const (
+	// DefaultSessionTTL is the lifetime of the unlock session if Config.SessionTTL is not set.
+	DefaultSessionTTL = 5 * time.Minute
+
+	sessionHeader    = "Hub-Kms-Session"
+	sessionTokenSize = 32
+)
+
+var (
+	// ErrSessionNotFound is returned when the session token is unknown, expired or bound to another keystore.
+	ErrSessionNotFound = errors.New("session not found or expired")
+	// ErrUnlockNotSupported is returned when the keystore is not protected with secret shares.
+	ErrUnlockNotSupported = errors.New("keystore is not protected with secret shares")
+)
+
+// Session is the unlock session of the keystore. The token is passed in the Hub-Kms-Session header instead of
+// the secret share headers until the session expires or the keystore is locked.
+type Session struct {
+	Token     string
+	ExpiresAt time.Time
+}
+
+// sessionStore keeps combined secrets of unlocked keystores in memory. Sessions are looked up by the hash of the
+// token, so tokens themselves are not kept. The secret is overwritten with zeros when the session expires or is
+// closed.
+type sessionStore struct {
+	ttl      time.Duration
+	mu       sync.Mutex
+	sessions map[[sha256.Size]byte]*session
+}
+
+type session struct {
+	keystoreID string
+	secret     []byte
+	timer      *time.Timer
+}
+
+func newSessionStore(ttl time.Duration) *sessionStore {
+	if ttl <= 0 {
+		ttl = DefaultSessionTTL
+	}
+
+	return &sessionStore{ttl: ttl, sessions: make(map[[sha256.Size]byte]*session)}
+}
+
+// open starts the session of the keystore. The session takes ownership of the secret.
+func (s *sessionStore) open(keystoreID string, secret []byte) (*Session, error) {
+	b := make([]byte, sessionTokenSize)
+
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+
+	token := base64.RawURLEncoding.EncodeToString(b)
+	key := sha256.Sum256([]byte(token))
+	expiresAt := time.Now().Add(s.ttl).UTC()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sessions[key] = &session{
+		keystoreID: keystoreID,
+		secret:     secret,
+		timer:      time.AfterFunc(s.ttl, func() { s.evict(key) }),
+	}
+
+	return &Session{Token: token, ExpiresAt: expiresAt}, nil
+}
+
+// get returns a copy of the secret of the keystore unlocked with the token, so the session can be closed while
+// the secret is in use. The caller should wipe the copy with secretsplitlock.Zeroize.
+func (s *sessionStore) get(keystoreID, token string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, ok := s.sessions[sha256.Sum256([]byte(token))]
+	if !ok || sess.keystoreID != keystoreID {
+		return nil, ErrSessionNotFound
+	}
+
+	secret := make([]byte, len(sess.secret))
+	copy(secret, sess.secret)
+
+	return secret, nil
+}
+
+// close ends the session before it expires.
+func (s *sessionStore) close(keystoreID, token string) error {
+	key := sha256.Sum256([]byte(token))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, ok := s.sessions[key]
+	if !ok || sess.keystoreID != keystoreID {
+		return ErrSessionNotFound
+	}
+
+	sess.timer.Stop()
+	secretsplitlock.Zeroize(sess.secret)
+
+	delete(s.sessions, key)
+
+	return nil
+}
+
+func (s *sessionStore) evict(key [sha256.Size]byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if sess, ok := s.sessions[key]; ok {
+		secretsplitlock.Zeroize(sess.secret)
+
+		delete(s.sessions, key)
+	}
+}
+
+// closeKeystore ends all sessions of the keystore.
+func (s *sessionStore) closeKeystore(keystoreID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, sess := range s.sessions {
+		if sess.keystoreID == keystoreID {
+			sess.timer.Stop()
+			secretsplitlock.Zeroize(sess.secret)
+
+			delete(s.sessions, key)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package kms_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	mocksecretlock "github.com/hyperledger/aries-framework-go/pkg/mock/secretlock"
+	mockstorage "github.com/hyperledger/aries-framework-go/pkg/mock/storage"
+	"github.com/hyperledger/aries-framework-go/pkg/secretlock"
+	"github.com/stretchr/testify/require"
+	"github.com/trustbloc/edge-core/pkg/sss/base"
+
+	"github.com/trustbloc/hub-kms/pkg/kms"
+	lock "github.com/trustbloc/hub-kms/pkg/secretlock"
+	"github.com/trustbloc/hub-kms/pkg/secretlock/secretsplitlock"
+)
+
+func TestUnlockKeystore(t *testing.T) {
+	secrets, err := (&base.Splitter{}).Split([]byte("secret"), 2, 2)
+	require.NoError(t, err)
+
+	data := testKeystoreData()
+	data.SecretShares = &kms.SecretShares{
+		Threshold: 2,
+		Providers: []string{kms.ShareProviderHeader, testShareProvider},
+	}
+
+	newService := func(t *testing.T, ttl time.Duration) (kms.Service, *mockShareProvider) {
+		t.Helper()
+
+		b, err := json.Marshal(data)
+		require.NoError(t, err)
+
+		sp := mockstorage.NewMockStoreProvider()
+		sp.Store.Store[testKeystoreID] = b
+
+		shareProvider := &mockShareProvider{share: secrets[1]}
+
+		svc, err := kms.NewService(&kms.Config{
+			StorageProvider:           sp,
+			KeyManagerStorageProvider: mockstorage.NewMockStoreProvider(),
+			PrimaryKeyStorageProvider: mockstorage.NewMockStoreProvider(),
+			CreateSecretLockFunc: func(keyURI string, p lock.Provider) (secretlock.Service, error) {
+				return p.SecretLock(), nil
+			},
+			ShareProviders: map[string]secretsplitlock.ShareProvider{
+				testShareProvider: shareProvider,
+			},
+			SessionTTL: ttl,
+		})
+		require.NoError(t, err)
+
+		return svc, shareProvider
+	}
+
+	newRequest := func(keystoreID string, headers map[string]string) *http.Request {
+		req := mux.SetURLVars(httptest.NewRequest(http.MethodPost, "/", nil), map[string]string{
+			"keystoreID": keystoreID,
+		})
+
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+
+		return req
+	}
+
+	secretHeader := map[string]string{"Hub-Kms-Secret": base64.StdEncoding.EncodeToString(secrets[0])}
+
+	t.Run("Resolve keystore with session token", func(t *testing.T) {
+		svc, shareProvider := newService(t, time.Minute)
+
+		session, err := svc.UnlockKeystore(newRequest(testKeystoreID, secretHeader))
+		require.NoError(t, err)
+		require.NotEmpty(t, session.Token)
+		require.True(t, session.ExpiresAt.After(time.Now()))
+
+		sessionHeader := map[string]string{"Hub-Kms-Session": session.Token}
+
+		k, err := svc.ResolveKeystore(newRequest(testKeystoreID, sessionHeader))
+		require.NoError(t, err)
+		require.NotNil(t, k)
+		require.Equal(t, 1, shareProvider.calls, "secret shares are requested once per session")
+
+		_, err = svc.ResolveKeystore(newRequest("otherKeystoreID", sessionHeader))
+		require.Error(t, err)
+
+		require.NoError(t, svc.LockKeystore(newRequest(testKeystoreID, sessionHeader)))
+
+		_, err = svc.ResolveKeystore(newRequest(testKeystoreID, sessionHeader))
+		require.True(t, errors.Is(err, kms.ErrSessionNotFound))
+
+		err = svc.LockKeystore(newRequest(testKeystoreID, sessionHeader))
+		require.True(t, errors.Is(err, kms.ErrSessionNotFound))
+	})
+
+	t.Run("Session is bound to keystore", func(t *testing.T) {
+		svc, _ := newService(t, time.Minute)
+
+		session, err := svc.UnlockKeystore(newRequest(testKeystoreID, secretHeader))
+		require.NoError(t, err)
+
+		err = svc.LockKeystore(newRequest("otherKeystoreID", map[string]string{"Hub-Kms-Session": session.Token}))
+		require.True(t, errors.Is(err, kms.ErrSessionNotFound))
+	})
+
+	t.Run("Session expires", func(t *testing.T) {
+		svc, _ := newService(t, 10*time.Millisecond)
+
+		session, err := svc.UnlockKeystore(newRequest(testKeystoreID, secretHeader))
+		require.NoError(t, err)
+
+		sessionHeader := map[string]string{"Hub-Kms-Session": session.Token}
+
+		require.Eventually(t, func() bool {
+			_, err = svc.ResolveKeystore(newRequest(testKeystoreID, sessionHeader))
+
+			return errors.Is(err, kms.ErrSessionNotFound)
+		}, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("Fail without secret shares", func(t *testing.T) {
+		svc, _ := newService(t, time.Minute)
+
+		_, err := svc.UnlockKeystore(newRequest(testKeystoreID, nil))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "not enough secret shares")
+	})
+
+	t.Run("Fail if keystore is not protected with secret shares", func(t *testing.T) {
+		b, err := json.Marshal(testKeystoreData())
+		require.NoError(t, err)
+
+		sp := mockstorage.NewMockStoreProvider()
+		sp.Store.Store[testKeystoreID] = b
+
+		svc, err := kms.NewService(&kms.Config{
+			StorageProvider: sp,
+			PrimaryKeyLock:  &mocksecretlock.MockSecretLock{},
+		})
+		require.NoError(t, err)
+
+		_, err = svc.UnlockKeystore(newRequest(testKeystoreID, nil))
+		require.True(t, errors.Is(err, kms.ErrUnlockNotSupported))
+	})
+
+	t.Run("Fail if keystore is not found", func(t *testing.T) {
+		svc, _ := newService(t, time.Minute)
+
+		_, err := svc.UnlockKeystore(newRequest("unknown", secretHeader))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "unlock keystore")
+	})
+}
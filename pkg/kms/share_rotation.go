@@ -0,0 +1,190 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package kms
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	lock "github.com/trustbloc/hub-kms/pkg/secretlock"
+	"github.com/trustbloc/hub-kms/pkg/secretlock/secretsplitlock"
+)
+
+// splitLockShares is the number of shares of the keystore secret without SecretShares: the client share passed in
+// the Hub-Kms-Secret header and the server share of the share provider. Both are needed to unlock the keystore.
+const splitLockShares = 2
+
+// ErrShareRotationNotSupported is returned when secret shares of the keystore cannot be rotated.
+var ErrShareRotationNotSupported = errors.New("secret share rotation is supported only for keystores protected " +
+	"with the share from the Hub-Kms-Secret header and the share of a provider that accepts new shares")
+
+// fixedShareProvider provides the share fetched beforehand.
+type fixedShareProvider []byte
+
+func (p fixedShareProvider) Share(*http.Request, string) ([]byte, error) {
+	return p, nil
+}
+
+// RotateSecretShares replaces secret shares of the keystore. The current shares from the request are verified first,
+// then a new secret is split into the client share, which is returned, and the server share, which is pushed to
+// the share provider. The primary key of the keystore is re-encrypted under the new secret, so keys are kept.
+// If the share provider keeps one share per user (e.g. Hub Auth), the share is common to all keystores of the user,
+// so primary keys of all of them are re-encrypted in the same operation. Sessions of the keystores are closed.
+func (s *service) RotateSecretShares(req *http.Request) ([]byte, error) {
+	keystoreData, err := s.GetKeystoreData(mux.Vars(req)[keystoreIDQueryParam])
+	if err != nil {
+		return nil, fmt.Errorf("rotate secret shares: %w", err)
+	}
+
+	updater, ok := s.shareProvider.(secretsplitlock.ShareUpdater)
+	if s.secretLockType(keystoreData) != SecretLockTypeSplit || !ok {
+		return nil, fmt.Errorf("rotate secret shares: %w", ErrShareRotationNotSupported)
+	}
+
+	req, err = s.verifyUser(req, keystoreData)
+	if err != nil {
+		return nil, fmt.Errorf("rotate secret shares: %w", err)
+	}
+
+	s.shareRotationMu.Lock()
+	defer s.shareRotationMu.Unlock()
+
+	keystores, err := s.shareKeystores(keystoreData)
+	if err != nil {
+		return nil, fmt.Errorf("rotate secret shares: %w", err)
+	}
+
+	clientShare, err := s.rotateSecretShares(req, keystoreData, keystores, updater)
+	if err != nil {
+		return nil, fmt.Errorf("rotate secret shares: %w", err)
+	}
+
+	for _, kd := range keystores {
+		s.sessions.closeKeystore(kd.ID)
+	}
+
+	return clientShare, nil
+}
+
+// shareKeystores returns keystores protected by the server share of the keystore. A share kept per user protects
+// all split lock keystores of the user. Keystores of the user are found by the controller, which is bound to
+// the user only by verified user assertions. Threshold keystores cannot be re-split, so rotation is refused if
+// the share of the user protects any of them.
+func (s *service) shareKeystores(kd *KeystoreData) ([]*KeystoreData, error) {
+	if !perUser(s.shareProvider) {
+		return []*KeystoreData{kd}, nil
+	}
+
+	if s.config.UserAssertionValidator == nil {
+		return nil, fmt.Errorf("%w: shares are kept per user, so user assertions are required to find keystores "+
+			"of the user", ErrShareRotationNotSupported)
+	}
+
+	keystores := []*KeystoreData{kd}
+	query := &KeystoreQuery{Controller: kd.Controller, Limit: MaxQueryLimit}
+
+	for {
+		page, err := s.QueryKeystores(query)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, k := range page.Keystores {
+			switch {
+			case k.ID == kd.ID:
+			case s.secretLockType(k) == SecretLockTypeSplit:
+				keystores = append(keystores, k)
+			case s.secretLockType(k) == SecretLockTypeThreshold && s.usesUserShares(k):
+				return nil, fmt.Errorf("%w: the share of the user also protects threshold keystore %s",
+					ErrShareRotationNotSupported, k.ID)
+			}
+		}
+
+		if page.NextCursor == "" {
+			return keystores, nil
+		}
+
+		query.Cursor = page.NextCursor
+	}
+}
+
+// usesUserShares checks whether a share kept per user is among the secret shares of the threshold keystore.
+func (s *service) usesUserShares(kd *KeystoreData) bool {
+	if kd.SecretShares == nil {
+		return false
+	}
+
+	for _, name := range kd.SecretShares.Providers {
+		if perUser(s.shareProviders[name]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func perUser(p secretsplitlock.ShareProvider) bool {
+	u, ok := p.(secretsplitlock.UserShares)
+
+	return ok && u.PerUser()
+}
+
+func (s *service) rotateSecretShares(req *http.Request, kd *KeystoreData, keystores []*KeystoreData,
+	updater secretsplitlock.ShareUpdater) ([]byte, error) {
+	// the current server share is kept to restore it if the re-encrypted primary key is not stored
+	oldShare, err := s.shareProvider.Share(req, kd.ID)
+	if err != nil {
+		return nil, fmt.Errorf("get secret share: %w", err)
+	}
+
+	oldLock, err := secretsplitlock.NewThresholdLock(req, kd.ID, splitLockShares,
+		[]secretsplitlock.ShareProvider{s.shareProviders[ShareProviderHeader], fixedShareProvider(oldShare)})
+	if err != nil {
+		return nil, err
+	}
+
+	shares, newLock, err := secretsplitlock.NewSecretShares(splitLockShares, splitLockShares)
+	if err != nil {
+		return nil, err
+	}
+
+	keyURIs := make([]string, len(keystores))
+
+	for i, k := range keystores {
+		keyURIs[i] = s.primaryKeyURI(k)
+	}
+
+	published := false
+
+	// primary keys of all keystores are decrypted with the current shares before the new share is pushed
+	err = lock.RekeyPrimaryKeys(keyURIs, &secretLockProvider{
+		storageProvider: s.config.PrimaryKeyStorageProvider,
+		secretLock:      oldLock,
+	}, newLock, func() error {
+		if e := updater.UpdateShare(req, kd.ID, shares[1]); e != nil {
+			return e
+		}
+
+		published = true
+
+		return nil
+	})
+	if err != nil && published {
+		if e := updater.UpdateShare(req, kd.ID, oldShare); e != nil {
+			return nil, fmt.Errorf("%w (failed to restore the previous secret share: %v)", err, e)
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return shares[0], nil
+}
@@ -0,0 +1,340 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package kms_test
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	arieskms "github.com/hyperledger/aries-framework-go/pkg/kms"
+	mockstorage "github.com/hyperledger/aries-framework-go/pkg/mock/storage"
+	"github.com/hyperledger/aries-framework-go/pkg/secretlock/noop"
+	"github.com/hyperledger/aries-framework-go/pkg/storage/mem"
+	"github.com/stretchr/testify/require"
+	"github.com/trustbloc/edge-core/pkg/sss/base"
+
+	"github.com/trustbloc/hub-kms/pkg/kms"
+	lock "github.com/trustbloc/hub-kms/pkg/secretlock"
+	"github.com/trustbloc/hub-kms/pkg/secretlock/secretsplitlock"
+)
+
+func TestRotateSecretShares(t *testing.T) {
+	secrets, err := (&base.Splitter{}).Split([]byte("secret"), 2, 2)
+	require.NoError(t, err)
+
+	newService := func(t *testing.T, p secretsplitlock.ShareProvider) (kms.Service, string) {
+		t.Helper()
+
+		svc, err := kms.NewService(&kms.Config{
+			StorageProvider:           mem.NewProvider(),
+			KeyManagerStorageProvider: mem.NewProvider(),
+			PrimaryKeyStorageProvider: mem.NewProvider(),
+			CreateSecretLockFunc:      lock.New,
+			SecretShareProvider:       p,
+			SessionTTL:                time.Minute,
+		})
+		require.NoError(t, err)
+
+		data, _, err := svc.CreateKeystore(createRequest(), testController, "")
+		require.NoError(t, err)
+
+		return svc, data.ID
+	}
+
+	newRequest := func(keystoreID string, headers map[string]string) *http.Request {
+		req := mux.SetURLVars(httptest.NewRequest(http.MethodPost, "/", nil), map[string]string{
+			"keystoreID": keystoreID,
+		})
+
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+
+		return req
+	}
+
+	secretHeader := func(share []byte) map[string]string {
+		return map[string]string{"Hub-Kms-Secret": base64.StdEncoding.EncodeToString(share)}
+	}
+
+	t.Run("Keys are available with new shares", func(t *testing.T) {
+		p := &updatableShareProvider{share: secrets[1]}
+		svc, keystoreID := newService(t, p)
+
+		ks, err := svc.ResolveKeystore(newRequest(keystoreID, secretHeader(secrets[0])))
+		require.NoError(t, err)
+
+		keyID, err := ks.CreateKey(arieskms.ED25519Type)
+		require.NoError(t, err)
+
+		session, err := svc.UnlockKeystore(newRequest(keystoreID, secretHeader(secrets[0])))
+		require.NoError(t, err)
+
+		clientShare, err := svc.RotateSecretShares(newRequest(keystoreID, secretHeader(secrets[0])))
+		require.NoError(t, err)
+		require.NotEqual(t, secrets[0], clientShare)
+		require.NotEqual(t, secrets[1], p.share, "server share is pushed to the provider")
+
+		ks, err = svc.ResolveKeystore(newRequest(keystoreID, secretHeader(clientShare)))
+		require.NoError(t, err)
+
+		_, err = ks.GetKeyHandle(keyID)
+		require.NoError(t, err)
+
+		_, err = svc.ResolveKeystore(newRequest(keystoreID, secretHeader(secrets[0])))
+		require.Error(t, err, "old client share is not valid")
+
+		_, err = svc.ResolveKeystore(newRequest(keystoreID, map[string]string{"Hub-Kms-Session": session.Token}))
+		require.True(t, errors.Is(err, kms.ErrSessionNotFound), "sessions are closed")
+	})
+
+	t.Run("Fail with invalid client share", func(t *testing.T) {
+		p := &updatableShareProvider{share: secrets[1]}
+		svc, keystoreID := newService(t, p)
+
+		_, err := svc.ResolveKeystore(newRequest(keystoreID, secretHeader(secrets[0])))
+		require.NoError(t, err)
+
+		other, err := (&base.Splitter{}).Split([]byte("secreT"), 2, 2)
+		require.NoError(t, err)
+
+		_, err = svc.RotateSecretShares(newRequest(keystoreID, secretHeader(other[0])))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "decrypt primary key")
+		require.Equal(t, secrets[1], p.share, "server share is not changed")
+	})
+
+	t.Run("Previous server share is restored if primary key is not stored", func(t *testing.T) {
+		p := &updatableShareProvider{share: secrets[1]}
+		primaryKeyStorage := mockstorage.NewMockStoreProvider()
+
+		svc, err := kms.NewService(&kms.Config{
+			StorageProvider:           mem.NewProvider(),
+			KeyManagerStorageProvider: mem.NewProvider(),
+			PrimaryKeyStorageProvider: primaryKeyStorage,
+			CreateSecretLockFunc:      lock.New,
+			SecretShareProvider:       p,
+		})
+		require.NoError(t, err)
+
+		data, _, err := svc.CreateKeystore(createRequest(), testController, "")
+		require.NoError(t, err)
+
+		_, err = svc.ResolveKeystore(newRequest(data.ID, secretHeader(secrets[0])))
+		require.NoError(t, err)
+
+		primaryKeyStorage.Store.ErrPut = errors.New("put error")
+
+		_, err = svc.RotateSecretShares(newRequest(data.ID, secretHeader(secrets[0])))
+		require.EqualError(t, err, "rotate secret shares: replace primary key: put error")
+		require.Equal(t, secrets[1], p.share)
+	})
+
+	t.Run("Fail to push server share", func(t *testing.T) {
+		p := &updatableShareProvider{share: secrets[1], updateErr: errors.New("update error")}
+		svc, keystoreID := newService(t, p)
+
+		_, err := svc.ResolveKeystore(newRequest(keystoreID, secretHeader(secrets[0])))
+		require.NoError(t, err)
+
+		_, err = svc.RotateSecretShares(newRequest(keystoreID, secretHeader(secrets[0])))
+		require.EqualError(t, err, "rotate secret shares: update error")
+
+		_, err = svc.ResolveKeystore(newRequest(keystoreID, secretHeader(secrets[0])))
+		require.NoError(t, err, "current shares are still valid")
+	})
+
+	t.Run("Fail if share provider does not accept new shares", func(t *testing.T) {
+		svc, keystoreID := newService(t, &mockShareProvider{share: secrets[1]})
+
+		_, err := svc.RotateSecretShares(newRequest(keystoreID, secretHeader(secrets[0])))
+		require.True(t, errors.Is(err, kms.ErrShareRotationNotSupported))
+	})
+
+	t.Run("Fail if keystore is not protected with secret shares", func(t *testing.T) {
+		svc, err := kms.NewService(&kms.Config{
+			StorageProvider: mem.NewProvider(),
+			PrimaryKeyLock:  &noop.NoLock{},
+		})
+		require.NoError(t, err)
+
+		data, _, err := svc.CreateKeystore(createRequest(), testController, "")
+		require.NoError(t, err)
+
+		_, err = svc.RotateSecretShares(newRequest(data.ID, nil))
+		require.True(t, errors.Is(err, kms.ErrShareRotationNotSupported))
+	})
+}
+
+func TestRotateSecretShares_SharesPerUser(t *testing.T) {
+	secrets, err := (&base.Splitter{}).Split([]byte("secret"), 2, 2)
+	require.NoError(t, err)
+
+	newService := func(t *testing.T, v kms.UserAssertionValidator, p secretsplitlock.ShareProvider) kms.Service {
+		t.Helper()
+
+		svc, err := kms.NewService(&kms.Config{
+			StorageProvider:           mem.NewProvider(),
+			KeyManagerStorageProvider: mem.NewProvider(),
+			PrimaryKeyStorageProvider: mem.NewProvider(),
+			CreateSecretLockFunc:      lock.New,
+			SecretShareProvider:       p,
+			ShareProviders:            map[string]secretsplitlock.ShareProvider{testShareProvider: p},
+			UserAssertionValidator:    v,
+		})
+		require.NoError(t, err)
+
+		return svc
+	}
+
+	newRequest := func(keystoreID string, share []byte) *http.Request {
+		req := mux.SetURLVars(httptest.NewRequest(http.MethodPost, "/", nil), map[string]string{
+			"keystoreID": keystoreID,
+		})
+
+		req.Header.Set("Hub-Kms-Secret", base64.StdEncoding.EncodeToString(share))
+		req.Header.Set("Hub-Kms-User-Assertion", testUserAssertion)
+
+		return req
+	}
+
+	createKeystore := func(t *testing.T, svc kms.Service, share []byte, options ...kms.CreateKeystoreOption) (string,
+		string) {
+		t.Helper()
+
+		data, _, err := svc.CreateKeystore(createRequest(), testController, "", options...)
+		require.NoError(t, err)
+
+		ks, err := svc.ResolveKeystore(newRequest(data.ID, share))
+		require.NoError(t, err)
+
+		keyID, err := ks.CreateKey(arieskms.ED25519Type)
+		require.NoError(t, err)
+
+		return data.ID, keyID
+	}
+
+	validator := &mockUserAssertionValidator{subject: testController}
+
+	t.Run("Keys of all keystores of the user are available with new shares", func(t *testing.T) {
+		p := &userUpdatableShareProvider{updatableShareProvider{share: secrets[1]}}
+		svc := newService(t, validator, p)
+
+		keystoreID1, keyID1 := createKeystore(t, svc, secrets[0])
+		keystoreID2, keyID2 := createKeystore(t, svc, secrets[0])
+
+		session, err := svc.UnlockKeystore(newRequest(keystoreID2, secrets[0]))
+		require.NoError(t, err)
+
+		clientShare, err := svc.RotateSecretShares(newRequest(keystoreID1, secrets[0]))
+		require.NoError(t, err)
+
+		for keystoreID, keyID := range map[string]string{keystoreID1: keyID1, keystoreID2: keyID2} {
+			ks, err := svc.ResolveKeystore(newRequest(keystoreID, clientShare))
+			require.NoError(t, err)
+
+			_, err = ks.GetKeyHandle(keyID)
+			require.NoError(t, err)
+		}
+
+		req := newRequest(keystoreID2, nil)
+		req.Header.Set("Hub-Kms-Session", session.Token)
+
+		_, err = svc.ResolveKeystore(req)
+		require.True(t, errors.Is(err, kms.ErrSessionNotFound), "sessions of all keystores are closed")
+	})
+
+	t.Run("Fail if other keystore of the user is protected with other client share", func(t *testing.T) {
+		other, err := (&base.Splitter{}).Split([]byte("other secret"), 2, 2)
+		require.NoError(t, err)
+
+		p := &userUpdatableShareProvider{updatableShareProvider{share: secrets[1]}}
+		svc := newService(t, validator, p)
+
+		keystoreID, _ := createKeystore(t, svc, secrets[0])
+
+		// the keystore is created with the other client share while the server share is the same
+		p.share = other[1]
+		_, _ = createKeystore(t, svc, other[0])
+		p.share = secrets[1]
+
+		_, err = svc.RotateSecretShares(newRequest(keystoreID, secrets[0]))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "decrypt primary key")
+		require.Equal(t, secrets[1], p.share, "server share is not changed")
+
+		_, err = svc.ResolveKeystore(newRequest(keystoreID, secrets[0]))
+		require.NoError(t, err, "current shares are still valid")
+	})
+
+	t.Run("Fail if share of the user protects threshold keystore", func(t *testing.T) {
+		p := &userUpdatableShareProvider{updatableShareProvider{share: secrets[1]}}
+		svc := newService(t, validator, p)
+
+		keystoreID, _ := createKeystore(t, svc, secrets[0])
+
+		// threshold keystores can't be created with shares kept per user anymore, but older ones may exist
+		err := svc.SaveKeystoreData(&kms.KeystoreData{
+			ID:             "threshold",
+			Controller:     testController,
+			SecretLockType: kms.SecretLockTypeThreshold,
+			SecretShares: &kms.SecretShares{
+				Threshold: 2,
+				Providers: []string{kms.ShareProviderHeader, testShareProvider},
+			},
+		})
+		require.NoError(t, err)
+
+		_, err = svc.RotateSecretShares(newRequest(keystoreID, secrets[0]))
+		require.True(t, errors.Is(err, kms.ErrShareRotationNotSupported))
+		require.Equal(t, secrets[1], p.share)
+	})
+
+	t.Run("Fail without user assertions", func(t *testing.T) {
+		p := &userUpdatableShareProvider{updatableShareProvider{share: secrets[1]}}
+		svc := newService(t, nil, p)
+
+		keystoreID, _ := createKeystore(t, svc, secrets[0])
+
+		_, err := svc.RotateSecretShares(newRequest(keystoreID, secrets[0]))
+		require.True(t, errors.Is(err, kms.ErrShareRotationNotSupported))
+		require.Equal(t, secrets[1], p.share)
+	})
+}
+
+type updatableShareProvider struct {
+	share     []byte
+	updateErr error
+}
+
+func (p *updatableShareProvider) Share(*http.Request, string) ([]byte, error) {
+	return p.share, nil
+}
+
+func (p *updatableShareProvider) UpdateShare(_ *http.Request, _ string, share []byte) error {
+	if p.updateErr != nil {
+		return p.updateErr
+	}
+
+	p.share = share
+
+	return nil
+}
+
+// userUpdatableShareProvider keeps one share per user like Hub Auth does.
+type userUpdatableShareProvider struct {
+	updatableShareProvider
+}
+
+func (p *userUpdatableShareProvider) PerUser() bool {
+	return true
+}
@@ -0,0 +1,61 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package kms
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/trustbloc/hub-kms/pkg/auth/oauth2"
+)
+
+const userAssertionHeader = "Hub-Kms-User-Assertion"
+
+// ErrInvalidUserAssertion is returned when the signed user assertion is missing, invalid or issued for a user other
+// than the controller of the keystore.
+var ErrInvalidUserAssertion = errors.New("invalid user assertion")
+
+// UserAssertionValidator verifies signed user assertions (JWTs) issued by the trusted issuer.
+type UserAssertionValidator interface {
+	Validate(ctx context.Context, token string) (*oauth2.Claims, error)
+}
+
+// verifyUser verifies the user assertion from the Hub-Kms-User-Assertion header and binds its subject to the
+// controller of the keystore. It returns a copy of the request with the Hub-Kms-User header set to the verified
+// subject, so share providers never see a user chosen by the caller. The request is returned unchanged if
+// the validator is not configured.
+func (s *service) verifyUser(req *http.Request, kd *KeystoreData) (*http.Request, error) {
+	v := s.config.UserAssertionValidator
+	if v == nil {
+		return req, nil
+	}
+
+	assertion := req.Header.Get(userAssertionHeader)
+	if assertion == "" {
+		return nil, fmt.Errorf("%w: missing %s header", ErrInvalidUserAssertion, userAssertionHeader)
+	}
+
+	claims, err := v.Validate(req.Context(), assertion)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidUserAssertion, err)
+	}
+
+	if claims.Subject == "" || claims.Subject != kd.Controller {
+		return nil, fmt.Errorf("%w: subject is not the controller of the keystore", ErrInvalidUserAssertion)
+	}
+
+	if user := req.Header.Get(userHeader); user != "" && user != claims.Subject {
+		return nil, fmt.Errorf("%w: %s header does not match the subject", ErrInvalidUserAssertion, userHeader)
+	}
+
+	r := req.Clone(req.Context())
+	r.Header.Set(userHeader, claims.Subject)
+
+	return r, nil
+}
@@ -0,0 +1,179 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package kms_test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	mockstorage "github.com/hyperledger/aries-framework-go/pkg/mock/storage"
+	"github.com/hyperledger/aries-framework-go/pkg/secretlock"
+	"github.com/stretchr/testify/require"
+	"github.com/trustbloc/edge-core/pkg/sss/base"
+
+	"github.com/trustbloc/hub-kms/pkg/auth/oauth2"
+	"github.com/trustbloc/hub-kms/pkg/kms"
+	lock "github.com/trustbloc/hub-kms/pkg/secretlock"
+	"github.com/trustbloc/hub-kms/pkg/secretlock/secretsplitlock"
+)
+
+const testUserAssertion = "assertion"
+
+func TestResolveKeystoreWithUserAssertion(t *testing.T) {
+	secrets, err := (&base.Splitter{}).Split([]byte("secret"), 2, 2)
+	require.NoError(t, err)
+
+	newService := func(t *testing.T, v kms.UserAssertionValidator, p secretsplitlock.ShareProvider) kms.Service {
+		t.Helper()
+
+		data := testKeystoreData()
+		data.SecretShares = &kms.SecretShares{
+			Threshold: 2,
+			Providers: []string{kms.ShareProviderHeader, testShareProvider},
+		}
+
+		b, err := json.Marshal(data)
+		require.NoError(t, err)
+
+		sp := mockstorage.NewMockStoreProvider()
+		sp.Store.Store[testKeystoreID] = b
+
+		svc, err := kms.NewService(&kms.Config{
+			StorageProvider:           sp,
+			KeyManagerStorageProvider: mockstorage.NewMockStoreProvider(),
+			PrimaryKeyStorageProvider: mockstorage.NewMockStoreProvider(),
+			CreateSecretLockFunc: func(keyURI string, p lock.Provider) (secretlock.Service, error) {
+				return p.SecretLock(), nil
+			},
+			ShareProviders:         map[string]secretsplitlock.ShareProvider{testShareProvider: p},
+			UserAssertionValidator: v,
+		})
+		require.NoError(t, err)
+
+		return svc
+	}
+
+	newRequest := func(headers map[string]string) *http.Request {
+		req := mux.SetURLVars(httptest.NewRequest(http.MethodPost, "/", nil), map[string]string{
+			"keystoreID": testKeystoreID,
+		})
+
+		req.Header.Set("Hub-Kms-Secret", base64.StdEncoding.EncodeToString(secrets[0]))
+
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+
+		return req
+	}
+
+	t.Run("Share provider gets verified subject", func(t *testing.T) {
+		p := &userShareProvider{share: secrets[1]}
+		svc := newService(t, &mockUserAssertionValidator{subject: testController}, p)
+
+		_, err := svc.ResolveKeystore(newRequest(map[string]string{"Hub-Kms-User-Assertion": testUserAssertion}))
+		require.NoError(t, err)
+		require.Equal(t, testController, p.user)
+	})
+
+	t.Run("Hub-Kms-User header is trusted without validator", func(t *testing.T) {
+		p := &userShareProvider{share: secrets[1]}
+		svc := newService(t, nil, p)
+
+		_, err := svc.ResolveKeystore(newRequest(map[string]string{"Hub-Kms-User": "user"}))
+		require.NoError(t, err)
+		require.Equal(t, "user", p.user)
+	})
+
+	tests := []struct {
+		name      string
+		validator *mockUserAssertionValidator
+		headers   map[string]string
+		errMsg    string
+	}{
+		{
+			name:      "missing assertion",
+			validator: &mockUserAssertionValidator{subject: testController},
+			headers:   map[string]string{"Hub-Kms-User": testController},
+			errMsg:    "missing Hub-Kms-User-Assertion header",
+		},
+		{
+			name:      "invalid assertion",
+			validator: &mockUserAssertionValidator{err: errors.New("failed to verify token signature")},
+			headers:   map[string]string{"Hub-Kms-User-Assertion": testUserAssertion},
+			errMsg:    "failed to verify token signature",
+		},
+		{
+			name:      "subject is not controller",
+			validator: &mockUserAssertionValidator{subject: "other"},
+			headers:   map[string]string{"Hub-Kms-User-Assertion": testUserAssertion},
+			errMsg:    "subject is not the controller of the keystore",
+		},
+		{
+			name:      "Hub-Kms-User does not match subject",
+			validator: &mockUserAssertionValidator{subject: testController},
+			headers: map[string]string{
+				"Hub-Kms-User-Assertion": testUserAssertion,
+				"Hub-Kms-User":           "other",
+			},
+			errMsg: "Hub-Kms-User header does not match the subject",
+		},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+
+		t.Run("Fail with "+tc.name, func(t *testing.T) {
+			p := &userShareProvider{share: secrets[1]}
+			svc := newService(t, tc.validator, p)
+
+			_, err := svc.ResolveKeystore(newRequest(tc.headers))
+			require.True(t, errors.Is(err, kms.ErrInvalidUserAssertion))
+			require.Contains(t, err.Error(), tc.errMsg)
+			require.False(t, p.called, "share must not be fetched")
+
+			_, err = svc.UnlockKeystore(newRequest(tc.headers))
+			require.True(t, errors.Is(err, kms.ErrInvalidUserAssertion))
+		})
+	}
+}
+
+type mockUserAssertionValidator struct {
+	subject string
+	err     error
+}
+
+func (v *mockUserAssertionValidator) Validate(_ context.Context, token string) (*oauth2.Claims, error) {
+	if v.err != nil {
+		return nil, v.err
+	}
+
+	if token != testUserAssertion {
+		return nil, errors.New("unexpected token")
+	}
+
+	return &oauth2.Claims{Subject: v.subject}, nil
+}
+
+type userShareProvider struct {
+	share  []byte
+	user   string
+	called bool
+}
+
+func (p *userShareProvider) Share(req *http.Request, _ string) ([]byte, error) {
+	p.called = true
+	p.user = req.Header.Get("Hub-Kms-User")
+
+	return p.share, nil
+}
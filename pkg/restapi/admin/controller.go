@@ -0,0 +1,30 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package admin
+
+import (
+	"github.com/trustbloc/hub-kms/pkg/restapi/admin/operation"
+)
+
+// Controller contains handlers for controller.
+type Controller struct {
+	handlers []operation.Handler
+}
+
+// New returns new controller instance.
+func New(config *operation.Config) *Controller {
+	op := operation.New(config)
+
+	return &Controller{
+		handlers: op.GetRESTHandlers(),
+	}
+}
+
+// GetOperations returns all controller endpoints.
+func (c *Controller) GetOperations() []operation.Handler {
+	return c.handlers
+}
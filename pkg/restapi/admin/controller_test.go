@@ -0,0 +1,35 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package admin_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/trustbloc/edge-core/pkg/log/mocklogger"
+
+	"github.com/trustbloc/hub-kms/pkg/restapi/admin"
+	"github.com/trustbloc/hub-kms/pkg/restapi/admin/operation"
+	"github.com/trustbloc/hub-kms/pkg/secretlock/secretsplitlock"
+)
+
+func TestNew(t *testing.T) {
+	controller := admin.New(&operation.Config{Logger: &mocklogger.MockLogger{}})
+	require.NotNil(t, controller)
+}
+
+func TestGetOperations(t *testing.T) {
+	controller := admin.New(&operation.Config{
+		ShareProvider: secretsplitlock.NewFileShareProvider(""),
+		Logger:        &mocklogger.MockLogger{},
+	})
+	require.NotNil(t, controller)
+
+	ops := controller.GetOperations()
+
+	require.Equal(t, 2, len(ops), "secret shares are served and stored")
+}
@@ -0,0 +1,26 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package operation
+
+type errorResp struct {
+	Message string `json:"errMessage,omitempty"`
+}
+
+// secretShareResp is the response with the secret share of the keystore, the same as of Hub Auth.
+type secretShareResp struct {
+	Secret string `json:"secret"`
+}
+
+// secretShareReq is the request to store the secret share of the keystore.
+type secretShareReq struct {
+	Secret string `json:"secret"`
+}
+
+// migrateKeysetsReq is the request to migrate keysets to an additional key manager storage or EDV.
+type migrateKeysetsReq struct {
+	TargetStorageType string `json:"targetStorageType"`
+}
@@ -0,0 +1,253 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package operation
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/trustbloc/edge-core/pkg/log"
+
+	"github.com/trustbloc/hub-kms/pkg/internal/support"
+	"github.com/trustbloc/hub-kms/pkg/kms"
+	lock "github.com/trustbloc/hub-kms/pkg/secretlock"
+	"github.com/trustbloc/hub-kms/pkg/secretlock/secretsplitlock"
+)
+
+const (
+	// AdminBasePath is the base path for all admin endpoints.
+	AdminBasePath = "/admin"
+
+	rotatePrimaryKeyEndpoint = AdminBasePath + "/primarykey/rotate"
+	migrateKeysetsEndpoint   = AdminBasePath + "/keymanager/migrate"
+	shareEndpoint            = AdminBasePath + "/shares/{" + keystoreIDQueryParam + "}"
+
+	keystoreIDQueryParam = "keystoreID"
+
+	bearerScheme = "Bearer "
+)
+
+// Handler http handler for each controller API endpoint.
+type Handler interface {
+	Path() string
+	Method() string
+	Handle() http.HandlerFunc
+}
+
+type primaryKeyRotator interface {
+	Rotate() (*lock.RotationResult, error)
+}
+
+type storageMigrator interface {
+	Migrate(ctx context.Context, targetStorageType string) (*kms.MigrationResult, error)
+}
+
+// Config defines configuration for admin operations. Endpoints are enabled only for configured dependencies.
+type Config struct {
+	Rotator       primaryKeyRotator
+	Migrator      storageMigrator
+	ShareProvider secretsplitlock.ShareProvider // secret shares held by this server for other hub-kms instances
+	APIToken      string                        // static token that protects admin endpoints
+	Logger        log.Logger
+}
+
+// Operation defines handlers for admin operations.
+type Operation struct {
+	rotator       primaryKeyRotator
+	migrator      storageMigrator
+	shareProvider secretsplitlock.ShareProvider
+	apiToken      string
+	logger        log.Logger
+}
+
+// New returns a new Operation instance.
+func New(config *Config) *Operation {
+	return &Operation{
+		rotator:       config.Rotator,
+		migrator:      config.Migrator,
+		shareProvider: config.ShareProvider,
+		apiToken:      config.APIToken,
+		logger:        config.Logger,
+	}
+}
+
+// GetRESTHandlers gets controller API handlers available for admin service.
+func (o *Operation) GetRESTHandlers() []Handler {
+	var handlers []Handler
+
+	if o.rotator != nil {
+		handlers = append(handlers, support.NewHTTPHandler(rotatePrimaryKeyEndpoint, rotatePrimaryKeyEndpoint,
+			http.MethodPost, o.authorized(o.rotatePrimaryKeyHandler)))
+	}
+
+	if o.migrator != nil {
+		handlers = append(handlers, support.NewHTTPHandler(migrateKeysetsEndpoint, migrateKeysetsEndpoint,
+			http.MethodPost, o.authorized(o.migrateKeysetsHandler)))
+	}
+
+	if o.shareProvider != nil {
+		handlers = append(handlers, support.NewHTTPHandler(shareEndpoint, shareEndpoint, http.MethodGet,
+			o.authorized(o.shareHandler)))
+	}
+
+	if _, ok := o.shareProvider.(secretsplitlock.ShareUpdater); ok {
+		handlers = append(handlers, support.NewHTTPHandler(shareEndpoint, shareEndpoint, http.MethodPut,
+			o.authorized(o.updateShareHandler)))
+	}
+
+	return handlers
+}
+
+// rotatePrimaryKeyHandler generates a new primary key and re-encrypts keysets of all keystores under it.
+// Calling it again after a failure resumes the interrupted rotation.
+func (o *Operation) rotatePrimaryKeyHandler(rw http.ResponseWriter, _ *http.Request) {
+	result, err := o.rotator.Rotate()
+	if err != nil {
+		o.writeErrorResponse(rw, http.StatusInternalServerError, "Failed to rotate primary key: %s", err)
+
+		return
+	}
+
+	o.logger.Infof("primary key rotated: %d keysets re-encrypted, %d skipped, %d foreign", result.Reencrypted,
+		result.Skipped, result.Foreign)
+
+	rw.Header().Set("Content-Type", "application/json")
+
+	if err = json.NewEncoder(rw).Encode(result); err != nil {
+		o.logger.Errorf("Unable to send a response: %s", err)
+	}
+}
+
+// migrateKeysetsHandler copies keysets to the additional key manager storage or EDV and switches keystores to it.
+// Calling it again resumes an interrupted migration and completes the migration of switched keystores. Keystore
+// metadata, primary keys and zcaps are not migrated, see kms.StorageMigrator.
+func (o *Operation) migrateKeysetsHandler(rw http.ResponseWriter, req *http.Request) {
+	var request migrateKeysetsReq
+
+	if err := json.NewDecoder(req.Body).Decode(&request); err != nil {
+		o.writeErrorResponse(rw, http.StatusBadRequest, "Received bad request: %s", err)
+
+		return
+	}
+
+	if request.TargetStorageType == "" {
+		o.writeErrorResponse(rw, http.StatusBadRequest, "Received bad request: %s",
+			errors.New("target storage type is required"))
+
+		return
+	}
+
+	result, err := o.migrator.Migrate(req.Context(), request.TargetStorageType)
+	if errors.Is(err, kms.ErrMigrationNotSupported) {
+		o.writeErrorResponse(rw, http.StatusBadRequest, "Failed to migrate keysets: %s", err)
+
+		return
+	}
+
+	if err != nil {
+		o.writeErrorResponse(rw, http.StatusInternalServerError, "Failed to migrate keysets: %s", err)
+
+		return
+	}
+
+	o.logger.Infof("keysets migrated to %s: %d keystores switched, %d completed, %d pending",
+		request.TargetStorageType, result.Switched, result.Completed, result.Pending)
+
+	rw.Header().Set("Content-Type", "application/json")
+
+	if err = json.NewEncoder(rw).Encode(result); err != nil {
+		o.logger.Errorf("Unable to send a response: %s", err)
+	}
+}
+
+// shareHandler returns the secret share of the keystore held by this server.
+func (o *Operation) shareHandler(rw http.ResponseWriter, req *http.Request) {
+	keystoreID := mux.Vars(req)[keystoreIDQueryParam]
+
+	share, err := o.shareProvider.Share(req, keystoreID)
+	if err != nil {
+		o.writeErrorResponse(rw, http.StatusNotFound, "Failed to get secret share: %s", err)
+
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+
+	if err = json.NewEncoder(rw).Encode(secretShareResp{
+		Secret: base64.StdEncoding.EncodeToString(share),
+	}); err != nil {
+		o.logger.Errorf("Unable to send a response: %s", err)
+	}
+}
+
+// updateShareHandler stores the secret share of the keystore set by another hub-kms instance when the keystore is
+// created.
+func (o *Operation) updateShareHandler(rw http.ResponseWriter, req *http.Request) {
+	var request secretShareReq
+
+	if err := json.NewDecoder(req.Body).Decode(&request); err != nil {
+		o.writeErrorResponse(rw, http.StatusBadRequest, "Received bad request: %s", err)
+
+		return
+	}
+
+	share, err := base64.StdEncoding.DecodeString(request.Secret)
+	if err != nil || len(share) == 0 {
+		o.writeErrorResponse(rw, http.StatusBadRequest, "Received bad request: %s",
+			errors.New("invalid secret share"))
+
+		return
+	}
+
+	updater := o.shareProvider.(secretsplitlock.ShareUpdater) //nolint:errcheck // checked when the handler is added
+
+	if err = updater.UpdateShare(req, mux.Vars(req)[keystoreIDQueryParam], share); err != nil {
+		o.writeErrorResponse(rw, http.StatusInternalServerError, "Failed to store secret share: %s", err)
+
+		return
+	}
+
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+// authorized requires the admin API token in the Authorization header.
+func (o *Operation) authorized(h http.HandlerFunc) http.HandlerFunc {
+	return func(rw http.ResponseWriter, req *http.Request) {
+		auth := req.Header.Get("Authorization")
+
+		if o.apiToken == "" || !strings.HasPrefix(auth, bearerScheme) ||
+			subtle.ConstantTimeCompare([]byte(auth[len(bearerScheme):]), []byte(o.apiToken)) != 1 {
+			o.writeErrorResponse(rw, http.StatusUnauthorized, "Unauthorized admin request: %s",
+				fmt.Errorf("missing or invalid API token"))
+
+			return
+		}
+
+		h(rw, req)
+	}
+}
+
+func (o *Operation) writeErrorResponse(rw http.ResponseWriter, status int, messageFormat string, err error) {
+	o.logger.Errorf(messageFormat, err)
+
+	rw.WriteHeader(status)
+
+	e := json.NewEncoder(rw).Encode(errorResp{
+		Message: fmt.Sprintf(messageFormat, err),
+	})
+
+	if e != nil {
+		o.logger.Errorf("Unable to send an error message: %s", e)
+	}
+}
@@ -0,0 +1,371 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package operation_test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+	"github.com/trustbloc/edge-core/pkg/log/mocklogger"
+
+	"github.com/trustbloc/hub-kms/pkg/kms"
+	"github.com/trustbloc/hub-kms/pkg/restapi/admin/operation"
+	lock "github.com/trustbloc/hub-kms/pkg/secretlock"
+	"github.com/trustbloc/hub-kms/pkg/storage/migration"
+)
+
+const testAPIToken = "token"
+
+func TestGetRESTHandlers(t *testing.T) {
+	t.Run("No endpoints are enabled by default", func(t *testing.T) {
+		op := operation.New(&operation.Config{})
+		require.Empty(t, op.GetRESTHandlers())
+	})
+
+	t.Run("Endpoints of configured dependencies are enabled", func(t *testing.T) {
+		op := operation.New(&operation.Config{
+			Rotator:       &mockRotator{},
+			Migrator:      &mockMigrator{},
+			ShareProvider: &mockShareProvider{},
+		})
+		require.Equal(t, 3, len(op.GetRESTHandlers()))
+	})
+
+	t.Run("Share endpoint accepts shares if provider stores them", func(t *testing.T) {
+		op := operation.New(&operation.Config{
+			ShareProvider: &mockShareUpdater{},
+		})
+
+		handlers := op.GetRESTHandlers()
+		require.Equal(t, 2, len(handlers))
+		require.Equal(t, http.MethodPut, handlers[1].Method())
+	})
+}
+
+func TestRotatePrimaryKeyHandler(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		rotator := &mockRotator{result: &lock.RotationResult{Reencrypted: 2, Skipped: 1}}
+
+		rr := serveRotatePrimaryKey(t, rotator, testAPIToken, "Bearer "+testAPIToken)
+
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		var result lock.RotationResult
+
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &result))
+		require.Equal(t, *rotator.result, result)
+	})
+
+	t.Run("Unauthorized without API token", func(t *testing.T) {
+		rr := serveRotatePrimaryKey(t, &mockRotator{}, testAPIToken, "")
+
+		require.Equal(t, http.StatusUnauthorized, rr.Code)
+	})
+
+	t.Run("Unauthorized with invalid API token", func(t *testing.T) {
+		rr := serveRotatePrimaryKey(t, &mockRotator{}, testAPIToken, "Bearer invalid")
+
+		require.Equal(t, http.StatusUnauthorized, rr.Code)
+	})
+
+	t.Run("Unauthorized if API token is not configured", func(t *testing.T) {
+		rr := serveRotatePrimaryKey(t, &mockRotator{}, "", "Bearer ")
+
+		require.Equal(t, http.StatusUnauthorized, rr.Code)
+	})
+
+	t.Run("Failed to rotate primary key", func(t *testing.T) {
+		rr := serveRotatePrimaryKey(t, &mockRotator{err: errors.New("rotate error")}, testAPIToken,
+			"Bearer "+testAPIToken)
+
+		require.Equal(t, http.StatusInternalServerError, rr.Code)
+		require.Contains(t, rr.Body.String(), "Failed to rotate primary key: rotate error")
+	})
+}
+
+func TestMigrateKeysetsHandler(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		migrator := &mockMigrator{result: &kms.MigrationResult{
+			Copied:    &migration.Result{Store: "kmsdb", Copied: 2, Checksum: "checksum"},
+			Synced:    &migration.Result{Store: "kmsdb", Skipped: 2, Checksum: "checksum"},
+			Switched:  1,
+			Completed: 1,
+		}}
+
+		rr := serveMigrateKeysets(t, migrator, `{"targetStorageType":"mysql"}`, "Bearer "+testAPIToken)
+
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, "mysql", migrator.targetStorageType)
+
+		var result kms.MigrationResult
+
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &result))
+		require.Equal(t, *migrator.result, result)
+	})
+
+	t.Run("Unauthorized with invalid API token", func(t *testing.T) {
+		rr := serveMigrateKeysets(t, &mockMigrator{}, `{"targetStorageType":"mysql"}`, "Bearer invalid")
+
+		require.Equal(t, http.StatusUnauthorized, rr.Code)
+	})
+
+	t.Run("Received bad request", func(t *testing.T) {
+		rr := serveMigrateKeysets(t, &mockMigrator{}, "not a request", "Bearer "+testAPIToken)
+
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Contains(t, rr.Body.String(), "Received bad request")
+	})
+
+	t.Run("Missing target storage type", func(t *testing.T) {
+		rr := serveMigrateKeysets(t, &mockMigrator{}, "{}", "Bearer "+testAPIToken)
+
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Contains(t, rr.Body.String(), "target storage type is required")
+	})
+
+	t.Run("Migration not supported", func(t *testing.T) {
+		rr := serveMigrateKeysets(t, &mockMigrator{err: fmt.Errorf("%w: storage type edv",
+			kms.ErrMigrationNotSupported)}, `{"targetStorageType":"edv"}`, "Bearer "+testAPIToken)
+
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Contains(t, rr.Body.String(), "Failed to migrate keysets")
+	})
+
+	t.Run("Failed to migrate keysets", func(t *testing.T) {
+		rr := serveMigrateKeysets(t, &mockMigrator{err: errors.New("migrate error")},
+			`{"targetStorageType":"mysql"}`, "Bearer "+testAPIToken)
+
+		require.Equal(t, http.StatusInternalServerError, rr.Code)
+		require.Contains(t, rr.Body.String(), "Failed to migrate keysets: migrate error")
+	})
+}
+
+func TestShareHandler(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		provider := &mockShareProvider{share: []byte("share")}
+
+		rr := serveShare(t, provider, "Bearer "+testAPIToken)
+
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, "keystoreID", provider.keystoreID)
+
+		var resp struct {
+			Secret string `json:"secret"`
+		}
+
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+		require.Equal(t, base64.StdEncoding.EncodeToString([]byte("share")), resp.Secret)
+	})
+
+	t.Run("Unauthorized with invalid API token", func(t *testing.T) {
+		rr := serveShare(t, &mockShareProvider{share: []byte("share")}, "Bearer invalid")
+
+		require.Equal(t, http.StatusUnauthorized, rr.Code)
+	})
+
+	t.Run("Share not found", func(t *testing.T) {
+		rr := serveShare(t, &mockShareProvider{err: errors.New("no share")}, "Bearer "+testAPIToken)
+
+		require.Equal(t, http.StatusNotFound, rr.Code)
+		require.Contains(t, rr.Body.String(), "Failed to get secret share: no share")
+	})
+}
+
+func TestUpdateShareHandler(t *testing.T) {
+	share := base64.StdEncoding.EncodeToString([]byte("share"))
+
+	t.Run("Success", func(t *testing.T) {
+		provider := &mockShareUpdater{}
+
+		rr := serveUpdateShare(t, provider, `{"secret":"`+share+`"}`, "Bearer "+testAPIToken)
+
+		require.Equal(t, http.StatusNoContent, rr.Code)
+		require.Equal(t, "keystoreID", provider.keystoreID)
+		require.Equal(t, []byte("share"), provider.share)
+	})
+
+	t.Run("Unauthorized with invalid API token", func(t *testing.T) {
+		provider := &mockShareUpdater{}
+
+		rr := serveUpdateShare(t, provider, `{"secret":"`+share+`"}`, "Bearer invalid")
+
+		require.Equal(t, http.StatusUnauthorized, rr.Code)
+		require.Nil(t, provider.share)
+	})
+
+	t.Run("Received bad request", func(t *testing.T) {
+		rr := serveUpdateShare(t, &mockShareUpdater{}, "{", "Bearer "+testAPIToken)
+
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("Invalid secret share", func(t *testing.T) {
+		rr := serveUpdateShare(t, &mockShareUpdater{}, `{"secret":"!invalid"}`, "Bearer "+testAPIToken)
+
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Contains(t, rr.Body.String(), "invalid secret share")
+	})
+
+	t.Run("Failed to store secret share", func(t *testing.T) {
+		provider := &mockShareUpdater{updateErr: errors.New("update error")}
+
+		rr := serveUpdateShare(t, provider, `{"secret":"`+share+`"}`, "Bearer "+testAPIToken)
+
+		require.Equal(t, http.StatusInternalServerError, rr.Code)
+		require.Contains(t, rr.Body.String(), "Failed to store secret share: update error")
+	})
+}
+
+func serveUpdateShare(t *testing.T, provider *mockShareUpdater, body, auth string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	op := operation.New(&operation.Config{
+		ShareProvider: provider,
+		APIToken:      testAPIToken,
+		Logger:        &mocklogger.MockLogger{},
+	})
+
+	handler := op.GetRESTHandlers()[1]
+	require.Equal(t, http.MethodPut, handler.Method())
+
+	router := mux.NewRouter()
+	router.HandleFunc(handler.Path(), handler.Handle()).Methods(handler.Method())
+
+	req := httptest.NewRequest(handler.Method(), "/admin/shares/keystoreID", strings.NewReader(body))
+	req.Header.Set("Authorization", auth)
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	return rr
+}
+
+func serveShare(t *testing.T, provider *mockShareProvider, auth string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	op := operation.New(&operation.Config{
+		ShareProvider: provider,
+		APIToken:      testAPIToken,
+		Logger:        &mocklogger.MockLogger{},
+	})
+
+	handler := op.GetRESTHandlers()[0]
+	require.Equal(t, http.MethodGet, handler.Method())
+
+	router := mux.NewRouter()
+	router.HandleFunc(handler.Path(), handler.Handle()).Methods(handler.Method())
+
+	req := httptest.NewRequest(handler.Method(), "/admin/shares/keystoreID", nil)
+	req.Header.Set("Authorization", auth)
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	return rr
+}
+
+func serveRotatePrimaryKey(t *testing.T, rotator *mockRotator, apiToken, auth string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	op := operation.New(&operation.Config{
+		Rotator:  rotator,
+		APIToken: apiToken,
+		Logger:   &mocklogger.MockLogger{},
+	})
+
+	handler := op.GetRESTHandlers()[0]
+	require.Equal(t, http.MethodPost, handler.Method())
+
+	req := httptest.NewRequest(handler.Method(), handler.Path(), nil)
+	if auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+
+	rr := httptest.NewRecorder()
+	handler.Handle().ServeHTTP(rr, req)
+
+	return rr
+}
+
+func serveMigrateKeysets(t *testing.T, migrator *mockMigrator, body, auth string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	op := operation.New(&operation.Config{
+		Migrator: migrator,
+		APIToken: testAPIToken,
+		Logger:   &mocklogger.MockLogger{},
+	})
+
+	handler := op.GetRESTHandlers()[0]
+	require.Equal(t, http.MethodPost, handler.Method())
+
+	req := httptest.NewRequest(handler.Method(), handler.Path(), strings.NewReader(body))
+	req.Header.Set("Authorization", auth)
+
+	rr := httptest.NewRecorder()
+	handler.Handle().ServeHTTP(rr, req)
+
+	return rr
+}
+
+type mockRotator struct {
+	result *lock.RotationResult
+	err    error
+}
+
+func (m *mockRotator) Rotate() (*lock.RotationResult, error) {
+	return m.result, m.err
+}
+
+type mockShareProvider struct {
+	share      []byte
+	err        error
+	keystoreID string
+}
+
+func (m *mockShareProvider) Share(_ *http.Request, keystoreID string) ([]byte, error) {
+	m.keystoreID = keystoreID
+
+	return m.share, m.err
+}
+
+type mockShareUpdater struct {
+	mockShareProvider
+	updateErr error
+}
+
+func (m *mockShareUpdater) UpdateShare(_ *http.Request, keystoreID string, share []byte) error {
+	if m.updateErr != nil {
+		return m.updateErr
+	}
+
+	m.keystoreID = keystoreID
+	m.share = share
+
+	return nil
+}
+
+type mockMigrator struct {
+	result            *kms.MigrationResult
+	err               error
+	targetStorageType string
+}
+
+func (m *mockMigrator) Migrate(_ context.Context, targetStorageType string) (*kms.MigrationResult, error) {
+	m.targetStorageType = targetStorageType
+
+	return m.result, m.err
+}
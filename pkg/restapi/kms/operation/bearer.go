@@ -0,0 +1,96 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package operation
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/trustbloc/edge-core/pkg/log"
+	"go.opentelemetry.io/otel/label"
+
+	"github.com/trustbloc/hub-kms/pkg/auth/oauth2"
+)
+
+const bearerScheme = "Bearer "
+
+// TokenValidator validates bearer tokens and returns their claims.
+type TokenValidator interface {
+	Validate(ctx context.Context, token string) (*oauth2.Claims, error)
+}
+
+type subjectContextKey struct{}
+
+// BearerTokenMiddleware returns the middleware that authenticates keystore creation requests with OAuth2 bearer
+// tokens (JWTs). Requests to other endpoints are passed through unchanged. The middleware is a no-op if no token
+// validator is configured.
+func (o *Operation) BearerTokenMiddleware(h http.Handler) http.Handler {
+	if o.tokenValidator == nil {
+		return h
+	}
+
+	return &bearerHandler{
+		next:      h,
+		validator: o.tokenValidator,
+		logger:    o.logger,
+		routeFunc: (&muxNamer{}).GetName,
+	}
+}
+
+type bearerHandler struct {
+	next      http.Handler
+	validator TokenValidator
+	logger    log.Logger
+	routeFunc func(*http.Request) namer
+}
+
+func (h *bearerHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.routeFunc(r).GetName() != keystoresEndpoint {
+		h.next.ServeHTTP(w, r)
+
+		return
+	}
+
+	ctx, span := tracer.Start(r.Context(), "BearerTokenMiddleware")
+	defer span.End()
+
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, bearerScheme) {
+		h.unauthorized(w, "missing bearer token")
+
+		return
+	}
+
+	claims, err := h.validator.Validate(ctx, strings.TrimSpace(auth[len(bearerScheme):]))
+	if err != nil {
+		h.unauthorized(w, err.Error())
+
+		return
+	}
+
+	span.SetAttributes(label.String("subject", claims.Subject))
+
+	h.next.ServeHTTP(w, r.WithContext(context.WithValue(ctx, subjectContextKey{}, claims.Subject)))
+}
+
+func (h *bearerHandler) unauthorized(w http.ResponseWriter, reason string) {
+	h.logger.Errorf("unauthorized keystore creation request: %s", reason)
+
+	w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+	http.Error(w, "unauthorized", http.StatusUnauthorized)
+}
+
+// subjectFromContext returns the subject of the validated bearer token.
+func subjectFromContext(ctx context.Context) string {
+	s, ok := ctx.Value(subjectContextKey{}).(string)
+	if !ok {
+		return ""
+	}
+
+	return s
+}
@@ -0,0 +1,140 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package operation_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/hub-kms/pkg/auth/oauth2"
+	mockkms "github.com/trustbloc/hub-kms/pkg/internal/mock/kms"
+	"github.com/trustbloc/hub-kms/pkg/kms"
+	"github.com/trustbloc/hub-kms/pkg/restapi/kms/operation"
+)
+
+func TestBearerTokenMiddleware(t *testing.T) {
+	t.Run("no-op if token validator is not configured", func(t *testing.T) {
+		rr := serveWithBearerMiddleware(t, newConfig(), createKeystoreReq(t, "", ""))
+
+		require.Equal(t, http.StatusCreated, rr.Code)
+	})
+
+	t.Run("unauthorized if bearer token is missing", func(t *testing.T) {
+		config := newConfig()
+		config.TokenValidator = &mockTokenValidator{}
+
+		rr := serveWithBearerMiddleware(t, config, createKeystoreReq(t, "", ""))
+
+		require.Equal(t, http.StatusUnauthorized, rr.Code)
+		require.Contains(t, rr.Header().Get("WWW-Authenticate"), "Bearer")
+	})
+
+	t.Run("unauthorized if bearer token is invalid", func(t *testing.T) {
+		config := newConfig()
+		config.TokenValidator = &mockTokenValidator{err: errors.New("invalid token")}
+
+		rr := serveWithBearerMiddleware(t, config, createKeystoreReq(t, "", "token"))
+
+		require.Equal(t, http.StatusUnauthorized, rr.Code)
+	})
+
+	t.Run("token subject is the default controller", func(t *testing.T) {
+		svc := &controllerCapturingService{MockService: mockKMSService()}
+
+		config := newConfig(withKMSService(svc))
+		config.TokenValidator = &mockTokenValidator{claims: &oauth2.Claims{Subject: "did:example:subject"}}
+
+		rr := serveWithBearerMiddleware(t, config, createKeystoreReq(t, "", "token"))
+
+		require.Equal(t, http.StatusCreated, rr.Code)
+		require.Equal(t, "did:example:subject", svc.controller)
+	})
+
+	t.Run("controller in request takes precedence over token subject", func(t *testing.T) {
+		svc := &controllerCapturingService{MockService: mockKMSService()}
+
+		config := newConfig(withKMSService(svc))
+		config.TokenValidator = &mockTokenValidator{claims: &oauth2.Claims{Subject: "did:example:subject"}}
+
+		rr := serveWithBearerMiddleware(t, config, createKeystoreReq(t, testController, "token"))
+
+		require.Equal(t, http.StatusCreated, rr.Code)
+		require.Equal(t, testController, svc.controller)
+	})
+
+	t.Run("other endpoints are not protected with bearer tokens", func(t *testing.T) {
+		config := newConfig()
+		config.TokenValidator = &mockTokenValidator{err: errors.New("invalid token")}
+
+		rr := serveWithBearerMiddleware(t, config, buildCreateKeyReq(t))
+
+		require.NotEqual(t, http.StatusUnauthorized, rr.Code)
+	})
+}
+
+func serveWithBearerMiddleware(t *testing.T, config *operation.Config, req *http.Request) *httptest.ResponseRecorder {
+	t.Helper()
+
+	op := newOperation(t, config)
+
+	router := mux.NewRouter()
+	router.Use(op.BearerTokenMiddleware)
+
+	for _, h := range op.GetRESTHandlers() {
+		router.HandleFunc(h.Path(), h.Handle()).Methods(h.Method()).Name(h.Name())
+	}
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	return rr
+}
+
+func createKeystoreReq(t *testing.T, controller, token string) *http.Request {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, keystoresEndpoint,
+		bytes.NewBufferString(`{"controller": "`+controller+`"}`))
+
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	return req
+}
+
+type mockTokenValidator struct {
+	claims *oauth2.Claims
+	err    error
+}
+
+func (m *mockTokenValidator) Validate(context.Context, string) (*oauth2.Claims, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	return m.claims, nil
+}
+
+type controllerCapturingService struct {
+	*mockkms.MockService
+	controller string
+}
+
+func (s *controllerCapturingService) CreateKeystore(req *http.Request, controller, vaultID string,
+	options ...kms.CreateKeystoreOption) (*kms.KeystoreData, []byte, error) {
+	s.controller = controller
+
+	return s.MockService.CreateKeystore(req, controller, vaultID, options...)
+}
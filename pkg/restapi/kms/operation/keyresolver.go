@@ -0,0 +1,184 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package operation
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bluele/gcache"
+	"github.com/hyperledger/aries-framework-go/pkg/doc/did"
+	"github.com/hyperledger/aries-framework-go/pkg/doc/signature/verifier"
+	vdrapi "github.com/hyperledger/aries-framework-go/pkg/framework/aries/api/vdr"
+	arieskms "github.com/hyperledger/aries-framework-go/pkg/kms"
+	"github.com/hyperledger/aries-framework-go/pkg/storage"
+	"github.com/hyperledger/aries-framework-go/pkg/vdr"
+	"github.com/hyperledger/aries-framework-go/pkg/vdr/peer"
+	"github.com/hyperledger/aries-framework-go/pkg/vdr/web"
+
+	kmszcapld "github.com/trustbloc/hub-kms/pkg/auth/zcapld"
+)
+
+const (
+	didKeyPrefix = "did:key:"
+
+	defaultDIDCacheSize = 1000
+	defaultDIDCacheTTL  = 5 * time.Minute
+)
+
+// KeyResolver resolves verification keys of zcap invokers and delegators.
+type KeyResolver interface {
+	Resolve(keyID string) (*verifier.PublicKey, error)
+}
+
+// VDRKeyResolver resolves verification keys from DID documents resolved with the VDR registry.
+// did:key URLs are expanded locally with zcapld.DIDKeyResolver as the aries did:key VDR supports Ed25519 keys only.
+type VDRKeyResolver struct {
+	vdr        vdrapi.Registry
+	didKey     KeyResolver
+	httpClient *http.Client
+	cache      gcache.Cache
+}
+
+// KeyResolverOptions configures VDRKeyResolver.
+type KeyResolverOptions struct {
+	httpClient *http.Client
+	cacheTTL   time.Duration
+	cacheSize  int
+}
+
+// KeyResolverOption configures VDRKeyResolver.
+type KeyResolverOption func(options *KeyResolverOptions)
+
+// WithHTTPClient sets the HTTP client used for resolving did:web documents.
+func WithHTTPClient(c *http.Client) KeyResolverOption {
+	return func(o *KeyResolverOptions) {
+		o.httpClient = c
+	}
+}
+
+// WithDIDCacheTTL sets how long resolved DID documents are cached. Caching is disabled if ttl is zero.
+func WithDIDCacheTTL(ttl time.Duration) KeyResolverOption {
+	return func(o *KeyResolverOptions) {
+		o.cacheTTL = ttl
+	}
+}
+
+// WithDIDCacheSize sets the maximum number of cached DID documents.
+func WithDIDCacheSize(size int) KeyResolverOption {
+	return func(o *KeyResolverOptions) {
+		o.cacheSize = size
+	}
+}
+
+// NewVDRKeyResolver returns a new VDRKeyResolver instance.
+func NewVDRKeyResolver(registry vdrapi.Registry, opts ...KeyResolverOption) *VDRKeyResolver {
+	o := &KeyResolverOptions{
+		httpClient: &http.Client{},
+		cacheTTL:   defaultDIDCacheTTL,
+		cacheSize:  defaultDIDCacheSize,
+	}
+
+	for i := range opts {
+		opts[i](o)
+	}
+
+	r := &VDRKeyResolver{
+		vdr:        registry,
+		didKey:     &kmszcapld.DIDKeyResolver{},
+		httpClient: o.httpClient,
+	}
+
+	if o.cacheTTL > 0 {
+		r.cache = gcache.New(o.cacheSize).LRU().Expiration(o.cacheTTL).Build()
+	}
+
+	return r
+}
+
+// NewVDRRegistry returns a VDR registry that resolves did:peer and did:web DIDs.
+func NewVDRRegistry(keyManager arieskms.KeyManager, sp storage.Provider) (vdrapi.Registry, error) {
+	peerVDR, err := peer.New(sp)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create did:peer vdr: %w", err)
+	}
+
+	return vdr.New(&vdrProvider{keyManager: keyManager},
+		vdr.WithVDR(peerVDR),
+		vdr.WithVDR(&webVDR{VDR: web.New()}),
+	), nil
+}
+
+// Resolve resolves the public key referenced by keyID (a DID URL).
+func (r *VDRKeyResolver) Resolve(keyID string) (*verifier.PublicKey, error) {
+	if strings.HasPrefix(keyID, didKeyPrefix) {
+		return r.didKey.Resolve(keyID)
+	}
+
+	didID := strings.Split(keyID, "#")[0]
+
+	doc, err := r.resolveDID(didID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve DID %s: %w", didID, err)
+	}
+
+	for _, verifications := range doc.VerificationMethods() {
+		for i := range verifications {
+			vm := &verifications[i].VerificationMethod
+
+			if vm.ID == keyID || didID+vm.ID == keyID {
+				return &verifier.PublicKey{
+					Type:  vm.Type,
+					Value: vm.Value,
+					JWK:   vm.JSONWebKey(),
+				}, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("verification method %s not found in DID document", keyID)
+}
+
+func (r *VDRKeyResolver) resolveDID(didID string) (*did.Doc, error) {
+	if r.cache != nil {
+		if doc, err := r.cache.Get(didID); err == nil {
+			return doc.(*did.Doc), nil //nolint:errcheck // only *did.Doc values are cached
+		}
+	}
+
+	doc, err := r.vdr.Resolve(didID, vdrapi.WithHTTPClient(r.httpClient))
+	if err != nil {
+		return nil, err
+	}
+
+	if r.cache != nil {
+		if err = r.cache.Set(didID, doc); err != nil {
+			return nil, fmt.Errorf("failed to cache DID document: %w", err)
+		}
+	}
+
+	return doc, nil
+}
+
+type vdrProvider struct {
+	keyManager arieskms.KeyManager
+}
+
+func (p *vdrProvider) KMS() arieskms.KeyManager {
+	return p.keyManager
+}
+
+// webVDR adapts the did:web VDR to the vdrapi.VDR interface.
+type webVDR struct {
+	*web.VDR
+}
+
+func (v *webVDR) Store(doc *did.Doc, _ *[]vdrapi.ModifiedBy) error {
+	return v.VDR.Store(doc)
+}
@@ -0,0 +1,184 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package operation_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcutil/base58"
+	"github.com/hyperledger/aries-framework-go/pkg/doc/did"
+	vdrapi "github.com/hyperledger/aries-framework-go/pkg/framework/aries/api/vdr"
+	arieskms "github.com/hyperledger/aries-framework-go/pkg/kms"
+	mockkms "github.com/hyperledger/aries-framework-go/pkg/mock/kms"
+	"github.com/hyperledger/aries-framework-go/pkg/storage/mem"
+	"github.com/hyperledger/aries-framework-go/pkg/vdr/peer"
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/hub-kms/pkg/auth/zcapld"
+	"github.com/trustbloc/hub-kms/pkg/restapi/kms/operation"
+)
+
+const didWebDocFormat = `{
+  "@context": ["https://w3id.org/did/v1"],
+  "id": "%s",
+  "verificationMethod": [{
+    "id": "%s#key-1",
+    "type": "Ed25519VerificationKey2018",
+    "controller": "%s",
+    "publicKeyBase58": "%s"
+  }]
+}`
+
+func TestVDRKeyResolver_Resolve(t *testing.T) {
+	t.Run("resolves did:key", func(t *testing.T) {
+		pubKey, _, err := ed25519.GenerateKey(rand.Reader)
+		require.NoError(t, err)
+
+		resolver := operation.NewVDRKeyResolver(newVDRRegistry(t))
+
+		keyURL, err := zcapld.DIDKeyURL(pubKey, arieskms.ED25519Type)
+		require.NoError(t, err)
+
+		key, err := resolver.Resolve(keyURL)
+		require.NoError(t, err)
+		require.Equal(t, []byte(pubKey), key.Value)
+	})
+
+	t.Run("resolves did:peer", func(t *testing.T) {
+		pubKey, _, err := ed25519.GenerateKey(rand.Reader)
+		require.NoError(t, err)
+
+		registry := newVDRRegistry(t)
+
+		vm := did.NewVerificationMethodFromBytes("#key-1", "Ed25519VerificationKey2018", "", pubKey)
+
+		doc, err := peer.NewDoc([]did.VerificationMethod{*vm},
+			did.WithAuthentication([]did.Verification{*did.NewReferencedVerification(vm, did.Authentication)}))
+		require.NoError(t, err)
+		require.NoError(t, registry.Store(doc))
+
+		key, err := operation.NewVDRKeyResolver(registry).Resolve(doc.ID + "#key-1")
+		require.NoError(t, err)
+		require.Equal(t, "Ed25519VerificationKey2018", key.Type)
+		require.Equal(t, []byte(pubKey), key.Value)
+	})
+
+	t.Run("resolves did:web and caches DID document", func(t *testing.T) {
+		pubKey, _, err := ed25519.GenerateKey(rand.Reader)
+		require.NoError(t, err)
+
+		server, didID, hits := didWebServer(t, pubKey)
+		defer server.Close()
+
+		resolver := operation.NewVDRKeyResolver(newVDRRegistry(t), operation.WithHTTPClient(server.Client()))
+
+		for i := 0; i < 2; i++ {
+			key, err := resolver.Resolve(didID + "#key-1")
+			require.NoError(t, err)
+			require.Equal(t, []byte(pubKey), key.Value)
+		}
+
+		require.EqualValues(t, 1, atomic.LoadInt32(hits))
+	})
+
+	t.Run("resolves did:web every time if caching is disabled", func(t *testing.T) {
+		pubKey, _, err := ed25519.GenerateKey(rand.Reader)
+		require.NoError(t, err)
+
+		server, didID, hits := didWebServer(t, pubKey)
+		defer server.Close()
+
+		resolver := operation.NewVDRKeyResolver(newVDRRegistry(t),
+			operation.WithHTTPClient(server.Client()), operation.WithDIDCacheTTL(0))
+
+		for i := 0; i < 2; i++ {
+			_, err = resolver.Resolve(didID + "#key-1")
+			require.NoError(t, err)
+		}
+
+		require.EqualValues(t, 2, atomic.LoadInt32(hits))
+	})
+
+	t.Run("resolves did:web again after cache TTL expires", func(t *testing.T) {
+		pubKey, _, err := ed25519.GenerateKey(rand.Reader)
+		require.NoError(t, err)
+
+		server, didID, hits := didWebServer(t, pubKey)
+		defer server.Close()
+
+		resolver := operation.NewVDRKeyResolver(newVDRRegistry(t),
+			operation.WithHTTPClient(server.Client()), operation.WithDIDCacheTTL(time.Millisecond))
+
+		_, err = resolver.Resolve(didID + "#key-1")
+		require.NoError(t, err)
+
+		time.Sleep(5 * time.Millisecond)
+
+		_, err = resolver.Resolve(didID + "#key-1")
+		require.NoError(t, err)
+
+		require.EqualValues(t, 2, atomic.LoadInt32(hits))
+	})
+
+	t.Run("error if verification method is not found", func(t *testing.T) {
+		pubKey, _, err := ed25519.GenerateKey(rand.Reader)
+		require.NoError(t, err)
+
+		server, didID, _ := didWebServer(t, pubKey)
+		defer server.Close()
+
+		resolver := operation.NewVDRKeyResolver(newVDRRegistry(t), operation.WithHTTPClient(server.Client()))
+
+		_, err = resolver.Resolve(didID + "#key-2")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "not found in DID document")
+	})
+
+	t.Run("error if DID method is not supported", func(t *testing.T) {
+		_, err := operation.NewVDRKeyResolver(newVDRRegistry(t)).Resolve("did:example:123#key-1")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to resolve DID did:example:123")
+	})
+}
+
+func newVDRRegistry(t *testing.T) vdrapi.Registry {
+	t.Helper()
+
+	registry, err := operation.NewVDRRegistry(&mockkms.KeyManager{}, mem.NewProvider())
+	require.NoError(t, err)
+
+	return registry
+}
+
+func didWebServer(t *testing.T, pubKey ed25519.PublicKey) (*httptest.Server, string, *int32) {
+	t.Helper()
+
+	var (
+		hits  int32
+		didID string
+	)
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+
+		_, err := fmt.Fprintf(w, didWebDocFormat, didID, didID, didID, base58.Encode(pubKey))
+		require.NoError(t, err)
+	}))
+
+	didID = "did:web:" + url.QueryEscape(strings.TrimPrefix(server.URL, "https://"))
+
+	return server, didID, &hits
+}
@@ -10,11 +10,11 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/hyperledger/aries-framework-go/pkg/crypto"
-	"github.com/hyperledger/aries-framework-go/pkg/doc/signature/suite"
-	"github.com/hyperledger/aries-framework-go/pkg/doc/signature/suite/ed25519signature2018"
+	"github.com/hyperledger/aries-framework-go/pkg/doc/signature/verifier"
 	"github.com/hyperledger/aries-framework-go/pkg/doc/verifiable"
 	"github.com/hyperledger/aries-framework-go/pkg/kms"
 	"github.com/piprate/json-gold/ld"
@@ -22,6 +22,8 @@ import (
 	"github.com/trustbloc/edge-core/pkg/zcapld"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/label"
+
+	kmszcapld "github.com/trustbloc/hub-kms/pkg/auth/zcapld"
 )
 
 var tracer = otel.Tracer("hub-kms/operation") //nolint:gochecknoglobals // ignore
@@ -29,14 +31,18 @@ var tracer = otel.Tracer("hub-kms/operation") //nolint:gochecknoglobals // ignor
 // ZCAPLDMiddleware returns the ZCAPLD middleware that authorizes requests.
 func (o *Operation) ZCAPLDMiddleware(h http.Handler) http.Handler {
 	return &mwHandler{
-		next:         h,
-		zcaps:        o.authService,
-		keys:         o.authService.KMS(),
-		crpto:        o.authService.Crypto(),
-		logger:       o.logger,
-		routeFunc:    (&muxNamer{}).GetName,
-		baseURL:      o.baseURL,
-		cachedLDDocs: o.cachedLDDocs,
+		next:            h,
+		zcaps:           o.authService,
+		keys:            o.authService.KMS(),
+		crpto:           o.authService.Crypto(),
+		logger:          o.logger,
+		routeFunc:       (&muxNamer{}).GetName,
+		baseURL:         o.baseURL,
+		cachedLDDocs:    o.cachedLDDocs,
+		signatureSuites: o.signatureSuites,
+		keyResolver:     o.keyResolver,
+		maxClockSkew:    o.maxClockSkew,
+		replayCache:     o.replayCache,
 	}
 }
 
@@ -52,14 +58,18 @@ func (m *muxNamer) GetName(r *http.Request) namer {
 }
 
 type mwHandler struct {
-	next         http.Handler
-	zcaps        zcapld.CapabilityResolver
-	keys         kms.KeyManager
-	crpto        crypto.Crypto
-	logger       log.Logger
-	cachedLDDocs map[string]*ld.RemoteDocument
-	routeFunc    func(*http.Request) namer
-	baseURL      string
+	next            http.Handler
+	zcaps           zcapld.CapabilityResolver
+	keys            kms.KeyManager
+	crpto           crypto.Crypto
+	logger          log.Logger
+	cachedLDDocs    map[string]*ld.RemoteDocument
+	routeFunc       func(*http.Request) namer
+	baseURL         string
+	signatureSuites []verifier.SignatureSuite
+	keyResolver     KeyResolver
+	maxClockSkew    time.Duration
+	replayCache     *kmszcapld.ReplayCache
 }
 
 func (h *mwHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) { //nolint:funlen // TODO refactor
@@ -72,8 +82,9 @@ func (h *mwHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) { //nolint
 
 	h.logger.Debugf("handling request: %s", r.URL.String())
 
-	// this one is protected with OAuth2
-	if h.routeFunc(r).GetName() == keystoresEndpoint {
+	// keystoresEndpoint is protected with OAuth2 (see BearerTokenMiddleware); requests authorized with
+	// a client certificate do not need zcaps (see MTLSMiddleware)
+	if h.routeFunc(r).GetName() == keystoresEndpoint || authorizedByMTLS(ctx) {
 		h.next.ServeHTTP(w, r.WithContext(ctx))
 
 		span.AddEvent(fmt.Sprintf("handling request %q completed", r.URL.String()))
@@ -106,22 +117,20 @@ func (h *mwHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) { //nolint
 
 	span.AddEvent("populating cache for JSON-LD documents completed")
 
-	// TODO make KeyResolver configurable
-	// TODO make signature suites configurable
-	zcapld.NewHTTPSigAuthHandler(
-		&zcapld.HTTPSigAuthConfig{
+	kmszcapld.NewHTTPSigAuthHandler(
+		&kmszcapld.HTTPSigAuthConfig{
 			CapabilityResolver: h.zcaps,
-			KeyResolver:        &zcapld.DIDKeyResolver{},
+			KeyResolver:        h.keyResolver,
 			VerifierOptions: []zcapld.VerificationOption{
-				zcapld.WithSignatureSuites(
-					ed25519signature2018.New(suite.WithVerifier(ed25519signature2018.NewPublicKeyVerifier())),
-				),
+				zcapld.WithSignatureSuites(h.signatureSuites...),
 				zcapld.WithLDDocumentLoaders(cachingDL),
 			},
-			Secrets:     &zcapld.AriesDIDKeySecrets{},
-			ErrConsumer: h.logError,
-			KMS:         h.keys,
-			Crypto:      h.crpto,
+			Secrets:      &zcapld.AriesDIDKeySecrets{},
+			ErrConsumer:  h.logError,
+			KMS:          h.keys,
+			Crypto:       h.crpto,
+			MaxClockSkew: h.maxClockSkew,
+			ReplayCache:  h.replayCache,
 		},
 		expectations,
 		h.next.ServeHTTP,
@@ -171,6 +180,12 @@ func expectedAction(n namer) (string, error) { // nolint:gocyclo // necessary co
 		action = actionEasyOpen
 	case sealOpenEndpoint:
 		action = actionSealOpen
+	case unlockEndpoint:
+		action = actionUnlock
+	case lockEndpoint:
+		action = actionLock
+	case rotateSharesEndpoint:
+		action = actionRotateShares
 	default:
 		err = fmt.Errorf("unsupported endpoint: %s", n.GetName())
 	}
@@ -221,6 +236,12 @@ func CapabilityInvocationAction(r *http.Request) (string, error) { // nolint:goc
 		action = actionEasyOpen
 	case sealOpenPath:
 		action = actionSealOpen
+	case unlockPath:
+		action = actionUnlock
+	case lockPath:
+		action = actionLock
+	case rotateSharesPath:
+		action = actionRotateShares
 	default:
 		err = fmt.Errorf("unsupported endpoint: %s", r.URL.Path)
 	}
@@ -25,7 +25,7 @@ import (
 
 func TestMiddleware(t *testing.T) {
 	t.Run("returns middleware", func(t *testing.T) {
-		o := New(newConfig())
+		o := newOperation(t, newConfig())
 		require.NotEmpty(t, o.ZCAPLDMiddleware(nil))
 	})
 
@@ -33,7 +33,7 @@ func TestMiddleware(t *testing.T) {
 		t.Run("protects /keystore endpoint", func(t *testing.T) {
 			handler := &handler{}
 			result := httptest.NewRecorder()
-			mw := New(newConfig()).ZCAPLDMiddleware(handler)
+			mw := newOperation(t, newConfig()).ZCAPLDMiddleware(handler)
 			require.IsType(t, &mwHandler{}, mw)
 			(mw).(*mwHandler).routeFunc = mockRouteFunc(&mockNamer{name: keystoresEndpoint})
 			mw.ServeHTTP(
@@ -47,7 +47,7 @@ func TestMiddleware(t *testing.T) {
 	t.Run("authz: zcaps", func(t *testing.T) {
 		t.Run("protects endpoints", func(t *testing.T) {
 			handler := &handler{}
-			mw := New(newConfig()).ZCAPLDMiddleware(handler)
+			mw := newOperation(t, newConfig()).ZCAPLDMiddleware(handler)
 			require.IsType(t, &mwHandler{}, mw)
 			(mw).(*mwHandler).routeFunc = func(r *http.Request) namer {
 				return &mockNamer{name: r.URL.Path}
@@ -68,6 +68,9 @@ func TestMiddleware(t *testing.T) {
 				verifyMACEndpoint,
 				wrapEndpoint,
 				unwrapEndpoint,
+				unlockEndpoint,
+				lockEndpoint,
+				rotateSharesEndpoint,
 			}
 
 			for _, endpoint := range endpoints {
@@ -80,7 +83,7 @@ func TestMiddleware(t *testing.T) {
 
 		t.Run("protects endpoints", func(t *testing.T) {
 			handler := &handler{}
-			mw := New(newConfig()).ZCAPLDMiddleware(handler)
+			mw := newOperation(t, newConfig()).ZCAPLDMiddleware(handler)
 			require.IsType(t, &mwHandler{}, mw)
 			(mw).(*mwHandler).routeFunc = func(r *http.Request) namer {
 				return &mockNamer{name: r.URL.Path}
@@ -101,6 +104,9 @@ func TestMiddleware(t *testing.T) {
 				verifyMACEndpoint,
 				wrapEndpoint,
 				unwrapEndpoint,
+				unlockEndpoint,
+				lockEndpoint,
+				rotateSharesEndpoint,
 			}
 
 			for _, endpoint := range endpoints {
@@ -114,7 +120,7 @@ func TestMiddleware(t *testing.T) {
 
 		t.Run("badrequest if endpoint is not valid", func(t *testing.T) {
 			handler := &handler{}
-			mw := New(newConfig()).ZCAPLDMiddleware(handler)
+			mw := newOperation(t, newConfig()).ZCAPLDMiddleware(handler)
 			require.IsType(t, &mwHandler{}, mw)
 			(mw).(*mwHandler).routeFunc = func(r *http.Request) namer {
 				return &mockNamer{name: r.URL.Path}
@@ -182,6 +188,18 @@ func TestCapabilityInvocationAction(t *testing.T) {
 				endpoint:       unwrapEndpoint,
 				expectedAction: actionUnwrap,
 			},
+			{
+				endpoint:       unlockEndpoint,
+				expectedAction: actionUnlock,
+			},
+			{
+				endpoint:       lockEndpoint,
+				expectedAction: actionLock,
+			},
+			{
+				endpoint:       rotateSharesEndpoint,
+				expectedAction: actionRotateShares,
+			},
 		}
 
 		for i := range testCases {
@@ -237,6 +255,15 @@ type options struct {
 	logger      log.Logger
 }
 
+func newOperation(t *testing.T, config *Config) *Operation {
+	t.Helper()
+
+	op, err := New(config)
+	require.NoError(t, err)
+
+	return op
+}
+
 func newConfig() *Config {
 	cOpts := &options{
 		authService: &mockAuthService{},
@@ -6,11 +6,33 @@ SPDX-License-Identifier: Apache-2.0
 
 package operation
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"time"
+)
 
 type createKeystoreReq struct {
-	Controller string `json:"controller"`
-	VaultID    string `json:"vaultID,omitempty"`
+	Controller   string           `json:"controller"`
+	VaultID      string           `json:"vaultID,omitempty"`
+	SecretShares *secretSharesReq `json:"secretShares,omitempty"`
+	// StorageType and SecretLockType are one of the types allowed by the server, the default ones if not set.
+	StorageType    string `json:"storageType,omitempty"`
+	SecretLockType string `json:"secretLockType,omitempty"`
+	// ProvisionVault creates the EDV vault of the keystore with edv storage instead of using VaultID.
+	ProvisionVault bool `json:"provisionVault,omitempty"`
+}
+
+// createKeystoreResp is the body of the response to create the keystore with secret shares, if the header provider is
+// one of its providers.
+type createKeystoreResp struct {
+	// Secret is the base64-encoded share passed in the Hub-Kms-Secret header.
+	Secret string `json:"secret"`
+}
+
+// secretSharesReq enables k-of-n secret split lock for the keystore.
+type secretSharesReq struct {
+	Threshold int      `json:"threshold"`
+	Providers []string `json:"providers"`
 }
 
 // UpdateCapabilityReq update capability request.
@@ -147,3 +169,12 @@ type sealOpenResp struct {
 type errorResp struct {
 	Message string `json:"errMessage,omitempty"`
 }
+
+type unlockResp struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+type rotateSharesResp struct {
+	Secret string `json:"secret"`
+}
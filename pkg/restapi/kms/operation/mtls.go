@@ -0,0 +1,168 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package operation
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/trustbloc/edge-core/pkg/log"
+	"go.opentelemetry.io/otel/label"
+
+	"github.com/trustbloc/hub-kms/pkg/kms"
+)
+
+// Certificate attributes that can be mapped to the keystore controller.
+const (
+	IdentitySourceSANURI  = "san-uri"
+	IdentitySourceSubject = "subject"
+)
+
+// MTLSConfig configures authentication with TLS client certificates.
+type MTLSConfig struct {
+	// IdentitySource is the certificate attribute mapped to the keystore controller: san-uri or subject.
+	IdentitySource string
+	// AllowZCAPs passes requests that are not authorized with a client certificate to ZCAPLDMiddleware
+	// instead of rejecting them.
+	AllowZCAPs bool
+}
+
+type (
+	mtlsAuthorizedContextKey struct{}
+	mtlsIdentitiesContextKey struct{}
+)
+
+// MTLSMiddleware returns the middleware that authorizes requests with TLS client certificates. A request is
+// authorized if the certificate's identity is the controller of the keystore. On keystore creation, the controller
+// must be one of the certificate's identities, which is the default controller unless a bearer token subject is
+// set. The middleware is a no-op if mTLS is not configured.
+func (o *Operation) MTLSMiddleware(h http.Handler) http.Handler {
+	if o.mtlsConfig == nil {
+		return h
+	}
+
+	return &mtlsHandler{
+		next:       h,
+		kmsService: o.kmsService,
+		config:     o.mtlsConfig,
+		logger:     o.logger,
+		routeFunc:  (&muxNamer{}).GetName,
+	}
+}
+
+type mtlsHandler struct {
+	next       http.Handler
+	kmsService kms.Service
+	config     *MTLSConfig
+	logger     log.Logger
+	routeFunc  func(*http.Request) namer
+}
+
+func (h *mtlsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracer.Start(r.Context(), "MTLSMiddleware")
+	defer span.End()
+
+	identities := h.clientIdentities(r)
+	if len(identities) == 0 {
+		h.reject(w, r.WithContext(ctx), http.StatusUnauthorized, "no verified client certificate")
+
+		return
+	}
+
+	span.SetAttributes(label.String("identity", identities[0]))
+
+	if h.routeFunc(r).GetName() == keystoresEndpoint {
+		h.next.ServeHTTP(w, r.WithContext(context.WithValue(ctx, mtlsIdentitiesContextKey{}, identities)))
+
+		return
+	}
+
+	keystoreID := mux.Vars(r)[keystoreIDQueryParam]
+
+	data, err := h.kmsService.GetKeystoreData(keystoreID)
+	if err != nil {
+		h.reject(w, r.WithContext(ctx), http.StatusNotFound, fmt.Sprintf("failed to get keystore data: %s", err))
+
+		return
+	}
+
+	for _, id := range identities {
+		if id == data.Controller {
+			h.next.ServeHTTP(w, r.WithContext(context.WithValue(ctx, mtlsAuthorizedContextKey{}, true)))
+
+			return
+		}
+	}
+
+	h.reject(w, r.WithContext(ctx), http.StatusForbidden,
+		fmt.Sprintf("client certificate identity does not control keystore %s", keystoreID))
+}
+
+func (h *mtlsHandler) reject(w http.ResponseWriter, r *http.Request, status int, reason string) {
+	if h.config.AllowZCAPs {
+		h.logger.Debugf("request not authorized with client certificate, falling back to zcaps: %s", reason)
+		h.next.ServeHTTP(w, r)
+
+		return
+	}
+
+	h.logger.Errorf("unauthorized request: %s", reason)
+	http.Error(w, http.StatusText(status), status)
+}
+
+// clientIdentities returns identities of the verified client certificate.
+func (h *mtlsHandler) clientIdentities(r *http.Request) []string {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+
+	return certIdentities(r.TLS.VerifiedChains[0][0], h.config.IdentitySource)
+}
+
+func certIdentities(cert *x509.Certificate, source string) []string {
+	if source == IdentitySourceSubject {
+		return []string{cert.Subject.String()}
+	}
+
+	identities := make([]string, 0, len(cert.URIs))
+
+	for _, u := range cert.URIs {
+		identities = append(identities, u.String())
+	}
+
+	return identities
+}
+
+// mtlsIdentitiesFromContext returns identities of the client certificate of the keystore creation request.
+func mtlsIdentitiesFromContext(ctx context.Context) []string {
+	identities, ok := ctx.Value(mtlsIdentitiesContextKey{}).([]string)
+	if !ok {
+		return nil
+	}
+
+	return identities
+}
+
+// authorizedByMTLS returns true if the request was authorized with a TLS client certificate.
+func authorizedByMTLS(ctx context.Context) bool {
+	authorized, ok := ctx.Value(mtlsAuthorizedContextKey{}).(bool)
+
+	return ok && authorized
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
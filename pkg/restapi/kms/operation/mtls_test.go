@@ -0,0 +1,238 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package operation_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/hub-kms/pkg/auth/oauth2"
+	"github.com/trustbloc/hub-kms/pkg/kms"
+	"github.com/trustbloc/hub-kms/pkg/restapi/kms/operation"
+)
+
+const testSignEndpoint = "/keystores/" + testKeystoreID + "/keys/" + testKeyID + "/sign"
+
+func TestMTLSMiddleware(t *testing.T) {
+	t.Run("no-op if mTLS is not configured", func(t *testing.T) {
+		rr, executed := serveWithMTLSMiddleware(t, newConfig(), newMTLSRequest(testSignEndpoint, nil))
+
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.True(t, executed)
+	})
+
+	t.Run("unauthorized without client certificate", func(t *testing.T) {
+		config := newConfig()
+		config.MTLSConfig = &operation.MTLSConfig{IdentitySource: operation.IdentitySourceSANURI}
+
+		rr, executed := serveWithMTLSMiddleware(t, config, newMTLSRequest(testSignEndpoint, nil))
+
+		require.Equal(t, http.StatusUnauthorized, rr.Code)
+		require.False(t, executed)
+	})
+
+	t.Run("authorized if SAN URI is the keystore controller", func(t *testing.T) {
+		config := newConfig(withKMSService(mockKMSServiceWithController(testController)))
+		config.MTLSConfig = &operation.MTLSConfig{IdentitySource: operation.IdentitySourceSANURI, AllowZCAPs: true}
+
+		rr, executed := serveWithMTLSMiddleware(t, config,
+			newMTLSRequest(testSignEndpoint, newClientCert(t, testController, "")))
+
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.True(t, executed, "zcaps must not be required")
+	})
+
+	t.Run("authorized if subject is the keystore controller", func(t *testing.T) {
+		config := newConfig(withKMSService(mockKMSServiceWithController("CN=internal-service")))
+		config.MTLSConfig = &operation.MTLSConfig{IdentitySource: operation.IdentitySourceSubject}
+
+		rr, executed := serveWithMTLSMiddleware(t, config,
+			newMTLSRequest(testSignEndpoint, newClientCert(t, "", "internal-service")))
+
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.True(t, executed)
+	})
+
+	t.Run("forbidden if identity does not control keystore", func(t *testing.T) {
+		config := newConfig(withKMSService(mockKMSServiceWithController(testController)))
+		config.MTLSConfig = &operation.MTLSConfig{IdentitySource: operation.IdentitySourceSANURI}
+
+		rr, executed := serveWithMTLSMiddleware(t, config,
+			newMTLSRequest(testSignEndpoint, newClientCert(t, "did:example:other", "")))
+
+		require.Equal(t, http.StatusForbidden, rr.Code)
+		require.False(t, executed)
+	})
+
+	t.Run("not found if keystore does not exist", func(t *testing.T) {
+		svc := mockKMSService()
+		svc.GetKeystoreDataErr = errors.New("not found")
+
+		config := newConfig(withKMSService(svc))
+		config.MTLSConfig = &operation.MTLSConfig{IdentitySource: operation.IdentitySourceSANURI}
+
+		rr, executed := serveWithMTLSMiddleware(t, config,
+			newMTLSRequest(testSignEndpoint, newClientCert(t, testController, "")))
+
+		require.Equal(t, http.StatusNotFound, rr.Code)
+		require.False(t, executed)
+	})
+
+	t.Run("falls back to zcaps if identity does not control keystore", func(t *testing.T) {
+		config := newConfig(withKMSService(mockKMSServiceWithController(testController)))
+		config.MTLSConfig = &operation.MTLSConfig{IdentitySource: operation.IdentitySourceSANURI, AllowZCAPs: true}
+
+		rr, executed := serveWithMTLSMiddleware(t, config,
+			newMTLSRequest(testSignEndpoint, newClientCert(t, "did:example:other", "")))
+
+		require.Equal(t, http.StatusUnauthorized, rr.Code) // no zcap sent
+		require.False(t, executed)
+	})
+
+	t.Run("certificate identity is the default controller on keystore creation", func(t *testing.T) {
+		svc := &controllerCapturingService{MockService: mockKMSService()}
+
+		config := newConfig(withKMSService(svc))
+		config.MTLSConfig = &operation.MTLSConfig{IdentitySource: operation.IdentitySourceSANURI}
+
+		rr := serveCreateKeystoreWithMTLS(t, config, createKeystoreReq(t, "", ""), testController)
+
+		require.Equal(t, http.StatusCreated, rr.Code)
+		require.Equal(t, testController, svc.controller)
+	})
+
+	t.Run("forbidden to create keystore for another controller", func(t *testing.T) {
+		svc := &controllerCapturingService{MockService: mockKMSService()}
+
+		config := newConfig(withKMSService(svc))
+		config.MTLSConfig = &operation.MTLSConfig{IdentitySource: operation.IdentitySourceSANURI}
+
+		rr := serveCreateKeystoreWithMTLS(t, config, createKeystoreReq(t, "did:example:other", ""), testController)
+
+		require.Equal(t, http.StatusForbidden, rr.Code)
+		require.Empty(t, svc.controller)
+	})
+
+	t.Run("bearer token subject is kept on keystore creation", func(t *testing.T) {
+		svc := &controllerCapturingService{MockService: mockKMSService()}
+
+		config := newConfig(withKMSService(svc))
+		config.MTLSConfig = &operation.MTLSConfig{IdentitySource: operation.IdentitySourceSANURI}
+		config.TokenValidator = &mockTokenValidator{claims: &oauth2.Claims{Subject: testController}}
+
+		rr := serveCreateKeystoreWithMTLS(t, config, createKeystoreReq(t, "", "token"), testController)
+
+		require.Equal(t, http.StatusCreated, rr.Code)
+		require.Equal(t, testController, svc.controller)
+	})
+
+	t.Run("forbidden if bearer token subject is not the certificate identity", func(t *testing.T) {
+		svc := &controllerCapturingService{MockService: mockKMSService()}
+
+		config := newConfig(withKMSService(svc))
+		config.MTLSConfig = &operation.MTLSConfig{IdentitySource: operation.IdentitySourceSANURI}
+		config.TokenValidator = &mockTokenValidator{claims: &oauth2.Claims{Subject: "did:example:subject"}}
+
+		rr := serveCreateKeystoreWithMTLS(t, config, createKeystoreReq(t, "", "token"), testController)
+
+		require.Equal(t, http.StatusForbidden, rr.Code)
+		require.Empty(t, svc.controller)
+	})
+}
+
+// serveCreateKeystoreWithMTLS serves the keystore creation request with a client certificate of the given identity
+// through BearerTokenMiddleware and MTLSMiddleware.
+func serveCreateKeystoreWithMTLS(t *testing.T, config *operation.Config, req *http.Request,
+	identity string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req.TLS = &tls.ConnectionState{
+		VerifiedChains: [][]*x509.Certificate{{newClientCert(t, identity, "")}},
+	}
+
+	op := newOperation(t, config)
+
+	router := mux.NewRouter()
+	router.Use(op.BearerTokenMiddleware)
+	router.Use(op.MTLSMiddleware)
+
+	for _, h := range op.GetRESTHandlers() {
+		router.HandleFunc(h.Path(), h.Handle()).Methods(h.Method()).Name(h.Name())
+	}
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	return rr
+}
+
+// serveWithMTLSMiddleware serves the request with MTLSMiddleware, chained with ZCAPLDMiddleware if zcaps are allowed.
+func serveWithMTLSMiddleware(t *testing.T, config *operation.Config, req *http.Request) (*httptest.ResponseRecorder,
+	bool) {
+	t.Helper()
+
+	op := newOperation(t, config)
+
+	router := mux.NewRouter()
+	router.Use(op.MTLSMiddleware)
+
+	if config.MTLSConfig != nil && config.MTLSConfig.AllowZCAPs {
+		router.Use(op.ZCAPLDMiddleware)
+	}
+
+	executed := false
+
+	router.HandleFunc(signEndpoint, func(w http.ResponseWriter, r *http.Request) {
+		executed = true
+	}).Methods(http.MethodPost).Name(signEndpoint)
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	return rr, executed
+}
+
+func newMTLSRequest(path string, cert *x509.Certificate) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, path, nil)
+
+	if cert != nil {
+		req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	}
+
+	return req
+}
+
+func newClientCert(t *testing.T, uri, commonName string) *x509.Certificate {
+	t.Helper()
+
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: commonName}}
+
+	if uri != "" {
+		u, err := url.Parse(uri)
+		require.NoError(t, err)
+
+		cert.URIs = []*url.URL{u}
+	}
+
+	return cert
+}
+
+func mockKMSServiceWithController(controller string) kms.Service {
+	svc := mockKMSService()
+	svc.GetKeystoreDataValue.Controller = controller
+
+	return svc
+}
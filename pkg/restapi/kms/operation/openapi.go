@@ -13,6 +13,12 @@ type createKeystoreReqSpec struct { //nolint:unused,deadcode // spec
 	// in: body
 	// required: true
 	CreateKeystoreReq createKeystoreReq
+	// User whose secret shares are stored by share providers of the keystore with secretShares.
+	// in: header
+	HubKMSUser string `json:"Hub-Kms-User"`
+	// Signed assertion (JWT) of the user, required if kms-rest is configured to verify user assertions.
+	// in: header
+	HubKMSUserAssertion string `json:"Hub-Kms-User-Assertion"`
 }
 
 // createKeystoreResp model
@@ -20,6 +26,10 @@ type createKeystoreReqSpec struct { //nolint:unused,deadcode // spec
 // swagger:response createKeystoreResp
 type createKeystoreRespSpec struct { //nolint:unused,deadcode // spec
 	Location string
+	// ETag of the keystore revision
+	ETag string
+	// in: body
+	CreateKeystoreResp createKeystoreResp
 }
 
 // updateCapabilityReq model
@@ -29,6 +39,9 @@ type updateCapabilityReqSpec struct { //nolint:unused,deadcode // spec
 	// in: path
 	// required: true
 	KeystoreID string `json:"keystoreID"`
+	// ETag of the keystore revision to update
+	// in: header
+	IfMatch string `json:"If-Match"`
 	// in: body
 	// required: true
 	UpdateCapabilityReq UpdateCapabilityReq
@@ -303,6 +316,72 @@ type sealOpenRespSpec struct { //nolint:unused,deadcode // spec
 	SealOpenResp sealOpenResp
 }
 
+// unlockReq model
+//
+// swagger:parameters unlockReq
+type unlockReqSpec struct { //nolint:unused,deadcode // spec
+	// in: path
+	// required: true
+	KeystoreID string `json:"keystoreID"`
+	// Secret share of the keystore.
+	// in: header
+	HubKMSSecret string `json:"Hub-Kms-Secret"`
+	// User whose secret share is fetched from Hub Auth.
+	// in: header
+	HubKMSUser string `json:"Hub-Kms-User"`
+	// Signed assertion (JWT) of the user, required if kms-rest is configured to verify user assertions.
+	// in: header
+	HubKMSUserAssertion string `json:"Hub-Kms-User-Assertion"`
+}
+
+// unlockResp model
+//
+// swagger:response unlockResp
+type unlockRespSpec struct { //nolint:unused,deadcode // spec
+	// in: body
+	UnlockResp unlockResp
+}
+
+// lockReq model
+//
+// swagger:parameters lockReq
+type lockReqSpec struct { //nolint:unused,deadcode // spec
+	// in: path
+	// required: true
+	KeystoreID string `json:"keystoreID"`
+	// Session token returned by unlock.
+	// in: header
+	// required: true
+	HubKMSSession string `json:"Hub-Kms-Session"`
+}
+
+// rotateSharesReq model
+//
+// swagger:parameters rotateSharesReq
+type rotateSharesReqSpec struct { //nolint:unused,deadcode // spec
+	// in: path
+	// required: true
+	KeystoreID string `json:"keystoreID"`
+	// Current secret share of the keystore.
+	// in: header
+	// required: true
+	HubKMSSecret string `json:"Hub-Kms-Secret"`
+	// User whose secret share is rotated in Hub Auth.
+	// in: header
+	HubKMSUser string `json:"Hub-Kms-User"`
+	// Signed assertion (JWT) of the user, required if kms-rest is configured to verify user assertions.
+	// in: header
+	HubKMSUserAssertion string `json:"Hub-Kms-User-Assertion"`
+}
+
+// rotateSharesResp model
+//
+// swagger:response rotateSharesResp
+type rotateSharesRespSpec struct { //nolint:unused,deadcode // spec
+	// in: body
+	RotateSharesResp rotateSharesResp
+}
+
 // errorResp model
 //
 // swagger:response errorResp
@@ -10,6 +10,7 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -18,6 +19,7 @@ import (
 
 	"github.com/gorilla/mux"
 	"github.com/hyperledger/aries-framework-go/pkg/crypto"
+	"github.com/hyperledger/aries-framework-go/pkg/doc/signature/verifier"
 	arieskms "github.com/hyperledger/aries-framework-go/pkg/kms"
 	"github.com/piprate/json-gold/ld"
 	"github.com/trustbloc/edge-core/pkg/log"
@@ -25,9 +27,11 @@ import (
 	"go.opentelemetry.io/otel/label"
 	"go.opentelemetry.io/otel/trace"
 
-	zcapld2 "github.com/trustbloc/hub-kms/pkg/auth/zcapld"
+	kmszcapld "github.com/trustbloc/hub-kms/pkg/auth/zcapld"
 	"github.com/trustbloc/hub-kms/pkg/internal/support"
 	"github.com/trustbloc/hub-kms/pkg/kms"
+	"github.com/trustbloc/hub-kms/pkg/secretlock/secretsplitlock"
+	"github.com/trustbloc/hub-kms/pkg/storage/cache"
 )
 
 const (
@@ -49,6 +53,10 @@ const (
 	easyPath       = "/easy"
 	easyOpenPath   = "/easyopen"
 	sealOpenPath   = "/sealopen"
+	unlockPath     = "/unlock"
+	lockPath       = "/lock"
+
+	rotateSharesPath = "/rotateshares"
 
 	// KMSBasePath is the base path for all KMS endpoints.
 	KMSBasePath        = "/kms"
@@ -71,6 +79,11 @@ const (
 	easyOpenEndpoint = keystoreEndpoint + easyOpenPath
 	sealOpenEndpoint = keystoreEndpoint + sealOpenPath
 
+	unlockEndpoint = keystoreEndpoint + unlockPath
+	lockEndpoint   = keystoreEndpoint + lockPath
+
+	rotateSharesEndpoint = keystoreEndpoint + rotateSharesPath
+
 	// Error messages.
 	receivedBadRequest     = "Received bad request: %s"
 	createKeystoreFailure  = "Failed to create a keystore: %s"
@@ -92,6 +105,11 @@ const (
 	easyMessageFailure     = "Failed to easy a message: %s"
 	easyOpenMessageFailure = "Failed to easyOpen a message: %s"
 	sealOpenPayloadFailure = "Failed to sealOpen a payload: %s"
+
+	unlockKeystoreFailure = "Failed to unlock a keystore: %s"
+	lockKeystoreFailure   = "Failed to lock a keystore: %s"
+
+	rotateSharesFailure = "Failed to rotate secret shares: %s"
 )
 
 const (
@@ -110,6 +128,11 @@ const (
 	actionEasy     = "easy"
 	actionEasyOpen = "easyOpen"
 	actionSealOpen = "sealOpen"
+
+	actionUnlock = "unlock"
+	actionLock   = "lock"
+
+	actionRotateShares = "rotateShares"
 )
 
 // Handler defines an HTTP handler for the API endpoint.
@@ -137,6 +160,12 @@ type Operation struct {
 	tracer           trace.Tracer
 	cachedLDDocs     map[string]*ld.RemoteDocument
 	baseURL          string
+	signatureSuites  []verifier.SignatureSuite
+	keyResolver      KeyResolver
+	tokenValidator   TokenValidator
+	mtlsConfig       *MTLSConfig
+	maxClockSkew     time.Duration
+	replayCache      *kmszcapld.ReplayCache
 }
 
 // Config defines configuration for KMS operations.
@@ -148,10 +177,16 @@ type Config struct {
 	Tracer           trace.Tracer
 	CachedLDDocs     map[string]*ld.RemoteDocument
 	BaseURL          string
+	SignatureSuites  []verifier.SignatureSuite // accepted zcap signature suites (Ed25519Signature2018 by default)
+	KeyResolver      KeyResolver               // resolves zcap invoker keys (did:key only by default)
+	TokenValidator   TokenValidator            // validates bearer tokens for keystore creation (optional)
+	MTLSConfig       *MTLSConfig               // enables authorization with TLS client certificates (optional)
+	MaxClockSkew     time.Duration             // allowed clock skew of HTTP signatures (5 minutes by default)
+	ReplayCache      *kmszcapld.ReplayCache    // detects replayed HTTP signatures (in-memory by default)
 }
 
 // New returns a new Operation instance.
-func New(config *Config) *Operation {
+func New(config *Config) (*Operation, error) {
 	op := &Operation{
 		authService:      config.AuthService,
 		kmsService:       config.KMSService,
@@ -160,9 +195,44 @@ func New(config *Config) *Operation {
 		tracer:           config.Tracer,
 		cachedLDDocs:     config.CachedLDDocs,
 		baseURL:          config.BaseURL,
+		signatureSuites:  config.SignatureSuites,
+		keyResolver:      config.KeyResolver,
+		tokenValidator:   config.TokenValidator,
+		mtlsConfig:       config.MTLSConfig,
+		maxClockSkew:     config.MaxClockSkew,
+		replayCache:      config.ReplayCache,
+	}
+
+	if op.maxClockSkew == 0 {
+		op.maxClockSkew = kmszcapld.DefaultMaxClockSkew
 	}
 
-	return op
+	if op.replayCache == nil {
+		// signatures older than the clock skew are rejected anyway, so there is no need to keep them longer
+		p := cache.NewProvider(cache.WithExpiration(2 * op.maxClockSkew)) //nolint:gomnd // past and future skew
+
+		replayCache, err := kmszcapld.NewReplayCache(p)
+		if err != nil {
+			return nil, fmt.Errorf("new replay cache: %w", err)
+		}
+
+		op.replayCache = replayCache
+	}
+
+	if op.keyResolver == nil {
+		op.keyResolver = &kmszcapld.DIDKeyResolver{}
+	}
+
+	if len(op.signatureSuites) == 0 {
+		suites, err := kmszcapld.SignatureSuites(kmszcapld.Ed25519Signature2018)
+		if err != nil {
+			return nil, fmt.Errorf("default signature suites: %w", err)
+		}
+
+		op.signatureSuites = suites
+	}
+
+	return op, nil
 }
 
 // GetRESTHandlers gets handlers available for the hub-kms REST API.
@@ -184,12 +254,18 @@ func (o *Operation) GetRESTHandlers() []Handler {
 		support.NewHTTPHandler(easyEndpoint, easyEndpoint, http.MethodPost, o.easyHandler),
 		support.NewHTTPHandler(easyOpenEndpoint, easyOpenEndpoint, http.MethodPost, o.easyOpenHandler),
 		support.NewHTTPHandler(sealOpenEndpoint, sealOpenEndpoint, http.MethodPost, o.sealOpenHandler),
+		// unlock sessions
+		support.NewHTTPHandler(unlockEndpoint, unlockEndpoint, http.MethodPost, o.unlockHandler),
+		support.NewHTTPHandler(lockEndpoint, lockEndpoint, http.MethodPost, o.lockHandler),
+		// secret shares
+		support.NewHTTPHandler(rotateSharesEndpoint, rotateSharesEndpoint, http.MethodPost, o.rotateSharesHandler),
 	}
 }
 
 // swagger:route POST /kms/keystores keystore createKeystoreReq
 //
-// Creates a new Keystore.
+// Creates a new Keystore. The secret of the keystore with secretShares is split into shares pushed to its providers,
+// the share of the header provider is returned in the body.
 //
 // Responses:
 //        201: createKeystoreResp
@@ -205,9 +281,57 @@ func (o *Operation) createKeystoreHandler(rw http.ResponseWriter, req *http.Requ
 		return
 	}
 
-	keystoreData, err := o.kmsService.CreateKeystore(request.Controller, request.VaultID)
+	identities := mtlsIdentitiesFromContext(ctx)
+
+	if request.Controller == "" {
+		// the subject of the bearer token, or the identity of the client certificate, is the default controller
+		request.Controller = subjectFromContext(ctx)
+
+		if request.Controller == "" && len(identities) > 0 {
+			request.Controller = identities[0]
+		}
+	}
+
+	if len(identities) > 0 && !contains(identities, request.Controller) {
+		o.writeErrorResponse(rw, http.StatusForbidden, createKeystoreFailure,
+			errors.New("client certificate identity is not the controller"))
+
+		return
+	}
+
+	var opts []kms.CreateKeystoreOption
+
+	if request.SecretShares != nil {
+		opts = append(opts, kms.WithSecretShares(request.SecretShares.Threshold, request.SecretShares.Providers...))
+	}
+
+	if request.StorageType != "" {
+		opts = append(opts, kms.WithStorageType(request.StorageType))
+	}
+
+	if request.SecretLockType != "" {
+		opts = append(opts, kms.WithSecretLockType(request.SecretLockType))
+	}
+
+	if request.ProvisionVault {
+		opts = append(opts, kms.WithVaultProvisioning())
+	}
+
+	keystoreData, secretShare, err := o.kmsService.CreateKeystore(req.WithContext(ctx), request.Controller,
+		request.VaultID, opts...)
 	if err != nil {
-		o.writeErrorResponse(rw, http.StatusInternalServerError, createKeystoreFailure, err)
+		status := http.StatusInternalServerError
+
+		switch {
+		case errors.Is(err, kms.ErrInvalidSecretShares) || errors.Is(err, kms.ErrUnsupportedKeystoreType):
+			status = http.StatusBadRequest
+		case errors.Is(err, kms.ErrInvalidUserAssertion):
+			status = http.StatusUnauthorized
+		case errors.Is(err, secretsplitlock.ErrUnavailable):
+			status = http.StatusServiceUnavailable
+		}
+
+		o.writeErrorResponse(rw, status, createKeystoreFailure, err)
 
 		return
 	}
@@ -238,8 +362,13 @@ func (o *Operation) createKeystoreHandler(rw http.ResponseWriter, req *http.Requ
 	rw.Header().Set("Location", resource)
 	rw.Header().Set("Edvdidkey", didKey)
 	rw.Header().Set("X-RootCapability", zcap)
+	rw.Header().Set(etagHeader, keystoreETag(keystoreData))
 	rw.WriteHeader(http.StatusCreated)
 
+	if secretShare != nil {
+		o.writeResponse(rw, createKeystoreResp{Secret: base64.StdEncoding.EncodeToString(secretShare)})
+	}
+
 	o.logger.Debugf("finished handling request - keystore: %s", resource)
 }
 
@@ -260,7 +389,7 @@ func (o *Operation) createKeyHandler(rw http.ResponseWriter, req *http.Request)
 
 	k, err := o.kmsService.ResolveKeystore(req.WithContext(ctx))
 	if err != nil {
-		o.writeErrorResponse(rw, http.StatusInternalServerError, resolveKeystoreFailure, err)
+		o.writeErrorResponse(rw, resolveKeystoreStatus(err), resolveKeystoreFailure, err)
 
 		return
 	}
@@ -302,7 +431,8 @@ func (o *Operation) createKeyHandler(rw http.ResponseWriter, req *http.Request)
 
 // swagger:route POST /kms/keystores/{keystoreID}/capability zcap updateCapabilityReq
 //
-// Updates ZCAP capabilities.
+// Updates ZCAP capabilities. The keystore is updated only if it matches the If-Match header, if set, and is not
+// changed concurrently, otherwise 409 Conflict is returned. The ETag header of the response is the new revision.
 //
 // Responses:
 //        201: emptyRes
@@ -334,14 +464,26 @@ func (o *Operation) updateCapabilityHandler(rw http.ResponseWriter, req *http.Re
 		return
 	}
 
+	if !ifMatch(req, keystoreData) {
+		o.writeErrorResponse(rw, http.StatusConflict, saveKeystoreFailure, errIfMatch)
+
+		return
+	}
+
 	keystoreData.EDVCapability = request.EDVCapability
 
 	if err := o.kmsService.SaveKeystoreData(keystoreData); err != nil {
-		o.writeErrorResponse(rw, http.StatusInternalServerError, saveKeystoreFailure, err)
+		status := http.StatusInternalServerError
+		if errors.Is(err, kms.ErrRevisionConflict) {
+			status = http.StatusConflict
+		}
+
+		o.writeErrorResponse(rw, status, saveKeystoreFailure, err)
 
 		return
 	}
 
+	rw.Header().Set(etagHeader, keystoreETag(keystoreData))
 	rw.WriteHeader(http.StatusOK)
 }
 
@@ -362,7 +504,7 @@ func (o *Operation) exportKeyHandler(rw http.ResponseWriter, req *http.Request)
 
 	k, err := o.kmsService.ResolveKeystore(req.WithContext(ctx))
 	if err != nil {
-		o.writeErrorResponse(rw, http.StatusInternalServerError, resolveKeystoreFailure, err)
+		o.writeErrorResponse(rw, resolveKeystoreStatus(err), resolveKeystoreFailure, err)
 
 		return
 	}
@@ -405,7 +547,7 @@ func (o *Operation) signHandler(rw http.ResponseWriter, req *http.Request) { //n
 
 	k, err := o.kmsService.ResolveKeystore(req.WithContext(ctx))
 	if err != nil {
-		o.writeErrorResponse(rw, http.StatusInternalServerError, resolveKeystoreFailure, err)
+		o.writeErrorResponse(rw, resolveKeystoreStatus(err), resolveKeystoreFailure, err)
 
 		return
 	}
@@ -467,7 +609,7 @@ func (o *Operation) verifyHandler(rw http.ResponseWriter, req *http.Request) { /
 
 	k, err := o.kmsService.ResolveKeystore(req.WithContext(ctx))
 	if err != nil {
-		o.writeErrorResponse(rw, http.StatusInternalServerError, resolveKeystoreFailure, err)
+		o.writeErrorResponse(rw, resolveKeystoreStatus(err), resolveKeystoreFailure, err)
 
 		return
 	}
@@ -532,7 +674,7 @@ func (o *Operation) encryptHandler(rw http.ResponseWriter, req *http.Request) {
 
 	k, err := o.kmsService.ResolveKeystore(req.WithContext(ctx))
 	if err != nil {
-		o.writeErrorResponse(rw, http.StatusInternalServerError, resolveKeystoreFailure, err)
+		o.writeErrorResponse(rw, resolveKeystoreStatus(err), resolveKeystoreFailure, err)
 
 		return
 	}
@@ -600,7 +742,7 @@ func (o *Operation) decryptHandler(rw http.ResponseWriter, req *http.Request) {
 
 	k, err := o.kmsService.ResolveKeystore(req.WithContext(ctx))
 	if err != nil {
-		o.writeErrorResponse(rw, http.StatusInternalServerError, resolveKeystoreFailure, err)
+		o.writeErrorResponse(rw, resolveKeystoreStatus(err), resolveKeystoreFailure, err)
 
 		return
 	}
@@ -674,7 +816,7 @@ func (o *Operation) computeMACHandler(rw http.ResponseWriter, req *http.Request)
 
 	k, err := o.kmsService.ResolveKeystore(req.WithContext(ctx))
 	if err != nil {
-		o.writeErrorResponse(rw, http.StatusInternalServerError, resolveKeystoreFailure, err)
+		o.writeErrorResponse(rw, resolveKeystoreStatus(err), resolveKeystoreFailure, err)
 
 		return
 	}
@@ -734,7 +876,7 @@ func (o *Operation) verifyMACHandler(rw http.ResponseWriter, req *http.Request)
 
 	k, err := o.kmsService.ResolveKeystore(req.WithContext(ctx))
 	if err != nil {
-		o.writeErrorResponse(rw, http.StatusInternalServerError, resolveKeystoreFailure, err)
+		o.writeErrorResponse(rw, resolveKeystoreStatus(err), resolveKeystoreFailure, err)
 
 		return
 	}
@@ -865,7 +1007,7 @@ func (o *Operation) unwrapHandler(rw http.ResponseWriter, req *http.Request) { /
 
 	k, err := o.kmsService.ResolveKeystore(req.WithContext(ctx))
 	if err != nil {
-		o.writeErrorResponse(rw, http.StatusInternalServerError, resolveKeystoreFailure, err)
+		o.writeErrorResponse(rw, resolveKeystoreStatus(err), resolveKeystoreFailure, err)
 
 		return
 	}
@@ -1007,7 +1149,7 @@ func (o *Operation) newCompressedZCAP(ctx context.Context, resource, controller
 		return "", fmt.Errorf("failed to create zcap: %w", err)
 	}
 
-	compressed, err := zcapld2.CompressZCAP(zcap)
+	compressed, err := kmszcapld.CompressZCAP(zcap)
 	if err != nil {
 		return "", fmt.Errorf("failed to compress zcap: %w", err)
 	}
@@ -1095,5 +1237,8 @@ func allActions() []string {
 		actionEasy,
 		actionEasyOpen,
 		actionSealOpen,
+		actionUnlock,
+		actionLock,
+		actionRotateShares,
 	}
 }
@@ -33,7 +33,7 @@ func (o *Operation) easyHandler(rw http.ResponseWriter, req *http.Request) { //n
 
 	k, err := o.kmsService.ResolveKeystore(req.WithContext(ctx))
 	if err != nil {
-		o.writeErrorResponse(rw, http.StatusInternalServerError, resolveKeystoreFailure, err)
+		o.writeErrorResponse(rw, resolveKeystoreStatus(err), resolveKeystoreFailure, err)
 
 		return
 	}
@@ -109,7 +109,7 @@ func (o *Operation) easyOpenHandler(rw http.ResponseWriter, req *http.Request) {
 
 	k, err := o.kmsService.ResolveKeystore(req.WithContext(ctx))
 	if err != nil {
-		o.writeErrorResponse(rw, http.StatusInternalServerError, resolveKeystoreFailure, err)
+		o.writeErrorResponse(rw, resolveKeystoreStatus(err), resolveKeystoreFailure, err)
 
 		return
 	}
@@ -190,7 +190,7 @@ func (o *Operation) sealOpenHandler(rw http.ResponseWriter, req *http.Request) {
 
 	k, err := o.kmsService.ResolveKeystore(req.WithContext(ctx))
 	if err != nil {
-		o.writeErrorResponse(rw, http.StatusInternalServerError, resolveKeystoreFailure, err)
+		o.writeErrorResponse(rw, resolveKeystoreStatus(err), resolveKeystoreFailure, err)
 
 		return
 	}
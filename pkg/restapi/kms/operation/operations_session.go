@@ -0,0 +1,121 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package operation
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/hyperledger/aries-framework-go/pkg/storage"
+	"go.opentelemetry.io/otel/label"
+
+	"github.com/trustbloc/hub-kms/pkg/kms"
+	"github.com/trustbloc/hub-kms/pkg/secretlock/secretsplitlock"
+)
+
+// swagger:route POST /kms/keystores/{keystoreID}/unlock session unlockReq
+//
+// Validates secret shares of the keystore and returns a short-lived session token. Until the session expires,
+// requests to the keystore pass the token in the Hub-Kms-Session header instead of the secret share headers.
+//
+// Responses:
+//        200: unlockResp
+//    default: errorResp
+func (o *Operation) unlockHandler(rw http.ResponseWriter, req *http.Request) {
+	ctx, span := o.traceSpan(req, "unlockHandler")
+	defer span.End()
+
+	span.SetAttributes(label.String("keystoreID", mux.Vars(req)[keystoreIDQueryParam]))
+
+	session, err := o.kmsService.UnlockKeystore(req.WithContext(ctx))
+	if err != nil {
+		o.writeErrorResponse(rw, secretSharesStatus(err), unlockKeystoreFailure, err)
+
+		return
+	}
+
+	o.writeResponse(rw, unlockResp{Token: session.Token, ExpiresAt: session.ExpiresAt})
+}
+
+// swagger:route POST /kms/keystores/{keystoreID}/lock session lockReq
+//
+// Ends the session before it expires.
+//
+// Responses:
+//        204: emptyRes
+//    default: errorResp
+func (o *Operation) lockHandler(rw http.ResponseWriter, req *http.Request) {
+	ctx, span := o.traceSpan(req, "lockHandler")
+	defer span.End()
+
+	span.SetAttributes(label.String("keystoreID", mux.Vars(req)[keystoreIDQueryParam]))
+
+	if err := o.kmsService.LockKeystore(req.WithContext(ctx)); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, kms.ErrSessionNotFound) {
+			status = http.StatusNotFound
+		}
+
+		o.writeErrorResponse(rw, status, lockKeystoreFailure, err)
+
+		return
+	}
+
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+// swagger:route POST /kms/keystores/{keystoreID}/rotateshares session rotateSharesReq
+//
+// Replaces secret shares of the keystore protected with the share from the Hub-Kms-Secret header and the share of
+// the share provider. Returns the new share to pass in the Hub-Kms-Secret header, the new share of the provider is
+// pushed to it. Keys of the keystore are kept, sessions of the keystore are closed.
+//
+// Responses:
+//        200: rotateSharesResp
+//    default: errorResp
+func (o *Operation) rotateSharesHandler(rw http.ResponseWriter, req *http.Request) {
+	ctx, span := o.traceSpan(req, "rotateSharesHandler")
+	defer span.End()
+
+	span.SetAttributes(label.String("keystoreID", mux.Vars(req)[keystoreIDQueryParam]))
+
+	share, err := o.kmsService.RotateSecretShares(req.WithContext(ctx))
+	if err != nil {
+		o.writeErrorResponse(rw, secretSharesStatus(err), rotateSharesFailure, err)
+
+		return
+	}
+
+	o.writeResponse(rw, rotateSharesResp{Secret: base64.StdEncoding.EncodeToString(share)})
+}
+
+// secretSharesStatus returns the status of the failed request that verifies secret shares of the keystore.
+func secretSharesStatus(err error) int {
+	switch {
+	case errors.Is(err, kms.ErrInvalidUserAssertion):
+		return http.StatusUnauthorized
+	case errors.Is(err, kms.ErrUnlockNotSupported), errors.Is(err, kms.ErrShareRotationNotSupported):
+		return http.StatusBadRequest
+	case errors.Is(err, storage.ErrDataNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, secretsplitlock.ErrUnavailable):
+		return http.StatusServiceUnavailable
+	default:
+		// the shares are missing or do not decrypt the primary key of the keystore
+		return http.StatusUnauthorized
+	}
+}
+
+func resolveKeystoreStatus(err error) int {
+	if errors.Is(err, kms.ErrSessionNotFound) || errors.Is(err, kms.ErrInvalidUserAssertion) {
+		return http.StatusUnauthorized
+	}
+
+	return http.StatusInternalServerError
+}
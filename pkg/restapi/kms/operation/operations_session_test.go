@@ -0,0 +1,211 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package operation_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/hyperledger/aries-framework-go/pkg/storage"
+	"github.com/stretchr/testify/require"
+
+	mockkms "github.com/trustbloc/hub-kms/pkg/internal/mock/kms"
+	"github.com/trustbloc/hub-kms/pkg/kms"
+	"github.com/trustbloc/hub-kms/pkg/secretlock/secretsplitlock"
+)
+
+const (
+	unlockEndpoint = "/keystores/{keystoreID}/unlock"
+	lockEndpoint   = "/keystores/{keystoreID}/lock"
+
+	rotateSharesEndpoint = "/keystores/{keystoreID}/rotateshares"
+)
+
+func TestUnlockHandler(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		expiresAt := time.Now().Add(time.Minute).UTC()
+
+		svc := mockKMSService()
+		svc.UnlockKeystoreValue = &kms.Session{Token: "token", ExpiresAt: expiresAt}
+
+		op := newOperation(t, newConfig(withKMSService(svc)))
+		handler := getHandler(t, op, unlockEndpoint, http.MethodPost)
+
+		rr := httptest.NewRecorder()
+		handler.Handle().ServeHTTP(rr, buildSessionReq(unlockEndpoint))
+
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		var resp struct {
+			Token     string    `json:"token"`
+			ExpiresAt time.Time `json:"expiresAt"`
+		}
+
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+		require.Equal(t, "token", resp.Token)
+		require.True(t, expiresAt.Equal(resp.ExpiresAt))
+	})
+
+	tests := []struct {
+		name   string
+		err    error
+		status int
+	}{
+		{name: "keystore without secret shares", err: kms.ErrUnlockNotSupported, status: http.StatusBadRequest},
+		{name: "keystore not found", err: storage.ErrDataNotFound, status: http.StatusNotFound},
+		{name: "share provider unavailable", err: secretsplitlock.ErrUnavailable, status: http.StatusServiceUnavailable},
+		{name: "invalid secret share", err: errors.New("not enough secret shares"), status: http.StatusUnauthorized},
+		{name: "invalid user assertion", err: kms.ErrInvalidUserAssertion, status: http.StatusUnauthorized},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+
+		t.Run("Fail with "+tc.name, func(t *testing.T) {
+			svc := &mockkms.MockService{UnlockKeystoreErr: fmt.Errorf("unlock keystore: %w", tc.err)}
+
+			op := newOperation(t, newConfig(withKMSService(svc)))
+			handler := getHandler(t, op, unlockEndpoint, http.MethodPost)
+
+			rr := httptest.NewRecorder()
+			handler.Handle().ServeHTTP(rr, buildSessionReq(unlockEndpoint))
+
+			require.Equal(t, tc.status, rr.Code)
+			require.Contains(t, rr.Body.String(), "Failed to unlock a keystore")
+		})
+	}
+}
+
+func TestLockHandler(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		op := newOperation(t, newConfig())
+		handler := getHandler(t, op, lockEndpoint, http.MethodPost)
+
+		rr := httptest.NewRecorder()
+		handler.Handle().ServeHTTP(rr, buildSessionReq(lockEndpoint))
+
+		require.Equal(t, http.StatusNoContent, rr.Code)
+	})
+
+	t.Run("Fail with unknown session", func(t *testing.T) {
+		svc := &mockkms.MockService{LockKeystoreErr: fmt.Errorf("lock keystore: %w", kms.ErrSessionNotFound)}
+
+		op := newOperation(t, newConfig(withKMSService(svc)))
+		handler := getHandler(t, op, lockEndpoint, http.MethodPost)
+
+		rr := httptest.NewRecorder()
+		handler.Handle().ServeHTTP(rr, buildSessionReq(lockEndpoint))
+
+		require.Equal(t, http.StatusNotFound, rr.Code)
+		require.Contains(t, rr.Body.String(), "Failed to lock a keystore")
+	})
+
+	t.Run("Fail to lock keystore", func(t *testing.T) {
+		svc := &mockkms.MockService{LockKeystoreErr: errors.New("lock keystore error")}
+
+		op := newOperation(t, newConfig(withKMSService(svc)))
+		handler := getHandler(t, op, lockEndpoint, http.MethodPost)
+
+		rr := httptest.NewRecorder()
+		handler.Handle().ServeHTTP(rr, buildSessionReq(lockEndpoint))
+
+		require.Equal(t, http.StatusInternalServerError, rr.Code)
+	})
+}
+
+func TestRotateSharesHandler(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		svc := mockKMSService()
+		svc.RotateSharesValue = []byte("share")
+
+		op := newOperation(t, newConfig(withKMSService(svc)))
+		handler := getHandler(t, op, rotateSharesEndpoint, http.MethodPost)
+
+		rr := httptest.NewRecorder()
+		handler.Handle().ServeHTTP(rr, buildSessionReq(rotateSharesEndpoint))
+
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		var resp struct {
+			Secret string `json:"secret"`
+		}
+
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+		require.Equal(t, base64.StdEncoding.EncodeToString([]byte("share")), resp.Secret)
+	})
+
+	tests := []struct {
+		name   string
+		err    error
+		status int
+	}{
+		{name: "rotation not supported", err: kms.ErrShareRotationNotSupported, status: http.StatusBadRequest},
+		{name: "keystore not found", err: storage.ErrDataNotFound, status: http.StatusNotFound},
+		{name: "share provider unavailable", err: secretsplitlock.ErrUnavailable, status: http.StatusServiceUnavailable},
+		{name: "invalid user assertion", err: kms.ErrInvalidUserAssertion, status: http.StatusUnauthorized},
+		{name: "invalid secret share", err: errors.New("decrypt primary key"), status: http.StatusUnauthorized},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+
+		t.Run("Fail with "+tc.name, func(t *testing.T) {
+			svc := &mockkms.MockService{RotateSharesErr: fmt.Errorf("rotate secret shares: %w", tc.err)}
+
+			op := newOperation(t, newConfig(withKMSService(svc)))
+			handler := getHandler(t, op, rotateSharesEndpoint, http.MethodPost)
+
+			rr := httptest.NewRecorder()
+			handler.Handle().ServeHTTP(rr, buildSessionReq(rotateSharesEndpoint))
+
+			require.Equal(t, tc.status, rr.Code)
+			require.Contains(t, rr.Body.String(), "Failed to rotate secret shares")
+		})
+	}
+}
+
+func TestResolveKeystoreWithExpiredSession(t *testing.T) {
+	svc := &mockkms.MockService{ResolveKeystoreErr: fmt.Errorf("resolve keystore: %w", kms.ErrSessionNotFound)}
+
+	op := newOperation(t, newConfig(withKMSService(svc)))
+	handler := getHandler(t, op, keysEndpoint, http.MethodPost)
+
+	rr := httptest.NewRecorder()
+	handler.Handle().ServeHTTP(rr, buildCreateKeyReq(t))
+
+	require.Equal(t, http.StatusUnauthorized, rr.Code)
+	require.Contains(t, rr.Body.String(), "session not found or expired")
+}
+
+func TestResolveKeystoreWithInvalidUserAssertion(t *testing.T) {
+	svc := &mockkms.MockService{ResolveKeystoreErr: fmt.Errorf("resolve keystore: %w", kms.ErrInvalidUserAssertion)}
+
+	op := newOperation(t, newConfig(withKMSService(svc)))
+	handler := getHandler(t, op, keysEndpoint, http.MethodPost)
+
+	rr := httptest.NewRecorder()
+	handler.Handle().ServeHTTP(rr, buildCreateKeyReq(t))
+
+	require.Equal(t, http.StatusUnauthorized, rr.Code)
+	require.Contains(t, rr.Body.String(), "invalid user assertion")
+}
+
+func buildSessionReq(endpoint string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, endpoint, nil)
+	req.Header.Set("Hub-Kms-Session", "token")
+
+	return mux.SetURLVars(req, map[string]string{
+		"keystoreID": testKeystoreID,
+	})
+}
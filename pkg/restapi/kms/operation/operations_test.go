@@ -32,6 +32,7 @@ import (
 	mockkms "github.com/trustbloc/hub-kms/pkg/internal/mock/kms"
 	"github.com/trustbloc/hub-kms/pkg/kms"
 	"github.com/trustbloc/hub-kms/pkg/restapi/kms/operation"
+	"github.com/trustbloc/hub-kms/pkg/secretlock/secretsplitlock"
 )
 
 const (
@@ -143,13 +144,13 @@ const (
 )
 
 func TestNew(t *testing.T) {
-	op := operation.New(newConfig())
+	op := newOperation(t, newConfig())
 	require.NotNil(t, op)
 }
 
 func TestCreateKeystoreHandler(t *testing.T) {
 	t.Run("Success", func(t *testing.T) {
-		op := operation.New(newConfig())
+		op := newOperation(t, newConfig())
 		handler := getHandler(t, op, keystoresEndpoint, http.MethodPost)
 
 		rr := httptest.NewRecorder()
@@ -157,6 +158,50 @@ func TestCreateKeystoreHandler(t *testing.T) {
 
 		require.Equal(t, http.StatusCreated, rr.Code)
 		require.NotEmpty(t, rr.Header().Get("Location"))
+		require.Equal(t, `"0"`, rr.Header().Get("ETag"))
+	})
+
+	t.Run("Success with keystore types and vault provisioning", func(t *testing.T) {
+		svc := &mockkms.MockService{CreateKeystoreValue: &kms.KeystoreData{ID: testKeystoreID}}
+
+		op := newOperation(t, newConfig(withKMSService(svc)))
+		handler := getHandler(t, op, keystoresEndpoint, http.MethodPost)
+
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, "",
+			bytes.NewBufferString(`{"controller":"controller","storageType":"edv","secretLockType":"split",`+
+				`"provisionVault":true}`))
+		require.NoError(t, err)
+
+		rr := httptest.NewRecorder()
+		handler.Handle().ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusCreated, rr.Code)
+		require.Equal(t, &kms.CreateKeystoreOptions{
+			StorageType:    kms.StorageTypeEDV,
+			SecretLockType: kms.SecretLockTypeSplit,
+			ProvisionVault: true,
+		}, svc.CreateKeystoreOptions)
+	})
+
+	t.Run("Success with secret shares", func(t *testing.T) {
+		svc := &mockkms.MockService{
+			CreateKeystoreValue: &kms.KeystoreData{ID: testKeystoreID},
+			CreateKeystoreShare: []byte("client share"),
+		}
+
+		op := newOperation(t, newConfig(withKMSService(svc)))
+		handler := getHandler(t, op, keystoresEndpoint, http.MethodPost)
+
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, "",
+			bytes.NewBufferString(`{"controller":"controller","secretShares":{"threshold":2,"providers":["header","peer"]}}`))
+		require.NoError(t, err)
+
+		rr := httptest.NewRecorder()
+		handler.Handle().ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusCreated, rr.Code)
+		require.JSONEq(t, `{"secret":"`+base64.StdEncoding.EncodeToString([]byte("client share"))+`"}`,
+			rr.Body.String())
 	})
 
 	t.Run("Error from create did key", func(t *testing.T) {
@@ -164,7 +209,7 @@ func TestCreateKeystoreHandler(t *testing.T) {
 			return "", fmt.Errorf("failed to create did key")
 		}}
 
-		op := operation.New(newConfig(withAuthService(svc)))
+		op := newOperation(t, newConfig(withAuthService(svc)))
 		handler := getHandler(t, op, keystoresEndpoint, http.MethodPost)
 
 		rr := httptest.NewRecorder()
@@ -178,7 +223,7 @@ func TestCreateKeystoreHandler(t *testing.T) {
 		req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, "", bytes.NewBuffer([]byte("")))
 		require.NoError(t, err)
 
-		op := operation.New(newConfig())
+		op := newOperation(t, newConfig())
 		handler := getHandler(t, op, keystoresEndpoint, http.MethodPost)
 
 		rr := httptest.NewRecorder()
@@ -188,10 +233,73 @@ func TestCreateKeystoreHandler(t *testing.T) {
 		require.Contains(t, rr.Body.String(), "Received bad request: EOF")
 	})
 
+	t.Run("Invalid secret shares", func(t *testing.T) {
+		svc := &mockkms.MockService{CreateKeystoreErr: fmt.Errorf("create keystore: %w", kms.ErrInvalidSecretShares)}
+
+		op := newOperation(t, newConfig(withKMSService(svc)))
+		handler := getHandler(t, op, keystoresEndpoint, http.MethodPost)
+
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, "",
+			bytes.NewBufferString(`{"controller":"controller","secretShares":{"threshold":1,"providers":["header"]}}`))
+		require.NoError(t, err)
+
+		rr := httptest.NewRecorder()
+		handler.Handle().ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Contains(t, rr.Body.String(), "invalid secret shares")
+	})
+
+	t.Run("Share provider unavailable", func(t *testing.T) {
+		svc := &mockkms.MockService{
+			CreateKeystoreErr: fmt.Errorf("create keystore: push secret share to peer: %w", secretsplitlock.ErrUnavailable),
+		}
+
+		op := newOperation(t, newConfig(withKMSService(svc)))
+		handler := getHandler(t, op, keystoresEndpoint, http.MethodPost)
+
+		rr := httptest.NewRecorder()
+		handler.Handle().ServeHTTP(rr, buildCreateKeystoreReq(t))
+
+		require.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	})
+
+	t.Run("Invalid user assertion", func(t *testing.T) {
+		svc := &mockkms.MockService{CreateKeystoreErr: fmt.Errorf("create keystore: %w", kms.ErrInvalidUserAssertion)}
+
+		op := newOperation(t, newConfig(withKMSService(svc)))
+		handler := getHandler(t, op, keystoresEndpoint, http.MethodPost)
+
+		rr := httptest.NewRecorder()
+		handler.Handle().ServeHTTP(rr, buildCreateKeystoreReq(t))
+
+		require.Equal(t, http.StatusUnauthorized, rr.Code)
+	})
+
+	t.Run("Unsupported keystore type", func(t *testing.T) {
+		svc := &mockkms.MockService{
+			CreateKeystoreErr: fmt.Errorf("create keystore: %w: storage type mysql is not allowed",
+				kms.ErrUnsupportedKeystoreType),
+		}
+
+		op := newOperation(t, newConfig(withKMSService(svc)))
+		handler := getHandler(t, op, keystoresEndpoint, http.MethodPost)
+
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, "",
+			bytes.NewBufferString(`{"controller":"controller","storageType":"mysql","secretLockType":"primary"}`))
+		require.NoError(t, err)
+
+		rr := httptest.NewRecorder()
+		handler.Handle().ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Contains(t, rr.Body.String(), "storage type mysql is not allowed")
+	})
+
 	t.Run("Failed to create a keystore", func(t *testing.T) {
 		svc := &mockkms.MockService{CreateKeystoreErr: errors.New("create keystore error")}
 
-		op := operation.New(newConfig(withKMSService(svc)))
+		op := newOperation(t, newConfig(withKMSService(svc)))
 		handler := getHandler(t, op, keystoresEndpoint, http.MethodPost)
 
 		rr := httptest.NewRecorder()
@@ -204,7 +312,7 @@ func TestCreateKeystoreHandler(t *testing.T) {
 	t.Run("internal server error if cannot create zcap", func(t *testing.T) {
 		svc := &mockAuthService{newCapabilityErr: errors.New("test")}
 
-		op := operation.New(newConfig(withAuthService(svc)))
+		op := newOperation(t, newConfig(withAuthService(svc)))
 		handler := getHandler(t, op, keystoresEndpoint, http.MethodPost)
 
 		rr := httptest.NewRecorder()
@@ -217,20 +325,75 @@ func TestCreateKeystoreHandler(t *testing.T) {
 
 func TestUpdateCapabilityHandler(t *testing.T) {
 	t.Run("Success", func(t *testing.T) {
-		op := operation.New(newConfig())
+		op := newOperation(t, newConfig())
 		handler := getHandler(t, op, capabilityEndpoint, http.MethodPost)
 
 		rr := httptest.NewRecorder()
 		handler.Handle().ServeHTTP(rr, buildUpdateCapabilityReq(t, []byte("{}")))
 
 		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, `"1"`, rr.Header().Get("ETag"))
+	})
+
+	t.Run("Success with matching If-Match", func(t *testing.T) {
+		svc := mockKMSService()
+		svc.GetKeystoreDataValue.Revision = 3
+
+		op := newOperation(t, newConfig(withKMSService(svc)))
+		handler := getHandler(t, op, capabilityEndpoint, http.MethodPost)
+
+		for _, ifMatch := range []string{`"3"`, `"2", "3"`, "*"} {
+			svc.GetKeystoreDataValue.Revision = 3
+
+			req := buildUpdateCapabilityReq(t, []byte("{}"))
+			req.Header.Set("If-Match", ifMatch)
+
+			rr := httptest.NewRecorder()
+			handler.Handle().ServeHTTP(rr, req)
+
+			require.Equal(t, http.StatusOK, rr.Code)
+			require.Equal(t, `"4"`, rr.Header().Get("ETag"))
+		}
+	})
+
+	t.Run("Conflict with outdated If-Match", func(t *testing.T) {
+		svc := mockKMSService()
+		svc.GetKeystoreDataValue.Revision = 3
+
+		op := newOperation(t, newConfig(withKMSService(svc)))
+		handler := getHandler(t, op, capabilityEndpoint, http.MethodPost)
+
+		for _, ifMatch := range []string{`"2"`, `W/"3"`} {
+			req := buildUpdateCapabilityReq(t, []byte("{}"))
+			req.Header.Set("If-Match", ifMatch)
+
+			rr := httptest.NewRecorder()
+			handler.Handle().ServeHTTP(rr, req)
+
+			require.Equal(t, http.StatusConflict, rr.Code)
+			require.Contains(t, rr.Body.String(), "If-Match does not match the keystore revision")
+		}
+	})
+
+	t.Run("Conflict with concurrent update", func(t *testing.T) {
+		svc := mockKMSService()
+		svc.SaveKeystoreDataErr = fmt.Errorf("%w: changed", kms.ErrRevisionConflict)
+
+		op := newOperation(t, newConfig(withKMSService(svc)))
+		handler := getHandler(t, op, capabilityEndpoint, http.MethodPost)
+
+		rr := httptest.NewRecorder()
+		handler.Handle().ServeHTTP(rr, buildUpdateCapabilityReq(t, []byte("{}")))
+
+		require.Equal(t, http.StatusConflict, rr.Code)
+		require.Contains(t, rr.Body.String(), "keystore revision conflict")
 	})
 
 	t.Run("test error from get keystore data", func(t *testing.T) {
 		svc := mockKMSService()
 		svc.GetKeystoreDataErr = errors.New("get keystore data error")
 
-		op := operation.New(newConfig(withKMSService(svc)))
+		op := newOperation(t, newConfig(withKMSService(svc)))
 		handler := getHandler(t, op, capabilityEndpoint, http.MethodPost)
 
 		rr := httptest.NewRecorder()
@@ -244,7 +407,7 @@ func TestUpdateCapabilityHandler(t *testing.T) {
 		svc := mockKMSService()
 		svc.SaveKeystoreDataErr = errors.New("save keystore data error")
 
-		op := operation.New(newConfig(withKMSService(svc)))
+		op := newOperation(t, newConfig(withKMSService(svc)))
 		handler := getHandler(t, op, capabilityEndpoint, http.MethodPost)
 
 		rr := httptest.NewRecorder()
@@ -255,7 +418,7 @@ func TestUpdateCapabilityHandler(t *testing.T) {
 	})
 
 	t.Run("test empty capability", func(t *testing.T) {
-		op := operation.New(newConfig())
+		op := newOperation(t, newConfig())
 		handler := getHandler(t, op, capabilityEndpoint, http.MethodPost)
 
 		rr := httptest.NewRecorder()
@@ -268,7 +431,7 @@ func TestUpdateCapabilityHandler(t *testing.T) {
 
 func TestCreateKeyHandler(t *testing.T) {
 	t.Run("Success", func(t *testing.T) {
-		op := operation.New(newConfig())
+		op := newOperation(t, newConfig())
 		handler := getHandler(t, op, keysEndpoint, http.MethodPost)
 
 		rr := httptest.NewRecorder()
@@ -282,7 +445,7 @@ func TestCreateKeyHandler(t *testing.T) {
 		req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, "", bytes.NewBuffer([]byte("")))
 		require.NoError(t, err)
 
-		op := operation.New(newConfig())
+		op := newOperation(t, newConfig())
 		handler := getHandler(t, op, keysEndpoint, http.MethodPost)
 
 		rr := httptest.NewRecorder()
@@ -295,7 +458,7 @@ func TestCreateKeyHandler(t *testing.T) {
 	t.Run("Failed to resolve a keystore", func(t *testing.T) {
 		svc := &mockkms.MockService{ResolveKeystoreErr: errors.New("resolve keystore error")}
 
-		op := operation.New(newConfig(withKMSService(svc)))
+		op := newOperation(t, newConfig(withKMSService(svc)))
 		handler := getHandler(t, op, keysEndpoint, http.MethodPost)
 
 		rr := httptest.NewRecorder()
@@ -309,7 +472,7 @@ func TestCreateKeyHandler(t *testing.T) {
 		svc := &mockkms.MockService{}
 		svc.ResolveKeystoreValue = &keystore.MockKeystore{CreateKeyErr: errors.New("create key error")}
 
-		op := operation.New(newConfig(withKMSService(svc)))
+		op := newOperation(t, newConfig(withKMSService(svc)))
 		handler := getHandler(t, op, keysEndpoint, http.MethodPost)
 
 		rr := httptest.NewRecorder()
@@ -325,7 +488,7 @@ func TestExportKeyHandler(t *testing.T) {
 		svc := mockKMSService()
 		svc.ResolveKeystoreValue = &keystore.MockKeystore{ExportKeyValue: []byte("public key bytes")}
 
-		op := operation.New(newConfig(withKMSService(svc)))
+		op := newOperation(t, newConfig(withKMSService(svc)))
 		handler := getHandler(t, op, exportEndpoint, http.MethodGet)
 
 		rr := httptest.NewRecorder()
@@ -338,7 +501,7 @@ func TestExportKeyHandler(t *testing.T) {
 	t.Run("Failed to resolve a keystore", func(t *testing.T) {
 		svc := &mockkms.MockService{ResolveKeystoreErr: errors.New("resolve keystore error")}
 
-		op := operation.New(newConfig(withKMSService(svc)))
+		op := newOperation(t, newConfig(withKMSService(svc)))
 		handler := getHandler(t, op, exportEndpoint, http.MethodGet)
 
 		rr := httptest.NewRecorder()
@@ -352,7 +515,7 @@ func TestExportKeyHandler(t *testing.T) {
 		svc := mockKMSService()
 		svc.ResolveKeystoreValue = &keystore.MockKeystore{ExportKeyErr: errors.New("export key error")}
 
-		op := operation.New(newConfig(withKMSService(svc)))
+		op := newOperation(t, newConfig(withKMSService(svc)))
 		handler := getHandler(t, op, exportEndpoint, http.MethodGet)
 
 		rr := httptest.NewRecorder()
@@ -368,7 +531,7 @@ func TestSignHandler(t *testing.T) {
 		svc := mockKMSService()
 		svc.SignValue = []byte("signature")
 
-		op := operation.New(newConfig(withKMSService(svc)))
+		op := newOperation(t, newConfig(withKMSService(svc)))
 		handler := getHandler(t, op, signEndpoint, http.MethodPost)
 
 		rr := httptest.NewRecorder()
@@ -382,7 +545,7 @@ func TestSignHandler(t *testing.T) {
 		req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, "", bytes.NewBuffer([]byte("")))
 		require.NoError(t, err)
 
-		op := operation.New(newConfig())
+		op := newOperation(t, newConfig())
 		handler := getHandler(t, op, signEndpoint, http.MethodPost)
 
 		rr := httptest.NewRecorder()
@@ -393,7 +556,7 @@ func TestSignHandler(t *testing.T) {
 	})
 
 	t.Run("Received bad request: bad encoded message", func(t *testing.T) {
-		op := operation.New(newConfig())
+		op := newOperation(t, newConfig())
 		handler := getHandler(t, op, signEndpoint, http.MethodPost)
 
 		rr := httptest.NewRecorder()
@@ -406,7 +569,7 @@ func TestSignHandler(t *testing.T) {
 	t.Run("Failed to resolve a keystore", func(t *testing.T) {
 		svc := &mockkms.MockService{ResolveKeystoreErr: errors.New("resolve keystore error")}
 
-		op := operation.New(newConfig(withKMSService(svc)))
+		op := newOperation(t, newConfig(withKMSService(svc)))
 		handler := getHandler(t, op, signEndpoint, http.MethodPost)
 
 		rr := httptest.NewRecorder()
@@ -420,7 +583,7 @@ func TestSignHandler(t *testing.T) {
 		svc := mockKMSService()
 		svc.ResolveKeystoreValue = &keystore.MockKeystore{GetKeyHandleErr: errors.New("get key handle error")}
 
-		op := operation.New(newConfig(withKMSService(svc)))
+		op := newOperation(t, newConfig(withKMSService(svc)))
 		handler := getHandler(t, op, signEndpoint, http.MethodPost)
 
 		rr := httptest.NewRecorder()
@@ -434,7 +597,7 @@ func TestSignHandler(t *testing.T) {
 		svc := mockKMSService()
 		svc.SignErr = errors.New("sign error")
 
-		op := operation.New(newConfig(withKMSService(svc)))
+		op := newOperation(t, newConfig(withKMSService(svc)))
 		handler := getHandler(t, op, signEndpoint, http.MethodPost)
 
 		rr := httptest.NewRecorder()
@@ -447,7 +610,7 @@ func TestSignHandler(t *testing.T) {
 
 func TestVerifyHandler(t *testing.T) {
 	t.Run("Success", func(t *testing.T) {
-		op := operation.New(newConfig())
+		op := newOperation(t, newConfig())
 		handler := getHandler(t, op, verifyEndpoint, http.MethodPost)
 
 		sig := base64.URLEncoding.EncodeToString([]byte("test signature"))
@@ -464,7 +627,7 @@ func TestVerifyHandler(t *testing.T) {
 		req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, "", bytes.NewBuffer([]byte("")))
 		require.NoError(t, err)
 
-		op := operation.New(newConfig())
+		op := newOperation(t, newConfig())
 		handler := getHandler(t, op, verifyEndpoint, http.MethodPost)
 
 		rr := httptest.NewRecorder()
@@ -475,7 +638,7 @@ func TestVerifyHandler(t *testing.T) {
 	})
 
 	t.Run("Received bad request: bad encoded signature", func(t *testing.T) {
-		op := operation.New(newConfig())
+		op := newOperation(t, newConfig())
 		handler := getHandler(t, op, verifyEndpoint, http.MethodPost)
 
 		msg := base64.URLEncoding.EncodeToString([]byte("test message"))
@@ -489,7 +652,7 @@ func TestVerifyHandler(t *testing.T) {
 	})
 
 	t.Run("Received bad request: bad encoded message", func(t *testing.T) {
-		op := operation.New(newConfig())
+		op := newOperation(t, newConfig())
 		handler := getHandler(t, op, verifyEndpoint, http.MethodPost)
 
 		sig := base64.URLEncoding.EncodeToString([]byte("test signature"))
@@ -505,7 +668,7 @@ func TestVerifyHandler(t *testing.T) {
 	t.Run("Failed to resolve a keystore", func(t *testing.T) {
 		svc := &mockkms.MockService{ResolveKeystoreErr: errors.New("resolve keystore error")}
 
-		op := operation.New(newConfig(withKMSService(svc)))
+		op := newOperation(t, newConfig(withKMSService(svc)))
 		handler := getHandler(t, op, verifyEndpoint, http.MethodPost)
 
 		sig := base64.URLEncoding.EncodeToString([]byte("test signature"))
@@ -523,7 +686,7 @@ func TestVerifyHandler(t *testing.T) {
 		svc := mockKMSService()
 		svc.ResolveKeystoreValue = &keystore.MockKeystore{GetKeyHandleErr: errors.New("get key handle error")}
 
-		op := operation.New(newConfig(withKMSService(svc)))
+		op := newOperation(t, newConfig(withKMSService(svc)))
 		handler := getHandler(t, op, verifyEndpoint, http.MethodPost)
 
 		sig := base64.URLEncoding.EncodeToString([]byte("test signature"))
@@ -541,7 +704,7 @@ func TestVerifyHandler(t *testing.T) {
 		svc := mockKMSService()
 		svc.VerifyErr = errors.New("verify error")
 
-		op := operation.New(newConfig(withKMSService(svc)))
+		op := newOperation(t, newConfig(withKMSService(svc)))
 		handler := getHandler(t, op, verifyEndpoint, http.MethodPost)
 
 		sig := base64.URLEncoding.EncodeToString([]byte("test signature"))
@@ -561,7 +724,7 @@ func TestEncryptHandler(t *testing.T) {
 		svc := mockKMSService()
 		svc.EncryptValue = []byte("cipher text")
 
-		op := operation.New(newConfig(withKMSService(svc)))
+		op := newOperation(t, newConfig(withKMSService(svc)))
 		handler := getHandler(t, op, encryptEndpoint, http.MethodPost)
 
 		msg := base64.URLEncoding.EncodeToString([]byte("test message"))
@@ -579,7 +742,7 @@ func TestEncryptHandler(t *testing.T) {
 		req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, "", bytes.NewBuffer([]byte("")))
 		require.NoError(t, err)
 
-		op := operation.New(newConfig())
+		op := newOperation(t, newConfig())
 		handler := getHandler(t, op, encryptEndpoint, http.MethodPost)
 
 		rr := httptest.NewRecorder()
@@ -590,7 +753,7 @@ func TestEncryptHandler(t *testing.T) {
 	})
 
 	t.Run("Received bad request: bad encoded message", func(t *testing.T) {
-		op := operation.New(newConfig())
+		op := newOperation(t, newConfig())
 		handler := getHandler(t, op, encryptEndpoint, http.MethodPost)
 
 		aad := base64.URLEncoding.EncodeToString([]byte("additional data"))
@@ -604,7 +767,7 @@ func TestEncryptHandler(t *testing.T) {
 	})
 
 	t.Run("Received bad request: bad encoded aad", func(t *testing.T) {
-		op := operation.New(newConfig())
+		op := newOperation(t, newConfig())
 		handler := getHandler(t, op, encryptEndpoint, http.MethodPost)
 
 		msg := base64.URLEncoding.EncodeToString([]byte("test message"))
@@ -620,7 +783,7 @@ func TestEncryptHandler(t *testing.T) {
 	t.Run("Failed to resolve a keystore", func(t *testing.T) {
 		svc := &mockkms.MockService{ResolveKeystoreErr: errors.New("resolve keystore error")}
 
-		op := operation.New(newConfig(withKMSService(svc)))
+		op := newOperation(t, newConfig(withKMSService(svc)))
 		handler := getHandler(t, op, encryptEndpoint, http.MethodPost)
 
 		msg := base64.URLEncoding.EncodeToString([]byte("test message"))
@@ -638,7 +801,7 @@ func TestEncryptHandler(t *testing.T) {
 		svc := mockKMSService()
 		svc.ResolveKeystoreValue = &keystore.MockKeystore{GetKeyHandleErr: errors.New("get key handle error")}
 
-		op := operation.New(newConfig(withKMSService(svc)))
+		op := newOperation(t, newConfig(withKMSService(svc)))
 		handler := getHandler(t, op, encryptEndpoint, http.MethodPost)
 
 		msg := base64.URLEncoding.EncodeToString([]byte("test message"))
@@ -656,7 +819,7 @@ func TestEncryptHandler(t *testing.T) {
 		svc := mockKMSService()
 		svc.EncryptErr = errors.New("encrypt error")
 
-		op := operation.New(newConfig(withKMSService(svc)))
+		op := newOperation(t, newConfig(withKMSService(svc)))
 		handler := getHandler(t, op, encryptEndpoint, http.MethodPost)
 
 		msg := base64.URLEncoding.EncodeToString([]byte("test message"))
@@ -676,7 +839,7 @@ func TestDecryptHandler(t *testing.T) {
 		svc := mockKMSService()
 		svc.DecryptValue = []byte("plain text")
 
-		op := operation.New(newConfig(withKMSService(svc)))
+		op := newOperation(t, newConfig(withKMSService(svc)))
 		handler := getHandler(t, op, decryptEndpoint, http.MethodPost)
 
 		cipherText := base64.URLEncoding.EncodeToString([]byte("test cipher text"))
@@ -695,7 +858,7 @@ func TestDecryptHandler(t *testing.T) {
 		req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, "", bytes.NewBuffer([]byte("")))
 		require.NoError(t, err)
 
-		op := operation.New(newConfig())
+		op := newOperation(t, newConfig())
 		handler := getHandler(t, op, decryptEndpoint, http.MethodPost)
 
 		rr := httptest.NewRecorder()
@@ -706,7 +869,7 @@ func TestDecryptHandler(t *testing.T) {
 	})
 
 	t.Run("Received bad request: bad encoded cipher text", func(t *testing.T) {
-		op := operation.New(newConfig())
+		op := newOperation(t, newConfig())
 		handler := getHandler(t, op, decryptEndpoint, http.MethodPost)
 
 		aad := base64.URLEncoding.EncodeToString([]byte("additional data"))
@@ -721,7 +884,7 @@ func TestDecryptHandler(t *testing.T) {
 	})
 
 	t.Run("Received bad request: bad encoded aad", func(t *testing.T) {
-		op := operation.New(newConfig())
+		op := newOperation(t, newConfig())
 		handler := getHandler(t, op, decryptEndpoint, http.MethodPost)
 
 		cipherText := base64.URLEncoding.EncodeToString([]byte("test cipher text"))
@@ -736,7 +899,7 @@ func TestDecryptHandler(t *testing.T) {
 	})
 
 	t.Run("Received bad request: bad encoded nonce", func(t *testing.T) {
-		op := operation.New(newConfig())
+		op := newOperation(t, newConfig())
 		handler := getHandler(t, op, decryptEndpoint, http.MethodPost)
 
 		cipherText := base64.URLEncoding.EncodeToString([]byte("test cipher text"))
@@ -753,7 +916,7 @@ func TestDecryptHandler(t *testing.T) {
 	t.Run("Failed to resolve a keystore", func(t *testing.T) {
 		svc := &mockkms.MockService{ResolveKeystoreErr: errors.New("resolve keystore error")}
 
-		op := operation.New(newConfig(withKMSService(svc)))
+		op := newOperation(t, newConfig(withKMSService(svc)))
 		handler := getHandler(t, op, decryptEndpoint, http.MethodPost)
 
 		cipherText := base64.URLEncoding.EncodeToString([]byte("test cipher text"))
@@ -772,7 +935,7 @@ func TestDecryptHandler(t *testing.T) {
 		svc := mockKMSService()
 		svc.ResolveKeystoreValue = &keystore.MockKeystore{GetKeyHandleErr: errors.New("get key handle error")}
 
-		op := operation.New(newConfig(withKMSService(svc)))
+		op := newOperation(t, newConfig(withKMSService(svc)))
 		handler := getHandler(t, op, decryptEndpoint, http.MethodPost)
 
 		cipherText := base64.URLEncoding.EncodeToString([]byte("test cipher text"))
@@ -791,7 +954,7 @@ func TestDecryptHandler(t *testing.T) {
 		svc := mockKMSService()
 		svc.DecryptErr = errors.New("decrypt error")
 
-		op := operation.New(newConfig(withKMSService(svc)))
+		op := newOperation(t, newConfig(withKMSService(svc)))
 		handler := getHandler(t, op, decryptEndpoint, http.MethodPost)
 
 		cipherText := base64.URLEncoding.EncodeToString([]byte("test cipher text"))
@@ -812,7 +975,7 @@ func TestComputeMACHandler(t *testing.T) {
 		svc := mockKMSService()
 		svc.ComputeMACValue = []byte("mac")
 
-		op := operation.New(newConfig(withKMSService(svc)))
+		op := newOperation(t, newConfig(withKMSService(svc)))
 		handler := getHandler(t, op, computeMACEndpoint, http.MethodPost)
 
 		data := base64.URLEncoding.EncodeToString([]byte("test data"))
@@ -829,7 +992,7 @@ func TestComputeMACHandler(t *testing.T) {
 		req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, "", bytes.NewBuffer([]byte("")))
 		require.NoError(t, err)
 
-		op := operation.New(newConfig())
+		op := newOperation(t, newConfig())
 		handler := getHandler(t, op, computeMACEndpoint, http.MethodPost)
 
 		rr := httptest.NewRecorder()
@@ -840,7 +1003,7 @@ func TestComputeMACHandler(t *testing.T) {
 	})
 
 	t.Run("Received bad request: bad encoded data", func(t *testing.T) {
-		op := operation.New(newConfig())
+		op := newOperation(t, newConfig())
 		handler := getHandler(t, op, computeMACEndpoint, http.MethodPost)
 
 		rr := httptest.NewRecorder()
@@ -853,7 +1016,7 @@ func TestComputeMACHandler(t *testing.T) {
 	t.Run("Failed to resolve a keystore", func(t *testing.T) {
 		svc := &mockkms.MockService{ResolveKeystoreErr: errors.New("resolve keystore error")}
 
-		op := operation.New(newConfig(withKMSService(svc)))
+		op := newOperation(t, newConfig(withKMSService(svc)))
 		handler := getHandler(t, op, computeMACEndpoint, http.MethodPost)
 
 		data := base64.URLEncoding.EncodeToString([]byte("test data"))
@@ -870,7 +1033,7 @@ func TestComputeMACHandler(t *testing.T) {
 		svc := mockKMSService()
 		svc.ResolveKeystoreValue = &keystore.MockKeystore{GetKeyHandleErr: errors.New("get key handle error")}
 
-		op := operation.New(newConfig(withKMSService(svc)))
+		op := newOperation(t, newConfig(withKMSService(svc)))
 		handler := getHandler(t, op, computeMACEndpoint, http.MethodPost)
 
 		data := base64.URLEncoding.EncodeToString([]byte("test data"))
@@ -887,7 +1050,7 @@ func TestComputeMACHandler(t *testing.T) {
 		svc := mockKMSService()
 		svc.ComputeMACErr = errors.New("compute mac error")
 
-		op := operation.New(newConfig(withKMSService(svc)))
+		op := newOperation(t, newConfig(withKMSService(svc)))
 		handler := getHandler(t, op, computeMACEndpoint, http.MethodPost)
 
 		data := base64.URLEncoding.EncodeToString([]byte("test data"))
@@ -906,7 +1069,7 @@ func TestVerifyMACHandler(t *testing.T) {
 		svc := mockKMSService()
 		svc.ComputeMACValue = []byte("mac")
 
-		op := operation.New(newConfig(withKMSService(svc)))
+		op := newOperation(t, newConfig(withKMSService(svc)))
 		handler := getHandler(t, op, verifyMACEndpoint, http.MethodPost)
 
 		mac := base64.URLEncoding.EncodeToString([]byte("mac"))
@@ -923,7 +1086,7 @@ func TestVerifyMACHandler(t *testing.T) {
 		req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, "", bytes.NewBuffer([]byte("")))
 		require.NoError(t, err)
 
-		op := operation.New(newConfig())
+		op := newOperation(t, newConfig())
 		handler := getHandler(t, op, verifyMACEndpoint, http.MethodPost)
 
 		rr := httptest.NewRecorder()
@@ -934,7 +1097,7 @@ func TestVerifyMACHandler(t *testing.T) {
 	})
 
 	t.Run("Received bad request: bad encoded mac", func(t *testing.T) {
-		op := operation.New(newConfig())
+		op := newOperation(t, newConfig())
 		handler := getHandler(t, op, verifyMACEndpoint, http.MethodPost)
 
 		data := base64.URLEncoding.EncodeToString([]byte("test data"))
@@ -948,7 +1111,7 @@ func TestVerifyMACHandler(t *testing.T) {
 	})
 
 	t.Run("Received bad request: bad encoded data", func(t *testing.T) {
-		op := operation.New(newConfig())
+		op := newOperation(t, newConfig())
 		handler := getHandler(t, op, verifyMACEndpoint, http.MethodPost)
 
 		mac := base64.URLEncoding.EncodeToString([]byte("mac"))
@@ -964,7 +1127,7 @@ func TestVerifyMACHandler(t *testing.T) {
 	t.Run("Failed to resolve a keystore", func(t *testing.T) {
 		svc := &mockkms.MockService{ResolveKeystoreErr: errors.New("resolve keystore error")}
 
-		op := operation.New(newConfig(withKMSService(svc)))
+		op := newOperation(t, newConfig(withKMSService(svc)))
 		handler := getHandler(t, op, verifyMACEndpoint, http.MethodPost)
 
 		mac := base64.URLEncoding.EncodeToString([]byte("mac"))
@@ -982,7 +1145,7 @@ func TestVerifyMACHandler(t *testing.T) {
 		svc := mockKMSService()
 		svc.ResolveKeystoreValue = &keystore.MockKeystore{GetKeyHandleErr: errors.New("get key handle error")}
 
-		op := operation.New(newConfig(withKMSService(svc)))
+		op := newOperation(t, newConfig(withKMSService(svc)))
 		handler := getHandler(t, op, verifyMACEndpoint, http.MethodPost)
 
 		mac := base64.URLEncoding.EncodeToString([]byte("mac"))
@@ -1000,7 +1163,7 @@ func TestVerifyMACHandler(t *testing.T) {
 		svc := mockKMSService()
 		svc.VerifyMACErr = errors.New("verify mac error")
 
-		op := operation.New(newConfig(withKMSService(svc)))
+		op := newOperation(t, newConfig(withKMSService(svc)))
 		handler := getHandler(t, op, verifyMACEndpoint, http.MethodPost)
 
 		mac := base64.URLEncoding.EncodeToString([]byte("mac"))
@@ -1026,7 +1189,7 @@ func (failingResponseWriter) Write(_ []byte) (int, error) {
 func TestFailToWriteResponse(t *testing.T) {
 	logger := &mocklogger.MockLogger{}
 
-	op := operation.New(newConfig(withLogger(logger)))
+	op := newOperation(t, newConfig(withLogger(logger)))
 	handler := getHandler(t, op, signEndpoint, http.MethodPost)
 	req := buildSignReq(t, base64.URLEncoding.EncodeToString([]byte("test message")))
 
@@ -1041,7 +1204,7 @@ func TestFailToWriteErrorResponse(t *testing.T) {
 	svc := &mockkms.MockService{ResolveKeystoreErr: errors.New("resolve keystore error")}
 	logger := &mocklogger.MockLogger{}
 
-	op := operation.New(newConfig(withKMSService(svc), withLogger(logger)))
+	op := newOperation(t, newConfig(withKMSService(svc), withLogger(logger)))
 	handler := getHandler(t, op, keysEndpoint, http.MethodPost)
 	req := buildCreateKeyReq(t)
 
@@ -1232,6 +1395,15 @@ type options struct {
 
 type optionFn func(opts *options)
 
+func newOperation(t *testing.T, config *operation.Config) *operation.Operation {
+	t.Helper()
+
+	op, err := operation.New(config)
+	require.NoError(t, err)
+
+	return op
+}
+
 func newConfig(opts ...optionFn) *operation.Config {
 	cOpts := &options{
 		authService: &mockAuthService{},
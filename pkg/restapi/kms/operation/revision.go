@@ -0,0 +1,48 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package operation
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/trustbloc/hub-kms/pkg/kms"
+)
+
+const (
+	etagHeader    = "ETag"
+	ifMatchHeader = "If-Match"
+)
+
+var errIfMatch = errors.New("If-Match does not match the keystore revision") //nolint:stylecheck // header name
+
+// keystoreETag returns the strong entity tag of the keystore revision.
+func keystoreETag(kd *kms.KeystoreData) string {
+	return strconv.Quote(strconv.Itoa(kd.Revision))
+}
+
+// ifMatch reports whether the If-Match header of the request matches the keystore revision. A request without
+// the header matches any revision. Weak entity tags never match.
+func ifMatch(req *http.Request, kd *kms.KeystoreData) bool {
+	header := req.Header.Get(ifMatchHeader)
+	if header == "" {
+		return true
+	}
+
+	etag := keystoreETag(kd)
+
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+
+	return false
+}
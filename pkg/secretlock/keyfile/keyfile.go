@@ -0,0 +1,287 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+// Package keyfile implements the passphrase-protected master key file of the local secret lock.
+//
+// The file has two lines. The first line is the JSON header with the key derivation function, its parameters,
+// the salt and the nonce. The second line is the base64 URL encoded AES-256-GCM ciphertext of the master key,
+// encrypted under the key derived from the passphrase. The header is authenticated as additional data, so
+// parameters cannot be changed without the passphrase.
+package keyfile
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Key derivation functions.
+const (
+	KDFArgon2id = "argon2id"
+	KDFScrypt   = "scrypt"
+)
+
+// Default KDF parameters.
+const (
+	DefaultArgon2idTime    = 3
+	DefaultArgon2idMemory  = 64 * 1024 // KiB
+	DefaultArgon2idThreads = 4
+	DefaultScryptN         = 1 << 15
+	DefaultScryptR         = 8
+	DefaultScryptP         = 1
+)
+
+const (
+	version   = 1
+	keySize   = 32
+	saltSize  = 16
+	nonceSize = 12
+
+	// upper bound on the KDF memory a header may ask for, protects from crafted files
+	maxKDFMemory = 4 << 30
+)
+
+// ErrInvalidPassphrase is returned when the master key can't be decrypted with the given passphrase.
+var ErrInvalidPassphrase = errors.New("invalid passphrase or corrupted master key file")
+
+// Header is the first line of the key file.
+type Header struct {
+	Version int    `json:"version"`
+	KDF     string `json:"kdf"`
+	Salt    []byte `json:"salt"`
+	Nonce   []byte `json:"nonce"`
+	// argon2id parameters, memory is in KiB
+	Time    uint32 `json:"time,omitempty"`
+	Memory  uint32 `json:"memory,omitempty"`
+	Threads uint8  `json:"threads,omitempty"`
+	// scrypt parameters
+	N int `json:"n,omitempty"`
+	R int `json:"r,omitempty"`
+	P int `json:"p,omitempty"`
+}
+
+// Options configures the KDF used to encrypt the master key.
+type Options struct {
+	kdf     string
+	time    uint32
+	memory  uint32
+	threads uint8
+	n, r, p int
+}
+
+// Option configures Options.
+type Option func(*Options)
+
+// WithArgon2id sets Argon2id parameters: the number of passes, memory in KiB and the degree of parallelism.
+// Argon2id is used by default.
+func WithArgon2id(time, memory uint32, threads uint8) Option {
+	return func(o *Options) {
+		o.kdf = KDFArgon2id
+		o.time, o.memory, o.threads = time, memory, threads
+	}
+}
+
+// WithScrypt selects scrypt with the given CPU/memory cost N, block size r and parallelization p.
+func WithScrypt(n, r, p int) Option {
+	return func(o *Options) {
+		o.kdf = KDFScrypt
+		o.n, o.r, o.p = n, r, p
+	}
+}
+
+// WithKDF selects the KDF by name with default parameters.
+func WithKDF(kdf string) Option {
+	return func(o *Options) {
+		switch kdf {
+		case KDFScrypt:
+			WithScrypt(DefaultScryptN, DefaultScryptR, DefaultScryptP)(o)
+		default:
+			o.kdf = kdf
+		}
+	}
+}
+
+// GenerateKey returns a new random master key.
+func GenerateKey() ([]byte, error) {
+	key := make([]byte, keySize)
+
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("generate master key: %w", err)
+	}
+
+	return key, nil
+}
+
+// IsEncrypted reports whether data is a key file produced by Encrypt rather than a raw base64 master key.
+func IsEncrypted(data []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(data), []byte("{"))
+}
+
+// Encrypt encrypts the master key under the passphrase and returns the content of the key file.
+func Encrypt(masterKey, passphrase []byte, opts ...Option) ([]byte, error) {
+	o := &Options{
+		kdf:     KDFArgon2id,
+		time:    DefaultArgon2idTime,
+		memory:  DefaultArgon2idMemory,
+		threads: DefaultArgon2idThreads,
+	}
+
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	h := &Header{Version: version, KDF: o.kdf, Salt: make([]byte, saltSize), Nonce: make([]byte, nonceSize)}
+
+	switch o.kdf {
+	case KDFArgon2id:
+		h.Time, h.Memory, h.Threads = o.time, o.memory, o.threads
+	case KDFScrypt:
+		h.N, h.R, h.P = o.n, o.r, o.p
+	default:
+		return nil, fmt.Errorf("unsupported KDF: %s", o.kdf)
+	}
+
+	if _, err := rand.Read(h.Salt); err != nil {
+		return nil, fmt.Errorf("generate salt: %w", err)
+	}
+
+	if _, err := rand.Read(h.Nonce); err != nil {
+		return nil, fmt.Errorf("generate nonce: %w", err)
+	}
+
+	headerBytes, err := json.Marshal(h)
+	if err != nil {
+		return nil, fmt.Errorf("marshal header: %w", err)
+	}
+
+	aead, err := newAEAD(h, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	ct := aead.Seal(nil, h.Nonce, masterKey, headerBytes)
+
+	var buf bytes.Buffer
+
+	buf.Write(headerBytes)
+	buf.WriteByte('\n')
+	buf.WriteString(base64.URLEncoding.EncodeToString(ct))
+	buf.WriteByte('\n')
+
+	return buf.Bytes(), nil
+}
+
+// Decrypt decrypts the master key from the content of the key file.
+func Decrypt(data, passphrase []byte) ([]byte, error) {
+	lines := bytes.SplitN(bytes.TrimSpace(data), []byte("\n"), 2) //nolint:gomnd // header and ciphertext
+	if len(lines) != 2 {                                          //nolint:gomnd // header and ciphertext
+		return nil, errors.New("invalid master key file: missing ciphertext")
+	}
+
+	headerBytes := bytes.TrimSpace(lines[0])
+
+	var h Header
+
+	if err := json.Unmarshal(headerBytes, &h); err != nil {
+		return nil, fmt.Errorf("invalid master key file header: %w", err)
+	}
+
+	if h.Version != version {
+		return nil, fmt.Errorf("unsupported master key file version: %d", h.Version)
+	}
+
+	if len(h.Nonce) != nonceSize {
+		return nil, errors.New("invalid master key file header: invalid nonce")
+	}
+
+	ct, err := base64.URLEncoding.DecodeString(string(bytes.TrimSpace(lines[1])))
+	if err != nil {
+		return nil, fmt.Errorf("invalid master key file ciphertext: %w", err)
+	}
+
+	aead, err := newAEAD(&h, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := aead.Open(nil, h.Nonce, ct, headerBytes)
+	if err != nil {
+		return nil, ErrInvalidPassphrase
+	}
+
+	return key, nil
+}
+
+// Rekey re-encrypts the key file under a new passphrase. Options select the KDF of the new file.
+func Rekey(data, oldPassphrase, newPassphrase []byte, opts ...Option) ([]byte, error) {
+	key, err := Decrypt(data, oldPassphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	defer Zeroize(key)
+
+	return Encrypt(key, newPassphrase, opts...)
+}
+
+// Zeroize overwrites b with zeros.
+func Zeroize(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+func newAEAD(h *Header, passphrase []byte) (cipher.AEAD, error) {
+	kek, err := deriveKey(h, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	defer Zeroize(kek)
+
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, fmt.Errorf("create cipher: %w", err)
+	}
+
+	return cipher.NewGCM(block)
+}
+
+func deriveKey(h *Header, passphrase []byte) ([]byte, error) {
+	if len(h.Salt) < saltSize {
+		return nil, errors.New("invalid master key file header: salt is too short")
+	}
+
+	switch h.KDF {
+	case KDFArgon2id:
+		if h.Time == 0 || h.Threads == 0 || uint64(h.Memory)*1024 > maxKDFMemory {
+			return nil, errors.New("invalid argon2id parameters")
+		}
+
+		return argon2.IDKey(passphrase, h.Salt, h.Time, h.Memory, h.Threads, keySize), nil
+	case KDFScrypt:
+		if h.N <= 1 || h.R <= 0 || h.P <= 0 || uint64(h.N)*uint64(h.R)*128 > maxKDFMemory {
+			return nil, errors.New("invalid scrypt parameters")
+		}
+
+		key, err := scrypt.Key(passphrase, h.Salt, h.N, h.R, h.P, keySize)
+		if err != nil {
+			return nil, fmt.Errorf("invalid scrypt parameters: %w", err)
+		}
+
+		return key, nil
+	default:
+		return nil, fmt.Errorf("unsupported KDF: %s", h.KDF)
+	}
+}
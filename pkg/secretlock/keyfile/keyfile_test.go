@@ -0,0 +1,156 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package keyfile_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/hub-kms/pkg/secretlock/keyfile"
+)
+
+// cheap KDF parameters to keep tests fast
+var (
+	fastArgon2id = keyfile.WithArgon2id(1, 64, 1) //nolint:gochecknoglobals // test options
+	fastScrypt   = keyfile.WithScrypt(16, 1, 1)   //nolint:gochecknoglobals // test options
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	key, err := keyfile.GenerateKey()
+	require.NoError(t, err)
+	require.Len(t, key, 32)
+
+	for name, opt := range map[string]keyfile.Option{keyfile.KDFArgon2id: fastArgon2id, keyfile.KDFScrypt: fastScrypt} {
+		opt := opt
+
+		t.Run(name, func(t *testing.T) {
+			data, err := keyfile.Encrypt(key, []byte("passphrase"), opt)
+			require.NoError(t, err)
+			require.True(t, keyfile.IsEncrypted(data))
+
+			var h keyfile.Header
+
+			require.NoError(t, json.Unmarshal(bytes.SplitN(data, []byte("\n"), 2)[0], &h))
+			require.Equal(t, name, h.KDF)
+
+			decrypted, err := keyfile.Decrypt(data, []byte("passphrase"))
+			require.NoError(t, err)
+			require.Equal(t, key, decrypted)
+
+			_, err = keyfile.Decrypt(data, []byte("wrong"))
+			require.True(t, errors.Is(err, keyfile.ErrInvalidPassphrase))
+		})
+	}
+}
+
+func TestIsEncrypted(t *testing.T) {
+	require.False(t, keyfile.IsEncrypted([]byte(base64.URLEncoding.EncodeToString([]byte("raw key")))))
+}
+
+func TestEncrypt(t *testing.T) {
+	t.Run("Fail with unsupported KDF", func(t *testing.T) {
+		_, err := keyfile.Encrypt([]byte("key"), []byte("passphrase"), keyfile.WithKDF("pbkdf2"))
+		require.EqualError(t, err, "unsupported KDF: pbkdf2")
+	})
+
+	t.Run("Default parameters", func(t *testing.T) {
+		data, err := keyfile.Encrypt([]byte("key"), []byte("passphrase"), keyfile.WithKDF(keyfile.KDFScrypt))
+		require.NoError(t, err)
+
+		h := header(t, data)
+		require.Equal(t, keyfile.DefaultScryptN, h.N)
+		require.Equal(t, keyfile.DefaultScryptR, h.R)
+		require.Equal(t, keyfile.DefaultScryptP, h.P)
+	})
+}
+
+func TestDecrypt(t *testing.T) {
+	data, err := keyfile.Encrypt([]byte("key"), []byte("passphrase"), fastArgon2id)
+	require.NoError(t, err)
+
+	t.Run("Fail without ciphertext", func(t *testing.T) {
+		_, err := keyfile.Decrypt(bytes.SplitN(data, []byte("\n"), 2)[0], []byte("passphrase"))
+		require.EqualError(t, err, "invalid master key file: missing ciphertext")
+	})
+
+	t.Run("Fail with invalid header", func(t *testing.T) {
+		_, err := keyfile.Decrypt([]byte("{\nAAAA"), []byte("passphrase"))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "invalid master key file header")
+	})
+
+	t.Run("Fail with unsupported version", func(t *testing.T) {
+		h := header(t, data)
+		h.Version = 2
+
+		_, err := keyfile.Decrypt(withHeader(t, data, h), []byte("passphrase"))
+		require.EqualError(t, err, "unsupported master key file version: 2")
+	})
+
+	t.Run("Fail with excessive KDF memory", func(t *testing.T) {
+		h := header(t, data)
+		h.Memory = 1 << 30
+
+		_, err := keyfile.Decrypt(withHeader(t, data, h), []byte("passphrase"))
+		require.EqualError(t, err, "invalid argon2id parameters")
+	})
+
+	t.Run("Fail if header is modified", func(t *testing.T) {
+		h := header(t, data)
+		h.Time = 2
+
+		_, err := keyfile.Decrypt(withHeader(t, data, h), []byte("passphrase"))
+		require.True(t, errors.Is(err, keyfile.ErrInvalidPassphrase))
+	})
+
+	t.Run("Fail with invalid ciphertext", func(t *testing.T) {
+		_, err := keyfile.Decrypt(append(bytes.SplitN(data, []byte("\n"), 2)[0], []byte("\n!")...),
+			[]byte("passphrase"))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "invalid master key file ciphertext")
+	})
+}
+
+func TestRekey(t *testing.T) {
+	data, err := keyfile.Encrypt([]byte("key"), []byte("old"), fastArgon2id)
+	require.NoError(t, err)
+
+	rekeyed, err := keyfile.Rekey(data, []byte("old"), []byte("new"), fastScrypt)
+	require.NoError(t, err)
+	require.Equal(t, keyfile.KDFScrypt, header(t, rekeyed).KDF)
+
+	key, err := keyfile.Decrypt(rekeyed, []byte("new"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("key"), key)
+
+	_, err = keyfile.Rekey(data, []byte("wrong"), []byte("new"))
+	require.True(t, errors.Is(err, keyfile.ErrInvalidPassphrase))
+}
+
+func header(t *testing.T, data []byte) *keyfile.Header {
+	t.Helper()
+
+	var h keyfile.Header
+
+	require.NoError(t, json.Unmarshal(bytes.SplitN(data, []byte("\n"), 2)[0], &h))
+
+	return &h
+}
+
+func withHeader(t *testing.T, data []byte, h *keyfile.Header) []byte {
+	t.Helper()
+
+	b, err := json.Marshal(h)
+	require.NoError(t, err)
+
+	return append(append(b, '\n'), bytes.SplitN(data, []byte("\n"), 2)[1]...)
+}
@@ -0,0 +1,212 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package pkcs11lock
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/hyperledger/aries-framework-go/pkg/secretlock"
+	"github.com/miekg/pkcs11"
+)
+
+const (
+	ivSize  = 12
+	tagBits = 128
+)
+
+// Config defines the PKCS#11 token and the AES key used by the secret lock.
+type Config struct {
+	// ModulePath is the path to the PKCS#11 library of the HSM, e.g. /usr/lib/softhsm/libsofthsm2.so.
+	ModulePath string
+	// Slot is the ID of the slot with the token.
+	Slot uint
+	// PIN is the user PIN of the token.
+	PIN string
+	// KeyLabel is the label of the AES key in the token.
+	KeyLabel string
+}
+
+// Lock is a secret lock that encrypts and decrypts with the AES key held in the HSM token. Data is encrypted with
+// AES-GCM inside the HSM, the key never leaves the token. Key URIs passed to Encrypt and Decrypt are not used.
+type Lock struct {
+	ctx     *pkcs11.Ctx
+	session pkcs11.SessionHandle
+	key     pkcs11.ObjectHandle
+	mu      sync.Mutex
+}
+
+// New loads the PKCS#11 module, logs in to the token and finds the key. Call Close to release the module. The module
+// is initialized once per process, so only one Lock should be open for the module at a time.
+func New(config *Config) (*Lock, error) {
+	if config.ModulePath == "" || config.KeyLabel == "" {
+		return nil, errors.New("PKCS#11 module path and key label are required")
+	}
+
+	ctx := pkcs11.New(config.ModulePath)
+	if ctx == nil {
+		return nil, fmt.Errorf("load PKCS#11 module %s", config.ModulePath)
+	}
+
+	err := ctx.Initialize()
+	if err != nil && !errors.Is(err, pkcs11.Error(pkcs11.CKR_CRYPTOKI_ALREADY_INITIALIZED)) {
+		ctx.Destroy()
+
+		return nil, fmt.Errorf("initialize PKCS#11 module: %w", err)
+	}
+
+	l, err := open(ctx, config)
+	if err != nil {
+		_ = ctx.Finalize() //nolint:errcheck // open error is returned
+		ctx.Destroy()
+
+		return nil, err
+	}
+
+	return l, nil
+}
+
+func open(ctx *pkcs11.Ctx, config *Config) (*Lock, error) {
+	session, err := ctx.OpenSession(config.Slot, pkcs11.CKF_SERIAL_SESSION)
+	if err != nil {
+		return nil, fmt.Errorf("open session with slot %d: %w", config.Slot, err)
+	}
+
+	err = ctx.Login(session, pkcs11.CKU_USER, config.PIN)
+	if err != nil && !errors.Is(err, pkcs11.Error(pkcs11.CKR_USER_ALREADY_LOGGED_IN)) {
+		_ = ctx.CloseSession(session) //nolint:errcheck // login error is returned
+
+		return nil, fmt.Errorf("login to token: %w", err)
+	}
+
+	key, err := findKey(ctx, session, config.KeyLabel)
+	if err != nil {
+		_ = ctx.CloseSession(session) //nolint:errcheck // find error is returned
+
+		return nil, err
+	}
+
+	return &Lock{ctx: ctx, session: session, key: key}, nil
+}
+
+func findKey(ctx *pkcs11.Ctx, session pkcs11.SessionHandle, label string) (pkcs11.ObjectHandle, error) {
+	template := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_SECRET_KEY),
+		pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, pkcs11.CKK_AES),
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, label),
+	}
+
+	if err := ctx.FindObjectsInit(session, template); err != nil {
+		return 0, fmt.Errorf("find key %s: %w", label, err)
+	}
+
+	objects, _, err := ctx.FindObjects(session, 2) //nolint:gomnd // enough to detect duplicate labels
+	if err != nil {
+		_ = ctx.FindObjectsFinal(session) //nolint:errcheck // find error is returned
+
+		return 0, fmt.Errorf("find key %s: %w", label, err)
+	}
+
+	if err = ctx.FindObjectsFinal(session); err != nil {
+		return 0, fmt.Errorf("find key %s: %w", label, err)
+	}
+
+	switch len(objects) {
+	case 0:
+		return 0, fmt.Errorf("AES key %s is not found in the token", label)
+	case 1:
+		return objects[0], nil
+	default:
+		return 0, fmt.Errorf("more than one AES key with label %s in the token", label)
+	}
+}
+
+// Encrypt encrypts the plaintext with the HSM key. The ciphertext is the base64 URL encoded IV followed by
+// the AES-GCM ciphertext and tag.
+func (l *Lock) Encrypt(_ string, req *secretlock.EncryptRequest) (*secretlock.EncryptResponse, error) {
+	iv := make([]byte, ivSize)
+
+	if _, err := rand.Read(iv); err != nil {
+		return nil, fmt.Errorf("pkcs11 encrypt: generate IV: %w", err)
+	}
+
+	params := pkcs11.NewGCMParams(iv, []byte(req.AdditionalAuthenticatedData), tagBits)
+	defer params.Free()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	err := l.ctx.EncryptInit(l.session, []*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_AES_GCM, params)}, l.key)
+	if err != nil {
+		return nil, fmt.Errorf("pkcs11 encrypt: %w", err)
+	}
+
+	ct, err := l.ctx.Encrypt(l.session, []byte(req.Plaintext))
+	if err != nil {
+		return nil, fmt.Errorf("pkcs11 encrypt: %w", err)
+	}
+
+	// some HSMs ignore the given IV and generate their own
+	if hsmIV := params.IV(); len(hsmIV) == ivSize {
+		iv = hsmIV
+	}
+
+	return &secretlock.EncryptResponse{
+		Ciphertext: base64.URLEncoding.EncodeToString(append(iv, ct...)),
+	}, nil
+}
+
+// Decrypt decrypts the ciphertext with the HSM key.
+func (l *Lock) Decrypt(_ string, req *secretlock.DecryptRequest) (*secretlock.DecryptResponse, error) {
+	b, err := base64.URLEncoding.DecodeString(req.Ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("pkcs11 decrypt: decode ciphertext: %w", err)
+	}
+
+	if len(b) < ivSize+tagBits/8 {
+		return nil, errors.New("pkcs11 decrypt: ciphertext is too short")
+	}
+
+	params := pkcs11.NewGCMParams(b[:ivSize], []byte(req.AdditionalAuthenticatedData), tagBits)
+	defer params.Free()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	err = l.ctx.DecryptInit(l.session, []*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_AES_GCM, params)}, l.key)
+	if err != nil {
+		return nil, fmt.Errorf("pkcs11 decrypt: %w", err)
+	}
+
+	pt, err := l.ctx.Decrypt(l.session, b[ivSize:])
+	if err != nil {
+		return nil, fmt.Errorf("pkcs11 decrypt: %w", err)
+	}
+
+	return &secretlock.DecryptResponse{Plaintext: string(pt)}, nil
+}
+
+// Close closes the session with the token and unloads the PKCS#11 module.
+func (l *Lock) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	defer l.ctx.Destroy()
+
+	if err := l.ctx.CloseSession(l.session); err != nil {
+		return fmt.Errorf("close session: %w", err)
+	}
+
+	if err := l.ctx.Finalize(); err != nil {
+		return fmt.Errorf("finalize PKCS#11 module: %w", err)
+	}
+
+	return nil
+}
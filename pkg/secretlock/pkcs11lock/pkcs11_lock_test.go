@@ -0,0 +1,306 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package pkcs11lock_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	mockstorage "github.com/hyperledger/aries-framework-go/pkg/mock/storage"
+	"github.com/hyperledger/aries-framework-go/pkg/secretlock"
+	"github.com/hyperledger/aries-framework-go/pkg/storage"
+	"github.com/miekg/pkcs11"
+	"github.com/stretchr/testify/require"
+
+	lock "github.com/trustbloc/hub-kms/pkg/secretlock"
+	"github.com/trustbloc/hub-kms/pkg/secretlock/pkcs11lock"
+)
+
+const (
+	tokenLabel = "hub-kms"
+	soPIN      = "12345678"
+	userPIN    = "1234"
+	keyLabel   = "primary-key-lock"
+)
+
+// softHSMConfig is set by TestMain if SoftHSMv2 is installed. Set SOFTHSM2_LIB to the path of libsofthsm2.so
+// if it is not in the default location.
+var softHSMConfig *pkcs11lock.Config //nolint:gochecknoglobals // shared token of the test package
+
+func TestMain(m *testing.M) {
+	dir, err := ioutil.TempDir("", "softhsm")
+	if err != nil {
+		panic(err)
+	}
+
+	if lib := findSoftHSM(); lib != "" {
+		softHSMConfig, err = initToken(lib, dir)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	code := m.Run()
+
+	_ = os.RemoveAll(dir) //nolint:errcheck // temp dir
+
+	os.Exit(code)
+}
+
+func TestNew(t *testing.T) {
+	t.Run("Fail without module path", func(t *testing.T) {
+		_, err := pkcs11lock.New(&pkcs11lock.Config{KeyLabel: keyLabel})
+		require.EqualError(t, err, "PKCS#11 module path and key label are required")
+	})
+
+	t.Run("Fail to load module", func(t *testing.T) {
+		_, err := pkcs11lock.New(&pkcs11lock.Config{ModulePath: "/invalid/libpkcs11.so", KeyLabel: keyLabel})
+		require.EqualError(t, err, "load PKCS#11 module /invalid/libpkcs11.so")
+	})
+
+	t.Run("Fail with invalid PIN", func(t *testing.T) {
+		c := requireSoftHSM(t)
+		c.PIN = "0000"
+
+		_, err := pkcs11lock.New(&c)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "login to token")
+	})
+
+	t.Run("Fail with invalid slot", func(t *testing.T) {
+		c := requireSoftHSM(t)
+		c.Slot++
+
+		_, err := pkcs11lock.New(&c)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "open session with slot")
+	})
+
+	t.Run("Fail if key is not found", func(t *testing.T) {
+		c := requireSoftHSM(t)
+		c.KeyLabel = "unknown"
+
+		_, err := pkcs11lock.New(&c)
+		require.EqualError(t, err, "AES key unknown is not found in the token")
+	})
+}
+
+func TestLock(t *testing.T) {
+	c := requireSoftHSM(t)
+
+	l, err := pkcs11lock.New(&c)
+	require.NoError(t, err)
+
+	defer func() {
+		require.NoError(t, l.Close())
+	}()
+
+	t.Run("Encrypt and decrypt", func(t *testing.T) {
+		enc, err := l.Encrypt("", &secretlock.EncryptRequest{Plaintext: "plaintext"})
+		require.NoError(t, err)
+		require.NotContains(t, enc.Ciphertext, "plaintext")
+
+		dec, err := l.Decrypt("", &secretlock.DecryptRequest{Ciphertext: enc.Ciphertext})
+		require.NoError(t, err)
+		require.Equal(t, "plaintext", dec.Plaintext)
+	})
+
+	t.Run("Associated data is bound to ciphertext", func(t *testing.T) {
+		enc, err := l.Encrypt("", &secretlock.EncryptRequest{Plaintext: "plaintext", AdditionalAuthenticatedData: "aad"})
+		require.NoError(t, err)
+
+		_, err = l.Decrypt("", &secretlock.DecryptRequest{Ciphertext: enc.Ciphertext})
+		require.Error(t, err)
+
+		dec, err := l.Decrypt("", &secretlock.DecryptRequest{Ciphertext: enc.Ciphertext,
+			AdditionalAuthenticatedData: "aad"})
+		require.NoError(t, err)
+		require.Equal(t, "plaintext", dec.Plaintext)
+	})
+
+	t.Run("Fail to decrypt invalid ciphertext", func(t *testing.T) {
+		_, err := l.Decrypt("", &secretlock.DecryptRequest{Ciphertext: "!"})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "pkcs11 decrypt: decode ciphertext")
+
+		_, err = l.Decrypt("", &secretlock.DecryptRequest{Ciphertext: "AAAA"})
+		require.EqualError(t, err, "pkcs11 decrypt: ciphertext is too short")
+	})
+
+	t.Run("Protects primary key", func(t *testing.T) {
+		provider := &secretLockProvider{storageProvider: mockstorage.NewMockStoreProvider(), secretLock: l}
+
+		secLock, err := lock.New("local-lock://keystorekms", provider)
+		require.NoError(t, err)
+
+		enc, err := secLock.Encrypt("", &secretlock.EncryptRequest{Plaintext: "keyset"})
+		require.NoError(t, err)
+
+		// the primary key is loaded from the storage and decrypted in the HSM
+		secLock, err = lock.New("local-lock://keystorekms", provider)
+		require.NoError(t, err)
+
+		dec, err := secLock.Decrypt("", &secretlock.DecryptRequest{Ciphertext: enc.Ciphertext})
+		require.NoError(t, err)
+		require.Equal(t, "keyset", dec.Plaintext)
+	})
+}
+
+func requireSoftHSM(t *testing.T) pkcs11lock.Config {
+	t.Helper()
+
+	if softHSMConfig == nil {
+		t.Skip("SoftHSMv2 is not installed, set SOFTHSM2_LIB to the path of libsofthsm2.so")
+	}
+
+	return *softHSMConfig
+}
+
+func findSoftHSM() string {
+	paths := []string{
+		os.Getenv("SOFTHSM2_LIB"),
+		"/usr/lib/softhsm/libsofthsm2.so",
+		"/usr/local/lib/softhsm/libsofthsm2.so",
+		"/usr/lib/x86_64-linux-gnu/softhsm/libsofthsm2.so",
+		"/usr/lib64/pkcs11/libsofthsm2.so",
+	}
+
+	for _, p := range paths {
+		if p == "" {
+			continue
+		}
+
+		if _, err := os.Stat(p); err == nil {
+			return p
+		}
+	}
+
+	return ""
+}
+
+// initToken initializes a SoftHSM token in dir and generates the AES key in it.
+func initToken(lib, dir string) (*pkcs11lock.Config, error) {
+	conf := filepath.Join(dir, "softhsm2.conf")
+
+	err := ioutil.WriteFile(conf, []byte(fmt.Sprintf("directories.tokendir = %s\nobjectstore.backend = file\n",
+		dir)), 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = os.Setenv("SOFTHSM2_CONF", conf); err != nil {
+		return nil, err
+	}
+
+	ctx := pkcs11.New(lib)
+	if ctx == nil {
+		return nil, fmt.Errorf("load %s", lib)
+	}
+
+	defer ctx.Destroy()
+
+	if err = ctx.Initialize(); err != nil {
+		return nil, err
+	}
+
+	defer ctx.Finalize() //nolint:errcheck // the lock initializes the module again
+
+	slots, err := ctx.GetSlotList(false)
+	if err != nil || len(slots) == 0 {
+		return nil, fmt.Errorf("get slots: %v", err)
+	}
+
+	if err = ctx.InitToken(slots[0], soPIN, tokenLabel); err != nil {
+		return nil, err
+	}
+
+	// SoftHSM moves the initialized token to a new slot
+	slot, err := findSlot(ctx, tokenLabel)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = generateKey(ctx, slot); err != nil {
+		return nil, err
+	}
+
+	return &pkcs11lock.Config{ModulePath: lib, Slot: slot, PIN: userPIN, KeyLabel: keyLabel}, nil
+}
+
+func findSlot(ctx *pkcs11.Ctx, label string) (uint, error) {
+	slots, err := ctx.GetSlotList(true)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, s := range slots {
+		info, err := ctx.GetTokenInfo(s)
+		if err == nil && info.Label == label {
+			return s, nil
+		}
+	}
+
+	return 0, fmt.Errorf("token %s not found", label)
+}
+
+func generateKey(ctx *pkcs11.Ctx, slot uint) error {
+	session, err := ctx.OpenSession(slot, pkcs11.CKF_SERIAL_SESSION|pkcs11.CKF_RW_SESSION)
+	if err != nil {
+		return err
+	}
+
+	defer ctx.CloseSession(session) //nolint:errcheck // test setup
+
+	if err = ctx.Login(session, pkcs11.CKU_SO, soPIN); err != nil {
+		return err
+	}
+
+	if err = ctx.InitPIN(session, userPIN); err != nil {
+		return err
+	}
+
+	if err = ctx.Logout(session); err != nil {
+		return err
+	}
+
+	if err = ctx.Login(session, pkcs11.CKU_USER, userPIN); err != nil {
+		return err
+	}
+
+	defer ctx.Logout(session) //nolint:errcheck // test setup
+
+	_, err = ctx.GenerateKey(session, []*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_AES_KEY_GEN, nil)},
+		[]*pkcs11.Attribute{
+			pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_SECRET_KEY),
+			pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, pkcs11.CKK_AES),
+			pkcs11.NewAttribute(pkcs11.CKA_VALUE_LEN, 32),
+			pkcs11.NewAttribute(pkcs11.CKA_TOKEN, true),
+			pkcs11.NewAttribute(pkcs11.CKA_LABEL, keyLabel),
+			pkcs11.NewAttribute(pkcs11.CKA_ENCRYPT, true),
+			pkcs11.NewAttribute(pkcs11.CKA_DECRYPT, true),
+			pkcs11.NewAttribute(pkcs11.CKA_SENSITIVE, true),
+			pkcs11.NewAttribute(pkcs11.CKA_EXTRACTABLE, false),
+		})
+
+	return err
+}
+
+type secretLockProvider struct {
+	storageProvider storage.Provider
+	secretLock      secretlock.Service
+}
+
+func (p *secretLockProvider) StorageProvider() storage.Provider {
+	return p.storageProvider
+}
+
+func (p *secretLockProvider) SecretLock() secretlock.Service {
+	return p.secretLock
+}
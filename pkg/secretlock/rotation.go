@@ -0,0 +1,405 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package secretlock
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/tink/go/aead"
+	"github.com/google/tink/go/keyset"
+	"github.com/google/tink/go/tink"
+	"github.com/hyperledger/aries-framework-go/pkg/kms/localkms"
+	"github.com/hyperledger/aries-framework-go/pkg/secretlock"
+	"github.com/hyperledger/aries-framework-go/pkg/secretlock/local"
+	"github.com/hyperledger/aries-framework-go/pkg/storage"
+	"github.com/hyperledger/aries-framework-go/pkg/storage/wrapper/prefix"
+)
+
+const (
+	// pendingKeySuffix is appended to the primary key entry to store the new primary key while rotation is in
+	// progress.
+	pendingKeySuffix = "_pending"
+	// previousKeySuffix is appended to the primary key entry to keep the replaced primary key after rotation. It is
+	// used only for decryption.
+	previousKeySuffix = "_previous"
+)
+
+// RotationResult contains the outcome of the primary key rotation.
+type RotationResult struct {
+	// Reencrypted is the number of keysets re-encrypted under the new primary key.
+	Reencrypted int `json:"reencrypted"`
+	// Skipped is the number of keysets that were already encrypted under the new primary key,
+	// e.g. when resuming an interrupted rotation.
+	Skipped int `json:"skipped"`
+	// Foreign is the number of keysets that are encrypted neither under the primary key nor under the previous one,
+	// e.g. keysets of keystores protected by secret shares. They are left as is.
+	Foreign int `json:"foreign"`
+}
+
+// Rotator rotates the primary key of the local secret lock.
+type Rotator struct {
+	keyURI          string
+	primaryKeyStore storage.Store
+	keysetStore     storage.Store
+	primaryKeyLock  secretlock.Service
+}
+
+// NewRotator returns a new Rotator for the primary key identified by keyURI. Keysets encrypted under the primary
+// key are read from the key manager storage (localkms namespace).
+func NewRotator(keyURI string, provider Provider, keyManagerStorage storage.Provider) (*Rotator, error) {
+	primaryKeyStore, err := provider.StorageProvider().OpenStore(primaryKeyStoreName)
+	if err != nil {
+		return nil, fmt.Errorf("open primary key store: %w", err)
+	}
+
+	keysetStore, err := keyManagerStorage.OpenStore(localkms.Namespace)
+	if err != nil {
+		return nil, fmt.Errorf("open keyset store: %w", err)
+	}
+
+	return &Rotator{
+		keyURI:          keyURI,
+		primaryKeyStore: primaryKeyStore,
+		keysetStore:     keysetStore,
+		primaryKeyLock:  provider.SecretLock(),
+	}, nil
+}
+
+// Rotate generates a new primary key, re-encrypts all keysets under it and replaces the current primary key.
+// The new primary key is persisted before any keyset is touched, so an interrupted rotation is resumed by
+// calling Rotate again. Secret locks created with New while rotation is in progress decrypt with both keys.
+//
+// A request that created its secret lock before the rotation may still store a keyset under the replaced primary
+// key after keysets are listed. The replaced primary key is therefore kept for decryption until the next rotation,
+// which re-encrypts such keysets as well.
+func (r *Rotator) Rotate() (*RotationResult, error) {
+	entry := keyEntryInDB(r.keyURI)
+
+	current, err := r.primaryKeyStore.Get(entry)
+	if err != nil {
+		return nil, fmt.Errorf("get primary key: %w", err)
+	}
+
+	pending, err := r.pendingPrimaryKey(entry)
+	if err != nil {
+		return nil, err
+	}
+
+	if bytes.Equal(current, pending) { // interrupted after the swap
+		return &RotationResult{}, r.primaryKeyStore.Delete(entry + pendingKeySuffix)
+	}
+
+	oldLock, err := local.NewService(bytes.NewReader(current), r.primaryKeyLock)
+	if err != nil {
+		return nil, fmt.Errorf("create secret lock for current primary key: %w", err)
+	}
+
+	oldLocks := []secretlock.Service{oldLock}
+
+	previousLock, err := previousPrimaryKeyLock(r.primaryKeyStore, r.primaryKeyLock, entry, current)
+	if err != nil {
+		return nil, err
+	}
+
+	if previousLock != nil {
+		oldLocks = append(oldLocks, previousLock)
+	}
+
+	newLock, err := local.NewService(bytes.NewReader(pending), r.primaryKeyLock)
+	if err != nil {
+		return nil, fmt.Errorf("create secret lock for new primary key: %w", err)
+	}
+
+	result, err := r.reencryptKeysets(oldLocks, newLock)
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.primaryKeyStore.Put(entry+previousKeySuffix, current)
+	if err != nil {
+		return nil, fmt.Errorf("store previous primary key: %w", err)
+	}
+
+	// the swap is a single write, so the primary key is either old or new
+	err = r.primaryKeyStore.Put(entry, pending)
+	if err != nil {
+		return nil, fmt.Errorf("replace primary key: %w", err)
+	}
+
+	err = r.primaryKeyStore.Delete(entry + pendingKeySuffix)
+	if err != nil {
+		return nil, fmt.Errorf("delete pending primary key: %w", err)
+	}
+
+	return result, nil
+}
+
+// pendingPrimaryKey returns the new primary key of the rotation in progress or creates one.
+func (r *Rotator) pendingPrimaryKey(entry string) ([]byte, error) {
+	pending, err := r.primaryKeyStore.Get(entry + pendingKeySuffix)
+	if err == nil {
+		return pending, nil
+	}
+
+	if !errors.Is(err, storage.ErrDataNotFound) {
+		return nil, fmt.Errorf("get pending primary key: %w", err)
+	}
+
+	pending, err = newPrimaryKey(r.primaryKeyStore, r.primaryKeyLock, r.keyURI, entry+pendingKeySuffix)
+	if err != nil {
+		return nil, fmt.Errorf("create new primary key: %w", err)
+	}
+
+	return pending, nil
+}
+
+// previousPrimaryKeyLock returns the secret lock of the primary key replaced by the last rotation or nil if there is
+// no such key.
+func previousPrimaryKeyLock(store storage.Store, primaryKeyLock secretlock.Service, entry string,
+	current []byte) (secretlock.Service, error) {
+	previous, err := store.Get(entry + previousKeySuffix)
+	if errors.Is(err, storage.ErrDataNotFound) || (err == nil && bytes.Equal(previous, current)) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("get previous primary key: %w", err)
+	}
+
+	previousLock, err := local.NewService(bytes.NewReader(previous), primaryKeyLock)
+	if err != nil {
+		return nil, fmt.Errorf("create secret lock for previous primary key: %w", err)
+	}
+
+	return previousLock, nil
+}
+
+func (r *Rotator) reencryptKeysets(oldLocks []secretlock.Service, newLock secretlock.Service) (*RotationResult, error) {
+	oldAEAD := envelopeAEAD(&rotatingLock{current: oldLocks[0], previous: oldLocks[1:]}, r.keyURI)
+	newAEAD := envelopeAEAD(newLock, r.keyURI)
+
+	keys, err := r.keysetIDs()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &RotationResult{}
+
+	for _, k := range keys {
+		b, err := r.keysetStore.Get(k)
+		if err != nil {
+			return nil, fmt.Errorf("get keyset %s: %w", k, err)
+		}
+
+		if _, err = keyset.Read(keyset.NewJSONReader(bytes.NewReader(b)), newAEAD); err == nil {
+			result.Skipped++
+
+			continue
+		}
+
+		kh, err := keyset.Read(keyset.NewJSONReader(bytes.NewReader(b)), oldAEAD)
+		if err != nil {
+			result.Foreign++
+
+			continue
+		}
+
+		buf := new(bytes.Buffer)
+
+		err = kh.Write(keyset.NewJSONWriter(buf), newAEAD)
+		if err != nil {
+			return nil, fmt.Errorf("encrypt keyset %s: %w", k, err)
+		}
+
+		err = r.keysetStore.Put(k, buf.Bytes())
+		if err != nil {
+			return nil, fmt.Errorf("store keyset %s: %w", k, err)
+		}
+
+		result.Reencrypted++
+	}
+
+	return result, nil
+}
+
+// keysetIDs returns storage keys of all keysets. Keys are collected before any keyset is updated, as not every
+// storage iterator tolerates concurrent writes.
+func (r *Rotator) keysetIDs() ([]string, error) {
+	it := r.keysetStore.Iterator(prefix.StorageKIDPrefix, prefix.StorageKIDPrefix+storage.EndKeySuffix)
+	defer it.Release()
+
+	var keys []string
+
+	for it.Next() {
+		keys = append(keys, string(it.Key()))
+	}
+
+	if err := it.Error(); err != nil {
+		return nil, fmt.Errorf("iterate keysets: %w", err)
+	}
+
+	return keys, nil
+}
+
+// envelopeAEAD returns the AEAD used by localkms to encrypt keysets with the secret lock.
+func envelopeAEAD(secLock secretlock.Service, keyURI string) tink.AEAD {
+	return aead.NewKMSEnvelopeAEAD2(aead.AES256GCMKeyTemplate(), &lockAEAD{
+		keyURI:     strings.TrimPrefix(keyURI, localLockPrefix),
+		secretLock: secLock,
+	})
+}
+
+// lockAEAD wraps a secret lock in tink.AEAD the same way as localkms does.
+type lockAEAD struct {
+	keyURI     string
+	secretLock secretlock.Service
+}
+
+func (a *lockAEAD) Encrypt(plaintext, additionalData []byte) ([]byte, error) {
+	resp, err := a.secretLock.Encrypt(a.keyURI, &secretlock.EncryptRequest{
+		Plaintext:                   base64.URLEncoding.EncodeToString(plaintext),
+		AdditionalAuthenticatedData: base64.URLEncoding.EncodeToString(additionalData),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return base64.URLEncoding.DecodeString(resp.Ciphertext)
+}
+
+func (a *lockAEAD) Decrypt(ciphertext, additionalData []byte) ([]byte, error) {
+	resp, err := a.secretLock.Decrypt(a.keyURI, &secretlock.DecryptRequest{
+		Ciphertext:                  base64.URLEncoding.EncodeToString(ciphertext),
+		AdditionalAuthenticatedData: base64.URLEncoding.EncodeToString(additionalData),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return base64.URLEncoding.DecodeString(resp.Plaintext)
+}
+
+// rotatingLock is used while the primary key rotation is in progress or a previous primary key is kept. It encrypts
+// with the current primary key and decrypts with whichever key the ciphertext was encrypted with.
+type rotatingLock struct {
+	current  secretlock.Service
+	previous []secretlock.Service
+}
+
+func (l *rotatingLock) Encrypt(keyURI string, req *secretlock.EncryptRequest) (*secretlock.EncryptResponse, error) {
+	return l.current.Encrypt(keyURI, req)
+}
+
+func (l *rotatingLock) Decrypt(keyURI string, req *secretlock.DecryptRequest) (*secretlock.DecryptResponse, error) {
+	resp, err := l.current.Decrypt(keyURI, req)
+
+	for _, previous := range l.previous {
+		if err == nil {
+			break
+		}
+
+		resp, err = previous.Decrypt(keyURI, req)
+	}
+
+	return resp, err
+}
+
+// RekeyPrimaryKey re-encrypts the primary key identified by keyURI under newLock. The primary key is decrypted with
+// the secret lock of the provider, so the current lock is verified before anything is changed. publish is called
+// after the primary key is re-encrypted and before it is stored, e.g. to distribute new secret shares; the stored
+// primary key is left as is if publish fails. The primary key itself stays the same, so keysets are not touched.
+// Pending and previous primary keys of the rotation are re-encrypted as well.
+func RekeyPrimaryKey(keyURI string, provider Provider, newLock secretlock.Service, publish func() error) error {
+	return RekeyPrimaryKeys([]string{keyURI}, provider, newLock, publish)
+}
+
+// RekeyPrimaryKeys re-encrypts primary keys identified by keyURIs under newLock, e.g. primary keys of all keystores
+// protected by the same secret. Primary keys that are not created yet are skipped, but at least one must exist.
+// All primary keys are decrypted before publish is called and nothing is changed if any of them fails. If a primary
+// key cannot be stored, the primary keys stored before it are restored.
+func RekeyPrimaryKeys(keyURIs []string, provider Provider, newLock secretlock.Service, publish func() error) error {
+	primaryKeyStore, err := provider.StorageProvider().OpenStore(primaryKeyStoreName)
+	if err != nil {
+		return fmt.Errorf("open primary key store: %w", err)
+	}
+
+	var entries []string
+
+	current := make(map[string][]byte)
+	rekeyed := make(map[string][]byte)
+
+	for _, keyURI := range keyURIs {
+		entry := keyEntryInDB(keyURI)
+
+		for _, e := range []string{entry, entry + pendingKeySuffix, entry + previousKeySuffix} {
+			primaryKey, err := primaryKeyStore.Get(e)
+			if errors.Is(err, storage.ErrDataNotFound) {
+				continue
+			}
+
+			if err != nil {
+				return fmt.Errorf("get primary key: %w", err)
+			}
+
+			k, err := rekey(primaryKey, provider.SecretLock(), newLock, keyURI)
+			if err != nil {
+				return err
+			}
+
+			entries = append(entries, e)
+			current[e] = primaryKey
+			rekeyed[e] = k
+		}
+	}
+
+	if len(entries) == 0 {
+		return fmt.Errorf("get primary key: %w", storage.ErrDataNotFound)
+	}
+
+	if err = publish(); err != nil {
+		return err
+	}
+
+	for i, e := range entries {
+		if err = primaryKeyStore.Put(e, rekeyed[e]); err != nil {
+			return restorePrimaryKeys(primaryKeyStore, entries[:i], current, fmt.Errorf("replace primary key: %w", err))
+		}
+	}
+
+	return nil
+}
+
+// restorePrimaryKeys puts back primary keys stored before rekeying failed with err.
+func restorePrimaryKeys(store storage.Store, entries []string, current map[string][]byte, err error) error {
+	for _, e := range entries {
+		if restoreErr := store.Put(e, current[e]); restoreErr != nil {
+			return fmt.Errorf("%w (failed to restore primary key: %v)", err, restoreErr)
+		}
+	}
+
+	return err
+}
+
+// rekey returns the primary key re-encrypted under newLock.
+func rekey(primaryKey []byte, currentLock, newLock secretlock.Service, keyURI string) ([]byte, error) {
+	// local.NewService decrypts the primary key with an empty key URI
+	dec, err := currentLock.Decrypt("", &secretlock.DecryptRequest{Ciphertext: string(primaryKey)})
+	if err != nil {
+		return nil, fmt.Errorf("decrypt primary key: %w", err)
+	}
+
+	enc, err := newLock.Encrypt(keyURI, &secretlock.EncryptRequest{Plaintext: dec.Plaintext})
+	if err != nil {
+		return nil, fmt.Errorf("encrypt primary key: %w", err)
+	}
+
+	return []byte(enc.Ciphertext), nil
+}
@@ -0,0 +1,515 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package secretlock_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	"github.com/hyperledger/aries-framework-go/pkg/kms"
+	mockstorage "github.com/hyperledger/aries-framework-go/pkg/mock/storage"
+	"github.com/hyperledger/aries-framework-go/pkg/secretlock"
+	"github.com/hyperledger/aries-framework-go/pkg/secretlock/local"
+	ariesstorage "github.com/hyperledger/aries-framework-go/pkg/storage"
+	"github.com/hyperledger/aries-framework-go/pkg/storage/mem"
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/hub-kms/pkg/keystore"
+	lock "github.com/trustbloc/hub-kms/pkg/secretlock"
+)
+
+const numKeys = 3
+
+func TestRotator_Rotate(t *testing.T) {
+	t.Run("re-encrypts keysets under new primary key", func(t *testing.T) {
+		env := newRotationEnv(t)
+		keyIDs := env.createKeys(t, numKeys)
+
+		primaryKey := env.primaryKey(t)
+
+		rotator, err := lock.NewRotator(keyURI, env.provider, env.keyManagerStorage)
+		require.NoError(t, err)
+
+		result, err := rotator.Rotate()
+		require.NoError(t, err)
+		require.Equal(t, &lock.RotationResult{Reencrypted: numKeys}, result)
+
+		require.NotEqual(t, primaryKey, env.primaryKey(t))
+		env.requireKeysReadable(t, keyIDs)
+
+		// the previous primary key can no longer decrypt keysets
+		ks := env.keystoreWithPrimaryKey(t, primaryKey)
+		_, err = ks.GetKeyHandle(keyIDs[0])
+		require.Error(t, err)
+	})
+
+	t.Run("resumes interrupted rotation", func(t *testing.T) {
+		env := newRotationEnv(t)
+		keyIDs := env.createKeys(t, numKeys)
+
+		store, err := env.keyManagerStorage.OpenStore("kmsdb")
+		require.NoError(t, err)
+
+		failing := &failingStoreProvider{Provider: env.keyManagerStorage, store: &failingStore{Store: store, putsLeft: 1}}
+
+		rotator, err := lock.NewRotator(keyURI, env.provider, failing)
+		require.NoError(t, err)
+
+		_, err = rotator.Rotate()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "store keyset")
+
+		// keysets are readable while rotation is in progress, new keys are created under the new primary key
+		env.requireKeysReadable(t, keyIDs)
+		keyIDs = append(keyIDs, env.createKeys(t, 1)...)
+
+		rotator, err = lock.NewRotator(keyURI, env.provider, env.keyManagerStorage)
+		require.NoError(t, err)
+
+		result, err := rotator.Rotate()
+		require.NoError(t, err)
+		require.Equal(t, &lock.RotationResult{Reencrypted: numKeys - 1, Skipped: 2}, result)
+
+		env.requireKeysReadable(t, keyIDs)
+	})
+
+	t.Run("completes rotation interrupted after primary key swap", func(t *testing.T) {
+		env := newRotationEnv(t)
+		keyIDs := env.createKeys(t, numKeys)
+
+		primaryKeyStore, err := env.provider.StorageProvider().OpenStore("primarykey")
+		require.NoError(t, err)
+
+		failing := &failingStoreProvider{
+			Provider: env.provider.sp,
+			store:    &failingStore{Store: primaryKeyStore, putsLeft: 3, errDelete: errors.New("delete error")},
+		}
+
+		rotator, err := lock.NewRotator(keyURI, &lockProvider{sp: failing, lock: env.provider.lock},
+			env.keyManagerStorage)
+		require.NoError(t, err)
+
+		_, err = rotator.Rotate()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "delete pending primary key")
+
+		rotator, err = lock.NewRotator(keyURI, env.provider, env.keyManagerStorage)
+		require.NoError(t, err)
+
+		result, err := rotator.Rotate()
+		require.NoError(t, err)
+		require.Equal(t, &lock.RotationResult{}, result)
+
+		env.requireKeysReadable(t, keyIDs)
+	})
+
+	t.Run("keeps keysets stored under replaced primary key readable", func(t *testing.T) {
+		env := newRotationEnv(t)
+		keyIDs := env.createKeys(t, 1)
+
+		// the secret lock of a request that started before the rotation
+		stale := env.keystoreWithPrimaryKey(t, env.primaryKey(t))
+
+		rotator, err := lock.NewRotator(keyURI, env.provider, env.keyManagerStorage)
+		require.NoError(t, err)
+
+		result, err := rotator.Rotate()
+		require.NoError(t, err)
+		require.Equal(t, &lock.RotationResult{Reencrypted: 1}, result)
+
+		keyID, err := stale.CreateKey(kms.ED25519Type)
+		require.NoError(t, err)
+
+		keyIDs = append(keyIDs, keyID)
+		env.requireKeysReadable(t, keyIDs)
+
+		// the next rotation re-encrypts keysets stored under the replaced primary key
+		result, err = rotator.Rotate()
+		require.NoError(t, err)
+		require.Equal(t, &lock.RotationResult{Reencrypted: 2}, result)
+
+		env.requireKeysReadable(t, keyIDs)
+	})
+
+	t.Run("error: store previous primary key", func(t *testing.T) {
+		env := newRotationEnv(t)
+		keyIDs := env.createKeys(t, 1)
+
+		primaryKeyStore, err := env.provider.StorageProvider().OpenStore("primarykey")
+		require.NoError(t, err)
+
+		failing := &failingStoreProvider{
+			Provider: env.provider.sp,
+			store:    &failingStore{Store: primaryKeyStore, putsLeft: 1},
+		}
+
+		rotator, err := lock.NewRotator(keyURI, &lockProvider{sp: failing, lock: env.provider.lock},
+			env.keyManagerStorage)
+		require.NoError(t, err)
+
+		_, err = rotator.Rotate()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "store previous primary key")
+
+		env.requireKeysReadable(t, keyIDs)
+	})
+
+	t.Run("leaves keysets encrypted under other keys", func(t *testing.T) {
+		env := newRotationEnv(t)
+		keyIDs := env.createKeys(t, 1)
+
+		other := newRotationEnv(t)
+		other.keyManagerStorage = env.keyManagerStorage
+		otherKeyIDs := other.createKeys(t, 1)
+
+		rotator, err := lock.NewRotator(keyURI, env.provider, env.keyManagerStorage)
+		require.NoError(t, err)
+
+		result, err := rotator.Rotate()
+		require.NoError(t, err)
+		require.Equal(t, &lock.RotationResult{Reencrypted: 1, Foreign: 1}, result)
+
+		env.requireKeysReadable(t, keyIDs)
+		other.requireKeysReadable(t, otherKeyIDs)
+	})
+
+	t.Run("error: no primary key", func(t *testing.T) {
+		env := newRotationEnv(t)
+
+		rotator, err := lock.NewRotator(keyURI, env.provider, env.keyManagerStorage)
+		require.NoError(t, err)
+
+		_, err = rotator.Rotate()
+		require.Error(t, err)
+		require.True(t, errors.Is(err, ariesstorage.ErrDataNotFound))
+	})
+}
+
+func TestRekeyPrimaryKeys(t *testing.T) {
+	const otherKeyURI = "local-lock://other"
+
+	newLock := func(t *testing.T) secretlock.Service {
+		t.Helper()
+
+		l, err := local.NewService(bytes.NewReader([]byte(base64.URLEncoding.EncodeToString(generateKey()))), nil)
+		require.NoError(t, err)
+
+		return l
+	}
+
+	t.Run("re-encrypts all primary keys", func(t *testing.T) {
+		env := newRotationEnv(t)
+		keyIDs := env.createKeys(t, 1)
+
+		_, err := lock.New(otherKeyURI, env.provider)
+		require.NoError(t, err)
+
+		l := newLock(t)
+
+		err = lock.RekeyPrimaryKeys([]string{keyURI, otherKeyURI, "local-lock://not-created"}, env.provider, l,
+			func() error { return nil })
+		require.NoError(t, err)
+
+		env.provider.lock = l
+		env.requireKeysReadable(t, keyIDs)
+
+		_, err = lock.New(otherKeyURI, env.provider)
+		require.NoError(t, err)
+	})
+
+	t.Run("restores primary keys if one cannot be stored", func(t *testing.T) {
+		env := newRotationEnv(t)
+		keyIDs := env.createKeys(t, 1)
+
+		_, err := lock.New(otherKeyURI, env.provider)
+		require.NoError(t, err)
+
+		primaryKey := env.primaryKey(t)
+
+		primaryKeyStore, err := env.provider.StorageProvider().OpenStore("primarykey")
+		require.NoError(t, err)
+
+		failing := &lockProvider{
+			sp: &failingStoreProvider{
+				Provider: env.provider.sp,
+				store:    &failingKeyStore{Store: primaryKeyStore, key: "other"},
+			},
+			lock: env.provider.lock,
+		}
+
+		err = lock.RekeyPrimaryKeys([]string{keyURI, otherKeyURI}, failing, newLock(t), func() error { return nil })
+		require.EqualError(t, err, "replace primary key: put error")
+
+		require.Equal(t, primaryKey, env.primaryKey(t))
+		env.requireKeysReadable(t, keyIDs)
+	})
+}
+
+func TestNewRotator(t *testing.T) {
+	t.Run("error: open primary key store", func(t *testing.T) {
+		sp := mockstorage.NewMockStoreProvider()
+		sp.ErrOpenStoreHandle = errors.New("open error")
+
+		_, err := lock.NewRotator(keyURI, &lockProvider{sp: sp}, mem.NewProvider())
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "open primary key store")
+	})
+
+	t.Run("error: open keyset store", func(t *testing.T) {
+		sp := mockstorage.NewMockStoreProvider()
+		sp.ErrOpenStoreHandle = errors.New("open error")
+
+		_, err := lock.NewRotator(keyURI, &lockProvider{sp: mem.NewProvider()}, sp)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "open keyset store")
+	})
+}
+
+func TestRekeyPrimaryKey(t *testing.T) {
+	newLock := func(t *testing.T) secretlock.Service {
+		t.Helper()
+
+		l, err := local.NewService(bytes.NewReader([]byte(base64.URLEncoding.EncodeToString(generateKey()))), nil)
+		require.NoError(t, err)
+
+		return l
+	}
+
+	t.Run("keysets are readable with new lock", func(t *testing.T) {
+		env := newRotationEnv(t)
+		keyIDs := env.createKeys(t, numKeys)
+
+		primaryKey := env.primaryKey(t)
+		published := false
+
+		l := newLock(t)
+
+		err := lock.RekeyPrimaryKey(keyURI, env.provider, l, func() error {
+			published = true
+
+			return nil
+		})
+		require.NoError(t, err)
+		require.True(t, published)
+		require.NotEqual(t, primaryKey, env.primaryKey(t))
+
+		env.provider.lock = l
+		env.requireKeysReadable(t, keyIDs)
+	})
+
+	t.Run("re-encrypts previous primary key", func(t *testing.T) {
+		env := newRotationEnv(t)
+		keyIDs := env.createKeys(t, 1)
+
+		stale := env.keystoreWithPrimaryKey(t, env.primaryKey(t))
+
+		rotator, err := lock.NewRotator(keyURI, env.provider, env.keyManagerStorage)
+		require.NoError(t, err)
+
+		_, err = rotator.Rotate()
+		require.NoError(t, err)
+
+		keyID, err := stale.CreateKey(kms.ED25519Type)
+		require.NoError(t, err)
+
+		l := newLock(t)
+
+		err = lock.RekeyPrimaryKey(keyURI, env.provider, l, func() error { return nil })
+		require.NoError(t, err)
+
+		env.provider.lock = l
+		env.requireKeysReadable(t, append(keyIDs, keyID))
+	})
+
+	t.Run("primary key is not replaced if publish fails", func(t *testing.T) {
+		env := newRotationEnv(t)
+		env.createKeys(t, 1)
+
+		primaryKey := env.primaryKey(t)
+
+		err := lock.RekeyPrimaryKey(keyURI, env.provider, newLock(t), func() error {
+			return errors.New("publish error")
+		})
+		require.EqualError(t, err, "publish error")
+		require.Equal(t, primaryKey, env.primaryKey(t))
+	})
+
+	t.Run("error: current lock does not decrypt primary key", func(t *testing.T) {
+		env := newRotationEnv(t)
+		env.createKeys(t, 1)
+
+		env.provider.lock = newLock(t)
+
+		err := lock.RekeyPrimaryKey(keyURI, env.provider, newLock(t), func() error {
+			require.Fail(t, "must not be published")
+
+			return nil
+		})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "decrypt primary key")
+	})
+
+	t.Run("error: primary key not found", func(t *testing.T) {
+		env := newRotationEnv(t)
+
+		err := lock.RekeyPrimaryKey(keyURI, env.provider, newLock(t), func() error { return nil })
+		require.True(t, errors.Is(err, ariesstorage.ErrDataNotFound))
+	})
+}
+
+type rotationEnv struct {
+	provider          *lockProvider
+	keyManagerStorage ariesstorage.Provider
+}
+
+func newRotationEnv(t *testing.T) *rotationEnv {
+	t.Helper()
+
+	masterKey := base64.URLEncoding.EncodeToString(generateKey())
+
+	masterLock, err := local.NewService(bytes.NewReader([]byte(masterKey)), nil)
+	require.NoError(t, err)
+
+	return &rotationEnv{
+		provider:          &lockProvider{sp: mem.NewProvider(), lock: masterLock},
+		keyManagerStorage: mem.NewProvider(),
+	}
+}
+
+func (e *rotationEnv) keystore(t *testing.T) keystore.Keystore {
+	t.Helper()
+
+	secretLock, err := lock.New(keyURI, e.provider)
+	require.NoError(t, err)
+
+	return e.newKeystore(t, secretLock)
+}
+
+func (e *rotationEnv) keystoreWithPrimaryKey(t *testing.T, primaryKey []byte) keystore.Keystore {
+	t.Helper()
+
+	secretLock, err := local.NewService(bytes.NewReader(primaryKey), e.provider.lock)
+	require.NoError(t, err)
+
+	return e.newKeystore(t, secretLock)
+}
+
+func (e *rotationEnv) newKeystore(t *testing.T, secretLock secretlock.Service) keystore.Keystore {
+	t.Helper()
+
+	ks, err := keystore.New(
+		keystore.WithPrimaryKeyURI(keyURI),
+		keystore.WithStorageProvider(e.keyManagerStorage),
+		keystore.WithSecretLock(secretLock),
+	)
+	require.NoError(t, err)
+
+	return ks
+}
+
+func (e *rotationEnv) createKeys(t *testing.T, n int) []string {
+	t.Helper()
+
+	ks := e.keystore(t)
+
+	keyIDs := make([]string, n)
+
+	for i := range keyIDs {
+		keyID, err := ks.CreateKey(kms.ED25519Type)
+		require.NoError(t, err)
+
+		keyIDs[i] = keyID
+	}
+
+	return keyIDs
+}
+
+func (e *rotationEnv) requireKeysReadable(t *testing.T, keyIDs []string) {
+	t.Helper()
+
+	ks := e.keystore(t)
+
+	for _, keyID := range keyIDs {
+		_, err := ks.GetKeyHandle(keyID)
+		require.NoError(t, err)
+	}
+}
+
+func (e *rotationEnv) primaryKey(t *testing.T) []byte {
+	t.Helper()
+
+	store, err := e.provider.sp.OpenStore("primarykey")
+	require.NoError(t, err)
+
+	b, err := store.Get(keyEntryInDB)
+	require.NoError(t, err)
+
+	return b
+}
+
+type lockProvider struct {
+	sp   ariesstorage.Provider
+	lock secretlock.Service
+}
+
+func (p *lockProvider) StorageProvider() ariesstorage.Provider {
+	return p.sp
+}
+
+func (p *lockProvider) SecretLock() secretlock.Service {
+	return p.lock
+}
+
+type failingStoreProvider struct {
+	ariesstorage.Provider
+	store ariesstorage.Store
+}
+
+func (p *failingStoreProvider) OpenStore(string) (ariesstorage.Store, error) {
+	return p.store, nil
+}
+
+// failingStore fails Put after putsLeft successful calls.
+type failingStore struct {
+	ariesstorage.Store
+	putsLeft  int
+	errDelete error
+}
+
+func (s *failingStore) Put(k string, v []byte) error {
+	if s.putsLeft == 0 {
+		return errors.New("put error")
+	}
+
+	s.putsLeft--
+
+	return s.Store.Put(k, v)
+}
+
+func (s *failingStore) Delete(k string) error {
+	if s.errDelete != nil {
+		return s.errDelete
+	}
+
+	return s.Store.Delete(k)
+}
+
+// failingKeyStore fails Put of the given key.
+type failingKeyStore struct {
+	ariesstorage.Store
+	key string
+}
+
+func (s *failingKeyStore) Put(k string, v []byte) error {
+	if k == s.key {
+		return errors.New("put error")
+	}
+
+	return s.Store.Put(k, v)
+}
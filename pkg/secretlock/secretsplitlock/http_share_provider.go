@@ -0,0 +1,232 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package secretsplitlock
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/trustbloc/edge-core/pkg/log"
+)
+
+// tokenExpiryDelta is how long before the expiration the access token is refreshed.
+const tokenExpiryDelta = 10 * time.Second
+
+// OAuth2Config defines OAuth2 client credentials used to get an access token for the share endpoint.
+type OAuth2Config struct {
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+}
+
+// HTTPShareProvider provides secret shares from a generic HTTPS endpoint protected with OAuth2 client credentials.
+// It sends GET <url>?keystoreID=<keystoreID>&sub=<user> and expects {"secret":"<base64-encoded share>"} in response,
+// the same as Hub Auth does. New shares are set with POST to the same URL with the same body.
+type HTTPShareProvider struct {
+	url        string
+	userHeader string
+	oauth2     *OAuth2Config
+	opts       *Options
+
+	mu          sync.Mutex
+	accessToken string
+	expiry      time.Time
+}
+
+// NewHTTPShareProvider returns a new HTTPShareProvider instance. The user is taken from userHeader of the request,
+// if set. Access tokens are not requested if oauth2 is nil.
+func NewHTTPShareProvider(shareURL, userHeader string, oauth2 *OAuth2Config, options ...Option) *HTTPShareProvider {
+	opts := &Options{
+		httpClient: http.DefaultClient,
+		logger:     log.New("hub-kms/secretsplitlock"),
+	}
+
+	for i := range options {
+		options[i](opts)
+	}
+
+	return &HTTPShareProvider{
+		url:        shareURL,
+		userHeader: userHeader,
+		oauth2:     oauth2,
+		opts:       opts,
+	}
+}
+
+// Share fetches the secret share of the keystore from the endpoint.
+func (p *HTTPShareProvider) Share(req *http.Request, keystoreID string) ([]byte, error) {
+	share, err := p.send(req.Context(), func() (*http.Request, error) {
+		return http.NewRequestWithContext(req.Context(), http.MethodGet, p.shareURL(req, keystoreID), nil)
+	}, func(r *http.Request) ([]byte, error) {
+		return doShareRequest(r, p.opts.httpClient, p.opts.logger)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("get secret share from %s: %w", p.url, err)
+	}
+
+	return share, nil
+}
+
+// UpdateShare sets the secret share of the keystore on the endpoint.
+func (p *HTTPShareProvider) UpdateShare(req *http.Request, keystoreID string, share []byte) error {
+	body, err := shareBody(share)
+	if err != nil {
+		return err
+	}
+
+	_, err = p.send(req.Context(), func() (*http.Request, error) {
+		r, e := http.NewRequestWithContext(req.Context(), http.MethodPost, p.shareURL(req, keystoreID),
+			bytes.NewReader(body))
+		if e != nil {
+			return nil, e
+		}
+
+		r.Header.Set("Content-Type", "application/json")
+
+		return r, nil
+	}, func(r *http.Request) ([]byte, error) {
+		return nil, doUpdateRequest(r, p.opts.httpClient, p.opts.logger)
+	})
+	if err != nil {
+		return fmt.Errorf("update secret share on %s: %w", p.url, err)
+	}
+
+	return nil
+}
+
+// shareURL returns the URL of the share of the keystore and the user from the request, if set.
+func (p *HTTPShareProvider) shareURL(req *http.Request, keystoreID string) string {
+	q := url.Values{}
+	q.Set("keystoreID", keystoreID)
+
+	if sub := req.Header.Get(p.userHeader); p.userHeader != "" && sub != "" {
+		q.Set("sub", sub)
+	}
+
+	return p.url + "?" + q.Encode()
+}
+
+// send sends the request built by newRequest with the access token using do and retries it according to the options.
+// The token is requested on each attempt, so a failed token request is retried as well. If the endpoint rejects
+// the token, e.g. because it was revoked before it expired, the token is dropped and the request is sent once more
+// with a new one.
+func (p *HTTPShareProvider) send(ctx context.Context, newRequest func() (*http.Request, error),
+	do func(*http.Request) ([]byte, error)) ([]byte, error) {
+	var token string
+
+	attempt := func() ([]byte, error) {
+		req, err := newRequest()
+		if err != nil {
+			return nil, err
+		}
+
+		if p.oauth2 != nil {
+			token, err = p.token(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("get access token: %w", err)
+			}
+
+			req.Header.Set("authorization", "Bearer "+token)
+		}
+
+		return do(req)
+	}
+
+	share, err := withRetry(ctx, p.opts, attempt)
+	if token == "" || !errors.Is(err, ErrUnauthorized) {
+		return share, err
+	}
+
+	p.dropToken(token)
+
+	return withRetry(ctx, p.opts, attempt)
+}
+
+// dropToken removes the cached access token unless it was already replaced by a concurrent request.
+func (p *HTTPShareProvider) dropToken(token string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.accessToken == token {
+		p.accessToken = ""
+	}
+}
+
+// token returns the cached access token or requests a new one with the client credentials grant. Errors are
+// classified with ErrUnauthorized and ErrUnavailable the same as errors of the share endpoint.
+func (p *HTTPShareProvider) token(ctx context.Context) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.accessToken != "" && time.Now().Add(tokenExpiryDelta).Before(p.expiry) {
+		return p.accessToken, nil
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+
+	if len(p.oauth2.Scopes) > 0 {
+		form.Set("scope", strings.Join(p.oauth2.Scopes, " "))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.oauth2.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(p.oauth2.ClientID), url.QueryEscape(p.oauth2.ClientSecret))
+
+	resp, err := p.opts.httpClient.Do(req)
+	if err != nil {
+		return "", requestError(req, err)
+	}
+
+	defer func() {
+		if e := resp.Body.Close(); e != nil {
+			p.opts.logger.Errorf("failed to close response body")
+		}
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("token endpoint returned status %d", resp.StatusCode)
+
+		// not found means a wrong token URL, not a missing share
+		if kind := classifyStatus(resp.StatusCode); kind != nil && kind != ErrShareNotFound {
+			return "", &shareError{kind: kind, err: err}
+		}
+
+		return "", err
+	}
+
+	var tokenResp struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+
+	if err = json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
+		return "", fmt.Errorf("decode token response: %w", err)
+	}
+
+	if tokenResp.AccessToken == "" {
+		return "", errors.New("no access token in response")
+	}
+
+	p.accessToken = tokenResp.AccessToken
+	p.expiry = time.Now().Add(time.Duration(tokenResp.ExpiresIn) * time.Second)
+
+	return p.accessToken, nil
+}
@@ -0,0 +1,315 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package secretsplitlock_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/hub-kms/pkg/secretlock/secretsplitlock"
+)
+
+const (
+	testClientID     = "client"
+	testClientSecret = "secret"
+	testAccessToken  = "access-token"
+)
+
+func TestHTTPShareProvider(t *testing.T) {
+	t.Run("Success with OAuth2 client credentials", func(t *testing.T) {
+		srv := newShareServer(t)
+		defer srv.Close()
+
+		p := secretsplitlock.NewHTTPShareProvider(srv.URL+"/share", testUserHeader, srv.oauth2Config())
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(testUserHeader, "user")
+
+		for i := 0; i < 2; i++ {
+			share, err := p.Share(req, testKeystoreID)
+			require.NoError(t, err)
+			require.Equal(t, []byte("share"), share)
+		}
+
+		require.Equal(t, 1, srv.tokenRequests, "access token is reused")
+		require.Equal(t, "user", srv.sub)
+	})
+
+	t.Run("Success without OAuth2", func(t *testing.T) {
+		srv := newShareServer(t)
+		srv.noAuth = true
+
+		defer srv.Close()
+
+		p := secretsplitlock.NewHTTPShareProvider(srv.URL+"/share", "", nil)
+
+		share, err := p.Share(httptest.NewRequest(http.MethodGet, "/", nil), testKeystoreID)
+		require.NoError(t, err)
+		require.Equal(t, []byte("share"), share)
+		require.Equal(t, 0, srv.tokenRequests)
+	})
+
+	t.Run("Fail with invalid client credentials", func(t *testing.T) {
+		srv := newShareServer(t)
+		defer srv.Close()
+
+		config := srv.oauth2Config()
+		config.ClientSecret = "invalid"
+
+		p := secretsplitlock.NewHTTPShareProvider(srv.URL+"/share", testUserHeader, config)
+
+		_, err := p.Share(httptest.NewRequest(http.MethodGet, "/", nil), testKeystoreID)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "get access token: token endpoint returned status 401")
+	})
+
+	t.Run("Fail with empty access token", func(t *testing.T) {
+		srv := newShareServer(t)
+		srv.emptyToken = true
+
+		defer srv.Close()
+
+		p := secretsplitlock.NewHTTPShareProvider(srv.URL+"/share", testUserHeader, srv.oauth2Config())
+
+		_, err := p.Share(httptest.NewRequest(http.MethodGet, "/", nil), testKeystoreID)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "no access token in response")
+	})
+
+	t.Run("Fail if share endpoint rejects request", func(t *testing.T) {
+		srv := newShareServer(t)
+		defer srv.Close()
+
+		p := secretsplitlock.NewHTTPShareProvider(srv.URL+"/share", testUserHeader, nil)
+
+		_, err := p.Share(httptest.NewRequest(http.MethodGet, "/", nil), testKeystoreID)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "unauthorized")
+	})
+
+	t.Run("Get new access token if share endpoint rejects the cached one", func(t *testing.T) {
+		srv := newShareServer(t)
+		defer srv.Close()
+
+		p := secretsplitlock.NewHTTPShareProvider(srv.URL+"/share", testUserHeader, srv.oauth2Config())
+
+		_, err := p.Share(httptest.NewRequest(http.MethodGet, "/", nil), testKeystoreID)
+		require.NoError(t, err)
+
+		srv.revoked = srv.issued
+
+		share, err := p.Share(httptest.NewRequest(http.MethodGet, "/", nil), testKeystoreID)
+		require.NoError(t, err)
+		require.Equal(t, []byte("share"), share)
+		require.Equal(t, 2, srv.tokenRequests)
+	})
+
+	t.Run("Fail if share endpoint rejects new access token", func(t *testing.T) {
+		srv := newShareServer(t)
+		srv.rejectAll = true
+
+		defer srv.Close()
+
+		p := secretsplitlock.NewHTTPShareProvider(srv.URL+"/share", testUserHeader, srv.oauth2Config())
+
+		_, err := p.Share(httptest.NewRequest(http.MethodGet, "/", nil), testKeystoreID)
+		require.True(t, errors.Is(err, secretsplitlock.ErrUnauthorized))
+		require.Equal(t, 2, srv.tokenRequests, "new access token is requested once")
+	})
+
+	t.Run("Classify token endpoint errors", func(t *testing.T) {
+		tests := []struct {
+			name   string
+			status int
+			kind   error
+		}{
+			{"unauthorized", http.StatusUnauthorized, secretsplitlock.ErrUnauthorized},
+			{"forbidden", http.StatusForbidden, secretsplitlock.ErrUnauthorized},
+			{"server error", http.StatusInternalServerError, secretsplitlock.ErrUnavailable},
+		}
+
+		for _, tt := range tests {
+			tc := tt
+			t.Run(tc.name, func(t *testing.T) {
+				srv := newShareServer(t)
+				srv.tokenStatus = tc.status
+
+				defer srv.Close()
+
+				p := secretsplitlock.NewHTTPShareProvider(srv.URL+"/share", testUserHeader, srv.oauth2Config(),
+					secretsplitlock.WithRetry(1, time.Millisecond))
+
+				_, err := p.Share(httptest.NewRequest(http.MethodGet, "/", nil), testKeystoreID)
+				require.True(t, errors.Is(err, tc.kind))
+				require.False(t, errors.Is(err, secretsplitlock.ErrShareNotFound))
+			})
+		}
+
+		srv := newShareServer(t)
+		srv.tokenStatus = http.StatusNotFound
+
+		defer srv.Close()
+
+		p := secretsplitlock.NewHTTPShareProvider(srv.URL+"/share", testUserHeader, srv.oauth2Config())
+
+		_, err := p.Share(httptest.NewRequest(http.MethodGet, "/", nil), testKeystoreID)
+		require.Error(t, err)
+		require.False(t, errors.Is(err, secretsplitlock.ErrShareNotFound), "wrong token URL is not a missing share")
+	})
+
+	t.Run("Retry failed token request", func(t *testing.T) {
+		srv := newShareServer(t)
+		srv.tokenStatus = http.StatusServiceUnavailable
+		srv.tokenFailures = 1
+
+		defer srv.Close()
+
+		p := secretsplitlock.NewHTTPShareProvider(srv.URL+"/share", testUserHeader, srv.oauth2Config(),
+			secretsplitlock.WithRetry(1, time.Millisecond))
+
+		share, err := p.Share(httptest.NewRequest(http.MethodGet, "/", nil), testKeystoreID)
+		require.NoError(t, err)
+		require.Equal(t, []byte("share"), share)
+		require.Equal(t, 2, srv.tokenRequests)
+	})
+
+	t.Run("Update share", func(t *testing.T) {
+		srv := newShareServer(t)
+		defer srv.Close()
+
+		p := secretsplitlock.NewHTTPShareProvider(srv.URL+"/share", testUserHeader, srv.oauth2Config())
+
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		req.Header.Set(testUserHeader, "user")
+
+		require.NoError(t, p.UpdateShare(req, testKeystoreID, []byte("new share")))
+		require.Equal(t, []byte("new share"), srv.stored)
+		require.Equal(t, "user", srv.sub)
+	})
+
+	t.Run("Fail to update share if endpoint rejects request", func(t *testing.T) {
+		srv := newShareServer(t)
+		defer srv.Close()
+
+		p := secretsplitlock.NewHTTPShareProvider(srv.URL+"/share", testUserHeader, nil)
+
+		err := p.UpdateShare(httptest.NewRequest(http.MethodPost, "/", nil), testKeystoreID, []byte("new share"))
+		require.True(t, errors.Is(err, secretsplitlock.ErrUnauthorized))
+		require.Nil(t, srv.stored)
+	})
+
+	t.Run("Fail with unreachable token endpoint", func(t *testing.T) {
+		p := secretsplitlock.NewHTTPShareProvider("https://share.example.com", testUserHeader,
+			&secretsplitlock.OAuth2Config{TokenURL: " invalid"})
+
+		_, err := p.Share(httptest.NewRequest(http.MethodGet, "/", nil), testKeystoreID)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "get access token")
+	})
+}
+
+type shareServer struct {
+	*httptest.Server
+	t             *testing.T
+	noAuth        bool
+	emptyToken    bool
+	rejectAll     bool
+	tokenStatus   int
+	tokenFailures int // number of token requests failed with tokenStatus, all if zero
+	tokenRequests int
+	issued        string
+	revoked       string
+	sub           string
+	stored        []byte
+}
+
+func newShareServer(t *testing.T) *shareServer {
+	t.Helper()
+
+	s := &shareServer{t: t}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", s.tokenHandler)
+	mux.HandleFunc("/share", s.shareHandler)
+
+	s.Server = httptest.NewServer(mux)
+
+	return s
+}
+
+func (s *shareServer) oauth2Config() *secretsplitlock.OAuth2Config {
+	return &secretsplitlock.OAuth2Config{
+		TokenURL:     s.URL + "/token",
+		ClientID:     testClientID,
+		ClientSecret: testClientSecret,
+		Scopes:       []string{"shares"},
+	}
+}
+
+func (s *shareServer) tokenHandler(rw http.ResponseWriter, req *http.Request) {
+	s.tokenRequests++
+
+	if s.tokenStatus != 0 && (s.tokenFailures == 0 || s.tokenRequests <= s.tokenFailures) {
+		rw.WriteHeader(s.tokenStatus)
+
+		return
+	}
+
+	id, secret, ok := req.BasicAuth()
+	if !ok || id != testClientID || secret != testClientSecret {
+		rw.WriteHeader(http.StatusUnauthorized)
+
+		return
+	}
+
+	require.NoError(s.t, req.ParseForm())
+	require.Equal(s.t, "client_credentials", req.PostForm.Get("grant_type"))
+	require.Equal(s.t, "shares", req.PostForm.Get("scope"))
+
+	token := testAccessToken + strconv.Itoa(s.tokenRequests)
+	if s.emptyToken {
+		token = ""
+	}
+
+	s.issued = token
+
+	require.NoError(s.t, json.NewEncoder(rw).Encode(map[string]interface{}{
+		"access_token": token,
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+	}))
+}
+
+func (s *shareServer) shareHandler(rw http.ResponseWriter, req *http.Request) {
+	token := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+
+	if !s.noAuth && (s.rejectAll || !strings.HasPrefix(token, testAccessToken) || token == s.revoked) {
+		rw.WriteHeader(http.StatusUnauthorized)
+		_, _ = rw.Write([]byte("unauthorized")) //nolint:errcheck // test
+
+		return
+	}
+
+	require.Equal(s.t, testKeystoreID, req.URL.Query().Get("keystoreID"))
+	s.sub = req.URL.Query().Get("sub")
+
+	if req.Method == http.MethodPost {
+		s.stored = readShare(s.t, req)
+
+		return
+	}
+
+	writeShare(s.t, rw, []byte("share"))
+}
@@ -0,0 +1,219 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package secretsplitlock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultCircuitBreakerFailures is the default number of consecutive failures that open the circuit breaker.
+const DefaultCircuitBreakerFailures = 5
+
+var (
+	// ErrShareNotFound is returned when the provider has no secret share for the user or keystore.
+	ErrShareNotFound = errors.New("secret share not found")
+	// ErrUnauthorized is returned when the provider rejects credentials used to get the secret share.
+	ErrUnauthorized = errors.New("unauthorized to get secret share")
+	// ErrUnavailable is returned when the provider is unreachable, fails with a server error or the circuit breaker
+	// is open. Requests failed with this error are retried.
+	ErrUnavailable = errors.New("secret share provider unavailable")
+)
+
+// shareError classifies the underlying error with one of ErrShareNotFound, ErrUnauthorized or ErrUnavailable.
+// The message is kept as is.
+type shareError struct {
+	kind error
+	err  error
+}
+
+func (e *shareError) Error() string {
+	return e.err.Error()
+}
+
+func (e *shareError) Unwrap() error {
+	return e.err
+}
+
+func (e *shareError) Is(target error) bool {
+	return e.kind == target
+}
+
+// classifyStatus returns the kind of error for the HTTP status code of the share response.
+func classifyStatus(code int) error {
+	switch {
+	case code == http.StatusNotFound:
+		return ErrShareNotFound
+	case code == http.StatusUnauthorized || code == http.StatusForbidden:
+		return ErrUnauthorized
+	case code == http.StatusTooManyRequests || code >= http.StatusInternalServerError:
+		return ErrUnavailable
+	default:
+		return nil
+	}
+}
+
+// shareErrors is a list of errors from share providers. It matches a target if any of the errors does.
+type shareErrors []error
+
+func (e shareErrors) Error() string {
+	msgs := make([]string, len(e))
+
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+
+	return strings.Join(msgs, "; ")
+}
+
+func (e shareErrors) Is(target error) bool {
+	for _, err := range e {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// WithRetry sets the number of retries of the share request failed with ErrUnavailable. The delay between retries
+// starts at backoff and doubles with each retry. Retries stop when the request context is done.
+func WithRetry(maxRetries int, backoff time.Duration) Option {
+	return func(o *Options) {
+		o.maxRetries = maxRetries
+		o.backoff = backoff
+	}
+}
+
+// WithCircuitBreaker sets the circuit breaker used for share requests. The same circuit breaker should be shared
+// by all requests to the provider.
+func WithCircuitBreaker(cb *CircuitBreaker) Option {
+	return func(o *Options) {
+		o.circuitBreaker = cb
+	}
+}
+
+// CircuitBreaker stops requests to the share provider after a number of consecutive failures. When open interval
+// passes, one request is let through and closes the circuit breaker on success.
+type CircuitBreaker struct {
+	failureThreshold int
+	openInterval     time.Duration
+
+	mu       sync.Mutex
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// NewCircuitBreaker returns a new CircuitBreaker instance.
+func NewCircuitBreaker(failureThreshold int, openInterval time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		failureThreshold: failureThreshold,
+		openInterval:     openInterval,
+	}
+}
+
+// allow returns an error if the circuit breaker is open.
+func (cb *CircuitBreaker) allow() error {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if cb.failures < cb.failureThreshold {
+		return nil
+	}
+
+	if time.Since(cb.openedAt) < cb.openInterval || cb.probing {
+		return &shareError{kind: ErrUnavailable, err: errors.New("circuit breaker is open")}
+	}
+
+	cb.probing = true
+
+	return nil
+}
+
+// done records the result of the request. Requests canceled by the caller or timed out by the caller's deadline tell
+// nothing about the provider, so they are not counted.
+func (cb *CircuitBreaker) done(err error) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.probing = false
+
+	switch {
+	case errors.Is(err, ErrUnavailable):
+	case errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded):
+		return
+	default:
+		cb.failures = 0
+
+		return
+	}
+
+	cb.failures++
+
+	if cb.failures >= cb.failureThreshold {
+		cb.openedAt = time.Now()
+	}
+}
+
+// requestError classifies the error of the HTTP client with ErrUnavailable. If the request context is done, i.e. the
+// caller canceled the request or its deadline exceeded, the context error is returned as is, so the request is neither
+// retried nor counted by the circuit breaker.
+func requestError(req *http.Request, err error) error {
+	if ctxErr := req.Context().Err(); ctxErr != nil {
+		return ctxErr
+	}
+
+	return &shareError{kind: ErrUnavailable, err: err}
+}
+
+// withRetry calls fn until it succeeds, fails with an error other than ErrUnavailable or retries are exhausted.
+func withRetry(ctx context.Context, opts *Options, fn func() ([]byte, error)) ([]byte, error) {
+	backoff := opts.backoff
+
+	for attempt := 0; ; attempt++ {
+		share, err := callWithCircuitBreaker(opts.circuitBreaker, fn)
+		if err == nil || !errors.Is(err, ErrUnavailable) || attempt >= opts.maxRetries {
+			return share, err
+		}
+
+		opts.logger.Debugf("secret share request failed, retrying in %s: %s", backoff, err)
+
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < backoff {
+			return nil, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("%w: %s", err, ctx.Err())
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+	}
+}
+
+func callWithCircuitBreaker(cb *CircuitBreaker, fn func() ([]byte, error)) ([]byte, error) {
+	if cb == nil {
+		return fn()
+	}
+
+	if err := cb.allow(); err != nil {
+		return nil, err
+	}
+
+	share, err := fn()
+
+	cb.done(err)
+
+	return share, err
+}
@@ -0,0 +1,305 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package secretsplitlock_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/hub-kms/pkg/secretlock/secretsplitlock"
+)
+
+func TestHubAuthShareProvider_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		kind   error
+	}{
+		{name: "share not found", status: http.StatusNotFound, kind: secretsplitlock.ErrShareNotFound},
+		{name: "unauthorized", status: http.StatusUnauthorized, kind: secretsplitlock.ErrUnauthorized},
+		{name: "forbidden", status: http.StatusForbidden, kind: secretsplitlock.ErrUnauthorized},
+		{name: "server error", status: http.StatusInternalServerError, kind: secretsplitlock.ErrUnavailable},
+		{name: "too many requests", status: http.StatusTooManyRequests, kind: secretsplitlock.ErrUnavailable},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tc.name, func(t *testing.T) {
+			srv := newStatusServer(tc.status)
+			defer srv.Close()
+
+			p := secretsplitlock.NewHubAuthShareProvider(srv.URL, "token", testUserHeader)
+
+			_, err := p.Share(newUserRequest(context.Background()), testKeystoreID)
+			require.Error(t, err)
+			require.True(t, errors.Is(err, tc.kind))
+			require.Contains(t, err.Error(), http.StatusText(tc.status))
+		})
+	}
+
+	t.Run("transport error is unavailable", func(t *testing.T) {
+		p := secretsplitlock.NewHubAuthShareProvider("https://hub-auth.example.com", "token", testUserHeader,
+			secretsplitlock.WithHTTPClient(&mockHTTPClient{
+				DoFunc: func(req *http.Request) (*http.Response, error) {
+					return nil, errors.New("response error")
+				},
+			}))
+
+		_, err := p.Share(newUserRequest(context.Background()), testKeystoreID)
+		require.True(t, errors.Is(err, secretsplitlock.ErrUnavailable))
+	})
+
+	t.Run("other status is not classified", func(t *testing.T) {
+		srv := newStatusServer(http.StatusBadRequest)
+		defer srv.Close()
+
+		p := secretsplitlock.NewHubAuthShareProvider(srv.URL, "token", testUserHeader)
+
+		_, err := p.Share(newUserRequest(context.Background()), testKeystoreID)
+		require.Error(t, err)
+		require.False(t, errors.Is(err, secretsplitlock.ErrShareNotFound))
+		require.False(t, errors.Is(err, secretsplitlock.ErrUnauthorized))
+		require.False(t, errors.Is(err, secretsplitlock.ErrUnavailable))
+	})
+
+	t.Run("threshold lock keeps error kinds of providers", func(t *testing.T) {
+		srv := newStatusServer(http.StatusNotFound)
+		defer srv.Close()
+
+		p := secretsplitlock.NewHubAuthShareProvider(srv.URL, "token", testUserHeader)
+
+		_, err := secretsplitlock.NewThresholdLock(newUserRequest(context.Background()), testKeystoreID, 2,
+			[]secretsplitlock.ShareProvider{&mockShareProvider{err: errors.New("header error")}, p})
+		require.Error(t, err)
+		require.True(t, errors.Is(err, secretsplitlock.ErrShareNotFound))
+		require.Contains(t, err.Error(), "header error")
+	})
+}
+
+func TestWithRetry(t *testing.T) {
+	t.Run("Retries transient failures", func(t *testing.T) {
+		var calls int32
+
+		srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			if atomic.AddInt32(&calls, 1) < 3 {
+				rw.WriteHeader(http.StatusServiceUnavailable)
+
+				return
+			}
+
+			writeShare(t, rw, []byte("share"))
+		}))
+		defer srv.Close()
+
+		p := secretsplitlock.NewHubAuthShareProvider(srv.URL, "token", testUserHeader,
+			secretsplitlock.WithRetry(2, time.Millisecond))
+
+		share, err := p.Share(newUserRequest(context.Background()), testKeystoreID)
+		require.NoError(t, err)
+		require.Equal(t, []byte("share"), share)
+		require.Equal(t, int32(3), atomic.LoadInt32(&calls))
+	})
+
+	t.Run("Fail when retries are exhausted", func(t *testing.T) {
+		srv, calls := newCountingStatusServer(http.StatusBadGateway)
+		defer srv.Close()
+
+		p := secretsplitlock.NewHubAuthShareProvider(srv.URL, "token", testUserHeader,
+			secretsplitlock.WithRetry(2, time.Millisecond))
+
+		_, err := p.Share(newUserRequest(context.Background()), testKeystoreID)
+		require.True(t, errors.Is(err, secretsplitlock.ErrUnavailable))
+		require.Equal(t, int32(3), atomic.LoadInt32(calls))
+	})
+
+	t.Run("Does not retry permanent failures", func(t *testing.T) {
+		srv, calls := newCountingStatusServer(http.StatusUnauthorized)
+		defer srv.Close()
+
+		p := secretsplitlock.NewHubAuthShareProvider(srv.URL, "token", testUserHeader,
+			secretsplitlock.WithRetry(2, time.Millisecond))
+
+		_, err := p.Share(newUserRequest(context.Background()), testKeystoreID)
+		require.True(t, errors.Is(err, secretsplitlock.ErrUnauthorized))
+		require.Equal(t, int32(1), atomic.LoadInt32(calls))
+	})
+
+	t.Run("Stops retrying when backoff exceeds request deadline", func(t *testing.T) {
+		srv, calls := newCountingStatusServer(http.StatusServiceUnavailable)
+		defer srv.Close()
+
+		p := secretsplitlock.NewHubAuthShareProvider(srv.URL, "token", testUserHeader,
+			secretsplitlock.WithRetry(5, time.Minute))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		_, err := p.Share(newUserRequest(ctx), testKeystoreID)
+		require.True(t, errors.Is(err, secretsplitlock.ErrUnavailable))
+		require.Equal(t, int32(1), atomic.LoadInt32(calls))
+	})
+
+	t.Run("Stops retrying when request is canceled", func(t *testing.T) {
+		srv, _ := newCountingStatusServer(http.StatusServiceUnavailable)
+		defer srv.Close()
+
+		p := secretsplitlock.NewHubAuthShareProvider(srv.URL, "token", testUserHeader,
+			secretsplitlock.WithRetry(5, time.Minute))
+
+		ctx, cancel := context.WithCancel(context.Background())
+
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			cancel()
+		}()
+
+		_, err := p.Share(newUserRequest(ctx), testKeystoreID)
+		require.True(t, errors.Is(err, secretsplitlock.ErrUnavailable))
+		require.Contains(t, err.Error(), context.Canceled.Error())
+	})
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	t.Run("Opens after consecutive failures and closes after successful probe", func(t *testing.T) {
+		var failing int32 = 1
+
+		var calls int32
+
+		srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			atomic.AddInt32(&calls, 1)
+
+			if atomic.LoadInt32(&failing) == 1 {
+				rw.WriteHeader(http.StatusInternalServerError)
+
+				return
+			}
+
+			writeShare(t, rw, []byte("share"))
+		}))
+		defer srv.Close()
+
+		openInterval := 100 * time.Millisecond
+
+		p := secretsplitlock.NewHubAuthShareProvider(srv.URL, "token", testUserHeader,
+			secretsplitlock.WithCircuitBreaker(secretsplitlock.NewCircuitBreaker(2, openInterval)))
+
+		for i := 0; i < 2; i++ {
+			_, err := p.Share(newUserRequest(context.Background()), testKeystoreID)
+			require.True(t, errors.Is(err, secretsplitlock.ErrUnavailable))
+		}
+
+		_, err := p.Share(newUserRequest(context.Background()), testKeystoreID)
+		require.True(t, errors.Is(err, secretsplitlock.ErrUnavailable))
+		require.Contains(t, err.Error(), "circuit breaker is open")
+		require.Equal(t, int32(2), atomic.LoadInt32(&calls))
+
+		atomic.StoreInt32(&failing, 0)
+		time.Sleep(openInterval)
+
+		share, err := p.Share(newUserRequest(context.Background()), testKeystoreID)
+		require.NoError(t, err)
+		require.Equal(t, []byte("share"), share)
+
+		_, err = p.Share(newUserRequest(context.Background()), testKeystoreID)
+		require.NoError(t, err)
+		require.Equal(t, int32(4), atomic.LoadInt32(&calls))
+	})
+
+	t.Run("Requests canceled by the caller do not open circuit breaker", func(t *testing.T) {
+		var blocking int32 = 1
+
+		var calls int32
+
+		srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			atomic.AddInt32(&calls, 1)
+
+			if atomic.LoadInt32(&blocking) == 1 {
+				<-req.Context().Done()
+
+				return
+			}
+
+			writeShare(t, rw, []byte("share"))
+		}))
+		defer srv.Close()
+
+		p := secretsplitlock.NewHubAuthShareProvider(srv.URL, "token", testUserHeader,
+			secretsplitlock.WithRetry(2, time.Millisecond),
+			secretsplitlock.WithCircuitBreaker(secretsplitlock.NewCircuitBreaker(1, time.Minute)))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		_, err := p.Share(newUserRequest(ctx), testKeystoreID)
+		require.True(t, errors.Is(err, context.DeadlineExceeded))
+		require.False(t, errors.Is(err, secretsplitlock.ErrUnavailable))
+
+		ctx, cancel = context.WithCancel(context.Background())
+
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			cancel()
+		}()
+
+		_, err = p.Share(newUserRequest(ctx), testKeystoreID)
+		require.True(t, errors.Is(err, context.Canceled))
+		require.Equal(t, int32(2), atomic.LoadInt32(&calls), "canceled requests are not retried")
+
+		atomic.StoreInt32(&blocking, 0)
+
+		share, err := p.Share(newUserRequest(context.Background()), testKeystoreID)
+		require.NoError(t, err)
+		require.Equal(t, []byte("share"), share)
+		require.Equal(t, int32(3), atomic.LoadInt32(&calls))
+	})
+
+	t.Run("Permanent failures do not open circuit breaker", func(t *testing.T) {
+		srv, calls := newCountingStatusServer(http.StatusNotFound)
+		defer srv.Close()
+
+		p := secretsplitlock.NewHubAuthShareProvider(srv.URL, "token", testUserHeader,
+			secretsplitlock.WithCircuitBreaker(secretsplitlock.NewCircuitBreaker(1, time.Minute)))
+
+		for i := 0; i < 3; i++ {
+			_, err := p.Share(newUserRequest(context.Background()), testKeystoreID)
+			require.True(t, errors.Is(err, secretsplitlock.ErrShareNotFound))
+		}
+
+		require.Equal(t, int32(3), atomic.LoadInt32(calls))
+	})
+}
+
+func newUserRequest(ctx context.Context) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+	req.Header.Set(testUserHeader, "user")
+
+	return req
+}
+
+func newStatusServer(status int) *httptest.Server {
+	srv, _ := newCountingStatusServer(status)
+
+	return srv
+}
+
+func newCountingStatusServer(status int) (*httptest.Server, *int32) {
+	var calls int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		http.Error(rw, http.StatusText(status), status)
+	}))
+
+	return srv, &calls
+}
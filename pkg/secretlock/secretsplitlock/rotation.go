@@ -0,0 +1,154 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package secretsplitlock
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/hyperledger/aries-framework-go/pkg/secretlock"
+	"github.com/trustbloc/edge-core/pkg/log"
+	"github.com/trustbloc/edge-core/pkg/sss/base"
+
+	"github.com/trustbloc/hub-kms/pkg/internal/support"
+)
+
+// secretSize is the size of the random secret generated by NewSecretShares.
+const secretSize = 32
+
+// ShareUpdater is implemented by share providers that store secret shares set by hub-kms, e.g. when the keystore
+// with the k-of-n secret split lock is created or when shares of the keystore are rotated.
+type ShareUpdater interface {
+	UpdateShare(req *http.Request, keystoreID string, share []byte) error
+}
+
+// UserShares is implemented by share providers that keep one share per user instead of one per keystore. Such a
+// share is common to all keystores of the user, so replacing it affects all of them.
+type UserShares interface {
+	PerUser() bool
+}
+
+// NewSecretShares generates a new random secret and splits it into n shares, any threshold of which combine into
+// the secret. It returns the shares and the secret lock based on the secret.
+func NewSecretShares(threshold, n int, options ...Option) ([][]byte, secretlock.Service, error) {
+	opts := &Options{secretSplitter: &base.Splitter{}}
+
+	for i := range options {
+		options[i](opts)
+	}
+
+	secret := make([]byte, secretSize)
+
+	if _, err := rand.Read(secret); err != nil {
+		return nil, nil, fmt.Errorf("generate secret: %w", err)
+	}
+
+	shares, err := opts.secretSplitter.Split(secret, n, threshold)
+	if err != nil {
+		return nil, nil, fmt.Errorf("split secret: %w", err)
+	}
+
+	secLock, err := newMasterLock(shares[:threshold], opts.secretSplitter)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return shares, secLock, nil
+}
+
+// PerUser returns true as Hub Auth keeps one share per user.
+func (p *HubAuthShareProvider) PerUser() bool {
+	return true
+}
+
+// UpdateShare sets the secret share of the user from the request header in Hub Auth. The share is sent with
+// POST /secret?sub={user} authenticated with the API token, and replaces the cached share on success.
+func (p *HubAuthShareProvider) UpdateShare(req *http.Request, _ string, share []byte) error {
+	sub := req.Header.Get(p.userHeader)
+	if sub == "" {
+		return fmt.Errorf("empty user in the %s header", p.userHeader)
+	}
+
+	body, err := shareBody(share)
+	if err != nil {
+		return err
+	}
+
+	uri := fmt.Sprintf("%s%s?sub=%s", p.url, hubAuthSecretPath, url.QueryEscape(sub))
+
+	_, err = withRetry(req.Context(), p.opts, func() ([]byte, error) {
+		r, e := http.NewRequestWithContext(req.Context(), http.MethodPost, uri, bytes.NewReader(body))
+		if e != nil {
+			return nil, e
+		}
+
+		r.Header.Set("Content-Type", "application/json")
+		r.Header.Set("authorization",
+			fmt.Sprintf("Bearer %s", base64.StdEncoding.EncodeToString([]byte(p.apiToken))),
+		)
+
+		return nil, doUpdateRequest(r, p.opts.httpClient, p.opts.logger)
+	})
+	if err != nil {
+		return fmt.Errorf("update secret share in hub auth: %w", err)
+	}
+
+	if p.opts.cacheProvider == nil {
+		return nil
+	}
+
+	cache, err := p.opts.cacheProvider.OpenStore(cacheStore)
+	if err != nil {
+		return fmt.Errorf("open cache store: %w", err)
+	}
+
+	if err = cache.Put(sub, share); err != nil {
+		return fmt.Errorf("save to cache: %w", err)
+	}
+
+	return nil
+}
+
+// shareBody returns the body of the request that sets the secret share, the same as the response with the share.
+func shareBody(share []byte) ([]byte, error) {
+	return json.Marshal(map[string]string{"secret": base64.StdEncoding.EncodeToString(share)})
+}
+
+// doUpdateRequest sends the request that sets the secret share. The share is accepted with 200 OK or 204 No Content.
+func doUpdateRequest(req *http.Request, httpClient support.HTTPClient, logger log.Logger) error {
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return requestError(req, err)
+	}
+
+	defer func() {
+		if e := resp.Body.Close(); e != nil {
+			logger.Errorf("failed to close response body")
+		}
+	}()
+
+	if resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("read response body: %s", err)
+	}
+
+	if kind := classifyStatus(resp.StatusCode); kind != nil {
+		return &shareError{kind: kind, err: fmt.Errorf("%s", b)}
+	}
+
+	return fmt.Errorf("%s", b)
+}
@@ -0,0 +1,147 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package secretsplitlock_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	mockstorage "github.com/hyperledger/aries-framework-go/pkg/mock/storage"
+	"github.com/hyperledger/aries-framework-go/pkg/secretlock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/hub-kms/pkg/secretlock/secretsplitlock"
+)
+
+func TestNewSecretShares(t *testing.T) {
+	t.Run("Shares unlock the secret lock", func(t *testing.T) {
+		shares, secLock, err := secretsplitlock.NewSecretShares(2, 3)
+		require.NoError(t, err)
+		require.Len(t, shares, 3)
+
+		enc, err := secLock.Encrypt("", &secretlock.EncryptRequest{Plaintext: testPlaintext})
+		require.NoError(t, err)
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		providers := []secretsplitlock.ShareProvider{
+			&mockShareProvider{share: shares[2]},
+			&mockShareProvider{share: shares[0]},
+		}
+
+		l, err := secretsplitlock.NewThresholdLock(req, testKeystoreID, 2, providers)
+		require.NoError(t, err)
+
+		dec, err := l.Decrypt("", &secretlock.DecryptRequest{Ciphertext: enc.Ciphertext})
+		require.NoError(t, err)
+		require.Equal(t, testPlaintext, dec.Plaintext)
+	})
+
+	t.Run("Fail to split secret", func(t *testing.T) {
+		_, _, err := secretsplitlock.NewSecretShares(3, 2)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "split secret")
+	})
+}
+
+func TestHubAuthShareProvider_UpdateShare(t *testing.T) {
+	var stored []byte
+
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		require.Equal(t, http.MethodPost, req.Method)
+		require.Equal(t, "/secret", req.URL.Path)
+		require.Equal(t, "user", req.URL.Query().Get("sub"))
+		require.Equal(t, "Bearer "+base64.StdEncoding.EncodeToString([]byte("token")), req.Header.Get("Authorization"))
+
+		var body struct {
+			Secret string `json:"secret"`
+		}
+
+		require.NoError(t, json.NewDecoder(req.Body).Decode(&body))
+
+		var err error
+
+		stored, err = base64.StdEncoding.DecodeString(body.Secret)
+		require.NoError(t, err)
+
+		rw.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	newRequest := func() *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		req.Header.Set(testUserHeader, "user")
+
+		return req
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		cache := mockstorage.NewMockStoreProvider()
+		cache.Store.Store["user"] = []byte("old share")
+
+		p := secretsplitlock.NewHubAuthShareProvider(srv.URL, "token", testUserHeader,
+			secretsplitlock.WithCacheProvider(cache))
+
+		require.NoError(t, p.UpdateShare(newRequest(), testKeystoreID, []byte("new share")))
+		require.Equal(t, []byte("new share"), stored)
+		require.Equal(t, []byte("new share"), cache.Store.Store["user"], "cached share is replaced")
+	})
+
+	t.Run("Share is kept per user", func(t *testing.T) {
+		var p secretsplitlock.ShareProvider = secretsplitlock.NewHubAuthShareProvider(srv.URL, "token", testUserHeader)
+
+		u, ok := p.(secretsplitlock.UserShares)
+		require.True(t, ok)
+		require.True(t, u.PerUser())
+	})
+
+	t.Run("Fail with empty user header", func(t *testing.T) {
+		p := secretsplitlock.NewHubAuthShareProvider(srv.URL, "token", testUserHeader)
+
+		err := p.UpdateShare(httptest.NewRequest(http.MethodPost, "/", nil), testKeystoreID, []byte("share"))
+		require.EqualError(t, err, "empty user in the Hub-Kms-User header")
+	})
+
+	t.Run("Fail with unauthorized", func(t *testing.T) {
+		p := secretsplitlock.NewHubAuthShareProvider(srv.URL, "token", testUserHeader,
+			secretsplitlock.WithHTTPClient(&mockHTTPClient{
+				DoFunc: func(req *http.Request) (*http.Response, error) {
+					return &http.Response{
+						StatusCode: http.StatusUnauthorized,
+						Body:       ioutil.NopCloser(bytes.NewReader([]byte("unauthorized"))),
+					}, nil
+				},
+			}))
+
+		err := p.UpdateShare(newRequest(), testKeystoreID, []byte("share"))
+		require.True(t, errors.Is(err, secretsplitlock.ErrUnauthorized))
+		require.Contains(t, err.Error(), "update secret share in hub auth: unauthorized")
+	})
+
+	t.Run("Retry if Hub Auth is unavailable", func(t *testing.T) {
+		calls := 0
+
+		p := secretsplitlock.NewHubAuthShareProvider(srv.URL, "token", testUserHeader,
+			secretsplitlock.WithRetry(1, 0),
+			secretsplitlock.WithHTTPClient(&mockHTTPClient{
+				DoFunc: func(req *http.Request) (*http.Response, error) {
+					calls++
+
+					return nil, errors.New("connection refused")
+				},
+			}))
+
+		err := p.UpdateShare(newRequest(), testKeystoreID, []byte("share"))
+		require.True(t, errors.Is(err, secretsplitlock.ErrUnavailable))
+		require.Equal(t, 2, calls)
+	})
+}
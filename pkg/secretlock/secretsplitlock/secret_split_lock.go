@@ -16,6 +16,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"time"
 
 	"github.com/hyperledger/aries-framework-go/pkg/secretlock"
 	"github.com/hyperledger/aries-framework-go/pkg/secretlock/local/masterlock/hkdf"
@@ -25,6 +26,7 @@ import (
 	"github.com/trustbloc/edge-core/pkg/sss/base"
 
 	"github.com/trustbloc/hub-kms/pkg/internal/support"
+	kmscache "github.com/trustbloc/hub-kms/pkg/storage/cache"
 )
 
 const (
@@ -45,13 +47,16 @@ type Options struct {
 	secretSplitter sss.SecretSplitter
 	logger         log.Logger
 	cacheProvider  ariesstorage.Provider
+	maxRetries     int
+	backoff        time.Duration
+	circuitBreaker *CircuitBreaker
 }
 
 // Option configures Options.
 type Option func(options *Options)
 
-// New returns a new secret split lock instance.
-func New(secret []byte, params *HubAuthParams, options ...Option) (secretlock.Service, error) {
+// New returns a new secret split lock instance. The server share is fetched from Hub Auth within ctx.
+func New(ctx context.Context, secret []byte, params *HubAuthParams, options ...Option) (secretlock.Service, error) {
 	opts := &Options{
 		httpClient:     http.DefaultClient,
 		secretSplitter: &base.Splitter{},
@@ -62,7 +67,7 @@ func New(secret []byte, params *HubAuthParams, options ...Option) (secretlock.Se
 		options[i](opts)
 	}
 
-	return createSecretSplitLock(secret, params, opts)
+	return createSecretSplitLock(ctx, secret, params, opts)
 }
 
 // WithHTTPClient sets the custom HTTP client.
@@ -93,13 +98,14 @@ func WithCacheProvider(p ariesstorage.Provider) Option {
 	}
 }
 
-func createSecretSplitLock(secret []byte, params *HubAuthParams, opts *Options) (secretlock.Service, error) {
+func createSecretSplitLock(ctx context.Context, secret []byte, params *HubAuthParams,
+	opts *Options) (secretlock.Service, error) {
 	if secret == nil {
 		return nil, errors.New("empty secret share")
 	}
 
 	fetchFunc := func() ([]byte, error) {
-		return fetch(params.URL, params.APIToken, params.Subject, opts.httpClient, opts.logger)
+		return fetch(ctx, params.URL, params.APIToken, params.Subject, opts)
 	}
 
 	share, err := getSecretShare(params.Subject, opts.cacheProvider, fetchFunc)
@@ -107,12 +113,33 @@ func createSecretSplitLock(secret []byte, params *HubAuthParams, opts *Options)
 		return nil, fmt.Errorf("get secret share: %w", err)
 	}
 
-	combined, err := opts.secretSplitter.Combine([][]byte{secret, share})
+	return newMasterLock([][]byte{secret, share}, opts.secretSplitter)
+}
+
+// newMasterLock returns a secret lock based on the secret combined from the given shares.
+func newMasterLock(shares [][]byte, splitter sss.SecretSplitter) (secretlock.Service, error) {
+	combined, err := combineShares(shares, splitter)
+	if err != nil {
+		return nil, err
+	}
+
+	defer Zeroize(combined)
+
+	return NewSecretLock(combined)
+}
+
+func combineShares(shares [][]byte, splitter sss.SecretSplitter) ([]byte, error) {
+	combined, err := splitter.Combine(shares)
 	if err != nil {
 		return nil, fmt.Errorf("combine secrets: %w", err)
 	}
 
-	secLock, err := hkdf.NewMasterLock(string(combined), sha256.New, nil)
+	return combined, nil
+}
+
+// NewSecretLock returns a secret lock based on the combined secret. The secret is not kept by the lock.
+func NewSecretLock(secret []byte) (secretlock.Service, error) {
+	secLock, err := hkdf.NewMasterLock(string(secret), sha256.New, nil)
 	if err != nil {
 		return nil, fmt.Errorf("new master lock: %w", err)
 	}
@@ -120,6 +147,13 @@ func createSecretSplitLock(secret []byte, params *HubAuthParams, opts *Options)
 	return secLock, nil
 }
 
+// Zeroize overwrites the secret with zeros.
+func Zeroize(secret []byte) {
+	for i := range secret {
+		secret[i] = 0
+	}
+}
+
 func getSecretShare(cacheKey string, cacheProvider ariesstorage.Provider,
 	fetchFunc func() ([]byte, error)) ([]byte, error) {
 	if cacheProvider == nil {
@@ -136,8 +170,16 @@ func getSecretShare(cacheKey string, cacheProvider ariesstorage.Provider,
 		return cachedSecret, nil
 	}
 
+	if errors.Is(getErr, kmscache.ErrCachedNotFound) {
+		return nil, fmt.Errorf("%w: cached", ErrShareNotFound)
+	}
+
 	if errors.Is(getErr, ariesstorage.ErrDataNotFound) {
 		secret, fetchErr := fetchFunc()
+		if errors.Is(fetchErr, ErrShareNotFound) {
+			cacheNotFound(cache, cacheKey)
+		}
+
 		if fetchErr != nil {
 			return nil, fetchErr
 		}
@@ -153,21 +195,41 @@ func getSecretShare(cacheKey string, cacheProvider ariesstorage.Provider,
 	return nil, fmt.Errorf("get from cache: %w", getErr)
 }
 
-func fetch(serverURL, apiToken, subject string, httpClient support.HTTPClient, logger log.Logger) ([]byte, error) {
+// cacheNotFound remembers a missing share if the cache supports negative caching, so that Hub Auth is not queried
+// again for the share until the negative entry expires.
+func cacheNotFound(cache ariesstorage.Store, cacheKey string) {
+	nc, ok := cache.(kmscache.NegativeCache)
+	if !ok {
+		return
+	}
+
+	_ = nc.PutNotFound(cacheKey) // best effort, the share is fetched again on error
+}
+
+// fetch gets the secret share of the subject from Hub Auth. The request is bound to ctx and retried according to
+// the options.
+func fetch(ctx context.Context, serverURL, apiToken, subject string, opts *Options) ([]byte, error) {
 	uri := fmt.Sprintf("%s%s?sub=%s", serverURL, hubAuthSecretPath, url.QueryEscape(subject))
 
-	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, uri, nil)
-	if err != nil {
-		return nil, err
-	}
+	return withRetry(ctx, opts, func() ([]byte, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		req.Header.Set("authorization",
+			fmt.Sprintf("Bearer %s", base64.StdEncoding.EncodeToString([]byte(apiToken))),
+		)
 
-	req.Header.Set("authorization",
-		fmt.Sprintf("Bearer %s", base64.StdEncoding.EncodeToString([]byte(apiToken))),
-	)
+		return doShareRequest(req, opts.httpClient, opts.logger)
+	})
+}
 
+// doShareRequest sends the request for a secret share and decodes the share from the response.
+func doShareRequest(req *http.Request, httpClient support.HTTPClient, logger log.Logger) ([]byte, error) {
 	resp, err := httpClient.Do(req)
 	if err != nil {
-		return nil, err
+		return nil, requestError(req, err)
 	}
 
 	defer func() {
@@ -183,6 +245,10 @@ func fetch(serverURL, apiToken, subject string, httpClient support.HTTPClient, l
 			return nil, fmt.Errorf("read response body: %s", errRead)
 		}
 
+		if kind := classifyStatus(resp.StatusCode); kind != nil {
+			return nil, &shareError{kind: kind, err: fmt.Errorf("%s", body)}
+		}
+
 		return nil, fmt.Errorf("%s", body)
 	}
 
@@ -8,6 +8,7 @@ package secretsplitlock_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
@@ -15,6 +16,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"testing"
+	"time"
 
 	mockstorage "github.com/hyperledger/aries-framework-go/pkg/mock/storage"
 	"github.com/hyperledger/aries-framework-go/pkg/secretlock"
@@ -26,6 +28,7 @@ import (
 
 	"github.com/trustbloc/hub-kms/pkg/internal/support"
 	"github.com/trustbloc/hub-kms/pkg/secretlock/secretsplitlock"
+	"github.com/trustbloc/hub-kms/pkg/storage/cache"
 )
 
 func TestNew(t *testing.T) {
@@ -58,6 +61,22 @@ func TestNew(t *testing.T) {
 		require.Contains(t, err.Error(), "get secret share: response error")
 	})
 
+	t.Run("Fail to fetch secret share: context canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		httpClient := &mockHTTPClient{
+			DoFunc: func(req *http.Request) (*http.Response, error) {
+				return nil, req.Context().Err()
+			},
+		}
+
+		secretLock, err := newSecretSplitLock(t, withHTTPClient(httpClient), withContext(ctx))
+
+		require.Nil(t, secretLock)
+		require.True(t, errors.Is(err, context.Canceled))
+	})
+
 	t.Run("Fail to fetch secret share: read body error", func(t *testing.T) {
 		secretLock, err := newSecretSplitLock(t, withResponseBody(ioutil.NopCloser(&failingReader{})))
 
@@ -208,6 +227,33 @@ func TestNew(t *testing.T) {
 		require.Contains(t, err.Error(), "get from cache: get error")
 	})
 
+	t.Run("Missing secret share is cached as not found", func(t *testing.T) {
+		cacheProvider := cache.NewProvider(cache.WithNegativeExpiration(time.Minute))
+
+		var calls int
+
+		client := &mockHTTPClient{
+			DoFunc: func(req *http.Request) (*http.Response, error) {
+				calls++
+
+				return &http.Response{
+					StatusCode: http.StatusNotFound,
+					Body:       ioutil.NopCloser(bytes.NewReader(nil)),
+				}, nil
+			},
+		}
+
+		for i := 0; i < 2; i++ {
+			secretLock, err := newSecretSplitLock(t, withCacheProvider(cacheProvider), withHTTPClient(client))
+
+			require.Nil(t, secretLock)
+			require.True(t, errors.Is(err, secretsplitlock.ErrShareNotFound))
+		}
+
+		require.Equal(t, 1, calls, "Hub Auth is queried once")
+		require.Equal(t, uint64(1), cacheProvider.Stats()["secretsplitlock"].NegativeHits)
+	})
+
 	t.Run("Fetch error after cache miss", func(t *testing.T) {
 		cacheProvider := mockstorage.NewMockStoreProvider()
 		cacheProvider.Store.ErrGet = storage.ErrDataNotFound
@@ -262,6 +308,7 @@ func (*failingCloser) Close() error {
 }
 
 type options struct {
+	ctx              context.Context
 	secret           []byte
 	secretInResponse string
 	body             io.ReadCloser
@@ -277,6 +324,7 @@ func newSecretSplitLock(t *testing.T, opts ...optionFn) (secretlock.Service, err
 	t.Helper()
 
 	cOpts := &options{
+		ctx:              context.Background(),
 		secret:           []byte("secret"),
 		secretInResponse: base64.StdEncoding.EncodeToString([]byte("other secret share")),
 		secretSplitter:   &mockSplitter{CombineValue: []byte("combined secret")},
@@ -328,7 +376,13 @@ func newSecretSplitLock(t *testing.T, opts ...optionFn) (secretlock.Service, err
 		o = append(o, secretsplitlock.WithCacheProvider(cOpts.cacheProvider))
 	}
 
-	return secretsplitlock.New(cOpts.secret, params, o...)
+	return secretsplitlock.New(cOpts.ctx, cOpts.secret, params, o...)
+}
+
+func withContext(ctx context.Context) optionFn {
+	return func(o *options) {
+		o.ctx = ctx
+	}
 }
 
 func withSecret(secret []byte) optionFn {
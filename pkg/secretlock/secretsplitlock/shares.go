@@ -0,0 +1,326 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package secretsplitlock
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hyperledger/aries-framework-go/pkg/secretlock"
+	"github.com/trustbloc/edge-core/pkg/log"
+	"github.com/trustbloc/edge-core/pkg/sss/base"
+)
+
+const (
+	// KMSSharePath is the path on hub-kms to get and set the secret share of the keystore.
+	KMSSharePath = "/admin/shares/%s"
+
+	shareFileMode = 0600
+)
+
+// ShareProvider provides a secret share of the keystore.
+type ShareProvider interface {
+	Share(req *http.Request, keystoreID string) ([]byte, error)
+}
+
+// NewThresholdLock returns a new secret lock based on the secret combined from threshold shares. Providers are
+// asked for shares in order until threshold shares are collected, so the keystore is unlocked with any threshold
+// of available providers.
+func NewThresholdLock(req *http.Request, keystoreID string, threshold int, providers []ShareProvider,
+	options ...Option) (secretlock.Service, error) {
+	secret, err := CombineShares(req, keystoreID, threshold, providers, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer Zeroize(secret)
+
+	return NewSecretLock(secret)
+}
+
+// CombineShares returns the secret combined from threshold shares collected from providers in order. The caller
+// should wipe the secret with Zeroize once it is no longer needed.
+func CombineShares(req *http.Request, keystoreID string, threshold int, providers []ShareProvider,
+	options ...Option) ([]byte, error) {
+	opts := &Options{
+		secretSplitter: &base.Splitter{},
+		logger:         log.New("hub-kms/secretsplitlock"),
+	}
+
+	for i := range options {
+		options[i](opts)
+	}
+
+	var (
+		shares [][]byte
+		errs   shareErrors
+	)
+
+	for i := 0; i < len(providers) && len(shares) < threshold; i++ {
+		share, err := providers[i].Share(req, keystoreID)
+		if err != nil {
+			opts.logger.Debugf("secret share %d of keystore %s is not available: %s", i, keystoreID, err)
+
+			errs = append(errs, err)
+
+			continue
+		}
+
+		shares = append(shares, share)
+	}
+
+	if len(shares) < threshold {
+		return nil, fmt.Errorf("not enough secret shares: got %d of %d: %w", len(shares), threshold, errs)
+	}
+
+	return combineShares(shares, opts.secretSplitter)
+}
+
+// HeaderShareProvider provides a secret share passed in the request header.
+type HeaderShareProvider struct {
+	header string
+}
+
+// NewHeaderShareProvider returns a new HeaderShareProvider instance.
+func NewHeaderShareProvider(header string) *HeaderShareProvider {
+	return &HeaderShareProvider{header: header}
+}
+
+// Share returns base64-decoded value of the header.
+func (p *HeaderShareProvider) Share(req *http.Request, _ string) ([]byte, error) {
+	secret := req.Header.Get(p.header)
+	if secret == "" {
+		return nil, fmt.Errorf("empty secret share in the %s header", p.header)
+	}
+
+	share, err := base64.StdEncoding.DecodeString(secret)
+	if err != nil {
+		return nil, fmt.Errorf("decode secret share from the %s header: %w", p.header, err)
+	}
+
+	return share, nil
+}
+
+// HubAuthShareProvider provides a secret share of the user from Hub Auth. The user is taken from the request header.
+type HubAuthShareProvider struct {
+	url        string
+	apiToken   string
+	userHeader string
+	opts       *Options
+}
+
+// NewHubAuthShareProvider returns a new HubAuthShareProvider instance.
+func NewHubAuthShareProvider(hubAuthURL, apiToken, userHeader string, options ...Option) *HubAuthShareProvider {
+	opts := &Options{
+		httpClient: http.DefaultClient,
+		logger:     log.New("hub-kms/secretsplitlock"),
+	}
+
+	for i := range options {
+		options[i](opts)
+	}
+
+	return &HubAuthShareProvider{
+		url:        hubAuthURL,
+		apiToken:   apiToken,
+		userHeader: userHeader,
+		opts:       opts,
+	}
+}
+
+// Share fetches the secret share from Hub Auth or returns the cached one.
+func (p *HubAuthShareProvider) Share(req *http.Request, _ string) ([]byte, error) {
+	sub := req.Header.Get(p.userHeader)
+	if sub == "" {
+		return nil, fmt.Errorf("empty user in the %s header", p.userHeader)
+	}
+
+	fetchFunc := func() ([]byte, error) {
+		return fetch(req.Context(), p.url, p.apiToken, sub, p.opts)
+	}
+
+	share, err := getSecretShare(sub, p.opts.cacheProvider, fetchFunc)
+	if err != nil {
+		return nil, fmt.Errorf("get secret share from hub auth: %w", err)
+	}
+
+	return share, nil
+}
+
+// FileShareProvider provides secret shares stored in the file system. If the path is a directory, the share of the
+// keystore is kept base64-encoded in the file named after the keystore ID. Otherwise the file holds the share for all
+// keystores.
+type FileShareProvider struct {
+	path string
+}
+
+// NewFileShareProvider returns a new FileShareProvider instance.
+func NewFileShareProvider(path string) *FileShareProvider {
+	return &FileShareProvider{path: path}
+}
+
+// Share reads the secret share of the keystore from the file.
+func (p *FileShareProvider) Share(_ *http.Request, keystoreID string) ([]byte, error) {
+	path := p.path
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("read secret share: %w", err)
+	}
+
+	if fi.IsDir() {
+		if keystoreID == "" || filepath.Base(keystoreID) != keystoreID {
+			return nil, errors.New("invalid keystore ID")
+		}
+
+		path = filepath.Join(path, keystoreID)
+	}
+
+	b, err := ioutil.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, fmt.Errorf("read secret share: %w", err)
+	}
+
+	return decodeShare(string(b))
+}
+
+// UpdateShare stores the secret share of the keystore base64-encoded in the file named after the keystore ID. Shares
+// are stored only if the path is a directory, a single file can't hold a share per keystore.
+func (p *FileShareProvider) UpdateShare(_ *http.Request, keystoreID string, share []byte) error {
+	fi, err := os.Stat(p.path)
+	if err != nil {
+		return fmt.Errorf("store secret share: %w", err)
+	}
+
+	if !fi.IsDir() {
+		return fmt.Errorf("store secret share: %s is not a directory", p.path)
+	}
+
+	if keystoreID == "" || filepath.Base(keystoreID) != keystoreID {
+		return errors.New("invalid keystore ID")
+	}
+
+	err = ioutil.WriteFile(filepath.Join(p.path, keystoreID), []byte(base64.StdEncoding.EncodeToString(share)),
+		shareFileMode)
+	if err != nil {
+		return fmt.Errorf("store secret share: %w", err)
+	}
+
+	return nil
+}
+
+// EnvShareProvider provides a base64-encoded secret share from the environment variable. The share is the same for
+// all keystores.
+type EnvShareProvider struct {
+	name string
+}
+
+// NewEnvShareProvider returns a new EnvShareProvider instance.
+func NewEnvShareProvider(name string) *EnvShareProvider {
+	return &EnvShareProvider{name: name}
+}
+
+// Share returns the secret share from the environment variable.
+func (p *EnvShareProvider) Share(*http.Request, string) ([]byte, error) {
+	v, ok := os.LookupEnv(p.name)
+	if !ok || v == "" {
+		return nil, fmt.Errorf("secret share is not set in the %s environment variable", p.name)
+	}
+
+	return decodeShare(v)
+}
+
+func decodeShare(s string) ([]byte, error) {
+	share, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("decode secret share: %w", err)
+	}
+
+	return share, nil
+}
+
+// KMSShareProvider provides a secret share from another hub-kms instance that holds it.
+type KMSShareProvider struct {
+	url      string
+	apiToken string
+	opts     *Options
+}
+
+// NewKMSShareProvider returns a new KMSShareProvider instance. apiToken is the admin API token of the hub-kms server.
+func NewKMSShareProvider(kmsURL, apiToken string, options ...Option) *KMSShareProvider {
+	opts := &Options{
+		httpClient: http.DefaultClient,
+		logger:     log.New("hub-kms/secretsplitlock"),
+	}
+
+	for i := range options {
+		options[i](opts)
+	}
+
+	return &KMSShareProvider{
+		url:      kmsURL,
+		apiToken: apiToken,
+		opts:     opts,
+	}
+}
+
+// Share fetches the secret share of the keystore from hub-kms.
+func (p *KMSShareProvider) Share(req *http.Request, keystoreID string) ([]byte, error) {
+	uri := p.url + fmt.Sprintf(KMSSharePath, url.PathEscape(keystoreID))
+
+	shareReq, err := http.NewRequestWithContext(req.Context(), http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	shareReq.Header.Set("authorization", "Bearer "+p.apiToken)
+
+	share, err := withRetry(req.Context(), p.opts, func() ([]byte, error) {
+		return doShareRequest(shareReq, p.opts.httpClient, p.opts.logger)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("get secret share from hub-kms: %w", err)
+	}
+
+	return share, nil
+}
+
+// UpdateShare sets the secret share of the keystore on hub-kms with PUT, the instance stores it in its
+// secret share directory.
+func (p *KMSShareProvider) UpdateShare(req *http.Request, keystoreID string, share []byte) error {
+	uri := p.url + fmt.Sprintf(KMSSharePath, url.PathEscape(keystoreID))
+
+	body, err := shareBody(share)
+	if err != nil {
+		return err
+	}
+
+	_, err = withRetry(req.Context(), p.opts, func() ([]byte, error) {
+		r, e := http.NewRequestWithContext(req.Context(), http.MethodPut, uri, bytes.NewReader(body))
+		if e != nil {
+			return nil, e
+		}
+
+		r.Header.Set("Content-Type", "application/json")
+		r.Header.Set("authorization", "Bearer "+p.apiToken)
+
+		return nil, doUpdateRequest(r, p.opts.httpClient, p.opts.logger)
+	})
+	if err != nil {
+		return fmt.Errorf("update secret share on hub-kms: %w", err)
+	}
+
+	return nil
+}
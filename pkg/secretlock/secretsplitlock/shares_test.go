@@ -0,0 +1,440 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package secretsplitlock_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hyperledger/aries-framework-go/pkg/secretlock"
+	"github.com/stretchr/testify/require"
+	"github.com/trustbloc/edge-core/pkg/log/mocklogger"
+	"github.com/trustbloc/edge-core/pkg/sss/base"
+
+	"github.com/trustbloc/hub-kms/pkg/secretlock/secretsplitlock"
+)
+
+const (
+	testKeystoreID = "keystoreID"
+	testHeader     = "Hub-Kms-Secret"
+	testUserHeader = "Hub-Kms-User"
+	testPlaintext  = "32-byte key to be wrapped by hkd" // master lock encrypts keys of the hash size
+)
+
+func TestNewThresholdLock(t *testing.T) {
+	shares, err := (&base.Splitter{}).Split([]byte("secret"), 3, 2)
+	require.NoError(t, err)
+
+	t.Run("Unlocks with any threshold of shares", func(t *testing.T) {
+		providers := []secretsplitlock.ShareProvider{
+			&mockShareProvider{share: shares[0]},
+			&mockShareProvider{share: shares[1]},
+			&mockShareProvider{share: shares[2]},
+		}
+
+		ciphertext := encrypt(t, newThresholdLock(t, providers[0], providers[1]))
+
+		require.Equal(t, testPlaintext, decrypt(t, newThresholdLock(t, providers[1], providers[2]), ciphertext))
+		require.Equal(t, testPlaintext, decrypt(t, newThresholdLock(t, providers[0], providers[2]), ciphertext))
+	})
+
+	t.Run("Skips unavailable shares", func(t *testing.T) {
+		ciphertext := encrypt(t, newThresholdLock(t,
+			&mockShareProvider{share: shares[0]},
+			&mockShareProvider{share: shares[1]},
+		))
+
+		secLock := newThresholdLock(t,
+			&mockShareProvider{err: errors.New("share error")},
+			&mockShareProvider{share: shares[1]},
+			&mockShareProvider{share: shares[2]},
+		)
+
+		require.Equal(t, testPlaintext, decrypt(t, secLock, ciphertext))
+	})
+
+	t.Run("Fail if not enough shares", func(t *testing.T) {
+		providers := []secretsplitlock.ShareProvider{
+			&mockShareProvider{share: shares[0]},
+			&mockShareProvider{err: errors.New("share error")},
+		}
+
+		_, err := secretsplitlock.NewThresholdLock(httptest.NewRequest(http.MethodGet, "/", nil), testKeystoreID,
+			2, providers, secretsplitlock.WithLogger(&mocklogger.MockLogger{}))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "not enough secret shares: got 1 of 2: share error")
+	})
+
+	t.Run("Fail to combine shares", func(t *testing.T) {
+		providers := []secretsplitlock.ShareProvider{
+			&mockShareProvider{share: shares[0]},
+			&mockShareProvider{share: shares[1]},
+		}
+
+		_, err := secretsplitlock.NewThresholdLock(httptest.NewRequest(http.MethodGet, "/", nil), testKeystoreID,
+			2, providers, secretsplitlock.WithSecretSplitter(&mockSplitter{CombineErr: errors.New("combine error")}))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "combine secrets: combine error")
+	})
+}
+
+func TestCombineShares(t *testing.T) {
+	shares, err := (&base.Splitter{}).Split([]byte("secret"), 2, 2)
+	require.NoError(t, err)
+
+	providers := []secretsplitlock.ShareProvider{
+		&mockShareProvider{share: shares[0]},
+		&mockShareProvider{share: shares[1]},
+	}
+
+	secret, err := secretsplitlock.CombineShares(httptest.NewRequest(http.MethodGet, "/", nil), testKeystoreID, 2,
+		providers)
+	require.NoError(t, err)
+
+	secLock, err := secretsplitlock.NewSecretLock(secret)
+	require.NoError(t, err)
+
+	ciphertext := encrypt(t, secLock)
+
+	secretsplitlock.Zeroize(secret)
+	require.Equal(t, make([]byte, len(secret)), secret)
+
+	// the lock does not depend on the wiped secret
+	require.Equal(t, testPlaintext, decrypt(t, secLock, ciphertext))
+	require.Equal(t, testPlaintext, decrypt(t, newThresholdLock(t, providers...), ciphertext))
+}
+
+func TestHeaderShareProvider(t *testing.T) {
+	p := secretsplitlock.NewHeaderShareProvider(testHeader)
+
+	t.Run("Success", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(testHeader, base64.StdEncoding.EncodeToString([]byte("share")))
+
+		share, err := p.Share(req, testKeystoreID)
+		require.NoError(t, err)
+		require.Equal(t, []byte("share"), share)
+	})
+
+	t.Run("Fail with empty header", func(t *testing.T) {
+		_, err := p.Share(httptest.NewRequest(http.MethodGet, "/", nil), testKeystoreID)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "empty secret share in the Hub-Kms-Secret header")
+	})
+
+	t.Run("Fail to decode header", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(testHeader, "!invalid")
+
+		_, err := p.Share(req, testKeystoreID)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "decode secret share from the Hub-Kms-Secret header")
+	})
+}
+
+func TestHubAuthShareProvider(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		require.Equal(t, "/secret", req.URL.Path)
+		require.Equal(t, "user", req.URL.Query().Get("sub"))
+
+		writeShare(t, rw, []byte("share"))
+	}))
+	defer srv.Close()
+
+	p := secretsplitlock.NewHubAuthShareProvider(srv.URL, "token", testUserHeader)
+
+	t.Run("Success", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(testUserHeader, "user")
+
+		share, err := p.Share(req, testKeystoreID)
+		require.NoError(t, err)
+		require.Equal(t, []byte("share"), share)
+	})
+
+	t.Run("Fail with empty user header", func(t *testing.T) {
+		_, err := p.Share(httptest.NewRequest(http.MethodGet, "/", nil), testKeystoreID)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "empty user in the Hub-Kms-User header")
+	})
+
+	t.Run("Fail to fetch share", func(t *testing.T) {
+		p := secretsplitlock.NewHubAuthShareProvider(srv.URL, "token", testUserHeader,
+			secretsplitlock.WithHTTPClient(&mockHTTPClient{
+				DoFunc: func(req *http.Request) (*http.Response, error) {
+					return nil, errors.New("response error")
+				},
+			}))
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(testUserHeader, "user")
+
+		_, err := p.Share(req, testKeystoreID)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "get secret share from hub auth: response error")
+	})
+}
+
+func TestFileShareProvider(t *testing.T) {
+	dir, err := ioutil.TempDir("", "shares")
+	require.NoError(t, err)
+
+	defer func() { require.NoError(t, os.RemoveAll(dir)) }()
+
+	err = ioutil.WriteFile(filepath.Join(dir, testKeystoreID),
+		[]byte(base64.StdEncoding.EncodeToString([]byte("share"))+"\n"), 0600)
+	require.NoError(t, err)
+
+	err = ioutil.WriteFile(filepath.Join(dir, "invalid"), []byte("!invalid"), 0600)
+	require.NoError(t, err)
+
+	p := secretsplitlock.NewFileShareProvider(dir)
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	t.Run("Success", func(t *testing.T) {
+		share, err := p.Share(req, testKeystoreID)
+		require.NoError(t, err)
+		require.Equal(t, []byte("share"), share)
+	})
+
+	t.Run("Fail with invalid keystore ID", func(t *testing.T) {
+		_, err := p.Share(req, "../"+testKeystoreID)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "invalid keystore ID")
+	})
+
+	t.Run("Fail if share does not exist", func(t *testing.T) {
+		_, err := p.Share(req, "unknown")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "read secret share")
+	})
+
+	t.Run("Fail to decode share", func(t *testing.T) {
+		_, err := p.Share(req, "invalid")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "decode secret share")
+	})
+
+	t.Run("Update share", func(t *testing.T) {
+		require.NoError(t, p.UpdateShare(req, "new", []byte("new share")))
+
+		share, err := p.Share(req, "new")
+		require.NoError(t, err)
+		require.Equal(t, []byte("new share"), share)
+	})
+
+	t.Run("Fail to update share with invalid keystore ID", func(t *testing.T) {
+		err := p.UpdateShare(req, "../new", []byte("new share"))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "invalid keystore ID")
+	})
+}
+
+func TestFileShareProvider_StaticFile(t *testing.T) {
+	file, err := ioutil.TempFile("", "share")
+	require.NoError(t, err)
+
+	defer func() { require.NoError(t, os.Remove(file.Name())) }()
+
+	_, err = file.WriteString(base64.StdEncoding.EncodeToString([]byte("share")))
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	p := secretsplitlock.NewFileShareProvider(file.Name())
+
+	t.Run("Success", func(t *testing.T) {
+		share, err := p.Share(httptest.NewRequest(http.MethodGet, "/", nil), testKeystoreID)
+		require.NoError(t, err)
+		require.Equal(t, []byte("share"), share)
+	})
+
+	t.Run("Fail if file does not exist", func(t *testing.T) {
+		p := secretsplitlock.NewFileShareProvider(file.Name() + "_missing")
+
+		_, err := p.Share(httptest.NewRequest(http.MethodGet, "/", nil), testKeystoreID)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "read secret share")
+
+		err = p.UpdateShare(httptest.NewRequest(http.MethodGet, "/", nil), testKeystoreID, []byte("share"))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "store secret share")
+	})
+
+	t.Run("Fail to update share of keystore", func(t *testing.T) {
+		err := p.UpdateShare(httptest.NewRequest(http.MethodGet, "/", nil), testKeystoreID, []byte("new share"))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "is not a directory")
+	})
+}
+
+func TestEnvShareProvider(t *testing.T) {
+	const envKey = "KMS_TEST_SECRET_SHARE"
+
+	p := secretsplitlock.NewEnvShareProvider(envKey)
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	t.Run("Success", func(t *testing.T) {
+		require.NoError(t, os.Setenv(envKey, base64.StdEncoding.EncodeToString([]byte("share"))))
+		defer func() { require.NoError(t, os.Unsetenv(envKey)) }()
+
+		share, err := p.Share(req, testKeystoreID)
+		require.NoError(t, err)
+		require.Equal(t, []byte("share"), share)
+	})
+
+	t.Run("Fail if variable is not set", func(t *testing.T) {
+		_, err := p.Share(req, testKeystoreID)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "secret share is not set in the KMS_TEST_SECRET_SHARE environment variable")
+	})
+
+	t.Run("Fail to decode share", func(t *testing.T) {
+		require.NoError(t, os.Setenv(envKey, "!invalid"))
+		defer func() { require.NoError(t, os.Unsetenv(envKey)) }()
+
+		_, err := p.Share(req, testKeystoreID)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "decode secret share")
+	})
+}
+
+func TestKMSShareProvider(t *testing.T) {
+	var stored []byte
+
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Authorization") != "Bearer token" {
+			rw.WriteHeader(http.StatusUnauthorized)
+			_, _ = rw.Write([]byte("unauthorized")) //nolint:errcheck // test
+
+			return
+		}
+
+		require.Equal(t, fmt.Sprintf(secretsplitlock.KMSSharePath, testKeystoreID), req.URL.Path)
+
+		if req.Method == http.MethodPut {
+			stored = readShare(t, req)
+
+			rw.WriteHeader(http.StatusNoContent)
+
+			return
+		}
+
+		writeShare(t, rw, []byte("share"))
+	}))
+	defer srv.Close()
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	t.Run("Success", func(t *testing.T) {
+		p := secretsplitlock.NewKMSShareProvider(srv.URL, "token")
+
+		share, err := p.Share(req, testKeystoreID)
+		require.NoError(t, err)
+		require.Equal(t, []byte("share"), share)
+	})
+
+	t.Run("Fail with invalid API token", func(t *testing.T) {
+		p := secretsplitlock.NewKMSShareProvider(srv.URL, "invalid", secretsplitlock.WithHTTPClient(srv.Client()))
+
+		_, err := p.Share(req, testKeystoreID)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "get secret share from hub-kms: unauthorized")
+	})
+
+	t.Run("Fail with invalid URL", func(t *testing.T) {
+		p := secretsplitlock.NewKMSShareProvider(" invalid", "token")
+
+		_, err := p.Share(req, testKeystoreID)
+		require.Error(t, err)
+	})
+
+	t.Run("Update share", func(t *testing.T) {
+		p := secretsplitlock.NewKMSShareProvider(srv.URL, "token")
+
+		require.NoError(t, p.UpdateShare(req, testKeystoreID, []byte("new share")))
+		require.Equal(t, []byte("new share"), stored)
+	})
+
+	t.Run("Fail to update share with invalid API token", func(t *testing.T) {
+		p := secretsplitlock.NewKMSShareProvider(srv.URL, "invalid")
+
+		err := p.UpdateShare(req, testKeystoreID, []byte("new share"))
+		require.True(t, errors.Is(err, secretsplitlock.ErrUnauthorized))
+		require.Contains(t, err.Error(), "update secret share on hub-kms: unauthorized")
+	})
+}
+
+type mockShareProvider struct {
+	share []byte
+	err   error
+}
+
+func (p *mockShareProvider) Share(*http.Request, string) ([]byte, error) {
+	return p.share, p.err
+}
+
+func newThresholdLock(t *testing.T, providers ...secretsplitlock.ShareProvider) secretlock.Service {
+	t.Helper()
+
+	secLock, err := secretsplitlock.NewThresholdLock(httptest.NewRequest(http.MethodGet, "/", nil), testKeystoreID,
+		2, providers)
+	require.NoError(t, err)
+
+	return secLock
+}
+
+func encrypt(t *testing.T, secLock secretlock.Service) string {
+	t.Helper()
+
+	resp, err := secLock.Encrypt("", &secretlock.EncryptRequest{Plaintext: testPlaintext})
+	require.NoError(t, err)
+
+	return resp.Ciphertext
+}
+
+func decrypt(t *testing.T, secLock secretlock.Service, ciphertext string) string {
+	t.Helper()
+
+	resp, err := secLock.Decrypt("", &secretlock.DecryptRequest{Ciphertext: ciphertext})
+	require.NoError(t, err)
+
+	return resp.Plaintext
+}
+
+func readShare(t *testing.T, req *http.Request) []byte {
+	t.Helper()
+
+	var body struct {
+		Secret string `json:"secret"`
+	}
+
+	require.NoError(t, json.NewDecoder(req.Body).Decode(&body))
+
+	share, err := base64.StdEncoding.DecodeString(body.Secret)
+	require.NoError(t, err)
+
+	return share
+}
+
+func writeShare(t *testing.T, rw http.ResponseWriter, share []byte) {
+	t.Helper()
+
+	err := json.NewEncoder(rw).Encode(struct {
+		Secret string `json:"secret"`
+	}{
+		Secret: base64.StdEncoding.EncodeToString(share),
+	})
+	require.NoError(t, err)
+}
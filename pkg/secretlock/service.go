@@ -30,32 +30,65 @@ type Provider interface {
 	SecretLock() secretlock.Service
 }
 
-// New returns a new secret lock service instance.
+// New returns a new secret lock service instance. If the primary key is being rotated (see Rotator), the returned
+// secret lock encrypts with the new primary key and decrypts with both keys. The primary key replaced by the last
+// rotation is used for decryption as well.
 func New(keyURI string, provider Provider) (secretlock.Service, error) {
-	r, err := primaryKeyReader(provider.StorageProvider(), provider.SecretLock(), keyURI)
+	primaryKeyStore, err := provider.StorageProvider().OpenStore(primaryKeyStoreName)
 	if err != nil {
 		return nil, err
 	}
 
-	secretLock, err := local.NewService(r, provider.SecretLock())
+	primaryKey, err := getOrCreatePrimaryKey(primaryKeyStore, provider.SecretLock(), keyURI)
 	if err != nil {
 		return nil, err
 	}
 
-	return secretLock, nil
-}
+	secretLock, err := local.NewService(bytes.NewReader(primaryKey), provider.SecretLock())
+	if err != nil {
+		return nil, err
+	}
+
+	entry := keyEntryInDB(keyURI)
 
-func primaryKeyReader(storageProvider storage.Provider, secretLock secretlock.Service,
-	keyURI string) (*bytes.Reader, error) {
-	primaryKeyStore, err := storageProvider.OpenStore(primaryKeyStoreName)
+	previousLock, err := previousPrimaryKeyLock(primaryKeyStore, provider.SecretLock(), entry, primaryKey)
 	if err != nil {
 		return nil, err
 	}
 
+	var previous []secretlock.Service
+
+	if previousLock != nil {
+		previous = append(previous, previousLock)
+	}
+
+	pending, err := primaryKeyStore.Get(entry + pendingKeySuffix)
+	if errors.Is(err, storage.ErrDataNotFound) || bytes.Equal(pending, primaryKey) {
+		if len(previous) == 0 {
+			return secretLock, nil
+		}
+
+		return &rotatingLock{current: secretLock, previous: previous}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	newSecretLock, err := local.NewService(bytes.NewReader(pending), provider.SecretLock())
+	if err != nil {
+		return nil, err
+	}
+
+	return &rotatingLock{current: newSecretLock, previous: append([]secretlock.Service{secretLock}, previous...)}, nil
+}
+
+func getOrCreatePrimaryKey(primaryKeyStore storage.Store, secretLock secretlock.Service,
+	keyURI string) ([]byte, error) {
 	primaryKey, err := primaryKeyStore.Get(keyEntryInDB(keyURI))
 	if err != nil {
 		if errors.Is(err, storage.ErrDataNotFound) {
-			primaryKey, err = newPrimaryKey(primaryKeyStore, secretLock, keyURI)
+			primaryKey, err = newPrimaryKey(primaryKeyStore, secretLock, keyURI, keyEntryInDB(keyURI))
 			if err != nil {
 				return nil, err
 			}
@@ -64,10 +97,10 @@ func primaryKeyReader(storageProvider storage.Provider, secretLock secretlock.Se
 		}
 	}
 
-	return bytes.NewReader(primaryKey), nil
+	return primaryKey, nil
 }
 
-func newPrimaryKey(store storage.Store, secLock secretlock.Service, keyURI string) ([]byte, error) {
+func newPrimaryKey(store storage.Store, secLock secretlock.Service, keyURI, entry string) ([]byte, error) {
 	primaryKeyContent, err := randomBytes(keySize)
 	if err != nil {
 		return nil, err
@@ -82,7 +115,7 @@ func newPrimaryKey(store storage.Store, secLock secretlock.Service, keyURI strin
 
 	primaryKey := []byte(primaryKeyEnc.Ciphertext)
 
-	err = store.Put(keyEntryInDB(keyURI), primaryKey)
+	err = store.Put(entry, primaryKey)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,283 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package vaultlock
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/aries-framework-go/pkg/secretlock"
+	"github.com/trustbloc/edge-core/pkg/log"
+
+	"github.com/trustbloc/hub-kms/pkg/internal/support"
+)
+
+const (
+	defaultMountPath = "transit"
+	encryptPath      = "/v1/%s/encrypt/%s"
+	decryptPath      = "/v1/%s/decrypt/%s"
+	appRoleLoginPath = "/v1/auth/approle/login"
+	tokenHeader      = "X-Vault-Token"
+
+	// tokenExpiryDelta is how long before the lease expiration the AppRole token is renewed with a new login.
+	tokenExpiryDelta = 10 * time.Second
+)
+
+// Config defines the Vault server and credentials used by the secret lock. Either Token or AppRole credentials
+// (RoleID and SecretID) must be set.
+type Config struct {
+	// URL is the address of the Vault server, e.g. https://vault.example.com:8200.
+	URL string
+	// KeyName is the name of the Transit encryption key.
+	KeyName string
+	// MountPath is the path the Transit engine is mounted at. Defaults to "transit".
+	MountPath string
+
+	Token    string
+	RoleID   string
+	SecretID string
+}
+
+// Options configures Vault secret lock dependencies.
+type Options struct {
+	httpClient support.HTTPClient
+	logger     log.Logger
+}
+
+// Option configures Options.
+type Option func(options *Options)
+
+// WithHTTPClient sets the custom HTTP client.
+func WithHTTPClient(c support.HTTPClient) Option {
+	return func(o *Options) {
+		o.httpClient = c
+	}
+}
+
+// WithLogger sets the custom logger.
+func WithLogger(l log.Logger) Option {
+	return func(o *Options) {
+		o.logger = l
+	}
+}
+
+// Lock is a secret lock that encrypts and decrypts with the key kept in the Vault Transit engine. The key never
+// leaves Vault. Key URIs passed to Encrypt and Decrypt are not used, all data is encrypted with the configured key.
+type Lock struct {
+	config *Config
+	opts   *Options
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+// New returns a new Vault secret lock instance.
+func New(config *Config, options ...Option) (*Lock, error) {
+	if config.URL == "" || config.KeyName == "" {
+		return nil, errors.New("vault URL and transit key name are required")
+	}
+
+	if config.Token == "" && (config.RoleID == "" || config.SecretID == "") {
+		return nil, errors.New("either vault token or AppRole role ID and secret ID are required")
+	}
+
+	opts := &Options{
+		httpClient: http.DefaultClient,
+		logger:     log.New("hub-kms/vaultlock"),
+	}
+
+	for i := range options {
+		options[i](opts)
+	}
+
+	c := *config
+	c.URL = strings.TrimSuffix(c.URL, "/")
+
+	if c.MountPath == "" {
+		c.MountPath = defaultMountPath
+	}
+
+	return &Lock{config: &c, opts: opts}, nil
+}
+
+// Encrypt encrypts the plaintext with the Transit key. The ciphertext is in the Vault format (vault:v<N>:...), so
+// it can be decrypted after the key is rotated in Vault.
+func (l *Lock) Encrypt(_ string, req *secretlock.EncryptRequest) (*secretlock.EncryptResponse, error) {
+	body := map[string]string{
+		"plaintext": base64.StdEncoding.EncodeToString([]byte(req.Plaintext)),
+	}
+
+	if req.AdditionalAuthenticatedData != "" {
+		body["associated_data"] = base64.StdEncoding.EncodeToString([]byte(req.AdditionalAuthenticatedData))
+	}
+
+	var resp struct {
+		Data struct {
+			Ciphertext string `json:"ciphertext"`
+		} `json:"data"`
+	}
+
+	err := l.transit(fmt.Sprintf(encryptPath, l.config.MountPath, l.config.KeyName), body, &resp)
+	if err != nil {
+		return nil, fmt.Errorf("vault encrypt: %w", err)
+	}
+
+	return &secretlock.EncryptResponse{Ciphertext: resp.Data.Ciphertext}, nil
+}
+
+// Decrypt decrypts the ciphertext with the Transit key.
+func (l *Lock) Decrypt(_ string, req *secretlock.DecryptRequest) (*secretlock.DecryptResponse, error) {
+	body := map[string]string{
+		"ciphertext": req.Ciphertext,
+	}
+
+	if req.AdditionalAuthenticatedData != "" {
+		body["associated_data"] = base64.StdEncoding.EncodeToString([]byte(req.AdditionalAuthenticatedData))
+	}
+
+	var resp struct {
+		Data struct {
+			Plaintext string `json:"plaintext"`
+		} `json:"data"`
+	}
+
+	err := l.transit(fmt.Sprintf(decryptPath, l.config.MountPath, l.config.KeyName), body, &resp)
+	if err != nil {
+		return nil, fmt.Errorf("vault decrypt: %w", err)
+	}
+
+	plaintext, err := base64.StdEncoding.DecodeString(resp.Data.Plaintext)
+	if err != nil {
+		return nil, fmt.Errorf("vault decrypt: decode plaintext: %w", err)
+	}
+
+	return &secretlock.DecryptResponse{Plaintext: string(plaintext)}, nil
+}
+
+// transit sends the request to the Transit engine. If the AppRole token is rejected, it logs in again and retries
+// once.
+func (l *Lock) transit(path string, body, result interface{}) error {
+	token, err := l.getToken(false)
+	if err != nil {
+		return err
+	}
+
+	status, err := l.post(path, token, body, result)
+	if status == http.StatusForbidden && l.config.Token == "" {
+		l.opts.logger.Debugf("vault token is rejected, logging in with AppRole again")
+
+		if token, err = l.getToken(true); err != nil {
+			return err
+		}
+
+		_, err = l.post(path, token, body, result)
+	}
+
+	return err
+}
+
+// getToken returns the static token or the AppRole token, logging in if the token is missing, expires soon or
+// refresh is requested.
+func (l *Lock) getToken(refresh bool) (string, error) {
+	if l.config.Token != "" {
+		return l.config.Token, nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !refresh && l.token != "" && (l.expiry.IsZero() || time.Now().Add(tokenExpiryDelta).Before(l.expiry)) {
+		return l.token, nil
+	}
+
+	var resp struct {
+		Auth struct {
+			ClientToken   string `json:"client_token"`
+			LeaseDuration int64  `json:"lease_duration"`
+		} `json:"auth"`
+	}
+
+	_, err := l.post(appRoleLoginPath, "", map[string]string{
+		"role_id":   l.config.RoleID,
+		"secret_id": l.config.SecretID,
+	}, &resp)
+	if err != nil {
+		return "", fmt.Errorf("vault approle login: %w", err)
+	}
+
+	if resp.Auth.ClientToken == "" {
+		return "", errors.New("vault approle login: no client token in response")
+	}
+
+	l.token = resp.Auth.ClientToken
+	l.expiry = time.Time{}
+
+	if resp.Auth.LeaseDuration > 0 {
+		l.expiry = time.Now().Add(time.Duration(resp.Auth.LeaseDuration) * time.Second)
+	}
+
+	return l.token, nil
+}
+
+// post sends the JSON request to Vault and decodes the response into result. It returns the response status code.
+func (l *Lock) post(path, token string, body, result interface{}) (int, error) {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return 0, fmt.Errorf("marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, l.config.URL+path,
+		bytes.NewReader(b))
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	if token != "" {
+		req.Header.Set(tokenHeader, token)
+	}
+
+	resp, err := l.opts.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+
+	defer func() {
+		if e := resp.Body.Close(); e != nil {
+			l.opts.logger.Errorf("failed to close response body")
+		}
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp struct {
+			Errors []string `json:"errors"`
+		}
+
+		if e := json.NewDecoder(resp.Body).Decode(&errResp); e != nil || len(errResp.Errors) == 0 {
+			return resp.StatusCode, fmt.Errorf("vault returned status %d", resp.StatusCode)
+		}
+
+		return resp.StatusCode, fmt.Errorf("vault returned status %d: %s", resp.StatusCode,
+			strings.Join(errResp.Errors, "; "))
+	}
+
+	if err = json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return resp.StatusCode, fmt.Errorf("decode response: %w", err)
+	}
+
+	return resp.StatusCode, nil
+}
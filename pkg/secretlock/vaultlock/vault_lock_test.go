@@ -0,0 +1,387 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package vaultlock_test
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	mockstorage "github.com/hyperledger/aries-framework-go/pkg/mock/storage"
+	"github.com/hyperledger/aries-framework-go/pkg/secretlock"
+	"github.com/hyperledger/aries-framework-go/pkg/storage"
+	"github.com/stretchr/testify/require"
+
+	lock "github.com/trustbloc/hub-kms/pkg/secretlock"
+	"github.com/trustbloc/hub-kms/pkg/secretlock/vaultlock"
+)
+
+const (
+	testToken    = "s.token"
+	testRoleID   = "role-id"
+	testSecretID = "secret-id"
+	testKeyName  = "hub-kms"
+)
+
+func TestNew(t *testing.T) {
+	t.Run("Fail without URL", func(t *testing.T) {
+		_, err := vaultlock.New(&vaultlock.Config{KeyName: testKeyName, Token: testToken})
+		require.EqualError(t, err, "vault URL and transit key name are required")
+	})
+
+	t.Run("Fail without credentials", func(t *testing.T) {
+		_, err := vaultlock.New(&vaultlock.Config{URL: "https://vault.example.com", KeyName: testKeyName,
+			RoleID: testRoleID})
+		require.EqualError(t, err, "either vault token or AppRole role ID and secret ID are required")
+	})
+}
+
+func TestLock_Token(t *testing.T) {
+	v := newFakeVault(t)
+	defer v.Close()
+
+	l, err := vaultlock.New(&vaultlock.Config{URL: v.URL + "/", KeyName: testKeyName, Token: testToken})
+	require.NoError(t, err)
+
+	t.Run("Encrypt and decrypt", func(t *testing.T) {
+		enc, err := l.Encrypt("", &secretlock.EncryptRequest{Plaintext: "plaintext"})
+		require.NoError(t, err)
+		require.True(t, strings.HasPrefix(enc.Ciphertext, "vault:v1:"))
+
+		dec, err := l.Decrypt("", &secretlock.DecryptRequest{Ciphertext: enc.Ciphertext})
+		require.NoError(t, err)
+		require.Equal(t, "plaintext", dec.Plaintext)
+	})
+
+	t.Run("Associated data is bound to ciphertext", func(t *testing.T) {
+		enc, err := l.Encrypt("", &secretlock.EncryptRequest{Plaintext: "plaintext",
+			AdditionalAuthenticatedData: "aad"})
+		require.NoError(t, err)
+
+		_, err = l.Decrypt("", &secretlock.DecryptRequest{Ciphertext: enc.Ciphertext})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "vault returned status 400: cipher: message authentication failed")
+
+		dec, err := l.Decrypt("", &secretlock.DecryptRequest{Ciphertext: enc.Ciphertext,
+			AdditionalAuthenticatedData: "aad"})
+		require.NoError(t, err)
+		require.Equal(t, "plaintext", dec.Plaintext)
+	})
+
+	t.Run("Fail with invalid token", func(t *testing.T) {
+		l, err := vaultlock.New(&vaultlock.Config{URL: v.URL, KeyName: testKeyName, Token: "invalid"})
+		require.NoError(t, err)
+
+		_, err = l.Encrypt("", &secretlock.EncryptRequest{Plaintext: "plaintext"})
+		require.EqualError(t, err, "vault encrypt: vault returned status 403: permission denied")
+	})
+
+	t.Run("Fail with unknown key", func(t *testing.T) {
+		l, err := vaultlock.New(&vaultlock.Config{URL: v.URL, KeyName: "unknown", Token: testToken})
+		require.NoError(t, err)
+
+		_, err = l.Decrypt("", &secretlock.DecryptRequest{Ciphertext: "vault:v1:"})
+		require.EqualError(t, err, "vault decrypt: vault returned status 404")
+	})
+
+	t.Run("Fail with custom mount path not enabled", func(t *testing.T) {
+		l, err := vaultlock.New(&vaultlock.Config{URL: v.URL, KeyName: testKeyName, MountPath: "kms",
+			Token: testToken})
+		require.NoError(t, err)
+
+		_, err = l.Encrypt("", &secretlock.EncryptRequest{Plaintext: "plaintext"})
+		require.EqualError(t, err, "vault encrypt: vault returned status 404")
+	})
+
+	t.Run("Fail with unreachable vault", func(t *testing.T) {
+		l, err := vaultlock.New(&vaultlock.Config{URL: "http://127.0.0.1:0", KeyName: testKeyName, Token: testToken})
+		require.NoError(t, err)
+
+		_, err = l.Encrypt("", &secretlock.EncryptRequest{Plaintext: "plaintext"})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "vault encrypt:")
+	})
+}
+
+func TestLock_AppRole(t *testing.T) {
+	t.Run("Logs in once and reuses token", func(t *testing.T) {
+		v := newFakeVault(t)
+		defer v.Close()
+
+		l := newAppRoleLock(t, v.URL, testSecretID)
+
+		for i := 0; i < 3; i++ {
+			_, err := l.Encrypt("", &secretlock.EncryptRequest{Plaintext: "plaintext"})
+			require.NoError(t, err)
+		}
+
+		require.Equal(t, 1, v.logins())
+	})
+
+	t.Run("Logs in again when token is about to expire", func(t *testing.T) {
+		v := newFakeVault(t)
+		defer v.Close()
+
+		v.leaseDuration = 1
+
+		l := newAppRoleLock(t, v.URL, testSecretID)
+
+		for i := 0; i < 2; i++ {
+			_, err := l.Encrypt("", &secretlock.EncryptRequest{Plaintext: "plaintext"})
+			require.NoError(t, err)
+		}
+
+		require.Equal(t, 2, v.logins())
+	})
+
+	t.Run("Logs in again when token is revoked", func(t *testing.T) {
+		v := newFakeVault(t)
+		defer v.Close()
+
+		l := newAppRoleLock(t, v.URL, testSecretID)
+
+		_, err := l.Encrypt("", &secretlock.EncryptRequest{Plaintext: "plaintext"})
+		require.NoError(t, err)
+
+		v.revokeTokens()
+
+		_, err = l.Encrypt("", &secretlock.EncryptRequest{Plaintext: "plaintext"})
+		require.NoError(t, err)
+		require.Equal(t, 2, v.logins())
+	})
+
+	t.Run("Fail with invalid secret ID", func(t *testing.T) {
+		v := newFakeVault(t)
+		defer v.Close()
+
+		l := newAppRoleLock(t, v.URL, "invalid")
+
+		_, err := l.Encrypt("", &secretlock.EncryptRequest{Plaintext: "plaintext"})
+		require.EqualError(t, err, "vault encrypt: vault approle login: vault returned status 400: "+
+			"invalid role or secret ID")
+	})
+
+	t.Run("Fail without client token in response", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			_, err := rw.Write([]byte(`{"auth":{}}`))
+			require.NoError(t, err)
+		}))
+		defer srv.Close()
+
+		l := newAppRoleLock(t, srv.URL, testSecretID)
+
+		_, err := l.Decrypt("", &secretlock.DecryptRequest{Ciphertext: "vault:v1:"})
+		require.EqualError(t, err, "vault decrypt: vault approle login: no client token in response")
+	})
+}
+
+func TestLock_AsPrimaryKeyLock(t *testing.T) {
+	v := newFakeVault(t)
+	defer v.Close()
+
+	vaultLock, err := vaultlock.New(&vaultlock.Config{URL: v.URL, KeyName: testKeyName, Token: testToken})
+	require.NoError(t, err)
+
+	provider := &secretLockProvider{storageProvider: mockstorage.NewMockStoreProvider(), secretLock: vaultLock}
+
+	secLock, err := lock.New("local-lock://keystorekms", provider)
+	require.NoError(t, err)
+
+	enc, err := secLock.Encrypt("", &secretlock.EncryptRequest{Plaintext: "keyset"})
+	require.NoError(t, err)
+
+	// the primary key is loaded from the storage and decrypted by Vault
+	secLock, err = lock.New("local-lock://keystorekms", provider)
+	require.NoError(t, err)
+
+	dec, err := secLock.Decrypt("", &secretlock.DecryptRequest{Ciphertext: enc.Ciphertext})
+	require.NoError(t, err)
+	require.Equal(t, "keyset", dec.Plaintext)
+}
+
+func newAppRoleLock(t *testing.T, url, secretID string) *vaultlock.Lock {
+	t.Helper()
+
+	l, err := vaultlock.New(&vaultlock.Config{URL: url, KeyName: testKeyName, RoleID: testRoleID,
+		SecretID: secretID})
+	require.NoError(t, err)
+
+	return l
+}
+
+type secretLockProvider struct {
+	storageProvider storage.Provider
+	secretLock      secretlock.Service
+}
+
+func (p *secretLockProvider) StorageProvider() storage.Provider {
+	return p.storageProvider
+}
+
+func (p *secretLockProvider) SecretLock() secretlock.Service {
+	return p.secretLock
+}
+
+// fakeVault implements the Transit encrypt and decrypt endpoints and AppRole login of Vault.
+type fakeVault struct {
+	*httptest.Server
+	t             *testing.T
+	aead          cipher.AEAD
+	leaseDuration int
+
+	mu         sync.Mutex
+	tokens     map[string]struct{}
+	loginCount int
+}
+
+func newFakeVault(t *testing.T) *fakeVault {
+	t.Helper()
+
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	require.NoError(t, err)
+
+	block, err := aes.NewCipher(key)
+	require.NoError(t, err)
+
+	aead, err := cipher.NewGCM(block)
+	require.NoError(t, err)
+
+	v := &fakeVault{
+		t:             t,
+		aead:          aead,
+		leaseDuration: 3600,
+		tokens:        map[string]struct{}{testToken: {}},
+	}
+
+	router := http.NewServeMux()
+	router.HandleFunc("/v1/auth/approle/login", v.login)
+	router.HandleFunc("/v1/transit/encrypt/"+testKeyName, v.authorized(v.encrypt))
+	router.HandleFunc("/v1/transit/decrypt/"+testKeyName, v.authorized(v.decrypt))
+
+	v.Server = httptest.NewServer(router)
+
+	return v
+}
+
+func (v *fakeVault) logins() int {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	return v.loginCount
+}
+
+func (v *fakeVault) revokeTokens() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.tokens = map[string]struct{}{}
+}
+
+func (v *fakeVault) login(rw http.ResponseWriter, req *http.Request) {
+	var body map[string]string
+	require.NoError(v.t, json.NewDecoder(req.Body).Decode(&body))
+
+	if body["role_id"] != testRoleID || body["secret_id"] != testSecretID {
+		v.writeError(rw, http.StatusBadRequest, "invalid role or secret ID")
+
+		return
+	}
+
+	v.mu.Lock()
+	v.loginCount++
+	token := "s.approle" + strconv.Itoa(v.loginCount)
+	v.tokens[token] = struct{}{}
+	v.mu.Unlock()
+
+	v.write(rw, map[string]interface{}{
+		"auth": map[string]interface{}{"client_token": token, "lease_duration": v.leaseDuration},
+	})
+}
+
+func (v *fakeVault) authorized(next http.HandlerFunc) http.HandlerFunc {
+	return func(rw http.ResponseWriter, req *http.Request) {
+		v.mu.Lock()
+		_, ok := v.tokens[req.Header.Get("X-Vault-Token")]
+		v.mu.Unlock()
+
+		if !ok {
+			v.writeError(rw, http.StatusForbidden, "permission denied")
+
+			return
+		}
+
+		next(rw, req)
+	}
+}
+
+func (v *fakeVault) encrypt(rw http.ResponseWriter, req *http.Request) {
+	body := v.readBody(req)
+
+	nonce := make([]byte, v.aead.NonceSize())
+	_, err := rand.Read(nonce)
+	require.NoError(v.t, err)
+
+	ct := v.aead.Seal(nonce, nonce, v.decode(body["plaintext"]), v.decode(body["associated_data"]))
+
+	v.write(rw, map[string]interface{}{
+		"data": map[string]string{"ciphertext": "vault:v1:" + base64.StdEncoding.EncodeToString(ct)},
+	})
+}
+
+func (v *fakeVault) decrypt(rw http.ResponseWriter, req *http.Request) {
+	body := v.readBody(req)
+
+	ct := v.decode(strings.TrimPrefix(body["ciphertext"], "vault:v1:"))
+	if len(ct) < v.aead.NonceSize() {
+		v.writeError(rw, http.StatusBadRequest, "invalid ciphertext")
+
+		return
+	}
+
+	pt, err := v.aead.Open(nil, ct[:v.aead.NonceSize()], ct[v.aead.NonceSize():], v.decode(body["associated_data"]))
+	if err != nil {
+		v.writeError(rw, http.StatusBadRequest, err.Error())
+
+		return
+	}
+
+	v.write(rw, map[string]interface{}{
+		"data": map[string]string{"plaintext": base64.StdEncoding.EncodeToString(pt)},
+	})
+}
+
+func (v *fakeVault) readBody(req *http.Request) map[string]string {
+	var body map[string]string
+	require.NoError(v.t, json.NewDecoder(req.Body).Decode(&body))
+
+	return body
+}
+
+func (v *fakeVault) decode(s string) []byte {
+	b, err := base64.StdEncoding.DecodeString(s)
+	require.NoError(v.t, err)
+
+	return b
+}
+
+func (v *fakeVault) write(rw http.ResponseWriter, resp interface{}) {
+	require.NoError(v.t, json.NewEncoder(rw).Encode(resp))
+}
+
+func (v *fakeVault) writeError(rw http.ResponseWriter, status int, msg string) {
+	rw.WriteHeader(status)
+	v.write(rw, map[string][]string{"errors": {msg}})
+}
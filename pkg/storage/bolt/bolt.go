@@ -0,0 +1,432 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package bolt
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/aries-framework-go/pkg/storage"
+	"go.etcd.io/bbolt"
+)
+
+const (
+	defaultDBName     = "kms"
+	dbFileExt         = ".db"
+	dbFileMode        = 0600
+	dataDirMode       = 0700
+	openTimeout       = time.Second
+	iteratorBatchSize = 100
+	// endKeySuffix replaces storage.EndKeySuffix in the end key of the iterator. No UTF-8 encoded key contains
+	// 0xff byte, so the range covers all keys with the given prefix.
+	endKeySuffix = "\xff"
+)
+
+// databases keeps database files opened by providers of the process. bbolt holds an exclusive lock on the file,
+// so providers for the same data directory and prefix share one handle.
+var databases = struct { //nolint:gochecknoglobals // process-wide registry of opened database files
+	sync.Mutex
+	open map[string]*database
+}{open: make(map[string]*database)}
+
+type database struct {
+	*bbolt.DB
+	refs int
+}
+
+// Provider is a storage provider backed by an embedded bbolt database file. Each store is kept in a separate
+// bucket of the database. Writes are synced to disk before they are acknowledged.
+type Provider struct {
+	path   string
+	db     *database
+	stores map[string]*store
+	mu     sync.Mutex
+}
+
+// NewProvider returns a new storage provider that keeps data in the database file in the given data directory.
+// The directory is created if it does not exist.
+func NewProvider(dataDir string, opts ...Option) (*Provider, error) {
+	if dataDir == "" {
+		return nil, errors.New("data directory is required")
+	}
+
+	o := &Options{
+		dbName:  defaultDBName,
+		timeout: openTimeout,
+	}
+
+	for i := range opts {
+		opts[i](o)
+	}
+
+	if err := os.MkdirAll(dataDir, dataDirMode); err != nil {
+		return nil, fmt.Errorf("create data directory: %w", err)
+	}
+
+	path, err := filepath.Abs(filepath.Join(dataDir, o.dbName+dbFileExt))
+	if err != nil {
+		return nil, fmt.Errorf("resolve database path: %w", err)
+	}
+
+	db, err := openDatabase(path, o.timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Provider{
+		path:   path,
+		db:     db,
+		stores: make(map[string]*store),
+	}, nil
+}
+
+func openDatabase(path string, timeout time.Duration) (*database, error) {
+	databases.Lock()
+	defer databases.Unlock()
+
+	if db, ok := databases.open[path]; ok {
+		db.refs++
+
+		return db, nil
+	}
+
+	// NoSync is false by default: every committed transaction is fsync'ed.
+	b, err := bbolt.Open(path, dbFileMode, &bbolt.Options{Timeout: timeout})
+	if err != nil {
+		return nil, fmt.Errorf("open database %s: %w", path, err)
+	}
+
+	db := &database{DB: b, refs: 1}
+	databases.open[path] = db
+
+	return db, nil
+}
+
+// OpenStore opens and returns a store for the given namespace. The bucket for the namespace is created if it
+// does not exist.
+func (p *Provider) OpenStore(name string) (storage.Store, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if s, ok := p.stores[name]; ok {
+		return s, nil
+	}
+
+	if p.db == nil {
+		return nil, errors.New("provider is closed")
+	}
+
+	bucket := []byte(name)
+
+	err := p.db.Update(func(tx *bbolt.Tx) error {
+		_, e := tx.CreateBucketIfNotExists(bucket)
+
+		return e
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create bucket %s: %w", name, err)
+	}
+
+	s := &store{db: p.db.DB, bucket: bucket}
+	p.stores[name] = s
+
+	return s, nil
+}
+
+// CloseStore closes the store for the given namespace. Data of the store is kept in the database.
+func (p *Provider) CloseStore(name string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	delete(p.stores, name)
+
+	return nil
+}
+
+// Close closes all stores of the provider. The database file is closed when no other provider uses it.
+func (p *Provider) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.stores = make(map[string]*store)
+
+	if p.db == nil {
+		return nil
+	}
+
+	databases.Lock()
+	defer databases.Unlock()
+
+	p.db.refs--
+
+	db := p.db
+	p.db = nil
+
+	if db.refs > 0 {
+		return nil
+	}
+
+	delete(databases.open, p.path)
+
+	if err := db.Close(); err != nil {
+		return fmt.Errorf("close database: %w", err)
+	}
+
+	return nil
+}
+
+// Options configures Provider.
+type Options struct {
+	dbName  string
+	timeout time.Duration
+}
+
+// Option configures Provider.
+type Option func(o *Options)
+
+// WithDBPrefix sets the prefix of the database file name.
+func WithDBPrefix(prefix string) Option {
+	return func(o *Options) {
+		if prefix != "" {
+			o.dbName = prefix + "_" + defaultDBName
+		}
+	}
+}
+
+// WithTimeout sets the time to wait for the lock on the database file held by another process.
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *Options) {
+		o.timeout = timeout
+	}
+}
+
+type store struct {
+	db     *bbolt.DB
+	bucket []byte
+}
+
+// Put stores the key and the value.
+func (s *store) Put(k string, v []byte) error {
+	if k == "" || v == nil {
+		return errors.New("key and value are mandatory")
+	}
+
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		b, err := s.bucketOf(tx)
+		if err != nil {
+			return err
+		}
+
+		return b.Put([]byte(k), v)
+	})
+}
+
+// PutIf stores the value only if the current value of the key is old, or if the key does not exist when old is nil.
+// It reports whether the value was stored.
+func (s *store) PutIf(k string, old, v []byte) (bool, error) {
+	if k == "" || v == nil {
+		return false, errors.New("key and value are mandatory")
+	}
+
+	stored := false
+
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		b, err := s.bucketOf(tx)
+		if err != nil {
+			return err
+		}
+
+		current := b.Get([]byte(k))
+		if (current == nil) != (old == nil) || !bytes.Equal(current, old) {
+			return nil
+		}
+
+		stored = true
+
+		return b.Put([]byte(k), v)
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return stored, nil
+}
+
+// Get fetches the value for the given key.
+func (s *store) Get(k string) ([]byte, error) {
+	var v []byte
+
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		b, err := s.bucketOf(tx)
+		if err != nil {
+			return err
+		}
+
+		val := b.Get([]byte(k))
+		if val == nil {
+			return storage.ErrDataNotFound
+		}
+
+		// the value is valid only for the life of the transaction
+		v = append([]byte{}, val...)
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return v, nil
+}
+
+// Delete deletes the given key from the store.
+func (s *store) Delete(k string) error {
+	if k == "" {
+		return errors.New("key is mandatory")
+	}
+
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		b, err := s.bucketOf(tx)
+		if err != nil {
+			return err
+		}
+
+		return b.Delete([]byte(k))
+	})
+}
+
+// Iterator returns an iterator over the keys in the range [start, end). An end key with storage.EndKeySuffix
+// covers all keys that begin with the end key without the suffix.
+func (s *store) Iterator(start, end string) storage.StoreIterator {
+	return &iterator{
+		store: s,
+		start: []byte(start),
+		end:   []byte(endKey(end)),
+		first: true,
+	}
+}
+
+// endKey replaces the trailing storage.EndKeySuffix of the end key, so the suffix within the key itself is kept.
+func endKey(end string) string {
+	if !strings.HasSuffix(end, storage.EndKeySuffix) {
+		return end
+	}
+
+	return strings.TrimSuffix(end, storage.EndKeySuffix) + endKeySuffix
+}
+
+func (s *store) bucketOf(tx *bbolt.Tx) (*bbolt.Bucket, error) {
+	b := tx.Bucket(s.bucket)
+	if b == nil {
+		return nil, fmt.Errorf("bucket %s not found", s.bucket)
+	}
+
+	return b, nil
+}
+
+type entry struct {
+	key   []byte
+	value []byte
+}
+
+// iterator reads the range in batches, each in a separate read-only transaction, so that the store can be
+// updated while iterating.
+type iterator struct {
+	store *store
+	start []byte
+	end   []byte
+	batch []entry
+	pos   int
+	first bool
+	done  bool
+	err   error
+}
+
+func (i *iterator) Next() bool {
+	if i.err != nil {
+		return false
+	}
+
+	i.pos++
+
+	if i.pos < len(i.batch) {
+		return true
+	}
+
+	if i.done {
+		return false
+	}
+
+	i.err = i.fetch()
+
+	return i.err == nil && len(i.batch) > 0
+}
+
+func (i *iterator) fetch() error {
+	i.batch = i.batch[:0]
+	i.pos = 0
+
+	return i.store.db.View(func(tx *bbolt.Tx) error {
+		b, err := i.store.bucketOf(tx)
+		if err != nil {
+			return err
+		}
+
+		c := b.Cursor()
+
+		k, v := c.Seek(i.start)
+		if !i.first && k != nil && bytes.Equal(k, i.start) {
+			k, v = c.Next()
+		}
+
+		i.first = false
+
+		for ; k != nil && bytes.Compare(k, i.end) < 0; k, v = c.Next() {
+			if len(i.batch) == iteratorBatchSize {
+				return nil
+			}
+
+			i.batch = append(i.batch, entry{key: append([]byte{}, k...), value: append([]byte{}, v...)})
+			i.start = i.batch[len(i.batch)-1].key
+		}
+
+		i.done = true
+
+		return nil
+	})
+}
+
+func (i *iterator) Release() {
+	i.batch = nil
+	i.done = true
+}
+
+func (i *iterator) Error() error {
+	return i.err
+}
+
+func (i *iterator) Key() []byte {
+	if i.pos >= len(i.batch) {
+		return nil
+	}
+
+	return i.batch[i.pos].key
+}
+
+func (i *iterator) Value() []byte {
+	if i.pos >= len(i.batch) {
+		return nil
+	}
+
+	return i.batch[i.pos].value
+}
@@ -0,0 +1,310 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package bolt_test
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hyperledger/aries-framework-go/pkg/storage"
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/hub-kms/pkg/storage/bolt"
+)
+
+const testStore = "store"
+
+func TestNewProvider(t *testing.T) {
+	t.Run("Create data directory", func(t *testing.T) {
+		dir := filepath.Join(t.TempDir(), "data")
+
+		p, err := bolt.NewProvider(dir, bolt.WithDBPrefix("test"))
+		require.NoError(t, err)
+		require.NoError(t, p.Close())
+
+		_, err = os.Stat(filepath.Join(dir, "test_kms.db"))
+		require.NoError(t, err)
+	})
+
+	t.Run("Fail with empty data directory", func(t *testing.T) {
+		p, err := bolt.NewProvider("")
+		require.Nil(t, p)
+		require.EqualError(t, err, "data directory is required")
+	})
+
+	t.Run("Fail to create data directory", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "file")
+		require.NoError(t, ioutil.WriteFile(file, []byte("data"), 0600))
+
+		_, err := bolt.NewProvider(filepath.Join(file, "data"))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "create data directory")
+	})
+
+	t.Run("Fail to open database", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "kms.db"), []byte("invalid"), 0600))
+
+		_, err := bolt.NewProvider(dir)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "open database")
+	})
+}
+
+func TestProvider_OpenStore(t *testing.T) {
+	t.Run("Data is kept after reopening", func(t *testing.T) {
+		dir := t.TempDir()
+
+		p, err := bolt.NewProvider(dir)
+		require.NoError(t, err)
+
+		s, err := p.OpenStore(testStore)
+		require.NoError(t, err)
+		require.NoError(t, s.Put("key", []byte("value")))
+		require.NoError(t, p.Close())
+
+		p, err = bolt.NewProvider(dir)
+		require.NoError(t, err)
+
+		defer func() { require.NoError(t, p.Close()) }()
+
+		s, err = p.OpenStore(testStore)
+		require.NoError(t, err)
+
+		v, err := s.Get("key")
+		require.NoError(t, err)
+		require.Equal(t, []byte("value"), v)
+	})
+
+	t.Run("Providers for the same directory share the database", func(t *testing.T) {
+		dir := t.TempDir()
+
+		p1, err := bolt.NewProvider(dir)
+		require.NoError(t, err)
+
+		p2, err := bolt.NewProvider(dir)
+		require.NoError(t, err)
+
+		s1, err := p1.OpenStore(testStore)
+		require.NoError(t, err)
+		require.NoError(t, s1.Put("key", []byte("value")))
+		require.NoError(t, p1.Close())
+
+		s2, err := p2.OpenStore(testStore)
+		require.NoError(t, err)
+
+		v, err := s2.Get("key")
+		require.NoError(t, err)
+		require.Equal(t, []byte("value"), v)
+		require.NoError(t, p2.Close())
+	})
+
+	t.Run("Stores are isolated", func(t *testing.T) {
+		p := newProvider(t)
+
+		s1, err := p.OpenStore("store1")
+		require.NoError(t, err)
+		require.NoError(t, s1.Put("key", []byte("value")))
+
+		s2, err := p.OpenStore("store2")
+		require.NoError(t, err)
+
+		_, err = s2.Get("key")
+		require.True(t, errors.Is(err, storage.ErrDataNotFound))
+	})
+
+	t.Run("Fail if provider is closed", func(t *testing.T) {
+		p, err := bolt.NewProvider(t.TempDir())
+		require.NoError(t, err)
+		require.NoError(t, p.Close())
+		require.NoError(t, p.Close(), "close is idempotent")
+
+		_, err = p.OpenStore(testStore)
+		require.EqualError(t, err, "provider is closed")
+	})
+
+	t.Run("Fail with empty store name", func(t *testing.T) {
+		_, err := newProvider(t).OpenStore("")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "create bucket")
+	})
+}
+
+func TestProvider_CloseStore(t *testing.T) {
+	p := newProvider(t)
+
+	s, err := p.OpenStore(testStore)
+	require.NoError(t, err)
+	require.NoError(t, s.Put("key", []byte("value")))
+	require.NoError(t, p.CloseStore(testStore))
+	require.NoError(t, p.CloseStore("not opened"))
+
+	s, err = p.OpenStore(testStore)
+	require.NoError(t, err)
+
+	_, err = s.Get("key")
+	require.NoError(t, err, "data is kept after closing store")
+}
+
+func TestStore(t *testing.T) {
+	s, err := newProvider(t).OpenStore(testStore)
+	require.NoError(t, err)
+
+	t.Run("Put, get and delete", func(t *testing.T) {
+		require.NoError(t, s.Put("key", []byte("value")))
+
+		v, err := s.Get("key")
+		require.NoError(t, err)
+		require.Equal(t, []byte("value"), v)
+
+		require.NoError(t, s.Put("key", []byte("new value")))
+
+		v, err = s.Get("key")
+		require.NoError(t, err)
+		require.Equal(t, []byte("new value"), v)
+
+		require.NoError(t, s.Delete("key"))
+
+		_, err = s.Get("key")
+		require.True(t, errors.Is(err, storage.ErrDataNotFound))
+	})
+
+	t.Run("Put if value is unchanged", func(t *testing.T) {
+		cs, ok := s.(interface {
+			PutIf(k string, old, v []byte) (bool, error)
+		})
+		require.True(t, ok)
+
+		stored, err := cs.PutIf("cas", nil, []byte("value"))
+		require.NoError(t, err)
+		require.True(t, stored)
+
+		stored, err = cs.PutIf("cas", nil, []byte("other"))
+		require.NoError(t, err)
+		require.False(t, stored)
+
+		stored, err = cs.PutIf("cas", []byte("other"), []byte("new value"))
+		require.NoError(t, err)
+		require.False(t, stored)
+
+		stored, err = cs.PutIf("cas", []byte("value"), []byte("new value"))
+		require.NoError(t, err)
+		require.True(t, stored)
+
+		v, err := s.Get("cas")
+		require.NoError(t, err)
+		require.Equal(t, []byte("new value"), v)
+
+		_, err = cs.PutIf("", nil, []byte("value"))
+		require.EqualError(t, err, "key and value are mandatory")
+	})
+
+	t.Run("Fail with invalid arguments", func(t *testing.T) {
+		require.EqualError(t, s.Put("", []byte("value")), "key and value are mandatory")
+		require.EqualError(t, s.Put("key", nil), "key and value are mandatory")
+		require.EqualError(t, s.Delete(""), "key is mandatory")
+	})
+}
+
+func TestStore_Iterator(t *testing.T) {
+	s, err := newProvider(t).OpenStore(testStore)
+	require.NoError(t, err)
+
+	const count = 250 // more than one batch
+
+	for i := 0; i < count; i++ {
+		require.NoError(t, s.Put(fmt.Sprintf("abc_%03d", i), []byte(fmt.Sprintf("value_%d", i))))
+	}
+
+	require.NoError(t, s.Put("abd_000", []byte("other")))
+
+	t.Run("Iterate over keys with prefix", func(t *testing.T) {
+		keys := collect(t, s.Iterator("abc_", "abc_"+storage.EndKeySuffix))
+		require.Len(t, keys, count)
+		require.Equal(t, "abc_000", keys[0])
+		require.Equal(t, "abc_249", keys[count-1])
+	})
+
+	t.Run("End key is excluded", func(t *testing.T) {
+		keys := collect(t, s.Iterator("abc_010", "abc_020"))
+		require.Len(t, keys, 10)
+		require.Equal(t, "abc_010", keys[0])
+		require.Equal(t, "abc_019", keys[9])
+	})
+
+	t.Run("Empty range", func(t *testing.T) {
+		require.Empty(t, collect(t, s.Iterator("x", "x"+storage.EndKeySuffix)))
+		require.Empty(t, collect(t, s.Iterator("abc_", "")))
+	})
+
+	t.Run("Prefix contains end key suffix", func(t *testing.T) {
+		require.NoError(t, s.Put("x!!a_1", []byte("value")))
+		require.NoError(t, s.Put("x!!a_2", []byte("value")))
+		require.NoError(t, s.Put("x!!b", []byte("other")))
+
+		require.Equal(t, []string{"x!!a_1", "x!!a_2"}, collect(t, s.Iterator("x!!a_", "x!!a_"+storage.EndKeySuffix)))
+	})
+
+	t.Run("Store can be updated while iterating", func(t *testing.T) {
+		it := s.Iterator("abc_", "abc_"+storage.EndKeySuffix)
+
+		n := 0
+
+		for it.Next() {
+			require.NoError(t, s.Delete(string(it.Key())))
+			n++
+		}
+
+		require.NoError(t, it.Error())
+		require.Equal(t, count, n)
+		require.Empty(t, collect(t, s.Iterator("abc_", "abc_"+storage.EndKeySuffix)))
+	})
+
+	t.Run("Release stops iteration", func(t *testing.T) {
+		it := s.Iterator("abd_", "abd_"+storage.EndKeySuffix)
+		require.Nil(t, it.Key())
+
+		it.Release()
+		require.False(t, it.Next())
+		require.Nil(t, it.Value())
+	})
+}
+
+func collect(t *testing.T, it storage.StoreIterator) []string {
+	t.Helper()
+
+	defer it.Release()
+
+	var keys []string
+
+	for it.Next() {
+		require.NotEmpty(t, it.Value())
+
+		keys = append(keys, string(it.Key()))
+	}
+
+	require.NoError(t, it.Error())
+
+	return keys
+}
+
+func newProvider(t *testing.T) *bolt.Provider {
+	t.Helper()
+
+	p, err := bolt.NewProvider(t.TempDir())
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		require.NoError(t, p.Close())
+	})
+
+	return p
+}
@@ -0,0 +1,249 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package encryptedcache
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/hyperledger/aries-framework-go/pkg/storage"
+	"github.com/trustbloc/edge-core/pkg/log"
+
+	"github.com/trustbloc/hub-kms/pkg/storage/cache"
+)
+
+const keySize = 32
+
+// Provider wraps a cache storage provider and seals every cached value with AES-GCM under an ephemeral key. The key
+// is generated when the provider is created and is never persisted, so values cached by another process (e.g. in a
+// shared Redis cache) or left in a heap dump can't be decrypted without the memory of this process.
+type Provider struct {
+	provider   storage.Provider
+	aead       cipher.AEAD
+	randReader io.Reader
+	logger     log.Logger
+}
+
+// NewProvider returns a new provider that encrypts values of the given cache storage provider.
+func NewProvider(p storage.Provider, opts ...Option) (*Provider, error) {
+	o := &Options{
+		randReader: rand.Reader,
+		logger:     log.New("hub-kms/encryptedcache"),
+	}
+
+	for i := range opts {
+		opts[i](o)
+	}
+
+	key := make([]byte, keySize)
+	defer zeroize(key)
+
+	if _, err := io.ReadFull(o.randReader, key); err != nil {
+		return nil, fmt.Errorf("generate cache key: %w", err)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("create cipher: %w", err)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("create gcm: %w", err)
+	}
+
+	return &Provider{
+		provider:   p,
+		aead:       aead,
+		randReader: o.randReader,
+		logger:     o.logger,
+	}, nil
+}
+
+// OpenStore opens the cache store for the given namespace.
+func (p *Provider) OpenStore(name string) (storage.Store, error) {
+	s, err := p.provider.OpenStore(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &encryptedStore{store: s, name: name, provider: p}, nil
+}
+
+// CloseStore closes the cache store for the given namespace.
+func (p *Provider) CloseStore(name string) error {
+	return p.provider.CloseStore(name)
+}
+
+// Close closes the wrapped provider.
+func (p *Provider) Close() error {
+	return p.provider.Close()
+}
+
+// Stats returns statistics of the wrapped provider if it collects them.
+func (p *Provider) Stats() map[string]cache.Stats {
+	if sp, ok := p.provider.(interface{ Stats() map[string]cache.Stats }); ok {
+		return sp.Stats()
+	}
+
+	return nil
+}
+
+// Options configures Provider.
+type Options struct {
+	randReader io.Reader
+	logger     log.Logger
+}
+
+// Option configures Options.
+type Option func(options *Options)
+
+// WithRandReader sets the source of the key and nonces. Defaults to crypto/rand.
+func WithRandReader(r io.Reader) Option {
+	return func(o *Options) {
+		o.randReader = r
+	}
+}
+
+// WithLogger sets the custom logger.
+func WithLogger(l log.Logger) Option {
+	return func(o *Options) {
+		o.logger = l
+	}
+}
+
+type encryptedStore struct {
+	store    storage.Store
+	name     string
+	provider *Provider
+}
+
+// Get fetches and decrypts the value. A value that can't be decrypted, e.g. cached by another process, is a cache
+// miss.
+func (s *encryptedStore) Get(k string) ([]byte, error) {
+	v, err := s.store.Get(k)
+	if err != nil {
+		return nil, err
+	}
+
+	v, err = s.open(k, v)
+	if err != nil {
+		s.provider.logger.Debugf("invalid value of key %q in cache %q: %s", k, s.name, err)
+
+		return nil, storage.ErrDataNotFound
+	}
+
+	return v, nil
+}
+
+// Put encrypts and stores the value.
+func (s *encryptedStore) Put(k string, v []byte) error {
+	sealed, err := s.seal(k, v)
+	if err != nil {
+		return err
+	}
+
+	return s.store.Put(k, sealed)
+}
+
+// PutNotFound marks the key as not found in the source if the wrapped store supports negative caching.
+func (s *encryptedStore) PutNotFound(k string) error {
+	nc, ok := s.store.(cache.NegativeCache)
+	if !ok {
+		return nil
+	}
+
+	return nc.PutNotFound(k)
+}
+
+// Delete removes the key from the cache.
+func (s *encryptedStore) Delete(k string) error {
+	return s.store.Delete(k)
+}
+
+// Iterator returns an iterator over decrypted values. Values that can't be decrypted are skipped.
+func (s *encryptedStore) Iterator(start, end string) storage.StoreIterator {
+	return &iterator{store: s, it: s.store.Iterator(start, end)}
+}
+
+// seal encrypts the value with the store name and key as the associated data, so encrypted values can't be swapped
+// between keys.
+func (s *encryptedStore) seal(k string, v []byte) ([]byte, error) {
+	aead := s.provider.aead
+
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(v)+aead.Overhead())
+
+	if _, err := io.ReadFull(s.provider.randReader, nonce); err != nil {
+		return nil, fmt.Errorf("generate nonce: %w", err)
+	}
+
+	return aead.Seal(nonce, nonce, v, s.additionalData(k)), nil
+}
+
+func (s *encryptedStore) open(k string, v []byte) ([]byte, error) {
+	aead := s.provider.aead
+
+	if len(v) < aead.NonceSize() {
+		return nil, errors.New("ciphertext is too short")
+	}
+
+	return aead.Open(nil, v[:aead.NonceSize()], v[aead.NonceSize():], s.additionalData(k))
+}
+
+func (s *encryptedStore) additionalData(k string) []byte {
+	return []byte(s.name + "\x00" + k)
+}
+
+type iterator struct {
+	store *encryptedStore
+	it    storage.StoreIterator
+	value []byte
+}
+
+func (i *iterator) Next() bool {
+	for i.it.Next() {
+		v, err := i.store.open(string(i.it.Key()), i.it.Value())
+		if err != nil {
+			continue
+		}
+
+		i.value = v
+
+		return true
+	}
+
+	i.value = nil
+
+	return false
+}
+
+func (i *iterator) Release() {
+	i.value = nil
+	i.it.Release()
+}
+
+func (i *iterator) Error() error {
+	return i.it.Error()
+}
+
+func (i *iterator) Key() []byte {
+	return i.it.Key()
+}
+
+func (i *iterator) Value() []byte {
+	return i.value
+}
+
+func zeroize(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
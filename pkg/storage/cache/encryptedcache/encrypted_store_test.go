@@ -0,0 +1,202 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package encryptedcache_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	mockstorage "github.com/hyperledger/aries-framework-go/pkg/mock/storage"
+	"github.com/hyperledger/aries-framework-go/pkg/storage"
+	"github.com/stretchr/testify/require"
+	"github.com/trustbloc/edge-core/pkg/log/mocklogger"
+
+	"github.com/trustbloc/hub-kms/pkg/storage/cache"
+	"github.com/trustbloc/hub-kms/pkg/storage/cache/encryptedcache"
+)
+
+const testStore = "store"
+
+func TestNewProvider(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		p, err := encryptedcache.NewProvider(cache.NewProvider())
+		require.NoError(t, err)
+		require.NotNil(t, p)
+		require.NoError(t, p.CloseStore(testStore))
+		require.NoError(t, p.Close())
+	})
+
+	t.Run("Fail to generate key", func(t *testing.T) {
+		_, err := encryptedcache.NewProvider(cache.NewProvider(),
+			encryptedcache.WithRandReader(bytes.NewReader(nil)))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "generate cache key")
+	})
+
+	t.Run("Fail to open store", func(t *testing.T) {
+		mp := mockstorage.NewMockStoreProvider()
+		mp.ErrOpenStoreHandle = errors.New("open error")
+
+		p, err := encryptedcache.NewProvider(mp)
+		require.NoError(t, err)
+
+		_, err = p.OpenStore(testStore)
+		require.EqualError(t, err, "open error")
+	})
+}
+
+func TestEncryptedStore(t *testing.T) {
+	t.Run("Put, get and delete", func(t *testing.T) {
+		mp := mockstorage.NewMockStoreProvider()
+		s := openStore(t, mp)
+
+		require.NoError(t, s.Put("key", []byte("secret share")))
+		require.NotContains(t, string(mp.Store.Store["key"]), "secret share")
+
+		v, err := s.Get("key")
+		require.NoError(t, err)
+		require.Equal(t, []byte("secret share"), v)
+
+		require.NoError(t, s.Delete("key"))
+
+		_, err = s.Get("key")
+		require.True(t, errors.Is(err, storage.ErrDataNotFound))
+	})
+
+	t.Run("Value sealed by another process is a cache miss", func(t *testing.T) {
+		mp := mockstorage.NewMockStoreProvider()
+		logger := &mocklogger.MockLogger{}
+
+		require.NoError(t, openStore(t, mp).Put("key", []byte("value")))
+
+		s := openStore(t, mp, encryptedcache.WithLogger(logger))
+
+		_, err := s.Get("key")
+		require.True(t, errors.Is(err, storage.ErrDataNotFound))
+		require.Contains(t, logger.DebugLogContents, `invalid value of key "key" in cache "store"`)
+
+		mp.Store.Store["short"] = []byte("x")
+
+		_, err = s.Get("short")
+		require.True(t, errors.Is(err, storage.ErrDataNotFound))
+	})
+
+	t.Run("Value moved to another key is a cache miss", func(t *testing.T) {
+		mp := mockstorage.NewMockStoreProvider()
+		s := openStore(t, mp)
+
+		require.NoError(t, s.Put("key", []byte("value")))
+		mp.Store.Store["other"] = mp.Store.Store["key"]
+
+		_, err := s.Get("other")
+		require.True(t, errors.Is(err, storage.ErrDataNotFound))
+	})
+
+	t.Run("Fail to generate nonce", func(t *testing.T) {
+		key := bytes.Repeat([]byte{1}, 32)
+
+		p, err := encryptedcache.NewProvider(cache.NewProvider(),
+			encryptedcache.WithRandReader(bytes.NewReader(key)))
+		require.NoError(t, err)
+
+		s, err := p.OpenStore(testStore)
+		require.NoError(t, err)
+
+		err = s.Put("key", []byte("value"))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "generate nonce")
+	})
+
+	t.Run("Fail to get from the wrapped store", func(t *testing.T) {
+		mp := mockstorage.NewMockStoreProvider()
+		mp.Store.ErrGet = errors.New("get error")
+
+		_, err := openStore(t, mp).Get("key")
+		require.EqualError(t, err, "get error")
+	})
+}
+
+func TestNegativeCaching(t *testing.T) {
+	t.Run("Forwarded to the wrapped store", func(t *testing.T) {
+		cp := cache.NewProvider(cache.WithNegativeExpiration(time.Minute))
+
+		p, err := encryptedcache.NewProvider(cp)
+		require.NoError(t, err)
+
+		s, err := p.OpenStore(testStore)
+		require.NoError(t, err)
+
+		require.NoError(t, s.(cache.NegativeCache).PutNotFound("key"))
+
+		_, err = s.Get("key")
+		require.True(t, errors.Is(err, cache.ErrCachedNotFound))
+		require.Equal(t, uint64(1), p.Stats()[testStore].NegativeHits)
+	})
+
+	t.Run("Noop if the wrapped store does not support it", func(t *testing.T) {
+		p, err := encryptedcache.NewProvider(mockstorage.NewMockStoreProvider())
+		require.NoError(t, err)
+		require.Nil(t, p.Stats())
+
+		s, err := p.OpenStore(testStore)
+		require.NoError(t, err)
+
+		require.NoError(t, s.(cache.NegativeCache).PutNotFound("key"))
+	})
+}
+
+func TestIterator(t *testing.T) {
+	mp := mockstorage.NewMockStoreProvider()
+
+	p, err := encryptedcache.NewProvider(cache.NewProvider())
+	require.NoError(t, err)
+
+	s, err := p.OpenStore(testStore)
+	require.NoError(t, err)
+
+	for _, k := range []string{"abc_2", "abc_1", "abd_1"} {
+		require.NoError(t, s.Put(k, []byte("value "+k)))
+	}
+
+	it := s.Iterator("abc_", "abc_"+storage.EndKeySuffix)
+
+	var keys []string
+
+	for it.Next() {
+		require.Equal(t, []byte("value "+string(it.Key())), it.Value())
+
+		keys = append(keys, string(it.Key()))
+	}
+
+	require.NoError(t, it.Error())
+	require.Equal(t, []string{"abc_1", "abc_2"}, keys)
+
+	it.Release()
+	require.Nil(t, it.Value())
+
+	t.Run("Values sealed by another process are skipped", func(t *testing.T) {
+		require.NoError(t, openStore(t, mp).Put("key", []byte("value")))
+
+		it := openStore(t, mp).Iterator("", storage.EndKeySuffix)
+		require.False(t, it.Next())
+		require.Nil(t, it.Value())
+	})
+}
+
+func openStore(t *testing.T, mp storage.Provider, opts ...encryptedcache.Option) storage.Store {
+	t.Helper()
+
+	p, err := encryptedcache.NewProvider(mp, opts...)
+	require.NoError(t, err)
+
+	s, err := p.OpenStore(testStore)
+	require.NoError(t, err)
+
+	return s
+}
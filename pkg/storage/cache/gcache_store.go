@@ -9,7 +9,10 @@ package cache
 import (
 	"errors"
 	"fmt"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/bluele/gcache"
@@ -19,34 +22,70 @@ import (
 
 const (
 	cacheExpMinutes = 10
+	// endKeySuffix replaces storage.EndKeySuffix in the end key of the iterator. It is the largest Unicode code point,
+	// so the range covers all keys with the given prefix.
+	endKeySuffix = "\U0010FFFF"
 )
 
+// Eviction policies of bounded cache stores.
+const (
+	EvictionLRU = gcache.TYPE_LRU // least recently used
+	EvictionLFU = gcache.TYPE_LFU // least frequently used
+	EvictionARC = gcache.TYPE_ARC // adaptive replacement cache
+)
+
+// ErrCachedNotFound is returned by Get for a key marked as not found in the source with PutNotFound. It wraps
+// storage.ErrDataNotFound, so callers unaware of negative caching treat it as a cache miss.
+var ErrCachedNotFound = fmt.Errorf("%w: cached", storage.ErrDataNotFound)
+
 // GCache represents GCache implementation.
 type GCache interface {
 	Get(key interface{}) (interface{}, error)
 	SetWithExpire(key, value interface{}, expiration time.Duration) error
 	Remove(key interface{}) bool
 	Purge()
+	GetALL(checkExpired bool) map[interface{}]interface{}
 }
 
 // Creator defines function to create a new GCache instance.
 type Creator func() GCache
 
+// NegativeCache is implemented by cache stores that remember keys not found in the source for a short time, so that
+// the source is not queried again for them.
+type NegativeCache interface {
+	PutNotFound(k string) error
+}
+
+// Stats contains statistics of a cache store. Evictions counts entries dropped because of the size limit or
+// expiration, not the deleted ones.
+type Stats struct {
+	Hits         uint64 `json:"hits"`
+	Misses       uint64 `json:"misses"`
+	NegativeHits uint64 `json:"negativeHits"`
+	Evictions    uint64 `json:"evictions"`
+}
+
+// negativeEntry is cached for keys not found in the source.
+type negativeEntry struct{}
+
 // Provider contains dependencies for a storage provider based on GCache.
 type Provider struct {
-	cacheList map[string]*cacheStore
-	gcCreator Creator
-	exp       time.Duration
-	logger    log.Logger
-	mu        sync.RWMutex
+	cacheList      map[string]*cacheStore
+	gcCreator      Creator
+	exp            time.Duration
+	size           int
+	evictionPolicy string
+	negativeExp    time.Duration
+	logger         log.Logger
+	mu             sync.RWMutex
 }
 
 // NewProvider returns a new storage provider instance based on GCache.
 func NewProvider(opts ...Option) *Provider {
 	o := &Options{
-		gcCreator: func() GCache { return gcache.New(0).Build() },
-		exp:       cacheExpMinutes * time.Minute,
-		logger:    log.New("hub-kms/cache"),
+		exp:            cacheExpMinutes * time.Minute,
+		evictionPolicy: EvictionLRU,
+		logger:         log.New("hub-kms/cache"),
 	}
 
 	for i := range opts {
@@ -54,10 +93,13 @@ func NewProvider(opts ...Option) *Provider {
 	}
 
 	return &Provider{
-		cacheList: make(map[string]*cacheStore),
-		gcCreator: o.gcCreator,
-		exp:       o.exp,
-		logger:    o.logger,
+		cacheList:      make(map[string]*cacheStore),
+		gcCreator:      o.gcCreator,
+		exp:            o.exp,
+		size:           o.size,
+		evictionPolicy: o.evictionPolicy,
+		negativeExp:    o.negativeExp,
+		logger:         o.logger,
 	}
 }
 
@@ -69,12 +111,14 @@ func (p *Provider) OpenStore(name string) (storage.Store, error) {
 	s, ok := p.cacheList[name]
 	if !ok {
 		s = &cacheStore{
-			name:   name,
-			gc:     p.gcCreator(),
-			exp:    p.exp,
-			logger: p.logger,
+			name:        name,
+			exp:         p.exp,
+			negativeExp: p.negativeExp,
+			logger:      p.logger,
 		}
 
+		s.gc = p.newGCache(s)
+
 		p.cacheList[name] = s
 
 		p.logger.Debugf("new cache %q created", name)
@@ -85,6 +129,23 @@ func (p *Provider) OpenStore(name string) (storage.Store, error) {
 	return s, nil
 }
 
+// newGCache creates a cache for the store. Without the custom creator the cache is unbounded, or holds up to the
+// maximum size of entries evicted with the configured policy. Values evicted, expired or purged from the cache are
+// zeroized.
+func (p *Provider) newGCache(s *cacheStore) GCache {
+	if p.gcCreator != nil {
+		return p.gcCreator()
+	}
+
+	b := gcache.New(p.size).EvictedFunc(s.evicted).PurgeVisitorFunc(zeroize)
+
+	if p.size > 0 {
+		b = b.EvictType(p.evictionPolicy)
+	}
+
+	return b.Build()
+}
+
 // CloseStore purges cache store for the given namespace.
 func (p *Provider) CloseStore(name string) error {
 	p.mu.Lock()
@@ -95,7 +156,7 @@ func (p *Provider) CloseStore(name string) error {
 		return nil
 	}
 
-	s.gc.Purge()
+	s.purge()
 	delete(p.cacheList, name)
 
 	return nil
@@ -107,7 +168,7 @@ func (p *Provider) Close() error {
 	defer p.mu.Unlock()
 
 	for _, s := range p.cacheList {
-		s.gc.Purge()
+		s.purge()
 	}
 
 	p.cacheList = make(map[string]*cacheStore)
@@ -115,17 +176,35 @@ func (p *Provider) Close() error {
 	return nil
 }
 
+// Stats returns statistics of opened cache stores by namespace.
+func (p *Provider) Stats() map[string]Stats {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	stats := make(map[string]Stats, len(p.cacheList))
+
+	for name, s := range p.cacheList {
+		stats[name] = s.stats()
+	}
+
+	return stats
+}
+
 // Options configures Provider dependencies.
 type Options struct {
-	gcCreator Creator
-	exp       time.Duration
-	logger    log.Logger
+	gcCreator      Creator
+	exp            time.Duration
+	size           int
+	evictionPolicy string
+	negativeExp    time.Duration
+	logger         log.Logger
 }
 
 // Option configures Options.
 type Option func(options *Options)
 
-// WithGCacheCreator sets the function to create a new GCache instance.
+// WithGCacheCreator sets the function to create a new GCache instance. Size and eviction policy options are not
+// applied to caches from the custom creator.
 func WithGCacheCreator(c Creator) Option {
 	return func(o *Options) {
 		o.gcCreator = c
@@ -139,6 +218,29 @@ func WithExpiration(d time.Duration) Option {
 	}
 }
 
+// WithMaxSize sets the maximum number of entries in each cache store. Stores are unbounded if not set.
+func WithMaxSize(size int) Option {
+	return func(o *Options) {
+		o.size = size
+	}
+}
+
+// WithEvictionPolicy sets the policy to evict entries from bounded cache stores: EvictionLRU (default), EvictionLFU
+// or EvictionARC.
+func WithEvictionPolicy(policy string) Option {
+	return func(o *Options) {
+		o.evictionPolicy = policy
+	}
+}
+
+// WithNegativeExpiration enables negative caching: keys marked with PutNotFound are reported as not found with
+// ErrCachedNotFound for the given duration.
+func WithNegativeExpiration(d time.Duration) Option {
+	return func(o *Options) {
+		o.negativeExp = d
+	}
+}
+
 // WithLogger sets the custom logger.
 func WithLogger(l log.Logger) Option {
 	return func(o *Options) {
@@ -146,19 +248,33 @@ func WithLogger(l log.Logger) Option {
 	}
 }
 
-// Store is a store backed by GCache.
+// Store is a store backed by GCache. Values are copied in and out of the cache under the lock, so that they can be
+// zeroized on eviction without affecting callers.
 type cacheStore struct {
-	name   string
-	gc     GCache
-	exp    time.Duration
-	logger log.Logger
+	// counters are accessed atomically and kept first for 64-bit alignment
+	hits         uint64
+	misses       uint64
+	negativeHits uint64
+	evictions    uint64
+
+	name        string
+	gc          GCache
+	exp         time.Duration
+	negativeExp time.Duration
+	deleting    bool
+	logger      log.Logger
+	mu          sync.Mutex
 }
 
 // Get fetches value from the cache by key.
 func (s *cacheStore) Get(k string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	v, err := s.gc.Get(k)
 	if err != nil {
 		if errors.Is(err, gcache.KeyNotFoundError) {
+			atomic.AddUint64(&s.misses, 1)
 			s.logger.Debugf("no key %q in cache %q", k, s.name)
 
 			return nil, storage.ErrDataNotFound
@@ -167,14 +283,25 @@ func (s *cacheStore) Get(k string) ([]byte, error) {
 		return nil, fmt.Errorf("get from cache: %w", err)
 	}
 
+	if _, ok := v.(negativeEntry); ok {
+		atomic.AddUint64(&s.negativeHits, 1)
+		s.logger.Debugf("key %q is cached as not found in cache %q", k, s.name)
+
+		return nil, ErrCachedNotFound
+	}
+
+	atomic.AddUint64(&s.hits, 1)
 	s.logger.Debugf("get key %q from cache %q", k, s.name)
 
-	return v.([]byte), nil
+	return copyBytes(v.([]byte)), nil
 }
 
 // Put stores a new key-value pair with an expiration time set for the cacheStore instance.
 func (s *cacheStore) Put(k string, v []byte) error {
-	err := s.gc.SetWithExpire(k, v, s.exp)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.gc.SetWithExpire(k, copyBytes(v), s.exp)
 	if err != nil {
 		return fmt.Errorf("set to cache: %w", err)
 	}
@@ -184,8 +311,34 @@ func (s *cacheStore) Put(k string, v []byte) error {
 	return nil
 }
 
+// PutNotFound marks the key as not found in the source. It is a noop if negative caching is disabled.
+func (s *cacheStore) PutNotFound(k string) error {
+	if s.negativeExp <= 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.gc.SetWithExpire(k, negativeEntry{}, s.negativeExp)
+	if err != nil {
+		return fmt.Errorf("set to cache: %w", err)
+	}
+
+	s.logger.Debugf("save key %q into cache %q as not found", k, s.name)
+
+	return nil
+}
+
 // Delete removes key and associated value from the cache.
 func (s *cacheStore) Delete(k string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// removed entries are not counted as evicted
+	s.deleting = true
+	defer func() { s.deleting = false }()
+
 	if ok := s.gc.Remove(k); ok {
 		s.logger.Debugf("delete key %q from cache %q", k, s.name)
 	}
@@ -193,7 +346,134 @@ func (s *cacheStore) Delete(k string) error {
 	return nil
 }
 
-// Iterator returns store iterator (not implemented).
-func (s *cacheStore) Iterator(startKey, endKey string) storage.StoreIterator {
-	panic("implement me")
+// Iterator returns an iterator over live entries in the range [start, end). An end key with storage.EndKeySuffix
+// covers all keys that begin with the end key without the suffix. The iterator works on a snapshot of the cache.
+func (s *cacheStore) Iterator(start, end string) storage.StoreIterator {
+	end = endKey(end)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var entries []entry
+
+	for key, value := range s.gc.GetALL(true) {
+		k, ok := key.(string)
+		if !ok || k < start || k >= end {
+			continue
+		}
+
+		v, ok := value.([]byte)
+		if !ok { // negative entry
+			continue
+		}
+
+		entries = append(entries, entry{key: []byte(k), value: copyBytes(v)})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return string(entries[i].key) < string(entries[j].key)
+	})
+
+	return &iterator{entries: entries, pos: -1}
+}
+
+// endKey replaces the trailing storage.EndKeySuffix of the end key, so the suffix within the key itself is kept.
+func endKey(end string) string {
+	if !strings.HasSuffix(end, storage.EndKeySuffix) {
+		return end
+	}
+
+	return strings.TrimSuffix(end, storage.EndKeySuffix) + endKeySuffix
+}
+
+// evicted is called by GCache with the store lock held.
+func (s *cacheStore) evicted(key, value interface{}) {
+	zeroize(key, value)
+
+	if s.deleting {
+		return
+	}
+
+	atomic.AddUint64(&s.evictions, 1)
+}
+
+func (s *cacheStore) purge() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.gc.Purge()
+}
+
+// zeroize overwrites the value removed from the cache on a best-effort basis. Expired values are removed, and
+// zeroized, when accessed or evicted.
+func zeroize(_, value interface{}) {
+	if v, ok := value.([]byte); ok {
+		for i := range v {
+			v[i] = 0
+		}
+	}
+}
+
+func copyBytes(v []byte) []byte {
+	if v == nil {
+		return nil
+	}
+
+	c := make([]byte, len(v))
+	copy(c, v)
+
+	return c
+}
+
+func (s *cacheStore) stats() Stats {
+	return Stats{
+		Hits:         atomic.LoadUint64(&s.hits),
+		Misses:       atomic.LoadUint64(&s.misses),
+		NegativeHits: atomic.LoadUint64(&s.negativeHits),
+		Evictions:    atomic.LoadUint64(&s.evictions),
+	}
+}
+
+type entry struct {
+	key   []byte
+	value []byte
+}
+
+type iterator struct {
+	entries []entry
+	pos     int
+}
+
+func (i *iterator) Next() bool {
+	if i.pos >= len(i.entries) {
+		return false
+	}
+
+	i.pos++
+
+	return i.pos < len(i.entries)
+}
+
+func (i *iterator) Release() {
+	i.entries = nil
+}
+
+func (i *iterator) Error() error {
+	return nil
+}
+
+func (i *iterator) Key() []byte {
+	if i.pos < 0 || i.pos >= len(i.entries) {
+		return nil
+	}
+
+	return i.entries[i.pos].key
+}
+
+func (i *iterator) Value() []byte {
+	if i.pos < 0 || i.pos >= len(i.entries) {
+		return nil
+	}
+
+	return i.entries[i.pos].value
 }
@@ -266,14 +266,246 @@ func TestDelete(t *testing.T) {
 	})
 }
 
+func TestValuesAreCopied(t *testing.T) {
+	p := cache.NewProvider(cache.WithMaxSize(1))
+
+	store, err := p.OpenStore(testStore)
+	require.NoError(t, err)
+
+	value := []byte("value")
+	require.NoError(t, store.Put("key", value))
+
+	value[0] = 'X' // caller's buffer is not cached
+
+	v, err := store.Get("key")
+	require.NoError(t, err)
+	require.Equal(t, []byte("value"), v)
+
+	require.NoError(t, store.Put("other", []byte("other"))) // evicts and zeroizes the cached value of "key"
+
+	require.Equal(t, []byte("value"), v, "returned value is not zeroized")
+	require.Equal(t, []byte("Xalue"), value)
+}
+
 func TestIterator(t *testing.T) {
-	p := cache.NewProvider()
+	p := cache.NewProvider(cache.WithNegativeExpiration(time.Minute))
 
 	store, err := p.OpenStore(testStore)
-	require.NotNil(t, store)
 	require.NoError(t, err)
 
-	require.Panics(t, func() { store.Iterator("startKey", "endKey") }) // Iterator is not implemented
+	for _, k := range []string{"abc_2", "abc_1", "abc_3", "abd_1"} {
+		require.NoError(t, store.Put(k, []byte("value "+k)))
+	}
+
+	require.NoError(t, store.(cache.NegativeCache).PutNotFound("abc_4"))
+
+	t.Run("iterate over keys with prefix in order", func(t *testing.T) {
+		it := store.Iterator("abc_", "abc_"+storage.EndKeySuffix)
+		require.Nil(t, it.Key())
+
+		var keys []string
+
+		for it.Next() {
+			require.Equal(t, []byte("value "+string(it.Key())), it.Value())
+
+			keys = append(keys, string(it.Key()))
+		}
+
+		require.NoError(t, it.Error())
+		require.Equal(t, []string{"abc_1", "abc_2", "abc_3"}, keys) // negative entry is skipped
+
+		it.Release()
+		require.False(t, it.Next())
+		require.Nil(t, it.Value())
+	})
+
+	t.Run("end key is excluded", func(t *testing.T) {
+		it := store.Iterator("abc_1", "abc_3")
+
+		var keys []string
+
+		for it.Next() {
+			keys = append(keys, string(it.Key()))
+		}
+
+		require.Equal(t, []string{"abc_1", "abc_2"}, keys)
+	})
+
+	t.Run("prefix contains end key suffix", func(t *testing.T) {
+		require.NoError(t, store.Put("x!!a_1", []byte("value x!!a_1")))
+		require.NoError(t, store.Put("x!!b", []byte("value x!!b")))
+
+		it := store.Iterator("x!!a_", "x!!a_"+storage.EndKeySuffix)
+
+		var keys []string
+
+		for it.Next() {
+			keys = append(keys, string(it.Key()))
+		}
+
+		require.Equal(t, []string{"x!!a_1"}, keys)
+	})
+
+	t.Run("expired entries are skipped", func(t *testing.T) {
+		clock := gcache.NewFakeClock()
+		gc := gcache.New(0).Clock(clock).Build()
+
+		s, err := cache.NewProvider(
+			cache.WithGCacheCreator(func() cache.GCache {
+				return gc
+			}),
+			cache.WithExpiration(time.Minute),
+		).OpenStore(testStore)
+		require.NoError(t, err)
+
+		require.NoError(t, s.Put("key", []byte("value")))
+
+		clock.Advance(2 * time.Minute)
+
+		it := s.Iterator("", storage.EndKeySuffix)
+		require.False(t, it.Next())
+	})
+}
+
+func TestMaxSize(t *testing.T) {
+	for _, policy := range []string{cache.EvictionLRU, cache.EvictionLFU, cache.EvictionARC} {
+		pol := policy
+		t.Run("evict entries with "+pol+" policy", func(t *testing.T) {
+			p := cache.NewProvider(cache.WithMaxSize(2), cache.WithEvictionPolicy(pol))
+
+			store, err := p.OpenStore(testStore)
+			require.NoError(t, err)
+
+			for _, k := range []string{"key1", "key2", "key3"} {
+				require.NoError(t, store.Put(k, []byte("value")))
+			}
+
+			var n int
+
+			it := store.Iterator("", storage.EndKeySuffix)
+			for it.Next() {
+				n++
+			}
+
+			require.Equal(t, 2, n)
+			require.Equal(t, uint64(1), p.Stats()[testStore].Evictions)
+		})
+	}
+
+	t.Run("least recently used entry is evicted", func(t *testing.T) {
+		p := cache.NewProvider(cache.WithMaxSize(2))
+
+		store, err := p.OpenStore(testStore)
+		require.NoError(t, err)
+
+		require.NoError(t, store.Put("key1", []byte("value")))
+		require.NoError(t, store.Put("key2", []byte("value")))
+
+		_, err = store.Get("key1")
+		require.NoError(t, err)
+
+		require.NoError(t, store.Put("key3", []byte("value")))
+
+		_, err = store.Get("key2")
+		require.True(t, errors.Is(err, storage.ErrDataNotFound))
+
+		_, err = store.Get("key1")
+		require.NoError(t, err)
+	})
+
+	t.Run("deleted entries are not counted as evicted", func(t *testing.T) {
+		p := cache.NewProvider(cache.WithMaxSize(2))
+
+		store, err := p.OpenStore(testStore)
+		require.NoError(t, err)
+
+		require.NoError(t, store.Put("key", []byte("value")))
+		require.NoError(t, store.Delete("key"))
+
+		require.Zero(t, p.Stats()[testStore].Evictions)
+	})
+}
+
+func TestNegativeCaching(t *testing.T) {
+	t.Run("key is cached as not found", func(t *testing.T) {
+		clock := gcache.NewFakeClock()
+		gc := gcache.New(0).Clock(clock).Build()
+
+		p := cache.NewProvider(
+			cache.WithGCacheCreator(func() cache.GCache {
+				return gc
+			}),
+			cache.WithNegativeExpiration(time.Minute),
+		)
+
+		store, err := p.OpenStore(testStore)
+		require.NoError(t, err)
+
+		require.NoError(t, store.(cache.NegativeCache).PutNotFound("key"))
+
+		_, err = store.Get("key")
+		require.True(t, errors.Is(err, cache.ErrCachedNotFound))
+		require.True(t, errors.Is(err, storage.ErrDataNotFound))
+
+		clock.Advance(2 * time.Minute)
+
+		_, err = store.Get("key")
+		require.Equal(t, storage.ErrDataNotFound, err)
+	})
+
+	t.Run("noop if negative caching is disabled", func(t *testing.T) {
+		store, err := cache.NewProvider().OpenStore(testStore)
+		require.NoError(t, err)
+
+		require.NoError(t, store.(cache.NegativeCache).PutNotFound("key"))
+
+		_, err = store.Get("key")
+		require.Equal(t, storage.ErrDataNotFound, err)
+	})
+
+	t.Run("set returns an error", func(t *testing.T) {
+		p := cache.NewProvider(
+			cache.WithGCacheCreator(func() cache.GCache {
+				return &mockGCache{SetWithExpireErr: errors.New("set error")}
+			}),
+			cache.WithNegativeExpiration(time.Minute),
+		)
+
+		store, err := p.OpenStore(testStore)
+		require.NoError(t, err)
+
+		err = store.(cache.NegativeCache).PutNotFound("key")
+		require.EqualError(t, err, "set to cache: set error")
+	})
+}
+
+func TestStats(t *testing.T) {
+	p := cache.NewProvider(cache.WithNegativeExpiration(time.Minute))
+
+	store, err := p.OpenStore(testStore)
+	require.NoError(t, err)
+
+	require.NoError(t, store.Put("key", []byte("value")))
+	require.NoError(t, store.(cache.NegativeCache).PutNotFound("missing"))
+
+	_, err = store.Get("key")
+	require.NoError(t, err)
+
+	_, err = store.Get("key")
+	require.NoError(t, err)
+
+	_, err = store.Get("other")
+	require.Error(t, err)
+
+	_, err = store.Get("missing")
+	require.Error(t, err)
+
+	require.Equal(t, map[string]cache.Stats{
+		testStore: {Hits: 2, Misses: 1, NegativeHits: 1},
+	}, p.Stats())
+
+	require.NoError(t, p.CloseStore(testStore))
+	require.Empty(t, p.Stats())
 }
 
 type mockGCache struct {
@@ -298,3 +530,7 @@ func (m *mockGCache) Remove(key interface{}) bool {
 func (m *mockGCache) Purge() {
 	m.PurgeCalledTimes++
 }
+
+func (m *mockGCache) GetALL(bool) map[interface{}]interface{} {
+	return nil
+}
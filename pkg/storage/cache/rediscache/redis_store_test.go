@@ -0,0 +1,281 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package rediscache_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/hyperledger/aries-framework-go/pkg/storage"
+	"github.com/stretchr/testify/require"
+	"github.com/trustbloc/edge-core/pkg/log/mocklogger"
+
+	"github.com/trustbloc/hub-kms/pkg/storage/cache/rediscache"
+)
+
+const testStore = "store"
+
+func TestNewProvider(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		srv := miniredis.RunT(t)
+
+		p, err := rediscache.NewProvider("redis://" + srv.Addr())
+		require.NoError(t, err)
+		require.NoError(t, p.CloseStore(testStore))
+		require.NoError(t, p.Close())
+	})
+
+	t.Run("Fail with empty URL", func(t *testing.T) {
+		_, err := rediscache.NewProvider("")
+		require.EqualError(t, err, "redis URL is required")
+	})
+
+	t.Run("Fail to connect", func(t *testing.T) {
+		srv := miniredis.RunT(t)
+		addr := srv.Addr()
+		srv.Close()
+
+		_, err := rediscache.NewProvider("redis://" + addr)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "ping redis")
+	})
+
+	t.Run("Fail with invalid encryption key", func(t *testing.T) {
+		srv := miniredis.RunT(t)
+
+		_, err := rediscache.NewProvider("redis://"+srv.Addr(), rediscache.WithEncryptionKey([]byte("short")))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "create cipher")
+	})
+}
+
+func TestCacheStore(t *testing.T) {
+	t.Run("Put, get and delete", func(t *testing.T) {
+		srv := miniredis.RunT(t)
+		logger := &mocklogger.MockLogger{}
+		s := openStore(t, srv, rediscache.WithLogger(logger), rediscache.WithPrefix("kms"))
+
+		require.NoError(t, s.Put("key", []byte("value")))
+		require.Contains(t, logger.DebugLogContents, `save key "key" into cache "store"`)
+
+		raw, err := srv.Get("kms:store:key")
+		require.NoError(t, err)
+		require.Equal(t, "value", raw)
+		require.Zero(t, srv.TTL("kms:store:key"), "value does not expire")
+
+		v, err := s.Get("key")
+		require.NoError(t, err)
+		require.Equal(t, []byte("value"), v)
+
+		require.NoError(t, s.Delete("key"))
+
+		_, err = s.Get("key")
+		require.True(t, errors.Is(err, storage.ErrDataNotFound))
+	})
+
+	t.Run("Stores share data across providers", func(t *testing.T) {
+		srv := miniredis.RunT(t)
+
+		require.NoError(t, openStore(t, srv).Put("key", []byte("value")))
+
+		v, err := openStore(t, srv).Get("key")
+		require.NoError(t, err)
+		require.Equal(t, []byte("value"), v)
+	})
+
+	t.Run("Stores are isolated", func(t *testing.T) {
+		srv := miniredis.RunT(t)
+
+		p, err := rediscache.NewProvider("redis://" + srv.Addr())
+		require.NoError(t, err)
+
+		s1, err := p.OpenStore("store1")
+		require.NoError(t, err)
+		require.NoError(t, s1.Put("key", []byte("value")))
+
+		s2, err := p.OpenStore("store2")
+		require.NoError(t, err)
+
+		_, err = s2.Get("key")
+		require.True(t, errors.Is(err, storage.ErrDataNotFound))
+	})
+
+	t.Run("Values expire", func(t *testing.T) {
+		srv := miniredis.RunT(t)
+		s := openStore(t, srv, rediscache.WithExpiration(time.Minute))
+
+		require.NoError(t, s.Put("key", []byte("value")))
+		require.Equal(t, time.Minute, srv.TTL("hub-kms:store:key"))
+
+		srv.FastForward(time.Minute)
+
+		_, err := s.Get("key")
+		require.True(t, errors.Is(err, storage.ErrDataNotFound))
+	})
+
+	t.Run("Values are encrypted", func(t *testing.T) {
+		srv := miniredis.RunT(t)
+		key := bytes.Repeat([]byte{1}, 32)
+		s := openStore(t, srv, rediscache.WithEncryptionKey(key))
+
+		require.NoError(t, s.Put("key", []byte("value")))
+
+		raw, err := srv.Get("hub-kms:store:key")
+		require.NoError(t, err)
+		require.NotContains(t, raw, "value")
+
+		v, err := s.Get("key")
+		require.NoError(t, err)
+		require.Equal(t, []byte("value"), v)
+
+		// a value moved to another key is not decrypted
+		require.NoError(t, srv.Set("hub-kms:store:other", raw))
+
+		_, err = s.Get("other")
+		require.True(t, errors.Is(err, storage.ErrDataNotFound))
+	})
+
+	t.Run("Value encrypted under another key is a cache miss", func(t *testing.T) {
+		srv := miniredis.RunT(t)
+		logger := &mocklogger.MockLogger{}
+
+		require.NoError(t, openStore(t, srv, rediscache.WithEncryptionKey(bytes.Repeat([]byte{1}, 32))).
+			Put("key", []byte("value")))
+
+		s := openStore(t, srv, rediscache.WithEncryptionKey(bytes.Repeat([]byte{2}, 32)),
+			rediscache.WithLogger(logger))
+
+		_, err := s.Get("key")
+		require.True(t, errors.Is(err, storage.ErrDataNotFound))
+		require.Contains(t, logger.WarnLogContents, `invalid value of key "key"`)
+
+		require.NoError(t, srv.Set("hub-kms:store:short", "x"))
+
+		_, err = s.Get("short")
+		require.True(t, errors.Is(err, storage.ErrDataNotFound))
+	})
+
+	t.Run("Fail with invalid arguments", func(t *testing.T) {
+		s := openStore(t, miniredis.RunT(t))
+
+		require.EqualError(t, s.Put("", []byte("value")), "key and value are mandatory")
+		require.EqualError(t, s.Put("key", nil), "key and value are mandatory")
+	})
+
+	t.Run("Fail if server is not available", func(t *testing.T) {
+		srv := miniredis.RunT(t)
+		s := openStore(t, srv)
+		srv.Close()
+
+		err := s.Put("key", []byte("value"))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "set to cache")
+
+		_, err = s.Get("key")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "get from cache")
+
+		err = s.Delete("key")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "delete from cache")
+
+		it := s.Iterator("", storage.EndKeySuffix)
+		require.False(t, it.Next())
+		require.Contains(t, it.Error().Error(), "scan cache")
+	})
+
+	t.Run("Fail with empty store name", func(t *testing.T) {
+		p, err := rediscache.NewProvider("redis://" + miniredis.RunT(t).Addr())
+		require.NoError(t, err)
+
+		_, err = p.OpenStore("")
+		require.EqualError(t, err, "store name is required")
+	})
+}
+
+func TestCacheStore_Iterator(t *testing.T) {
+	srv := miniredis.RunT(t)
+	s := openStore(t, srv)
+
+	for _, k := range []string{"abc_2", "abc_1", "abc_3", "abd_1"} {
+		require.NoError(t, s.Put(k, []byte("value "+k)))
+	}
+
+	require.NoError(t, srv.Set("hub-kms:other:abc_4", "value"))
+
+	t.Run("Iterate over keys with prefix in order", func(t *testing.T) {
+		it := s.Iterator("abc_", "abc_"+storage.EndKeySuffix)
+		require.Nil(t, it.Key())
+
+		var keys []string
+
+		for it.Next() {
+			require.Equal(t, []byte("value "+string(it.Key())), it.Value())
+
+			keys = append(keys, string(it.Key()))
+		}
+
+		require.NoError(t, it.Error())
+		require.Equal(t, []string{"abc_1", "abc_2", "abc_3"}, keys)
+
+		it.Release()
+		require.False(t, it.Next())
+		require.Nil(t, it.Value())
+	})
+
+	t.Run("End key is excluded", func(t *testing.T) {
+		it := s.Iterator("abc_1", "abc_3")
+
+		var keys []string
+
+		for it.Next() {
+			keys = append(keys, string(it.Key()))
+		}
+
+		require.Equal(t, []string{"abc_1", "abc_2"}, keys)
+	})
+
+	t.Run("Prefix contains end key suffix", func(t *testing.T) {
+		require.NoError(t, s.Put("x!!a_1", []byte("value x!!a_1")))
+		require.NoError(t, s.Put("x!!b", []byte("value x!!b")))
+
+		it := s.Iterator("x!!a_", "x!!a_"+storage.EndKeySuffix)
+		defer it.Release()
+
+		require.True(t, it.Next())
+		require.Equal(t, []byte("x!!a_1"), it.Key())
+		require.False(t, it.Next())
+		require.NoError(t, it.Error())
+	})
+
+	t.Run("Expired values are skipped", func(t *testing.T) {
+		it := s.Iterator("abd_", "abd_"+storage.EndKeySuffix)
+		srv.Del("hub-kms:store:abd_1")
+
+		require.False(t, it.Next())
+		require.NoError(t, it.Error())
+	})
+}
+
+func openStore(t *testing.T, srv *miniredis.Miniredis, opts ...rediscache.Option) storage.Store {
+	t.Helper()
+
+	p, err := rediscache.NewProvider("redis://"+srv.Addr(), opts...)
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		require.NoError(t, p.Close())
+	})
+
+	s, err := p.OpenStore(testStore)
+	require.NoError(t, err)
+
+	return s
+}
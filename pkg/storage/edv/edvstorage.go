@@ -26,6 +26,8 @@ import (
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/label"
 	"go.opentelemetry.io/otel/trace"
+
+	"github.com/trustbloc/hub-kms/pkg/internal/support"
 )
 
 const (
@@ -54,6 +56,8 @@ type Config struct {
 	VaultID        string
 	RecipientKeyID string
 	MACKeyID       string
+	// HTTPClient is used to create vaults. Defaults to the client with TLSConfig.
+	HTTPClient support.HTTPClient
 }
 
 var tracer = otel.Tracer("hub-kms/edv") //nolint:gochecknoglobals // ignore
@@ -0,0 +1,110 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package edv
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+
+	"github.com/hyperledger/aries-framework-go/pkg/storage/edv/models"
+
+	"github.com/trustbloc/hub-kms/pkg/internal/support"
+)
+
+const (
+	kekType  = "JsonWebKey2020"
+	hmacType = "Sha256HmacKey2019"
+)
+
+// VaultConfig is the data vault configuration sent to the EDV server to create a vault.
+type VaultConfig struct {
+	Sequence    int               `json:"sequence"`
+	Controller  string            `json:"controller"`
+	ReferenceID string            `json:"referenceId,omitempty"`
+	KEK         models.IDTypePair `json:"kek"`
+	HMAC        models.IDTypePair `json:"hmac"`
+}
+
+// Vault is the vault created on the EDV server.
+type Vault struct {
+	ID string
+	// Capability authorizes the controller to use the vault. Empty if the EDV server does not use ZCAPs.
+	Capability json.RawMessage
+}
+
+// CreateVault creates a new vault on the EDV server of the config. The vault is controlled by the given DID and
+// its documents are encrypted with the recipient key and indexed with the MAC key of the config.
+func CreateVault(ctx context.Context, c *Config, controller, referenceID string) (*Vault, error) {
+	_, span := tracer.Start(ctx, "edv:CreateVault")
+	defer span.End()
+
+	b, err := json.Marshal(&VaultConfig{
+		Controller:  controller,
+		ReferenceID: referenceID,
+		KEK:         models.IDTypePair{ID: c.RecipientKeyID, Type: kekType},
+		HMAC:        models.IDTypePair{ID: c.MACKeyID, Type: hmacType},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("marshal vault config: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.EDVServerURL+edvEndpointPathRoot,
+		bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("create vault request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("create vault: %w", err)
+	}
+
+	defer resp.Body.Close() //nolint:errcheck // ignore
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read create vault response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusCreated {
+		return nil, fmt.Errorf("create vault: EDV server responded with %d: %s", resp.StatusCode, body)
+	}
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil || path.Base(location.Path) == "/" || path.Base(location.Path) == "." {
+		return nil, fmt.Errorf("create vault: invalid location %q", resp.Header.Get("Location"))
+	}
+
+	vault := &Vault{ID: path.Base(location.Path)}
+
+	if len(bytes.TrimSpace(body)) > 0 {
+		if !json.Valid(body) {
+			return nil, errors.New("create vault: invalid capability")
+		}
+
+		vault.Capability = body
+	}
+
+	return vault, nil
+}
+
+func (c *Config) httpClient() support.HTTPClient {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: c.TLSConfig}}
+}
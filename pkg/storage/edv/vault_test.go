@@ -0,0 +1,129 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package edv //nolint:testpackage // need to test local methods
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateVault(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		var config VaultConfig
+
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			require.Equal(t, http.MethodPost, r.Method)
+			require.Equal(t, "/encrypted-data-vaults", r.URL.Path)
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&config))
+
+			w.Header().Set("Location", "https://edv.example.com/encrypted-data-vaults/vaultID")
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"id":"urn:zcap:1"}`)) //nolint:errcheck // ignore
+		}))
+		defer srv.Close()
+
+		vault, err := CreateVault(context.Background(), vaultConfig(srv.URL), "did:key:controller", "keystoreID")
+		require.NoError(t, err)
+		require.Equal(t, "vaultID", vault.ID)
+		require.JSONEq(t, `{"id":"urn:zcap:1"}`, string(vault.Capability))
+
+		require.Equal(t, "did:key:controller", config.Controller)
+		require.Equal(t, "keystoreID", config.ReferenceID)
+		require.Equal(t, testRecipientKeyID, config.KEK.ID)
+		require.Equal(t, testMACKeyID, config.HMAC.ID)
+	})
+
+	t.Run("Success without capability", func(t *testing.T) {
+		srv := newEDVServer(http.StatusCreated, "/encrypted-data-vaults/vaultID", "")
+		defer srv.Close()
+
+		vault, err := CreateVault(context.Background(), vaultConfig(srv.URL), "did:key:controller", "")
+		require.NoError(t, err)
+		require.Equal(t, "vaultID", vault.ID)
+		require.Nil(t, vault.Capability)
+	})
+
+	tests := []struct {
+		name     string
+		status   int
+		location string
+		body     string
+		err      string
+	}{
+		{
+			name:   "EDV server error",
+			status: http.StatusConflict,
+			body:   "vault already exists",
+			err:    "EDV server responded with 409: vault already exists",
+		},
+		{
+			name:   "No location",
+			status: http.StatusCreated,
+			err:    `invalid location ""`,
+		},
+		{
+			name:     "Invalid capability",
+			status:   http.StatusCreated,
+			location: "/encrypted-data-vaults/vaultID",
+			body:     "not a capability",
+			err:      "invalid capability",
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run("Fail with "+tc.name, func(t *testing.T) {
+			srv := newEDVServer(tc.status, tc.location, tc.body)
+			defer srv.Close()
+
+			_, err := CreateVault(context.Background(), vaultConfig(srv.URL), "did:key:controller", "")
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tc.err)
+		})
+	}
+
+	t.Run("Fail to send request", func(t *testing.T) {
+		c := vaultConfig("https://edv.example.com")
+		c.HTTPClient = &mockHTTPClient{err: errors.New("connection refused")}
+
+		_, err := CreateVault(context.Background(), c, "did:key:controller", "")
+		require.EqualError(t, err, "create vault: connection refused")
+	})
+}
+
+func vaultConfig(url string) *Config {
+	return &Config{
+		EDVServerURL:   url,
+		RecipientKeyID: testRecipientKeyID,
+		MACKeyID:       testMACKeyID,
+	}
+}
+
+func newEDVServer(status int, location, body string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if location != "" {
+			w.Header().Set("Location", location)
+		}
+
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(body)) //nolint:errcheck // ignore
+	}))
+}
+
+type mockHTTPClient struct {
+	err error
+}
+
+func (c *mockHTTPClient) Do(*http.Request) (*http.Response, error) {
+	return nil, c.err
+}
@@ -0,0 +1,292 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package migration
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"sort"
+
+	"github.com/hyperledger/aries-framework-go/pkg/storage"
+)
+
+const (
+	// StateStoreName is the name of the store in the target storage that holds checkpoints of interrupted copies.
+	StateStoreName = "migration"
+	// DefaultCheckpointInterval is the number of entries copied between checkpoints if the interval is not set.
+	DefaultCheckpointInterval = 100
+)
+
+// ErrChecksumMismatch is returned when the value read back from the target storage differs from the source value.
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// Result is the outcome of copying a store.
+type Result struct {
+	Store string `json:"store"`
+	// Copied is the number of entries written to the target storage.
+	Copied int `json:"copied"`
+	// Skipped is the number of entries that were already in the target storage, with the same value unless the copy
+	// does not overwrite entries.
+	Skipped int `json:"skipped"`
+	// Checksum is the SHA-256 of keys and values of all copied and skipped entries in order of keys.
+	Checksum string `json:"checksum"`
+}
+
+// Copier copies stores from the source to the target storage provider. Each entry is read back from the target
+// storage and its checksum is compared with the source value. An interrupted copy is resumed from the last
+// checkpoint, a completed copy can be run again to copy entries changed in the meantime.
+type Copier struct {
+	source             storage.Provider
+	target             storage.Provider
+	state              storage.Store
+	checkpointInterval int
+	overwrite          bool
+}
+
+// NewCopier returns a new Copier instance.
+func NewCopier(source, target storage.Provider, opts ...Option) (*Copier, error) {
+	o := &Options{checkpointInterval: DefaultCheckpointInterval, overwrite: true}
+
+	for i := range opts {
+		opts[i](o)
+	}
+
+	state, err := target.OpenStore(StateStoreName)
+	if err != nil {
+		return nil, fmt.Errorf("open migration state store: %w", err)
+	}
+
+	return &Copier{
+		source:             source,
+		target:             target,
+		state:              state,
+		checkpointInterval: o.checkpointInterval,
+		overwrite:          o.overwrite,
+	}, nil
+}
+
+// Options configures Copier.
+type Options struct {
+	checkpointInterval int
+	overwrite          bool
+}
+
+// Option configures Options.
+type Option func(options *Options)
+
+// WithCheckpointInterval sets the number of entries copied between checkpoints. Defaults to
+// DefaultCheckpointInterval.
+func WithCheckpointInterval(n int) Option {
+	return func(o *Options) {
+		if n > 0 {
+			o.checkpointInterval = n
+		}
+	}
+}
+
+// WithoutOverwrite keeps entries that are already in the target storage with other values, e.g. entries changed in
+// the target storage after it was put in use, so they are not replaced with outdated values. Such entries are counted
+// as skipped.
+func WithoutOverwrite() Option {
+	return func(o *Options) {
+		o.overwrite = false
+	}
+}
+
+// checkpoint is the progress of the interrupted copy of the store.
+type checkpoint struct {
+	LastKey   string `json:"lastKey"`
+	Copied    int    `json:"copied"`
+	Skipped   int    `json:"skipped"`
+	HashState []byte `json:"hashState"`
+}
+
+// Copy copies all entries of the store in order of keys. Entries that are already in the target storage are not
+// written again, and are not overwritten with changed values if the copier was created with WithoutOverwrite.
+func (c *Copier) Copy(name string) (*Result, error) {
+	src, err := c.source.OpenStore(name)
+	if err != nil {
+		return nil, fmt.Errorf("open source store %s: %w", name, err)
+	}
+
+	dst, err := c.target.OpenStore(name)
+	if err != nil {
+		return nil, fmt.Errorf("open target store %s: %w", name, err)
+	}
+
+	keys, err := sortedKeys(src)
+	if err != nil {
+		return nil, fmt.Errorf("list keys of store %s: %w", name, err)
+	}
+
+	cp, h, err := c.loadCheckpoint(name)
+	if err != nil {
+		return nil, err
+	}
+
+	pending := 0
+
+	for _, k := range keys {
+		if cp.LastKey != "" && k <= cp.LastKey {
+			continue
+		}
+
+		copied, err := copyEntry(src, dst, k, h, c.overwrite)
+		if errors.Is(err, storage.ErrDataNotFound) { // deleted since the keys were listed
+			continue
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("copy key %q of store %s: %w", k, name, err)
+		}
+
+		if copied {
+			cp.Copied++
+		} else {
+			cp.Skipped++
+		}
+
+		cp.LastKey = k
+		pending++
+
+		if pending == c.checkpointInterval {
+			if err = c.saveCheckpoint(name, cp, h); err != nil {
+				return nil, err
+			}
+
+			pending = 0
+		}
+	}
+
+	if err = c.state.Delete(name); err != nil && !errors.Is(err, storage.ErrDataNotFound) {
+		return nil, fmt.Errorf("delete checkpoint of store %s: %w", name, err)
+	}
+
+	return &Result{
+		Store:    name,
+		Copied:   cp.Copied,
+		Skipped:  cp.Skipped,
+		Checksum: hex.EncodeToString(h.Sum(nil)),
+	}, nil
+}
+
+// copyEntry copies the entry unless the target storage has the same value, or any value if overwrite is false, and
+// verifies the written value.
+func copyEntry(src, dst storage.Store, k string, h hash.Hash, overwrite bool) (bool, error) {
+	v, err := src.Get(k)
+	if err != nil {
+		return false, err
+	}
+
+	sum := checksum(k, v)
+	h.Write(sum) //nolint:errcheck,gosec // never fails
+
+	existing, err := dst.Get(k)
+	if err != nil && !errors.Is(err, storage.ErrDataNotFound) {
+		return false, err
+	}
+
+	if err == nil && (!overwrite || bytes.Equal(checksum(k, existing), sum)) {
+		return false, nil
+	}
+
+	if err = dst.Put(k, v); err != nil {
+		return false, err
+	}
+
+	written, err := dst.Get(k)
+	if err != nil {
+		return false, fmt.Errorf("read back: %w", err)
+	}
+
+	if !bytes.Equal(checksum(k, written), sum) {
+		return false, ErrChecksumMismatch
+	}
+
+	return true, nil
+}
+
+func (c *Copier) loadCheckpoint(name string) (*checkpoint, hash.Hash, error) {
+	h := sha256.New()
+
+	b, err := c.state.Get(name)
+	if errors.Is(err, storage.ErrDataNotFound) {
+		return &checkpoint{}, h, nil
+	}
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("get checkpoint of store %s: %w", name, err)
+	}
+
+	var cp checkpoint
+
+	if err = json.Unmarshal(b, &cp); err != nil {
+		return nil, nil, fmt.Errorf("unmarshal checkpoint of store %s: %w", name, err)
+	}
+
+	if err = h.(encoding.BinaryUnmarshaler).UnmarshalBinary(cp.HashState); err != nil {
+		return nil, nil, fmt.Errorf("restore checksum of store %s: %w", name, err)
+	}
+
+	return &cp, h, nil
+}
+
+func (c *Copier) saveCheckpoint(name string, cp *checkpoint, h hash.Hash) error {
+	state, err := h.(encoding.BinaryMarshaler).MarshalBinary()
+	if err != nil {
+		return fmt.Errorf("save checksum of store %s: %w", name, err)
+	}
+
+	cp.HashState = state
+
+	b, err := json.Marshal(cp)
+	if err != nil {
+		return fmt.Errorf("marshal checkpoint of store %s: %w", name, err)
+	}
+
+	if err = c.state.Put(name, b); err != nil {
+		return fmt.Errorf("save checkpoint of store %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// sortedKeys returns keys of all entries of the store. Iterators of some storage providers are not ordered.
+func sortedKeys(s storage.Store) ([]string, error) {
+	it := s.Iterator("", storage.EndKeySuffix)
+	defer it.Release()
+
+	var keys []string
+
+	for it.Next() {
+		keys = append(keys, string(it.Key()))
+	}
+
+	if err := it.Error(); err != nil {
+		return nil, err
+	}
+
+	sort.Strings(keys)
+
+	return keys, nil
+}
+
+// checksum binds the value to its key.
+func checksum(k string, v []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte(k)) //nolint:errcheck,gosec // never fails
+	h.Write([]byte{0}) //nolint:errcheck,gosec // never fails
+	h.Write(v)         //nolint:errcheck,gosec // never fails
+
+	return h.Sum(nil)
+}
@@ -0,0 +1,252 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package migration_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	mockstorage "github.com/hyperledger/aries-framework-go/pkg/mock/storage"
+	"github.com/hyperledger/aries-framework-go/pkg/storage"
+	"github.com/hyperledger/aries-framework-go/pkg/storage/mem"
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/hub-kms/pkg/storage/migration"
+)
+
+const testStore = "store"
+
+func TestCopier_Copy(t *testing.T) {
+	t.Run("Copy all entries", func(t *testing.T) {
+		source := newSource(t, 5)
+		target := mem.NewProvider()
+
+		c, err := migration.NewCopier(source, target)
+		require.NoError(t, err)
+
+		result, err := c.Copy(testStore)
+		require.NoError(t, err)
+		require.Equal(t, testStore, result.Store)
+		require.Equal(t, 5, result.Copied)
+		require.Equal(t, 0, result.Skipped)
+		require.NotEmpty(t, result.Checksum)
+
+		requireEntries(t, target, 5)
+
+		t.Run("Skip copied entries on next run", func(t *testing.T) {
+			next, err := c.Copy(testStore)
+			require.NoError(t, err)
+			require.Equal(t, 0, next.Copied)
+			require.Equal(t, 5, next.Skipped)
+			require.Equal(t, result.Checksum, next.Checksum)
+		})
+
+		t.Run("Copy changed entries on next run", func(t *testing.T) {
+			store, err := source.OpenStore(testStore)
+			require.NoError(t, err)
+			require.NoError(t, store.Put("key2", []byte("changed")))
+
+			next, err := c.Copy(testStore)
+			require.NoError(t, err)
+			require.Equal(t, 1, next.Copied)
+			require.Equal(t, 4, next.Skipped)
+			require.NotEqual(t, result.Checksum, next.Checksum)
+
+			dst, err := target.OpenStore(testStore)
+			require.NoError(t, err)
+
+			v, err := dst.Get("key2")
+			require.NoError(t, err)
+			require.Equal(t, []byte("changed"), v)
+		})
+	})
+
+	t.Run("Keep entries changed in the target storage", func(t *testing.T) {
+		source := newSource(t, 3)
+		target := mem.NewProvider()
+
+		dst, err := target.OpenStore(testStore)
+		require.NoError(t, err)
+		require.NoError(t, dst.Put("key1", []byte("changed")))
+
+		c, err := migration.NewCopier(source, target, migration.WithoutOverwrite())
+		require.NoError(t, err)
+
+		result, err := c.Copy(testStore)
+		require.NoError(t, err)
+		require.Equal(t, 2, result.Copied)
+		require.Equal(t, 1, result.Skipped)
+
+		v, err := dst.Get("key1")
+		require.NoError(t, err)
+		require.Equal(t, []byte("changed"), v)
+
+		requireEntries(t, target, 3)
+	})
+
+	t.Run("Resume interrupted copy", func(t *testing.T) {
+		source := newSource(t, 5)
+		target := &failingProvider{Provider: mem.NewProvider(), failAfter: 3}
+
+		c, err := migration.NewCopier(source, target, migration.WithCheckpointInterval(2))
+		require.NoError(t, err)
+
+		_, err = c.Copy(testStore)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), `copy key "key3" of store store: put failed`)
+
+		state, err := target.OpenStore(migration.StateStoreName)
+		require.NoError(t, err)
+
+		_, err = state.Get(testStore)
+		require.NoError(t, err)
+
+		target.failAfter = -1
+
+		result, err := c.Copy(testStore)
+		require.NoError(t, err)
+		require.Equal(t, 4, result.Copied)
+		require.Equal(t, 1, result.Skipped) // copied after the last checkpoint
+
+		_, err = state.Get(testStore)
+		require.True(t, errors.Is(err, storage.ErrDataNotFound))
+
+		requireEntries(t, target, 5)
+
+		uninterrupted, err := migration.NewCopier(source, mem.NewProvider())
+		require.NoError(t, err)
+
+		expected, err := uninterrupted.Copy(testStore)
+		require.NoError(t, err)
+		require.Equal(t, expected.Checksum, result.Checksum)
+	})
+
+	t.Run("Fail with checksum mismatch", func(t *testing.T) {
+		target := &failingProvider{Provider: mem.NewProvider(), failAfter: -1, corrupt: true}
+
+		c, err := migration.NewCopier(newSource(t, 1), target)
+		require.NoError(t, err)
+
+		_, err = c.Copy(testStore)
+		require.Error(t, err)
+		require.True(t, errors.Is(err, migration.ErrChecksumMismatch))
+	})
+
+	t.Run("Fail to open source store", func(t *testing.T) {
+		source := mockstorage.NewMockStoreProvider()
+		source.FailNamespace = testStore
+
+		c, err := migration.NewCopier(source, mem.NewProvider())
+		require.NoError(t, err)
+
+		_, err = c.Copy(testStore)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "open source store store")
+	})
+
+	t.Run("Fail to list source keys", func(t *testing.T) {
+		source := mockstorage.NewMockStoreProvider()
+		source.Store.ErrItr = errors.New("iterator error")
+
+		c, err := migration.NewCopier(source, mem.NewProvider())
+		require.NoError(t, err)
+
+		_, err = c.Copy(testStore)
+		require.EqualError(t, err, "list keys of store store: iterator error")
+	})
+
+	t.Run("Fail with invalid checkpoint", func(t *testing.T) {
+		target := mem.NewProvider()
+
+		state, err := target.OpenStore(migration.StateStoreName)
+		require.NoError(t, err)
+		require.NoError(t, state.Put(testStore, []byte("not a checkpoint")))
+
+		c, err := migration.NewCopier(newSource(t, 1), target)
+		require.NoError(t, err)
+
+		_, err = c.Copy(testStore)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "unmarshal checkpoint of store store")
+	})
+}
+
+func TestNewCopier(t *testing.T) {
+	target := mockstorage.NewMockStoreProvider()
+	target.FailNamespace = migration.StateStoreName
+
+	c, err := migration.NewCopier(mem.NewProvider(), target)
+	require.Nil(t, c)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "open migration state store")
+}
+
+func newSource(t *testing.T, n int) storage.Provider {
+	t.Helper()
+
+	p := mem.NewProvider()
+
+	store, err := p.OpenStore(testStore)
+	require.NoError(t, err)
+
+	for i := 0; i < n; i++ {
+		require.NoError(t, store.Put(fmt.Sprintf("key%d", i), []byte(fmt.Sprintf("value%d", i))))
+	}
+
+	return p
+}
+
+func requireEntries(t *testing.T, p storage.Provider, n int) {
+	t.Helper()
+
+	store, err := p.OpenStore(testStore)
+	require.NoError(t, err)
+
+	for i := 0; i < n; i++ {
+		v, err := store.Get(fmt.Sprintf("key%d", i))
+		require.NoError(t, err)
+		require.NotEmpty(t, v)
+	}
+}
+
+// failingProvider wraps stores of the test store to fail puts after the given number of entries or to corrupt
+// written values.
+type failingProvider struct {
+	storage.Provider
+	failAfter int
+	corrupt   bool
+	puts      int
+}
+
+func (p *failingProvider) OpenStore(name string) (storage.Store, error) {
+	s, err := p.Provider.OpenStore(name)
+	if err != nil || name != testStore {
+		return s, err
+	}
+
+	return &failingStore{Store: s, provider: p}, nil
+}
+
+type failingStore struct {
+	storage.Store
+	provider *failingProvider
+}
+
+func (s *failingStore) Put(k string, v []byte) error {
+	if s.provider.failAfter >= 0 && s.provider.puts >= s.provider.failAfter {
+		return errors.New("put failed")
+	}
+
+	s.provider.puts++
+
+	if s.provider.corrupt {
+		v = append([]byte("corrupted"), v...)
+	}
+
+	return s.Store.Put(k, v)
+}
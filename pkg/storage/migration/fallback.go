@@ -0,0 +1,105 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package migration
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/hyperledger/aries-framework-go/pkg/storage"
+)
+
+// FallbackProvider is a storage provider used while entries are migrated from the source to the target storage.
+// Entries are written to the target storage. Entries not found in the target storage are read from the source storage
+// and copied to the target storage, so entries written to the source storage by requests that started before the
+// migration are not lost.
+type FallbackProvider struct {
+	target storage.Provider
+	source storage.Provider
+}
+
+// NewFallbackProvider returns a new FallbackProvider instance.
+func NewFallbackProvider(target, source storage.Provider) *FallbackProvider {
+	return &FallbackProvider{
+		target: target,
+		source: source,
+	}
+}
+
+// OpenStore opens the store in both storages.
+func (p *FallbackProvider) OpenStore(name string) (storage.Store, error) {
+	target, err := p.target.OpenStore(name)
+	if err != nil {
+		return nil, fmt.Errorf("open target store %s: %w", name, err)
+	}
+
+	source, err := p.source.OpenStore(name)
+	if err != nil {
+		return nil, fmt.Errorf("open source store %s: %w", name, err)
+	}
+
+	return &fallbackStore{target: target, source: source}, nil
+}
+
+// CloseStore closes the store in the target storage. The source storage is left open, as it is shared with other
+// users of the source storage.
+func (p *FallbackProvider) CloseStore(name string) error {
+	return p.target.CloseStore(name)
+}
+
+// Close closes the target storage. The source storage is left open.
+func (p *FallbackProvider) Close() error {
+	return p.target.Close()
+}
+
+type fallbackStore struct {
+	target storage.Store
+	source storage.Store
+}
+
+// Put stores the key and the value in the target storage.
+func (s *fallbackStore) Put(k string, v []byte) error {
+	return s.target.Put(k, v)
+}
+
+// Get fetches the value from the target storage, or from the source storage if the key is not in the target storage.
+// The value read from the source storage is copied to the target storage.
+func (s *fallbackStore) Get(k string) ([]byte, error) {
+	v, err := s.target.Get(k)
+	if !errors.Is(err, storage.ErrDataNotFound) {
+		return v, err
+	}
+
+	v, err = s.source.Get(k)
+	if err != nil {
+		return nil, err
+	}
+
+	_ = s.target.Put(k, v) //nolint:errcheck // best effort, the value is read from the source storage until copied
+
+	return v, nil
+}
+
+// Delete deletes the key from both storages, so the deleted value is not read from the source storage or copied to
+// the target storage again.
+func (s *fallbackStore) Delete(k string) error {
+	if err := s.target.Delete(k); err != nil && !errors.Is(err, storage.ErrDataNotFound) {
+		return err
+	}
+
+	if err := s.source.Delete(k); err != nil && !errors.Is(err, storage.ErrDataNotFound) {
+		return fmt.Errorf("delete from source storage: %w", err)
+	}
+
+	return nil
+}
+
+// Iterator returns an iterator over entries of the target storage. Entries that are only in the source storage are
+// not iterated.
+func (s *fallbackStore) Iterator(start, end string) storage.StoreIterator {
+	return s.target.Iterator(start, end)
+}
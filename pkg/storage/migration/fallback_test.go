@@ -0,0 +1,140 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package migration_test
+
+import (
+	"errors"
+	"testing"
+
+	mockstorage "github.com/hyperledger/aries-framework-go/pkg/mock/storage"
+	"github.com/hyperledger/aries-framework-go/pkg/storage"
+	"github.com/hyperledger/aries-framework-go/pkg/storage/mem"
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/hub-kms/pkg/storage/migration"
+)
+
+func TestFallbackProvider(t *testing.T) {
+	t.Run("Read from source storage and copy to target storage", func(t *testing.T) {
+		source := newSource(t, 2)
+		target := mem.NewProvider()
+
+		s, err := migration.NewFallbackProvider(target, source).OpenStore(testStore)
+		require.NoError(t, err)
+
+		v, err := s.Get("key1")
+		require.NoError(t, err)
+		require.Equal(t, []byte("value1"), v)
+
+		dst, err := target.OpenStore(testStore)
+		require.NoError(t, err)
+
+		v, err = dst.Get("key1")
+		require.NoError(t, err)
+		require.Equal(t, []byte("value1"), v)
+
+		_, err = dst.Get("key0")
+		require.True(t, errors.Is(err, storage.ErrDataNotFound), "only read entries are copied")
+
+		_, err = s.Get("missing")
+		require.True(t, errors.Is(err, storage.ErrDataNotFound))
+	})
+
+	t.Run("Write to target storage", func(t *testing.T) {
+		source := newSource(t, 1)
+		target := mem.NewProvider()
+
+		s, err := migration.NewFallbackProvider(target, source).OpenStore(testStore)
+		require.NoError(t, err)
+
+		require.NoError(t, s.Put("key0", []byte("new value")))
+
+		v, err := s.Get("key0")
+		require.NoError(t, err)
+		require.Equal(t, []byte("new value"), v)
+
+		src, err := source.OpenStore(testStore)
+		require.NoError(t, err)
+
+		v, err = src.Get("key0")
+		require.NoError(t, err)
+		require.Equal(t, []byte("value0"), v, "source storage is not changed")
+
+		it := s.Iterator("key", "key"+storage.EndKeySuffix)
+		require.True(t, it.Next())
+		require.Equal(t, "key0", string(it.Key()))
+		require.False(t, it.Next())
+		it.Release()
+	})
+
+	t.Run("Delete from both storages", func(t *testing.T) {
+		source := newSource(t, 2)
+		target := mem.NewProvider()
+
+		s, err := migration.NewFallbackProvider(target, source).OpenStore(testStore)
+		require.NoError(t, err)
+
+		_, err = s.Get("key0")
+		require.NoError(t, err)
+
+		require.NoError(t, s.Delete("key0"))
+		require.NoError(t, s.Delete("key1"))
+
+		for _, k := range []string{"key0", "key1"} {
+			_, err = s.Get(k)
+			require.True(t, errors.Is(err, storage.ErrDataNotFound))
+		}
+	})
+
+	t.Run("Fail to delete from source storage", func(t *testing.T) {
+		source := mockstorage.NewMockStoreProvider()
+		source.Store.ErrDelete = errors.New("delete error")
+
+		s, err := migration.NewFallbackProvider(mem.NewProvider(), source).OpenStore(testStore)
+		require.NoError(t, err)
+
+		require.EqualError(t, s.Delete("key"), "delete from source storage: delete error")
+	})
+
+	t.Run("Fail to read from source storage", func(t *testing.T) {
+		source := mockstorage.NewMockStoreProvider()
+		source.Store.ErrGet = errors.New("get error")
+
+		s, err := migration.NewFallbackProvider(mem.NewProvider(), source).OpenStore(testStore)
+		require.NoError(t, err)
+
+		_, err = s.Get("key")
+		require.EqualError(t, err, "get error")
+	})
+
+	t.Run("Fail to open store", func(t *testing.T) {
+		failing := mockstorage.NewMockStoreProvider()
+		failing.FailNamespace = testStore
+
+		_, err := migration.NewFallbackProvider(failing, mem.NewProvider()).OpenStore(testStore)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "open target store store")
+
+		_, err = migration.NewFallbackProvider(mem.NewProvider(), failing).OpenStore(testStore)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "open source store store")
+	})
+
+	t.Run("Close target storage only", func(t *testing.T) {
+		source := newSource(t, 1)
+		p := migration.NewFallbackProvider(mem.NewProvider(), source)
+
+		require.NoError(t, p.CloseStore(testStore))
+		require.NoError(t, p.Close())
+
+		src, err := source.OpenStore(testStore)
+		require.NoError(t, err)
+
+		_, err = src.Get("key0")
+		require.NoError(t, err)
+	})
+}
@@ -0,0 +1,473 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package sqlstore
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql" // MySQL driver
+	"github.com/hyperledger/aries-framework-go/pkg/storage"
+	_ "github.com/lib/pq" // PostgreSQL driver
+)
+
+const (
+	// Postgres is the type of PostgreSQL database.
+	Postgres = "postgres"
+	// MySQL is the type of MySQL database.
+	MySQL = "mysql"
+
+	iteratorBatchSize = 100
+	// endKeySuffix replaces storage.EndKeySuffix in the end key of the iterator. It is the largest Unicode code point,
+	// so the range covers all keys with the given prefix.
+	endKeySuffix = "\U0010FFFF"
+)
+
+var invalidTableChars = regexp.MustCompile(`[^a-z0-9_]`)
+
+// dialect contains SQL statements that differ between databases. Statements are formatted with the quoted table name.
+type dialect struct {
+	quote       func(table string) string
+	createTable string
+	put         string
+	insert      string
+	update      string
+	get         string
+	delete      string
+	iterate     string
+}
+
+//nolint:gochecknoglobals // SQL dialects of supported databases
+var dialects = map[string]*dialect{
+	Postgres: {
+		quote:       func(table string) string { return `"` + table + `"` },
+		createTable: `CREATE TABLE IF NOT EXISTS %s (id TEXT COLLATE "C" PRIMARY KEY, value BYTEA NOT NULL)`,
+		put: `INSERT INTO %s (id, value) VALUES ($1, $2) ` +
+			`ON CONFLICT (id) DO UPDATE SET value = EXCLUDED.value`,
+		insert:  `INSERT INTO %s (id, value) VALUES ($1, $2) ON CONFLICT (id) DO NOTHING`,
+		update:  `UPDATE %s SET value = $1 WHERE id = $2 AND value = $3`,
+		get:     `SELECT value FROM %s WHERE id = $1`,
+		delete:  `DELETE FROM %s WHERE id = $1`,
+		iterate: `SELECT id, value FROM %s WHERE id >= $1 AND id < $2 ORDER BY id LIMIT $3`,
+	},
+	MySQL: {
+		quote:       func(table string) string { return "`" + table + "`" },
+		createTable: `CREATE TABLE IF NOT EXISTS %s (id VARBINARY(1024) NOT NULL PRIMARY KEY, value LONGBLOB NOT NULL)`,
+		put:         `INSERT INTO %s (id, value) VALUES (?, ?) ON DUPLICATE KEY UPDATE value = VALUES(value)`,
+		insert:      `INSERT IGNORE INTO %s (id, value) VALUES (?, ?)`,
+		update:      `UPDATE %s SET value = ? WHERE id = ? AND value = ?`,
+		get:         `SELECT value FROM %s WHERE id = ?`,
+		delete:      `DELETE FROM %s WHERE id = ?`,
+		iterate:     `SELECT id, value FROM %s WHERE id >= ? AND id < ? ORDER BY id LIMIT ?`,
+	},
+}
+
+// Opener defines function to open a database.
+type Opener func(driverName, dataSourceName string) (*sql.DB, error)
+
+// Provider is a storage provider backed by a SQL database (PostgreSQL or MySQL). Each store is kept in a separate
+// table named after the store with an optional prefix.
+type Provider struct {
+	db      *sql.DB
+	dialect *dialect
+	prefix  string
+	stores  map[string]*store
+	mu      sync.Mutex
+}
+
+// NewProvider returns a new storage provider for the database of the given type (postgres or mysql) and the data
+// source name (DSN) in the format of the database driver.
+func NewProvider(dbType, dsn string, opts ...Option) (*Provider, error) {
+	d, ok := dialects[strings.ToLower(dbType)]
+	if !ok {
+		return nil, fmt.Errorf("unsupported database type: %s", dbType)
+	}
+
+	if dsn == "" {
+		return nil, errors.New("data source name is required")
+	}
+
+	o := &Options{opener: sql.Open}
+
+	for i := range opts {
+		opts[i](o)
+	}
+
+	db, err := o.opener(strings.ToLower(dbType), dsn)
+	if err != nil {
+		return nil, fmt.Errorf("open database: %w", err)
+	}
+
+	if o.maxOpenConns > 0 {
+		db.SetMaxOpenConns(o.maxOpenConns)
+	}
+
+	if o.maxIdleConns > 0 {
+		db.SetMaxIdleConns(o.maxIdleConns)
+	}
+
+	if o.connMaxLifetime > 0 {
+		db.SetConnMaxLifetime(o.connMaxLifetime)
+	}
+
+	if err = db.Ping(); err != nil {
+		db.Close() //nolint:errcheck,gosec // ping error is returned
+
+		return nil, fmt.Errorf("ping database: %w", err)
+	}
+
+	return &Provider{
+		db:      db,
+		dialect: d,
+		prefix:  o.prefix,
+		stores:  make(map[string]*store),
+	}, nil
+}
+
+// OpenStore opens and returns a store for the given namespace. The table for the namespace is created if it
+// does not exist.
+func (p *Provider) OpenStore(name string) (storage.Store, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if s, ok := p.stores[name]; ok {
+		return s, nil
+	}
+
+	if name == "" {
+		return nil, errors.New("store name is required")
+	}
+
+	table := strings.ToLower(name)
+	if p.prefix != "" {
+		table = strings.ToLower(p.prefix) + "_" + table
+	}
+
+	table = p.dialect.quote(invalidTableChars.ReplaceAllString(table, "_"))
+
+	if _, err := p.db.Exec(fmt.Sprintf(p.dialect.createTable, table)); err != nil {
+		return nil, fmt.Errorf("create table %s: %w", table, err)
+	}
+
+	s := &store{db: p.db, dialect: p.dialect, table: table}
+	p.stores[name] = s
+
+	return s, nil
+}
+
+// CloseStore closes the store for the given namespace. Data of the store is kept in the database.
+func (p *Provider) CloseStore(name string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	delete(p.stores, name)
+
+	return nil
+}
+
+// Close closes all stores of the provider and the database connection pool.
+func (p *Provider) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.stores = make(map[string]*store)
+
+	if err := p.db.Close(); err != nil {
+		return fmt.Errorf("close database: %w", err)
+	}
+
+	return nil
+}
+
+// Options configures Provider.
+type Options struct {
+	opener          Opener
+	prefix          string
+	maxOpenConns    int
+	maxIdleConns    int
+	connMaxLifetime time.Duration
+}
+
+// Option configures Provider.
+type Option func(o *Options)
+
+// WithDBPrefix sets the prefix of table names.
+func WithDBPrefix(prefix string) Option {
+	return func(o *Options) {
+		o.prefix = prefix
+	}
+}
+
+// WithMaxOpenConns sets the maximum number of open connections to the database.
+func WithMaxOpenConns(n int) Option {
+	return func(o *Options) {
+		o.maxOpenConns = n
+	}
+}
+
+// WithMaxIdleConns sets the maximum number of idle connections in the pool.
+func WithMaxIdleConns(n int) Option {
+	return func(o *Options) {
+		o.maxIdleConns = n
+	}
+}
+
+// WithConnMaxLifetime sets the maximum amount of time a connection may be reused.
+func WithConnMaxLifetime(d time.Duration) Option {
+	return func(o *Options) {
+		o.connMaxLifetime = d
+	}
+}
+
+// WithOpener sets the function to open the database. Defaults to sql.Open.
+func WithOpener(opener Opener) Option {
+	return func(o *Options) {
+		o.opener = opener
+	}
+}
+
+type store struct {
+	db      *sql.DB
+	dialect *dialect
+	table   string
+}
+
+// Put stores the key and the value.
+func (s *store) Put(k string, v []byte) error {
+	if k == "" || v == nil {
+		return errors.New("key and value are mandatory")
+	}
+
+	_, err := s.exec(s.dialect.put, k, v)
+
+	return err
+}
+
+// PutIf stores the value only if the current value of the key is old, or if the key does not exist when old is nil.
+// The condition is checked by the database, so concurrent writers sharing it do not overwrite each other's values.
+// It reports whether the value was stored.
+func (s *store) PutIf(k string, old, v []byte) (bool, error) {
+	if k == "" || v == nil {
+		return false, errors.New("key and value are mandatory")
+	}
+
+	if old == nil {
+		n, err := s.exec(s.dialect.insert, k, v)
+
+		return n == 1, err
+	}
+
+	if bytes.Equal(old, v) {
+		// MySQL does not count rows that are not changed by the update
+		current, err := s.Get(k)
+		if errors.Is(err, storage.ErrDataNotFound) {
+			return false, nil
+		}
+
+		return err == nil && bytes.Equal(current, old), err
+	}
+
+	n, err := s.exec(s.dialect.update, v, k, old)
+
+	return n == 1, err
+}
+
+// Get fetches the value for the given key.
+func (s *store) Get(k string) ([]byte, error) {
+	var v []byte
+
+	err := s.db.QueryRow(fmt.Sprintf(s.dialect.get, s.table), k).Scan(&v)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, storage.ErrDataNotFound
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("select from %s: %w", s.table, err)
+	}
+
+	return v, nil
+}
+
+// Delete deletes the given key from the store.
+func (s *store) Delete(k string) error {
+	if k == "" {
+		return errors.New("key is mandatory")
+	}
+
+	_, err := s.exec(s.dialect.delete, k)
+
+	return err
+}
+
+// exec executes the statement in a transaction and returns the number of affected rows.
+func (s *store) exec(query string, args ...interface{}) (int64, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("begin transaction: %w", err)
+	}
+
+	res, err := tx.Exec(fmt.Sprintf(query, s.table), args...)
+	if err != nil {
+		if e := tx.Rollback(); e != nil {
+			return 0, fmt.Errorf("%s: %w (rollback: %v)", s.table, err, e)
+		}
+
+		return 0, fmt.Errorf("%s: %w", s.table, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("commit transaction: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("%s: rows affected: %w", s.table, err)
+	}
+
+	return n, nil
+}
+
+// Iterator returns an iterator over the keys in the range [start, end). An end key with storage.EndKeySuffix
+// covers all keys that begin with the end key without the suffix.
+func (s *store) Iterator(start, end string) storage.StoreIterator {
+	return &iterator{
+		store: s,
+		start: start,
+		end:   endKey(end),
+	}
+}
+
+// endKey replaces the trailing storage.EndKeySuffix of the end key, so the suffix within the key itself is kept.
+func endKey(end string) string {
+	if !strings.HasSuffix(end, storage.EndKeySuffix) {
+		return end
+	}
+
+	return strings.TrimSuffix(end, storage.EndKeySuffix) + endKeySuffix
+}
+
+type entry struct {
+	key   []byte
+	value []byte
+}
+
+// iterator reads the range in batches of iteratorBatchSize rows, so that the connection is not held while the
+// caller processes the entries.
+type iterator struct {
+	store   *store
+	start   string
+	end     string
+	batch   []entry
+	pos     int
+	fetched bool
+	done    bool
+	err     error
+}
+
+func (i *iterator) Next() bool {
+	if i.err != nil {
+		return false
+	}
+
+	i.pos++
+
+	if i.pos < len(i.batch) {
+		return true
+	}
+
+	if i.done {
+		return false
+	}
+
+	i.err = i.fetch()
+
+	return i.err == nil && len(i.batch) > 0
+}
+
+func (i *iterator) fetch() error {
+	// the start key is inclusive, next batches begin with the last key of the previous batch which is skipped
+	skipStart := i.fetched
+	i.fetched = true
+
+	i.batch = i.batch[:0]
+	i.pos = 0
+
+	limit := iteratorBatchSize
+	if skipStart {
+		limit++
+	}
+
+	rows, err := i.store.db.Query(fmt.Sprintf(i.store.dialect.iterate, i.store.table), i.start, i.end, limit)
+	if err != nil {
+		return fmt.Errorf("select from %s: %w", i.store.table, err)
+	}
+
+	defer rows.Close() //nolint:errcheck // error is checked with rows.Err()
+
+	n := 0
+
+	for rows.Next() {
+		n++
+
+		var e entry
+
+		if err = rows.Scan(&e.key, &e.value); err != nil {
+			return fmt.Errorf("scan row: %w", err)
+		}
+
+		if skipStart && n == 1 && string(e.key) == i.start {
+			continue
+		}
+
+		i.batch = append(i.batch, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("read rows: %w", err)
+	}
+
+	if n < limit {
+		i.done = true
+	}
+
+	if len(i.batch) > 0 {
+		i.start = string(i.batch[len(i.batch)-1].key)
+	}
+
+	return nil
+}
+
+func (i *iterator) Release() {
+	i.batch = nil
+	i.done = true
+}
+
+func (i *iterator) Error() error {
+	return i.err
+}
+
+func (i *iterator) Key() []byte {
+	if i.pos >= len(i.batch) {
+		return nil
+	}
+
+	return i.batch[i.pos].key
+}
+
+func (i *iterator) Value() []byte {
+	if i.pos >= len(i.batch) {
+		return nil
+	}
+
+	return i.batch[i.pos].value
+}